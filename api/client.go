@@ -17,12 +17,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"runtime"
 
 	"github.com/ollama/ollama/envconfig"
@@ -35,6 +38,9 @@ import (
 type Client struct {
 	base *url.URL
 	http *http.Client
+
+	// key is the API key sent with requests, if set
+	key string
 }
 
 func checkError(resp *http.Response, body []byte) error {
@@ -62,13 +68,72 @@ func checkError(resp *http.Response, body []byte) error {
 //
 // If the variable is not specified, a default ollama host and port will be
 // used.
+//
+// If OLLAMA_API_KEY is set, it is sent with requests as a bearer token.
+//
+// For https hosts, OLLAMA_TLS_CA names a PEM bundle of the CAs to verify the
+// server's certificate with, instead of the system's, and
+// OLLAMA_TLS_CLIENT_CERT and OLLAMA_TLS_CLIENT_KEY name the PEM certificate
+// and key to send to servers that require client certificates.
 func ClientFromEnvironment() (*Client, error) {
+	client := http.DefaultClient
+
+	config, err := tlsConfigFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	if config != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		client = &http.Client{Transport: transport}
+	}
+
 	return &Client{
 		base: envconfig.Host(),
-		http: http.DefaultClient,
+		http: client,
+		key:  envconfig.APIKey(),
 	}, nil
 }
 
+// tlsConfigFromEnvironment returns the TLS config set by OLLAMA_TLS_CA,
+// OLLAMA_TLS_CLIENT_CERT and OLLAMA_TLS_CLIENT_KEY, or nil if none are set.
+func tlsConfigFromEnvironment() (*tls.Config, error) {
+	ca, cert, key := envconfig.TLSCA(), envconfig.TLSClientCert(), envconfig.TLSClientKey()
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("OLLAMA_TLS_CA: %w", err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OLLAMA_TLS_CA: no certificates in %s", ca)
+		}
+	}
+
+	if (cert == "") != (key == "") {
+		return nil, errors.New("OLLAMA_TLS_CLIENT_CERT and OLLAMA_TLS_CLIENT_KEY must be set together")
+	}
+
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("OLLAMA_TLS_CLIENT_CERT: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
 func NewClient(base *url.URL, http *http.Client) *Client {
 	return &Client{
 		base: base,
@@ -76,6 +141,13 @@ func NewClient(base *url.URL, http *http.Client) *Client {
 	}
 }
 
+// authorize sets the API key of c on r
+func (c *Client) authorize(r *http.Request) {
+	if c.key != "" {
+		r.Header.Set("Authorization", "Bearer "+c.key)
+	}
+}
+
 func (c *Client) do(ctx context.Context, method, path string, reqData, respData any) error {
 	var reqBody io.Reader
 	var data []byte
@@ -105,6 +177,7 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/json")
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	c.authorize(request)
 
 	respObj, err := c.http.Do(request)
 	if err != nil {
@@ -151,6 +224,7 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/x-ndjson")
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	c.authorize(request)
 
 	response, err := c.http.Do(request)
 	if err != nil {
@@ -307,6 +381,51 @@ func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	return &lr, nil
 }
 
+// ListPulls lists the pulls that are queued, running or paused.
+func (c *Client) ListPulls(ctx context.Context) (*ListPullsResponse, error) {
+	var resp ListPullsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/pulls", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PausePull pauses a pull. The data downloaded so far is kept until the pull
+// is resumed.
+func (c *Client) PausePull(ctx context.Context, req *PullControlRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/pulls/pause", req, nil)
+}
+
+// ResumePull resumes a paused pull.
+func (c *Client) ResumePull(ctx context.Context, req *PullControlRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/pulls/resume", req, nil)
+}
+
+// CancelPull cancels a pull and removes the data downloaded so far.
+func (c *Client) CancelPull(ctx context.Context, req *PullControlRequest) error {
+	return c.do(ctx, http.MethodDelete, "/api/pulls", req, nil)
+}
+
+// Plan reports how the server would place a model across the available GPUs
+// and which loaded models it would evict, without loading anything.
+func (c *Client) Plan(ctx context.Context, req *PlanRequest) (*PlanResponse, error) {
+	var resp PlanResponse
+	if err := c.do(ctx, http.MethodPost, "/api/plan", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RenderTemplate renders a chat request with the model's template and returns
+// the prompt the model would see, without running the model.
+func (c *Client) RenderTemplate(ctx context.Context, req *TemplateRenderRequest) (*TemplateRenderResponse, error) {
+	var resp TemplateRenderResponse
+	if err := c.do(ctx, http.MethodPost, "/api/template/render", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Copy copies a model - creating a model with another name from an existing
 // model.
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
@@ -316,6 +435,26 @@ func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
 	return nil
 }
 
+// SetAlias creates an alias for a model or points an existing alias at
+// another model.
+func (c *Client) SetAlias(ctx context.Context, req *AliasRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/alias", req, nil)
+}
+
+// ListAliases lists the aliases and the models they refer to.
+func (c *Client) ListAliases(ctx context.Context) (*ListAliasesResponse, error) {
+	var resp ListAliasesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/alias", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteAlias deletes an alias without deleting the model it refers to.
+func (c *Client) DeleteAlias(ctx context.Context, req *AliasRequest) error {
+	return c.do(ctx, http.MethodDelete, "/api/alias", req, nil)
+}
+
 // Delete deletes a model and its data.
 func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
 	if err := c.do(ctx, http.MethodDelete, "/api/delete", req, nil); err != nil {
@@ -324,6 +463,37 @@ func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
 	return nil
 }
 
+// Prune removes the models that haven't been used recently and, if the server
+// has a store quota, the least recently used models until the store fits in
+// it. Models pinned by the server's policy aren't removed.
+func (c *Client) Prune(ctx context.Context, req *PruneRequest) (*PruneResponse, error) {
+	var resp PruneResponse
+	if err := c.do(ctx, http.MethodPost, "/api/prune", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListKeys lists the API keys of the server with their limits and usage. It
+// requires an admin key.
+func (c *Client) ListKeys(ctx context.Context) (*ListKeysResponse, error) {
+	var resp ListKeysResponse
+	if err := c.do(ctx, http.MethodGet, "/api/keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Usage reports the tokens and GPU time used by each user, model and day,
+// with the monthly token quotas of the users.
+func (c *Client) Usage(ctx context.Context, req *UsageRequest) (*UsageResponse, error) {
+	var resp UsageResponse
+	if err := c.do(ctx, http.MethodPost, "/api/usage", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Show obtains model information, including details, modelfile, license etc.
 func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, error) {
 	var resp ShowResponse
@@ -366,6 +536,54 @@ func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) err
 	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/blobs/%s", digest), r, nil)
 }
 
+// Export writes the model in req to w as a tar archive in the OCI image
+// layout format, which can be read by [Client.Import].
+func (c *Client) Export(ctx context.Context, req *ExportRequest, w io.Writer) error {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	requestURL := c.base.JoinPath("/api/export")
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL.String(), bytes.NewReader(bts))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/x-tar")
+	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	c.authorize(request)
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		return checkError(response, body)
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// Import imports the models in the tar archive r, as written by
+// [Client.Export] or other tools using the OCI image layout format.
+func (c *Client) Import(ctx context.Context, r io.Reader) (*ImportResponse, error) {
+	var resp ImportResponse
+	if err := c.do(ctx, http.MethodPost, "/api/import", r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Version returns the Ollama server version as a string.
 func (c *Client) Version(ctx context.Context) (string, error) {
 	var version struct {
@@ -2,13 +2,19 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/ollama/ollama/internal/testca"
 )
 
 func TestClientFromEnvironment(t *testing.T) {
@@ -253,3 +259,106 @@ func TestClientDo(t *testing.T) {
 		})
 	}
 }
+
+func TestClientAPIKey(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"version": "0.0.0"}`)
+	}))
+	defer ts.Close()
+
+	t.Setenv("OLLAMA_HOST", ts.URL)
+	t.Setenv("OLLAMA_API_KEY", "0123456789abcdef")
+
+	client, err := ClientFromEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Version(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Pull(t.Context(), &PullRequest{Model: "test"}, func(ProgressResponse) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range got {
+		if h != "Bearer 0123456789abcdef" {
+			t.Errorf("Authorization = %q; want the API key", h)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d requests; want 2", len(got))
+	}
+}
+
+func TestClientFromEnvironmentTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := testca.New(t)
+	serverCert, serverKey := ca.Issue(t, "server")
+	clientCert, clientKey := ca.Issue(t, "client")
+
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	testca.WriteFile(t, caFile, ca.PEM(), time.Time{})
+	testca.WriteFile(t, certFile, clientCert, time.Time{})
+	testca.WriteFile(t, keyFile, clientKey, time.Time{})
+
+	pair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"version": "0.0.0"}`)
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	t.Setenv("OLLAMA_HOST", ts.URL)
+
+	cases := []struct {
+		name           string
+		ca, cert, key  string
+		clientErr, err bool
+	}{
+		{name: "client certificate", ca: caFile, cert: certFile, key: keyFile},
+		{name: "no client certificate", ca: caFile, err: true},
+		{name: "unknown CA", cert: certFile, key: keyFile, err: true},
+		{name: "certificate without key", ca: caFile, cert: certFile, clientErr: true},
+		{name: "missing CA", ca: filepath.Join(dir, "missing.crt"), clientErr: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OLLAMA_TLS_CA", tt.ca)
+			t.Setenv("OLLAMA_TLS_CLIENT_CERT", tt.cert)
+			t.Setenv("OLLAMA_TLS_CLIENT_KEY", tt.key)
+
+			client, err := ClientFromEnvironment()
+			if (err != nil) != tt.clientErr {
+				t.Fatalf("expected client error %t, got %v", tt.clientErr, err)
+			} else if err != nil {
+				return
+			}
+
+			if _, err := client.Version(t.Context()); (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -105,10 +105,37 @@ type ChatRequest struct {
 	// Tools is an optional list of tools the model has access to.
 	Tools `json:"tools,omitempty"`
 
+	// Truncation controls which messages are left out when the chat is
+	// longer than the context window.
+	Truncation *Truncation `json:"truncation,omitempty"`
+
+	// KeepThinking keeps the thinking of earlier assistant messages in the
+	// prompt. By default it is left out, as most thinking models expect.
+	KeepThinking bool `json:"keep_thinking,omitempty"`
+
 	// Options lists model-specific options.
 	Options map[string]interface{} `json:"options"`
 }
 
+// Truncation controls how a chat that doesn't fit in the context window is
+// shortened. System messages and the last message are always kept, and tool
+// results are kept or dropped together with the tool calls they answer.
+type Truncation struct {
+	// Strategy is one of:
+	//   - "oldest" drops the oldest messages first (the default)
+	//   - "keep_last" drops all but the last KeepLast messages, so that the
+	//     chat doesn't need truncating again on every turn
+	//   - "middle" drops messages from the middle of the chat outwards,
+	//     keeping the start of the chat and the latest messages
+	//   - "summarize" drops the oldest messages like "oldest" and has the
+	//     model summarize them into the system message
+	Strategy string `json:"strategy,omitempty"`
+
+	// KeepLast is the number of messages, besides system messages, kept by
+	// the "keep_last" strategy.
+	KeepLast int `json:"keep_last,omitempty"`
+}
+
 type Tools []Tool
 
 func (t Tools) String() string {
@@ -125,8 +152,13 @@ func (t Tool) String() string {
 // role ("system", "user", or "assistant"), the content and an optional list
 // of images.
 type Message struct {
-	Role      string      `json:"role"`
-	Content   string      `json:"content"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+
+	// Thinking is the reasoning of a thinking model that came before the
+	// content of an assistant message.
+	Thinking string `json:"thinking,omitempty"`
+
 	Images    []ImageData `json:"images,omitempty"`
 	ToolCalls []ToolCall  `json:"tool_calls,omitempty"`
 }
@@ -194,6 +226,11 @@ type ChatResponse struct {
 
 	Done bool `json:"done"`
 
+	// Truncated lists the indexes of the request's messages that were left
+	// out of the prompt to fit the context window. It is set on the final
+	// response.
+	Truncated []int `json:"truncated,omitempty"`
+
 	Metrics
 }
 
@@ -228,6 +265,12 @@ type Options struct {
 	MirostatTau      float32  `json:"mirostat_tau,omitempty"`
 	MirostatEta      float32  `json:"mirostat_eta,omitempty"`
 	Stop             []string `json:"stop,omitempty"`
+
+	// ThinkingStart and ThinkingEnd delimit the thinking of a thinking
+	// model, which chat responses return apart from the content. They
+	// override the delimiters found in the model's template.
+	ThinkingStart string `json:"thinking_start,omitempty"`
+	ThinkingEnd   string `json:"thinking_end,omitempty"`
 }
 
 // Runner options which must be set when the model is loaded into memory
@@ -358,6 +401,39 @@ type CopyRequest struct {
 	Destination string `json:"destination"`
 }
 
+// AliasRequest is the request passed to [Client.SetAlias] and
+// [Client.DeleteAlias].
+type AliasRequest struct {
+	// Name is the name of the alias
+	Name string `json:"name"`
+
+	// Target is the name of the model the alias refers to, which may be
+	// another alias. It is not used by [Client.DeleteAlias].
+	Target string `json:"target,omitempty"`
+}
+
+// AliasResponse describes an alias.
+type AliasResponse struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+// ListAliasesResponse is the response from [Client.ListAliases].
+type ListAliasesResponse struct {
+	Aliases []AliasResponse `json:"aliases"`
+}
+
+// ExportRequest is the request passed to [Client.Export].
+type ExportRequest struct {
+	Model string `json:"model"`
+}
+
+// ImportResponse is the response from [Client.Import].
+type ImportResponse struct {
+	// Models are the names of the models imported from the archive
+	Models []string `json:"models"`
+}
+
 // PullRequest is the request passed to [Client.Pull].
 type PullRequest struct {
 	Model    string `json:"model"`
@@ -366,10 +442,132 @@ type PullRequest struct {
 	Password string `json:"password"`           // Deprecated: ignored
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// Limit is the maximum download rate of the pull in bytes per second.
+	// Pulling a model that is already being pulled replaces its limit.
+	Limit int64 `json:"limit,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 }
 
+// PullControlRequest is the request passed to [Client.PausePull],
+// [Client.ResumePull] and [Client.CancelPull].
+type PullControlRequest struct {
+	Model string `json:"model"`
+}
+
+// ListPullsResponse is the response from [Client.ListPulls].
+type ListPullsResponse struct {
+	Pulls []PullStatus `json:"pulls"`
+}
+
+// PullStatus is a single pull in [ListPullsResponse].
+type PullStatus struct {
+	Model string `json:"model"`
+
+	// Status is queued, running or paused
+	Status string `json:"status"`
+
+	// Total and Completed are the bytes of the blobs seen so far, which
+	// are all of the model's once its manifest is pulled
+	Total     int64 `json:"total,omitempty"`
+	Completed int64 `json:"completed,omitempty"`
+
+	// Limit is the maximum download rate of the pull in bytes per second
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// PruneRequest is the request passed to [Client.Prune].
+type PruneRequest struct {
+	// OlderThan removes the models not used for longer than this
+	OlderThan *Duration `json:"older_than,omitempty"`
+
+	// DryRun reports the models that would be removed without removing them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// PruneResponse is the response from [Client.Prune].
+type PruneResponse struct {
+	Models []PrunedModel `json:"models"`
+
+	// Size is the space freed in bytes
+	Size int64 `json:"size"`
+}
+
+// PrunedModel is a single model removed in [PruneResponse].
+type PrunedModel struct {
+	Name     string    `json:"name"`
+	LastUsed time.Time `json:"last_used"`
+
+	// Size is the space freed by removing the model in bytes, which doesn't
+	// include blobs other models use
+	Size int64 `json:"size"`
+}
+
+// ListKeysResponse is the response from [Client.ListKeys].
+type ListKeysResponse struct {
+	Keys []KeyStatus `json:"keys"`
+}
+
+// KeyStatus is the limits and usage of a single API key in
+// [ListKeysResponse]. The key itself isn't included.
+type KeyStatus struct {
+	Name string `json:"name"`
+
+	// Scope is inference or admin
+	Scope string `json:"scope"`
+
+	RequestsPerMinute int64 `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int64 `json:"tokens_per_minute,omitempty"`
+
+	// Requests, PromptTokens and EvalTokens are used by the key since the
+	// server started
+	Requests     int64 `json:"requests"`
+	PromptTokens int64 `json:"prompt_tokens"`
+	EvalTokens   int64 `json:"eval_tokens"`
+}
+
+// UsageRequest is the request passed to [Client.Usage].
+type UsageRequest struct {
+	// Identity limits the usage to a single user. Keys without the admin
+	// scope can only see their own usage.
+	Identity string `json:"identity,omitempty"`
+
+	// From and To are the first and last days of the usage, as YYYY-MM-DD
+	// in UTC. They default to the first day of the month and today.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// UsageResponse is the response from [Client.Usage].
+type UsageResponse struct {
+	Usage  []UsageRecord `json:"usage"`
+	Quotas []UsageQuota  `json:"quotas,omitempty"`
+}
+
+// UsageRecord is the usage of a model by a user on a single day.
+type UsageRecord struct {
+	Identity string `json:"identity"`
+	Day      string `json:"day"`
+	Model    string `json:"model"`
+
+	Requests     int64 `json:"requests"`
+	PromptTokens int64 `json:"prompt_tokens"`
+	EvalTokens   int64 `json:"eval_tokens"`
+
+	// GPUSeconds is the time spent evaluating prompts and generating,
+	// weighted by the share of the model loaded on GPUs
+	GPUSeconds float64 `json:"gpu_seconds"`
+}
+
+// UsageQuota is the monthly token quota of a user and the tokens they've
+// used this month.
+type UsageQuota struct {
+	Identity      string `json:"identity"`
+	MonthlyTokens int64  `json:"monthly_tokens"`
+	Used          int64  `json:"used"`
+}
+
 // ProgressResponse is the response passed to progress functions like
 // [PullProgressFunc] and [PushProgressFunc].
 type ProgressResponse struct {
@@ -387,6 +585,10 @@ type PushRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// Sign pushes a signature of the model's manifest made with the
+	// server's key
+	Sign bool `json:"sign,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 }
@@ -422,6 +624,112 @@ type ProcessModelResponse struct {
 	SizeVRAM  int64        `json:"size_vram"`
 }
 
+// PlanRequest is the request passed to [Client.Plan].
+type PlanRequest struct {
+	Model string `json:"model"`
+
+	// NumParallel overrides OLLAMA_NUM_PARALLEL if set
+	NumParallel int `json:"num_parallel,omitempty"`
+
+	// Options lists model-specific options, e.g. num_ctx and num_gpu
+	Options map[string]any `json:"options"`
+}
+
+// PlanResponse is the response from [Client.Plan]. It describes how the
+// server would place the model if it were loaded now, without loading it.
+type PlanResponse struct {
+	Model   string `json:"model"`
+	Library string `json:"library"`
+
+	// NumParallel is the number of requests the runner would serve at once
+	NumParallel int `json:"num_parallel"`
+
+	// NumCtx is the context length of the runner, which is shared by the
+	// parallel requests
+	NumCtx int `json:"num_ctx"`
+
+	// KVCacheType is the K/V cache quantization, f16 by default
+	KVCacheType string `json:"kv_cache_type"`
+
+	// Layers is the number of layers offloaded out of TotalLayers
+	Layers      int `json:"layers"`
+	TotalLayers int `json:"total_layers"`
+
+	Size      int64 `json:"size"`
+	SizeVRAM  int64 `json:"size_vram"`
+	KVCache   int64 `json:"kv_cache"`
+	Graph     int64 `json:"graph"`
+	Projector int64 `json:"projector,omitempty"`
+
+	GPUs []PlanGPU `json:"gpus,omitempty"`
+
+	// Evict lists the loaded models that would be unloaded to make room
+	Evict []string `json:"evict,omitempty"`
+
+	// Loaded is set if the model is already loaded with compatible options
+	Loaded bool `json:"loaded,omitempty"`
+}
+
+// PlanGPU describes the share of a model placed on a single GPU in [PlanResponse].
+type PlanGPU struct {
+	ID      string `json:"id"`
+	Library string `json:"library"`
+	Name    string `json:"name,omitempty"`
+	Layers  int    `json:"layers"`
+	Size    int64  `json:"size"`
+
+	// Free is the memory available before the model is placed, after
+	// accounting for loaded models that would not be evicted
+	Free int64 `json:"free"`
+}
+
+// TemplateRenderRequest is the request passed to [Client.RenderTemplate].
+type TemplateRenderRequest struct {
+	Model string `json:"model"`
+
+	// Messages are rendered the same way as in a [ChatRequest]
+	Messages []Message `json:"messages"`
+
+	// Tools are rendered the same way as in a [ChatRequest]
+	Tools `json:"tools,omitempty"`
+
+	// System overrides the model's system message
+	System string `json:"system,omitempty"`
+
+	// Template overrides the model's template, e.g. to try out a change
+	// before putting it in a Modelfile
+	Template string `json:"template,omitempty"`
+
+	// Truncation is applied the same way as in a [ChatRequest]
+	Truncation *Truncation `json:"truncation,omitempty"`
+
+	// KeepThinking is applied the same way as in a [ChatRequest]
+	KeepThinking bool `json:"keep_thinking,omitempty"`
+
+	// Options lists model-specific options, e.g. num_ctx
+	Options map[string]any `json:"options"`
+
+	// KeepAlive controls how long the model will stay loaded after the
+	// request, since counting tokens requires its tokenizer
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+}
+
+// TemplateRenderResponse is the response from [Client.RenderTemplate].
+type TemplateRenderResponse struct {
+	// Prompt is the exact string passed to the model
+	Prompt string `json:"prompt"`
+
+	// Tokens is the number of tokens in Prompt, not counting images
+	Tokens int `json:"tokens"`
+
+	// Truncated lists the indexes of the messages left out of Prompt to
+	// fit the context window
+	Truncated []int `json:"truncated,omitempty"`
+
+	// Warnings lists likely problems with the template
+	Warnings []string `json:"warnings,omitempty"`
+}
+
 type RetrieveModelResponse struct {
 	Id      string `json:"id"`
 	Object  string `json:"object"`
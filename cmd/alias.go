@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func newAliasCmd() *cobra.Command {
+	aliasCmd := &cobra.Command{
+		Use:   "alias [ALIAS [MODEL]]",
+		Short: "Create, repoint or list model aliases",
+		Long: `Create, repoint or list model aliases.
+
+An alias refers to another model by name and follows it when the model is
+pulled or created again. Pointing an existing alias at another model is
+atomic, so requests see either the old or the new model.
+
+With no arguments, the aliases are listed. With ALIAS, its model is printed.
+With ALIAS and MODEL, the alias is created or pointed at MODEL.`,
+		Args:    cobra.MaximumNArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    AliasHandler,
+	}
+
+	aliasCmd.Flags().BoolP("delete", "d", false, "Delete the alias, keeping the model it refers to")
+
+	return aliasCmd
+}
+
+func AliasHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if del, _ := cmd.Flags().GetBool("delete"); del {
+		if len(args) != 1 {
+			return errors.New("--delete requires exactly one alias")
+		}
+
+		if err := client.DeleteAlias(cmd.Context(), &api.AliasRequest{Name: args[0]}); err != nil {
+			return err
+		}
+
+		fmt.Printf("deleted alias '%s'\n", args[0])
+		return nil
+	}
+
+	if len(args) == 2 {
+		if err := client.SetAlias(cmd.Context(), &api.AliasRequest{Name: args[0], Target: args[1]}); err != nil {
+			return err
+		}
+
+		fmt.Printf("'%s' now refers to '%s'\n", args[0], args[1])
+		return nil
+	}
+
+	resp, err := client.ListAliases(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		for _, alias := range resp.Aliases {
+			if alias.Name == args[0] {
+				fmt.Println(alias.Target)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("alias '%s' not found", args[0])
+	}
+
+	var data [][]string
+	for _, alias := range resp.Aliases {
+		data = append(data, []string{alias.Name, alias.Target})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ALIAS", "MODEL"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"math"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -65,6 +67,10 @@ func getModelfileName(cmd *cobra.Command) (string, error) {
 }
 
 func CreateHandler(cmd *cobra.Command, args []string) error {
+	if check, _ := cmd.Flags().GetBool("check"); check {
+		return CheckHandler(cmd, args)
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -383,6 +389,11 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	sign, err := cmd.Flags().GetBool("sign")
+	if err != nil {
+		return err
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -417,7 +428,7 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.PushRequest{Name: args[0], Insecure: insecure}
+	request := api.PushRequest{Name: args[0], Insecure: insecure, Sign: sign}
 
 	n := model.ParseName(args[0])
 	if err := client.Push(cmd.Context(), &request, fn); err != nil {
@@ -476,6 +487,23 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// processorString describes how a model of size bytes is split between the
+// CPU and GPU when sizeVRAM bytes are offloaded
+func processorString(size, sizeVRAM int64) string {
+	switch {
+	case sizeVRAM == 0:
+		return "100% CPU"
+	case sizeVRAM == size:
+		return "100% GPU"
+	case sizeVRAM > size || size == 0:
+		return "Unknown"
+	default:
+		sizeCPU := size - sizeVRAM
+		cpuPercent := math.Round(float64(sizeCPU) / float64(size) * 100)
+		return fmt.Sprintf("%d%%/%d%% CPU/GPU", int(cpuPercent), int(100-cpuPercent))
+	}
+}
+
 func ListRunningHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -491,19 +519,7 @@ func ListRunningHandler(cmd *cobra.Command, args []string) error {
 
 	for _, m := range models.Models {
 		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
-			var procStr string
-			switch {
-			case m.SizeVRAM == 0:
-				procStr = "100% CPU"
-			case m.SizeVRAM == m.Size:
-				procStr = "100% GPU"
-			case m.SizeVRAM > m.Size || m.Size == 0:
-				procStr = "Unknown"
-			default:
-				sizeCPU := m.Size - m.SizeVRAM
-				cpuPercent := math.Round(float64(sizeCPU) / float64(m.Size) * 100)
-				procStr = fmt.Sprintf("%d%%/%d%% CPU/GPU", int(cpuPercent), int(100-cpuPercent))
-			}
+			procStr := processorString(m.Size, m.SizeVRAM)
 
 			var until string
 			delta := time.Since(m.ExpiresAt)
@@ -558,6 +574,14 @@ func DeleteHandler(cmd *cobra.Command, args []string) error {
 }
 
 func ShowHandler(cmd *cobra.Command, args []string) error {
+	if filename, _ := cmd.Flags().GetString("file"); filename != "" {
+		return showModelfile(cmd, filename)
+	}
+
+	if len(args) != 1 {
+		return errors.New("a model or --file must be specified")
+	}
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
@@ -633,6 +657,92 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	return showInfo(resp, os.Stdout)
 }
 
+// CheckHandler checks a Modelfile without creating a model, printing every
+// error and warning found.
+func CheckHandler(cmd *cobra.Command, args []string) error {
+	filename, err := getModelfileName(cmd)
+	if os.IsNotExist(err) {
+		return errModelfileNotFound
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// models named in FROM are looked up if the server is running
+	var exists func(string) bool
+	if client, err := api.ClientFromEnvironment(); err == nil && client.Heartbeat(cmd.Context()) == nil {
+		exists = func(name string) bool {
+			_, err := client.Show(cmd.Context(), &api.ShowRequest{Name: name})
+			var statusErr api.StatusError
+			return !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound
+		}
+	}
+
+	diags := parser.Check(f, filepath.Dir(filename), exists)
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		if diags == nil {
+			diags = []parser.Diagnostic{}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		name, err := filepath.Rel(".", filename)
+		if err != nil {
+			name = filename
+		}
+
+		for _, d := range diags {
+			if d.File == "" {
+				d.File = name
+			}
+			fmt.Println(d)
+		}
+	}
+
+	if parser.HasErrors(diags) {
+		return errors.New("Modelfile has errors")
+	}
+
+	return nil
+}
+
+// showModelfile prints the local Modelfile filename with its includes and
+// file references expanded, as it is sent by "ollama create".
+func showModelfile(cmd *cobra.Command, filename string) error {
+	if modelfile, _ := cmd.Flags().GetBool("modelfile"); !modelfile {
+		return errors.New("--file can only be used with --modelfile")
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	modelfile, err := parser.ParseFile(f)
+	if err != nil {
+		return err
+	}
+
+	expanded, err := modelfile.Expand(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(expanded.String())
+	return nil
+}
+
 func showInfo(resp *api.ShowResponse, w io.Writer) error {
 	tableRender := func(header string, rows func() [][]string) {
 		fmt.Fprintln(w, " ", header)
@@ -729,6 +839,128 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	if output == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("refusing to write archive to a terminal, use --output")
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	var f *os.File
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err = os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	var pw progressWriter
+	status := fmt.Sprintf("exporting %s", args[0])
+	spinner := progress.NewSpinner(status)
+	p.Add(status, spinner)
+	defer spinner.Stop()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(60 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				spinner.SetMessage(fmt.Sprintf("%s %s", status, format.HumanBytes(pw.n.Load())))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	req := api.ExportRequest{Model: args[0]}
+	if err := client.Export(cmd.Context(), &req, io.MultiWriter(w, &pw)); err != nil {
+		if f != nil {
+			// don't leave a truncated archive behind
+			f.Close()
+			os.Remove(output)
+		}
+		return err
+	}
+
+	if f != nil {
+		return f.Close()
+	}
+
+	return nil
+}
+
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+
+	var pw progressWriter
+	status := fmt.Sprintf("importing %s 0%%", args[0])
+	spinner := progress.NewSpinner(status)
+	p.Add(status, spinner)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(60 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				spinner.SetMessage(fmt.Sprintf("importing %s %d%%", args[0], int(100*pw.n.Load()/max(fi.Size(), 1))))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	resp, err := client.Import(cmd.Context(), io.TeeReader(f, &pw))
+	close(done)
+	spinner.Stop()
+	p.Stop()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range resp.Models {
+		fmt.Printf("imported '%s'\n", name)
+	}
+
+	return nil
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
@@ -776,6 +1008,12 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 	}
 
 	request := api.PullRequest{Name: args[0], Insecure: insecure}
+	if limit, _ := cmd.Flags().GetString("limit"); limit != "" {
+		if request.Limit, err = format.ParseBytes(limit); err != nil {
+			return err
+		}
+	}
+
 	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
 		return err
 	}
@@ -1029,7 +1267,16 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 	return nil
 }
 
-func RunServer(_ *cobra.Command, _ []string) error {
+func RunServer(cmd *cobra.Command, _ []string) error {
+	config, _ := cmd.Flags().GetString("config")
+	if err := envconfig.LoadConfig(config); err != nil {
+		return err
+	}
+
+	if printConfig, _ := cmd.Flags().GetBool("print-config"); printConfig {
+		return PrintConfig()
+	}
+
 	if err := initializeKeypair(); err != nil {
 		return err
 	}
@@ -1047,6 +1294,32 @@ func RunServer(_ *cobra.Command, _ []string) error {
 	return err
 }
 
+// PrintConfig prints the effective value of every setting and where it
+// comes from.
+func PrintConfig() error {
+	vars := envconfig.AsMap()
+	names := slices.Sorted(maps.Keys(vars))
+
+	var data [][]string
+	for _, name := range names {
+		data = append(data, []string{name, envconfig.Source(name), fmt.Sprintf("%v", vars[name].Value)})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "SOURCE", "VALUE"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
+
 func initializeKeypair() error {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -1173,22 +1446,44 @@ func NewCLI() *cobra.Command {
 	rootCmd.Flags().BoolP("version", "v", false, "Show version information")
 
 	createCmd := &cobra.Command{
-		Use:     "create MODEL",
-		Short:   "Create a model from a Modelfile",
-		Args:    cobra.ExactArgs(1),
-		PreRunE: checkServerHeartbeat,
-		RunE:    CreateHandler,
+		Use:   "create MODEL",
+		Short: "Create a model from a Modelfile",
+		Args: func(cmd *cobra.Command, args []string) error {
+			// checking doesn't need a model name
+			if check, _ := cmd.Flags().GetBool("check"); check {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if check, _ := cmd.Flags().GetBool("check"); check {
+				return nil
+			}
+
+			return checkServerHeartbeat(cmd, args)
+		},
+		RunE: CreateHandler,
 	}
 
 	createCmd.Flags().StringP("file", "f", "", "Name of the Modelfile (default \"Modelfile\"")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_0)")
+	createCmd.Flags().Bool("check", false, "Check the Modelfile for errors without creating a model")
+	createCmd.Flags().Bool("json", false, "Output the results of --check as JSON")
 
 	showCmd := &cobra.Command{
-		Use:     "show MODEL",
-		Short:   "Show information for a model",
-		Args:    cobra.ExactArgs(1),
-		PreRunE: checkServerHeartbeat,
-		RunE:    ShowHandler,
+		Use:   "show MODEL",
+		Short: "Show information for a model",
+		Args:  cobra.MaximumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// a local Modelfile is expanded without the server
+			if cmd.Flags().Changed("file") {
+				return nil
+			}
+
+			return checkServerHeartbeat(cmd, args)
+		},
+		RunE: ShowHandler,
 	}
 
 	showCmd.Flags().Bool("license", false, "Show license of a model")
@@ -1196,6 +1491,7 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().Bool("parameters", false, "Show parameters of a model")
 	showCmd.Flags().Bool("template", false, "Show template of a model")
 	showCmd.Flags().Bool("system", false, "Show system message of a model")
+	showCmd.Flags().StringP("file", "f", "", "Show the expanded Modelfile at this path instead of a model")
 
 	runCmd := &cobra.Command{
 		Use:     "run MODEL [PROMPT]",
@@ -1227,6 +1523,9 @@ func NewCLI() *cobra.Command {
 		RunE:    RunServer,
 	}
 
+	serveCmd.Flags().String("config", "", "Path to a TOML config file (default \"~/.ollama/config.toml\")")
+	serveCmd.Flags().Bool("print-config", false, "Print the effective configuration and exit")
+
 	pullCmd := &cobra.Command{
 		Use:     "pull MODEL",
 		Short:   "Pull a model from a registry",
@@ -1236,6 +1535,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pullCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pullCmd.Flags().String("limit", "", "Maximum download rate per second (e.g. 10MB)")
 
 	pushCmd := &cobra.Command{
 		Use:     "push MODEL",
@@ -1246,6 +1546,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pushCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pushCmd.Flags().Bool("sign", false, "Sign the model with the server's key")
 
 	listCmd := &cobra.Command{
 		Use:     "list",
@@ -1270,6 +1571,24 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	exportCmd := &cobra.Command{
+		Use:     "export MODEL",
+		Short:   "Export a model to an archive",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ExportHandler,
+	}
+
+	exportCmd.Flags().StringP("output", "o", "", "Write the archive to a file instead of stdout")
+
+	importCmd := &cobra.Command{
+		Use:     "import FILE",
+		Short:   "Import models from an archive",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImportHandler,
+	}
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1290,9 +1609,41 @@ func NewCLI() *cobra.Command {
 		_ = runner.Execute(args[1:])
 	})
 
+	planCmd := &cobra.Command{
+		Use:     "plan MODEL",
+		Short:   "Show how a model would be placed without loading it",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    PlanHandler,
+	}
+
+	planCmd.Flags().Int("ctx", 0, "Context length for each request (num_ctx)")
+	planCmd.Flags().Int("parallel", 0, "Number of parallel requests (default OLLAMA_NUM_PARALLEL)")
+	planCmd.Flags().Int("gpu", -1, "Number of layers to offload (num_gpu), -1 for as many as fit")
+	planCmd.Flags().Bool("json", false, "Output the plan as JSON")
+
+	ggufCmd := newGGUFCmd()
+	templateCmd := newTemplateCmd()
+	aliasCmd := newAliasCmd()
+	pullsCmd := newPullsCmd()
+	pruneCmd := newPruneCmd()
+	keysCmd := newKeysCmd()
+	usageCmd := newUsageCmd()
+
 	envVars := envconfig.AsMap()
 
-	envs := []envconfig.EnvVar{envVars["OLLAMA_HOST"]}
+	// the API key isn't in envVars so that it isn't logged with the
+	// server config
+	apiKey := envconfig.EnvVar{Name: "OLLAMA_API_KEY", Description: "API key to send to the server"}
+
+	// neither are the client's TLS settings, which the server doesn't use
+	clientTLS := []envconfig.EnvVar{
+		{Name: "OLLAMA_TLS_CA", Description: "Path to a PEM bundle of CAs to verify an https server with"},
+		{Name: "OLLAMA_TLS_CLIENT_CERT", Description: "Path to a PEM client certificate to send to an https server"},
+		{Name: "OLLAMA_TLS_CLIENT_KEY", Description: "Path to the PEM private key of OLLAMA_TLS_CLIENT_CERT"},
+	}
+
+	envs := append([]envconfig.EnvVar{envVars["OLLAMA_HOST"], apiKey}, clientTLS...)
 
 	for _, cmd := range []*cobra.Command{
 		createCmd,
@@ -1300,16 +1651,24 @@ func NewCLI() *cobra.Command {
 		runCmd,
 		stopCmd,
 		pullCmd,
+		pullsCmd,
 		pushCmd,
 		listCmd,
 		psCmd,
+		planCmd,
 		copyCmd,
+		exportCmd,
+		importCmd,
+		aliasCmd,
 		deleteCmd,
+		pruneCmd,
+		keysCmd,
+		usageCmd,
 		serveCmd,
 	} {
 		switch cmd {
 		case runCmd:
-			appendEnvDocs(cmd, []envconfig.EnvVar{envVars["OLLAMA_HOST"], envVars["OLLAMA_NOHISTORY"]})
+			appendEnvDocs(cmd, append(slices.Clone(envs), envVars["OLLAMA_NOHISTORY"]))
 		case serveCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{
 				envVars["OLLAMA_DEBUG"],
@@ -1317,11 +1676,25 @@ func NewCLI() *cobra.Command {
 				envVars["OLLAMA_KEEP_ALIVE"],
 				envVars["OLLAMA_MAX_LOADED_MODELS"],
 				envVars["OLLAMA_MAX_QUEUE"],
+				envVars["OLLAMA_MAX_PULLS"],
+				envVars["OLLAMA_MAX_DOWNLOAD_RATE"],
 				envVars["OLLAMA_MODELS"],
 				envVars["OLLAMA_NUM_PARALLEL"],
 				envVars["OLLAMA_NOPRUNE"],
 				envVars["OLLAMA_ORIGINS"],
+				envVars["OLLAMA_API_KEYS"],
+				envVars["OLLAMA_TLS_CERT"],
+				envVars["OLLAMA_TLS_KEY"],
+				envVars["OLLAMA_TLS_CLIENT_CA"],
+				envVars["OLLAMA_POLICY"],
+				envVars["OLLAMA_REGISTRY_CONFIG"],
+				envVars["OLLAMA_MIRROR"],
+				envVars["OLLAMA_REGISTRY_MIRROR"],
 				envVars["OLLAMA_SCHED_SPREAD"],
+				envVars["OLLAMA_STORE_QUOTA"],
+				envVars["OLLAMA_TRUST_POLICY"],
+				envVars["OLLAMA_USAGE_HEADER"],
+				envVars["OLLAMA_USAGE_QUOTAS"],
 				envVars["OLLAMA_TMPDIR"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
 				envVars["OLLAMA_KV_CACHE_TYPE"],
@@ -1341,11 +1714,21 @@ func NewCLI() *cobra.Command {
 		runCmd,
 		stopCmd,
 		pullCmd,
+		pullsCmd,
 		pushCmd,
 		listCmd,
 		psCmd,
+		planCmd,
 		copyCmd,
+		exportCmd,
+		importCmd,
+		aliasCmd,
 		deleteCmd,
+		pruneCmd,
+		keysCmd,
+		usageCmd,
+		ggufCmd,
+		templateCmd,
 		runnerCmd,
 	)
 
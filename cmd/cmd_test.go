@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +17,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/parser"
 )
 
 func TestShowInfo(t *testing.T) {
@@ -446,6 +449,7 @@ func TestPushHandler(t *testing.T) {
 
 			cmd := &cobra.Command{}
 			cmd.Flags().Bool("insecure", false, "")
+			cmd.Flags().Bool("sign", false, "")
 			cmd.SetContext(context.TODO())
 
 			// Redirect stderr to capture progress output
@@ -707,3 +711,220 @@ func TestCreateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGGUFValue(t *testing.T) {
+	cases := []struct {
+		old     any
+		value   string
+		want    any
+		wantErr bool
+	}{
+		{nil, "true", true, false},
+		{nil, "8192", uint32(8192), false},
+		{nil, "-1", int32(-1), false},
+		{nil, "1e6", float32(1e6), false},
+		{nil, "{{ .Prompt }}", "{{ .Prompt }}", false},
+		{"old", "42", "42", false},
+		{float32(10000), "500000", float32(500000), false},
+		{uint32(4096), "8192", uint32(8192), false},
+		{uint32(4096), "-1", nil, true},
+		{false, "yes", nil, true},
+		{knownGGUFKeyType("llama.rope.freq_base"), "500000", float32(500000), false},
+		{knownGGUFKeyType("general.name"), "7", uint32(7), false},
+		{ggufTypes["i64"], "8192", int64(8192), false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseGGUFValue(tt.old, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestGGUFSetHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.gguf")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ggml.WriteGGUF(f, ggml.KV{"general.architecture": "llama"}, []ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newGGUFCmd()
+	cmd.SetArgs([]string{"set", path, "llama.rope.freq_base=500000", "llama.context_length:u64=8192"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v; want %v", fi.Mode().Perm(), os.FileMode(0o644))
+	}
+
+	f, m, err := decodeGGUF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	kv := m.KV()
+	if v, ok := kv["llama.rope.freq_base"].(float32); !ok || v != 500000 {
+		t.Errorf("rope.freq_base = %v (%T); want float32 500000", kv["llama.rope.freq_base"], kv["llama.rope.freq_base"])
+	}
+	if v, ok := kv["llama.context_length"].(uint64); !ok || v != 8192 {
+		t.Errorf("context_length = %v (%T); want uint64 8192", kv["llama.context_length"], kv["llama.context_length"])
+	}
+}
+
+func TestTemplateRenderHandler(t *testing.T) {
+	var got api.TemplateRenderRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/template/render" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(api.TemplateRenderResponse{Prompt: "user: Hello!", Tokens: 2}); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	t.Setenv("OLLAMA_HOST", mockServer.URL)
+	t.Cleanup(mockServer.Close)
+
+	p := filepath.Join(t.TempDir(), "chat.json")
+	if err := os.WriteFile(p, []byte(`{
+  "model": "ignored",
+  "messages": [{"role": "user", "content": "Hello!"}],
+  "tools": [{"type": "function", "function": {"name": "get_weather"}}]
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newTemplateCmd().Commands()[0]
+	cmd.SetContext(context.TODO())
+	if err := cmd.Flags().Set("messages", p); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Flags().Set("ctx", "4096"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := TemplateRenderHandler(cmd, []string{"test-model", "How are you?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := api.TemplateRenderRequest{
+		Model: "test-model",
+		Messages: []api.Message{
+			{Role: "user", Content: "Hello!"},
+			{Role: "user", Content: "How are you?"},
+		},
+		Tools:   api.Tools{{Type: "function", Function: api.ToolFunction{Name: "get_weather"}}},
+		Options: map[string]any{"num_ctx": float64(4096)},
+	}
+
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := TemplateRenderHandler(newTemplateCmd().Commands()[0], []string{"test-model"}); err == nil {
+		t.Error("expected an error without messages")
+	}
+}
+
+func TestCheckHandler(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.WriteHeader(http.StatusOK)
+		case "/api/show":
+			var req api.ShowRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatal(err)
+			}
+
+			if req.Name != "llama3" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": "model not found"})
+				return
+			}
+
+			json.NewEncoder(w).Encode(api.ShowResponse{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mockServer.Close()
+
+	t.Setenv("OLLAMA_HOST", mockServer.URL)
+
+	filename := filepath.Join(t.TempDir(), "Modelfile")
+	if err := os.WriteFile(filename, []byte("FROM llama3\nFROM mistral\nPARAMETER temprature 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("file", filename, "")
+	cmd.Flags().Bool("json", true, "")
+	cmd.SetContext(context.TODO())
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := CheckHandler(cmd, nil)
+
+	w.Close()
+	os.Stdout = oldStdout
+
+	if err == nil || err.Error() != "Modelfile has errors" {
+		t.Errorf("expected errors, got %v", err)
+	}
+
+	var diags []parser.Diagnostic
+	if err := json.NewDecoder(r).Decode(&diags); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []parser.Diagnostic{
+		{Severity: parser.SeverityWarning, Line: 2, Column: 1, Message: "model mistral was not found locally and will be pulled"},
+		{Severity: parser.SeverityError, Line: 3, Column: 1, Message: "parameter temprature: unknown parameter 'temprature'"},
+	}
+
+	if diff := cmp.Diff(expect, diags); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+// maxDisplayArray is the largest array printed in full by `ollama gguf kv`
+// unless the key is requested explicitly
+const maxDisplayArray = 16
+
+func decodeGGUF(path string) (*os.File, *ggml.GGML, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, _, err := ggml.Decode(f, -1)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f, m, nil
+}
+
+func GGUFTensorsHandler(cmd *cobra.Command, args []string) error {
+	f, m, err := decodeGGUF(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var data [][]string
+	var total uint64
+	for _, t := range m.Tensors().Items() {
+		shape := make([]string, len(t.Shape))
+		for i, n := range t.Shape {
+			shape[i] = strconv.FormatUint(n, 10)
+		}
+
+		data = append(data, []string{t.Name, t.TypeString(), strings.Join(shape, "x"), format.HumanBytes(int64(t.Size()))})
+		total += t.Size()
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "TYPE", "SHAPE", "SIZE"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	fmt.Printf("\n%d tensors, %s\n", len(data), format.HumanBytes(int64(total)))
+	return nil
+}
+
+func GGUFKVHandler(cmd *cobra.Command, args []string) error {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+
+	f, m, err := decodeGGUF(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	kv := m.KV()
+	keys := args[1:]
+	if len(keys) == 0 {
+		keys = slices.Sorted(maps.Keys(kv))
+	}
+
+	if asJSON {
+		out := make(map[string]any, len(keys))
+		for _, k := range keys {
+			v, ok := kv[k]
+			if !ok {
+				return fmt.Errorf("key '%s' not found", k)
+			}
+			out[k] = v
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	for _, k := range keys {
+		v, ok := kv[k]
+		if !ok {
+			return fmt.Errorf("key '%s' not found", k)
+		}
+
+		// print large arrays such as the vocabulary in full only on request
+		if len(args) == 1 && ggml.ArrayLen(v) > maxDisplayArray {
+			fmt.Printf("%s = [%d items]\n", k, ggml.ArrayLen(v))
+			continue
+		}
+
+		if s, ok := v.(string); ok && len(args) > 1 {
+			fmt.Println(s)
+			continue
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 1 {
+			fmt.Println(string(b))
+		} else {
+			fmt.Printf("%s = %s\n", k, b)
+		}
+	}
+
+	return nil
+}
+
+func GGUFSetHandler(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	deletes, err := cmd.Flags().GetStringSlice("delete")
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 2 && len(deletes) == 0 {
+		return errors.New("nothing to change: specify KEY=VALUE pairs or --delete")
+	}
+
+	f, m, err := decodeGGUF(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	kv := maps.Clone(m.KV())
+	for _, k := range deletes {
+		if _, ok := kv[k]; !ok {
+			return fmt.Errorf("key '%s' not found", k)
+		}
+		delete(kv, k)
+	}
+
+	for _, arg := range args[1:] {
+		k, s, ok := strings.Cut(arg, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid assignment '%s': expected KEY=VALUE", arg)
+		}
+
+		old := kv[k]
+
+		// KEY:TYPE=VALUE sets the type of a new key, e.g. rope.freq_base:f32
+		if name, typ, ok := strings.Cut(k, ":"); ok {
+			zero, ok := ggufTypes[typ]
+			if !ok {
+				return fmt.Errorf("invalid type '%s' for '%s'", typ, name)
+			}
+			k, old = name, zero
+		} else if old == nil {
+			old = knownGGUFKeyType(k)
+		}
+
+		// KEY=@path reads the value from a file, e.g. for a chat template
+		if path, ok := strings.CutPrefix(s, "@"); ok {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			s = string(b)
+		}
+
+		v, err := parseGGUFValue(old, s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+
+		kv[k] = v
+	}
+
+	if output == "" {
+		output = args[0]
+	}
+
+	dir, name := filepath.Split(output)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ggml.RewriteGGUF(tmp, f, m, kv); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// CreateTemp makes files only readable by their owner; keep the mode
+	// of the file being replaced
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(output); err == nil {
+		mode = fi.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote '%s'\n", output)
+	return nil
+}
+
+// ggufTypes are the zero values of the types that can be given to new keys
+// with KEY:TYPE=VALUE
+var ggufTypes = map[string]any{
+	"str":  "",
+	"bool": false,
+	"u8":   uint8(0),
+	"i8":   int8(0),
+	"u16":  uint16(0),
+	"i16":  int16(0),
+	"u32":  uint32(0),
+	"i32":  int32(0),
+	"u64":  uint64(0),
+	"i64":  int64(0),
+	"f32":  float32(0),
+	"f64":  float64(0),
+}
+
+// floatGGUFKeys are the suffixes of keys llama.cpp reads as float32, so new
+// keys such as llama.rope.freq_base=500000 aren't typed as integers
+var floatGGUFKeys = []string{
+	"rope.freq_base",
+	"rope.scale_linear",
+	"rope.scaling.factor",
+	"rope.scaling.attn_factor",
+	"rope.scaling.yarn_log_multiplier",
+	"attention.layer_norm_epsilon",
+	"attention.layer_norm_rms_epsilon",
+	"attention.scale",
+	"attn_logit_softcapping",
+	"final_logit_softcapping",
+	"expert_weights_scale",
+	"logit_scale",
+	"embedding_scale",
+	"residual_scale",
+}
+
+// knownGGUFKeyType returns the zero value of the type of the new key k if
+// llama.cpp expects a particular type for it, or nil otherwise.
+func knownGGUFKeyType(k string) any {
+	for _, suffix := range floatGGUFKeys {
+		if k == suffix || strings.HasSuffix(k, "."+suffix) {
+			return float32(0)
+		}
+	}
+	return nil
+}
+
+// parseGGUFValue converts s to the type of the existing value old. New keys
+// are typed by their value: booleans, unsigned integers, signed integers and
+// floats are tried in turn before falling back to a string.
+func parseGGUFValue(old any, s string) (any, error) {
+	switch old.(type) {
+	case nil:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		} else if u, err := strconv.ParseUint(s, 10, 32); err == nil {
+			return uint32(u), nil
+		} else if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+			return int32(i), nil
+		} else if f, err := strconv.ParseFloat(s, 32); err == nil {
+			return float32(f), nil
+		}
+		return s, nil
+	case string:
+		return s, nil
+	case bool:
+		return strconv.ParseBool(s)
+	case uint8:
+		u, err := strconv.ParseUint(s, 10, 8)
+		return uint8(u), err
+	case int8:
+		i, err := strconv.ParseInt(s, 10, 8)
+		return int8(i), err
+	case uint16:
+		u, err := strconv.ParseUint(s, 10, 16)
+		return uint16(u), err
+	case int16:
+		i, err := strconv.ParseInt(s, 10, 16)
+		return int16(i), err
+	case uint32:
+		u, err := strconv.ParseUint(s, 10, 32)
+		return uint32(u), err
+	case int32:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case float32:
+		f, err := strconv.ParseFloat(s, 32)
+		if err == nil && math.IsInf(f, 0) {
+			return nil, fmt.Errorf("value out of range: %s", s)
+		}
+		return float32(f), err
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	default:
+		return nil, fmt.Errorf("cannot set values of type %T", old)
+	}
+}
+
+func newGGUFCmd() *cobra.Command {
+	ggufCmd := &cobra.Command{
+		Use:   "gguf",
+		Short: "Inspect and edit GGUF files",
+	}
+
+	tensorsCmd := &cobra.Command{
+		Use:   "tensors FILE",
+		Short: "List the tensors of a GGUF file",
+		Args:  cobra.ExactArgs(1),
+		RunE:  GGUFTensorsHandler,
+	}
+
+	kvCmd := &cobra.Command{
+		Use:   "kv FILE [KEY...]",
+		Short: "Print the metadata of a GGUF file",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  GGUFKVHandler,
+	}
+
+	kvCmd.Flags().Bool("json", false, "Print metadata as JSON")
+
+	setCmd := &cobra.Command{
+		Use:   "set FILE [KEY=VALUE...]",
+		Short: "Set or delete metadata in a GGUF file",
+		Long: `Set or delete metadata in a GGUF file without re-quantizing it.
+
+Values keep the type of the existing key. New keys are typed by their
+value unless llama.cpp expects a float, such as rope.freq_base; use
+KEY:TYPE=VALUE to choose the type of a new key, where TYPE is one of str,
+bool, u8, i8, u16, i16, u32, i32, u64, i64, f32 or f64. Use KEY=@PATH to
+read a value, such as a chat template, from a file.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: GGUFSetHandler,
+	}
+
+	setCmd.Flags().StringP("output", "o", "", "Write to this file instead of editing in place")
+	setCmd.Flags().StringSlice("delete", nil, "Delete a key")
+
+	ggufCmd.AddCommand(tensorsCmd, kvCmd, setCmd)
+	return ggufCmd
+}
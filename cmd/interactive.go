@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"slices"
 	"strings"
@@ -74,6 +75,10 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  Ctrl + u            Delete the sentence before the cursor")
 		fmt.Fprintln(os.Stderr, "  Ctrl + w            Delete the word before the cursor")
 		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "       Tab            Complete commands, parameters, models and paths")
+		fmt.Fprintln(os.Stderr, "  Ctrl + r            Search the history as you type")
+		fmt.Fprintln(os.Stderr, "  Ctrl + x Ctrl + e   Write the message in $EDITOR")
+		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "  Ctrl + l            Clear the screen")
 		fmt.Fprintln(os.Stderr, "  Ctrl + c            Stop the model from responding")
 		fmt.Fprintln(os.Stderr, "  Ctrl + d            Exit ollama (/bye)")
@@ -122,6 +127,27 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		scanner.HistoryDisable()
 	}
 
+	scanner.Completer = func(line string) []string {
+		return complete(line, func() []string {
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return nil
+			}
+
+			resp, err := client.List(cmd.Context())
+			if err != nil {
+				return nil
+			}
+
+			var models []string
+			for _, m := range resp.Models {
+				models = append(models, m.Name)
+			}
+
+			return models
+		})
+	}
+
 	fmt.Print(readline.StartBracketedPaste)
 	defer fmt.Printf(readline.EndBracketedPaste)
 
@@ -454,6 +480,111 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 	}
 }
 
+var (
+	interactiveCommands = []string{"/set", "/show", "/load", "/save", "/clear", "/list", "/bye", "/help"}
+	setCommands         = []string{"parameter", "system", "history", "nohistory", "wordwrap", "nowordwrap", "format", "noformat", "verbose", "quiet"}
+	showCommands        = []string{"info", "license", "modelfile", "parameters", "system", "template"}
+)
+
+// complete returns the completions of the last word of line. Models are
+// only listed when a model name is being completed.
+func complete(line string, models func() []string) []string {
+	args := strings.Fields(line)
+	if len(args) == 0 || strings.HasSuffix(line, " ") {
+		args = append(args, "")
+	}
+
+	word := args[len(args)-1]
+
+	var candidates []string
+	switch {
+	case len(args) == 1 && strings.HasPrefix(word, "/") && !strings.Contains(word[1:], "/"):
+		candidates = interactiveCommands
+	case len(args) == 2 && args[0] == "/set":
+		candidates = setCommands
+	case len(args) == 2 && args[0] == "/show":
+		candidates = showCommands
+	case len(args) == 3 && args[0] == "/set" && args[1] == "parameter":
+		candidates = parameterNames()
+	case len(args) == 2 && (args[0] == "/load" || args[0] == "/save"):
+		candidates = models()
+	}
+
+	var completions []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, c)
+		}
+	}
+
+	if len(completions) == 0 && isPath(word) {
+		completions = completePath(word)
+	}
+
+	return completions
+}
+
+// parameterNames returns the names of the options that can be set with
+// /set parameter.
+func parameterNames() []string {
+	var names []string
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(api.Options{})) {
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+func isPath(s string) bool {
+	for _, prefix := range []string{"/", "./", "../", "~/"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return filepath.IsAbs(s)
+}
+
+// completePath returns the files and directories starting with path.
+// Hidden files are only completed if path names one.
+func completePath(path string) []string {
+	dir, base := filepath.Split(path)
+
+	root := dir
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+
+		root = filepath.Join(home, rest)
+	}
+
+	entries, err := os.ReadDir(cmp.Or(root, "."))
+	if err != nil {
+		return nil
+	}
+
+	var completions []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		if entry.IsDir() {
+			name += "/"
+		}
+
+		completions = append(completions, dir+strings.ReplaceAll(name, " ", "\\ "))
+	}
+
+	return completions
+}
+
 func NewCreateRequest(name string, opts runOptions) *api.CreateRequest {
 	req := &api.CreateRequest{
 		Name: name,
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -50,3 +53,51 @@ d:\path with\spaces\seven.JPEG inbetween7 c:\users\jdoe\eight.png inbetween8
 	assert.Contains(t, res[9], "ten.PNG")
 	assert.Contains(t, res[9], "E:")
 }
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"image.png", "images/", "notes.txt", ".hidden"} {
+		if strings.HasSuffix(name, "/") {
+			if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var listed bool
+	models := func() []string {
+		listed = true
+		return []string{"llama3.2:latest", "llava:latest", "mistral:latest"}
+	}
+
+	cases := []struct {
+		line   string
+		expect []string
+	}{
+		{"/s", []string{"/set", "/show", "/save"}},
+		{"/se", []string{"/set"}},
+		{"/set ", setCommands},
+		{"/set no", []string{"nohistory", "nowordwrap", "noformat"}},
+		{"/show mod", []string{"modelfile"}},
+		{"/set parameter temp", []string{"temperature"}},
+		{"/set parameter num_c", []string{"num_ctx"}},
+		{"/load ll", []string{"llama3.2:latest", "llava:latest"}},
+		{"/save m", []string{"mistral:latest"}},
+		{"describe " + dir + "/im", []string{dir + "/image.png", dir + "/images/"}},
+		{"describe " + dir + "/.h", []string{dir + "/.hidden"}},
+		{"describe " + dir + "/x", nil},
+		{"hello wor", nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.expect, complete(tt.line, models))
+		})
+	}
+
+	listed = false
+	complete("/set parameter ", models)
+	assert.False(t, listed, "models should only be listed when completing a model name")
+}
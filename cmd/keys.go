@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func newKeysCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keys",
+		Short: "List the server's API keys and their usage",
+		Long: `List the server's API keys and their usage.
+
+The keys are read by the server from the file named by OLLAMA_API_KEYS.
+Listing them requires a key with the admin scope in OLLAMA_API_KEY. Usage
+is counted from when the server started.`,
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    KeysHandler,
+	}
+}
+
+// formatLimit formats a per-minute limit, where zero is unlimited
+func formatLimit(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10) + "/min"
+}
+
+func KeysHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListKeys(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Keys) == 0 {
+		fmt.Println("the server doesn't require API keys")
+		return nil
+	}
+
+	var data [][]string
+	for _, k := range resp.Keys {
+		data = append(data, []string{
+			k.Name,
+			k.Scope,
+			formatLimit(k.RequestsPerMinute),
+			formatLimit(k.TokensPerMinute),
+			strconv.FormatInt(k.Requests, 10),
+			strconv.FormatInt(k.PromptTokens+k.EvalTokens, 10),
+		})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "SCOPE", "REQUEST LIMIT", "TOKEN LIMIT", "REQUESTS", "TOKENS"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
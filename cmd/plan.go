@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+func PlanHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.PlanRequest{Model: args[0], Options: map[string]any{}}
+
+	if cmd.Flags().Changed("ctx") {
+		numCtx, err := cmd.Flags().GetInt("ctx")
+		if err != nil {
+			return err
+		}
+		req.Options["num_ctx"] = numCtx
+	}
+
+	if cmd.Flags().Changed("gpu") {
+		numGPU, err := cmd.Flags().GetInt("gpu")
+		if err != nil {
+			return err
+		}
+		req.Options["num_gpu"] = numGPU
+	}
+
+	req.NumParallel, err = cmd.Flags().GetInt("parallel")
+	if err != nil {
+		return err
+	}
+
+	plan, err := client.Plan(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	return printPlan(os.Stdout, plan)
+}
+
+func printPlan(w io.Writer, plan *api.PlanResponse) error {
+	newTable := func() *tablewriter.Table {
+		table := tablewriter.NewWriter(w)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("    ")
+		return table
+	}
+
+	context := strconv.Itoa(plan.NumCtx)
+	if plan.NumParallel > 1 {
+		context = fmt.Sprintf("%d (%d parallel x %d)", plan.NumCtx, plan.NumParallel, plan.NumCtx/plan.NumParallel)
+	}
+
+	summary := newTable()
+	summary.AppendBulk([][]string{
+		{"model", plan.Model},
+		{"processor", processorString(plan.Size, plan.SizeVRAM)},
+		{"layers", fmt.Sprintf("%d/%d offloaded", plan.Layers, plan.TotalLayers)},
+		{"context", context},
+		{"kv cache", fmt.Sprintf("%s (%s)", format.HumanBytes(plan.KVCache), plan.KVCacheType)},
+		{"graph", format.HumanBytes(plan.Graph)},
+	})
+	if plan.Projector > 0 {
+		summary.Append([]string{"projector", format.HumanBytes(plan.Projector)})
+	}
+	summary.Append([]string{"size", format.HumanBytes(plan.Size)})
+	if plan.Loaded {
+		summary.Append([]string{"status", "already loaded"})
+	}
+	summary.Render()
+
+	if len(plan.GPUs) > 0 {
+		fmt.Fprintln(w)
+		gpus := newTable()
+		gpus.SetHeader([]string{"GPU", "LIBRARY", "NAME", "LAYERS", "SIZE", "FREE"})
+		for _, gpu := range plan.GPUs {
+			gpus.Append([]string{gpu.ID, gpu.Library, gpu.Name, strconv.Itoa(gpu.Layers), format.HumanBytes(gpu.Size), format.HumanBytes(gpu.Free)})
+		}
+		gpus.Render()
+	}
+
+	if len(plan.Evict) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Loading would unload: %s\n", strings.Join(plan.Evict, ", "))
+	}
+
+	return nil
+}
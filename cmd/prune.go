@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+func newPruneCmd() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove models that haven't been used recently",
+		Long: `Remove models that haven't been used recently.
+
+With --older-than, the models not used for longer than the duration are
+removed. If the server has a store quota (OLLAMA_STORE_QUOTA), the least
+recently used models are also removed until the store fits in it. Models
+pinned by the server's policy (OLLAMA_POLICY) are never removed.`,
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    PruneHandler,
+	}
+
+	pruneCmd.Flags().String("older-than", "", "Remove models not used for longer than this (e.g. 30d, 12h)")
+	pruneCmd.Flags().Bool("dry-run", false, "List the models that would be removed without removing them")
+
+	return pruneCmd
+}
+
+// parseAge parses a duration such as "12h" or "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return d, nil
+}
+
+func PruneHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	var req api.PruneRequest
+	req.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+	if s, _ := cmd.Flags().GetString("older-than"); s != "" {
+		d, err := parseAge(s)
+		if err != nil {
+			return err
+		} else if d == 0 {
+			return errors.New("--older-than must be greater than zero")
+		}
+
+		req.OlderThan = &api.Duration{Duration: d}
+	}
+
+	resp, err := client.Prune(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Models) == 0 {
+		fmt.Println("no models to remove")
+		return nil
+	}
+
+	var data [][]string
+	for _, m := range resp.Models {
+		data = append(data, []string{m.Name, format.HumanTime(m.LastUsed, "Never"), format.HumanBytes(m.Size)})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "LAST USED", "SIZE"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	if req.DryRun {
+		fmt.Printf("\nwould free %s\n", format.HumanBytes(resp.Size))
+	} else {
+		fmt.Printf("\nfreed %s\n", format.HumanBytes(resp.Size))
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+func newPullsCmd() *cobra.Command {
+	pullsCmd := &cobra.Command{
+		Use:   "pulls [MODEL]",
+		Short: "List, pause, resume or cancel model pulls",
+		Long: `List, pause, resume or cancel model pulls.
+
+Pulls run on the server and continue if 'ollama pull' is interrupted. They
+are queued when more than OLLAMA_MAX_PULLS models are pulled at once, and the
+pulls that haven't completed are resumed when the server restarts.
+
+With no arguments, the pulls are listed. With MODEL and a flag, its pull is
+paused, resumed or canceled.`,
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    PullsHandler,
+	}
+
+	pullsCmd.Flags().Bool("pause", false, "Pause the pull, keeping the data downloaded so far")
+	pullsCmd.Flags().Bool("resume", false, "Resume the paused pull")
+	pullsCmd.Flags().Bool("cancel", false, "Cancel the pull and remove the data downloaded so far")
+	pullsCmd.MarkFlagsMutuallyExclusive("pause", "resume", "cancel")
+
+	return pullsCmd
+}
+
+func PullsHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	pause, _ := cmd.Flags().GetBool("pause")
+	resume, _ := cmd.Flags().GetBool("resume")
+	cancel, _ := cmd.Flags().GetBool("cancel")
+
+	if pause || resume || cancel {
+		if len(args) != 1 {
+			return errors.New("a model is required")
+		}
+
+		req := &api.PullControlRequest{Model: args[0]}
+		switch {
+		case pause:
+			err = client.PausePull(cmd.Context(), req)
+		case resume:
+			err = client.ResumePull(cmd.Context(), req)
+		case cancel:
+			err = client.CancelPull(cmd.Context(), req)
+		}
+
+		return err
+	}
+
+	resp, err := client.ListPulls(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, p := range resp.Pulls {
+		if len(args) == 1 && p.Model != args[0] {
+			continue
+		}
+
+		progress := "-"
+		if p.Total > 0 {
+			progress = fmt.Sprintf("%s/%s", format.HumanBytes(p.Completed), format.HumanBytes(p.Total))
+		}
+
+		limit := "-"
+		if p.Limit > 0 {
+			limit = format.HumanBytes(p.Limit) + "/s"
+		}
+
+		data = append(data, []string{p.Model, p.Status, progress, limit})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "STATUS", "PROGRESS", "LIMIT"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
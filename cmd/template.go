@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func newTemplateCmd() *cobra.Command {
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Inspect model templates",
+	}
+
+	renderCmd := &cobra.Command{
+		Use:   "render MODEL [PROMPT]",
+		Short: "Render the prompt a model would see for a chat request",
+		Long: `Render the prompt a model would see for a chat request.
+
+The prompt is written to stdout exactly as it is passed to the model. The
+token count and any warnings about the template are written to stderr.
+
+Messages are read from --messages as a JSON list of messages or as an
+/api/chat request body, which may also set tools and truncation. A PROMPT
+argument is appended as a user message.`,
+		Args:    cobra.RangeArgs(1, 2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    TemplateRenderHandler,
+	}
+
+	renderCmd.Flags().StringP("messages", "m", "", "JSON file with the messages to render, or - for stdin")
+	renderCmd.Flags().String("tools", "", "JSON file with a list of tools to render")
+	renderCmd.Flags().String("system", "", "Override the model's system message")
+	renderCmd.Flags().String("template", "", "File with a template to use in place of the model's template")
+	renderCmd.Flags().Int("ctx", 0, "Context length used to truncate the messages (num_ctx)")
+	renderCmd.Flags().Bool("json", false, "Output the result as JSON")
+
+	templateCmd.AddCommand(renderCmd)
+	return templateCmd
+}
+
+func TemplateRenderHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.TemplateRenderRequest{Model: args[0], Options: map[string]any{}}
+
+	if path, _ := cmd.Flags().GetString("messages"); path != "" {
+		bts, err := readFileOrStdin(path)
+		if err != nil {
+			return err
+		}
+
+		if err := decodeMessages(bts, &req); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if len(args) > 1 {
+		req.Messages = append(req.Messages, api.Message{Role: "user", Content: args[1]})
+	}
+
+	if len(req.Messages) == 0 {
+		return errors.New("no messages to render, pass a PROMPT or --messages")
+	}
+
+	if path, _ := cmd.Flags().GetString("tools"); path != "" {
+		bts, err := readFileOrStdin(path)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(bts, &req.Tools); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if path, _ := cmd.Flags().GetString("template"); path != "" {
+		bts, err := readFileOrStdin(path)
+		if err != nil {
+			return err
+		}
+
+		req.Template = string(bts)
+	}
+
+	req.System, err = cmd.Flags().GetString("system")
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flags().Changed("ctx") {
+		numCtx, err := cmd.Flags().GetInt("ctx")
+		if err != nil {
+			return err
+		}
+		req.Options["num_ctx"] = numCtx
+	}
+
+	resp, err := client.RenderTemplate(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	return printTemplateRender(os.Stdout, os.Stderr, resp)
+}
+
+// decodeMessages accepts either a bare list of messages or a chat request
+// so a request body can be rendered as is.
+func decodeMessages(bts []byte, req *api.TemplateRenderRequest) error {
+	if trimmed := strings.TrimSpace(string(bts)); strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(bts, &req.Messages)
+	}
+
+	var chat api.ChatRequest
+	if err := json.Unmarshal(bts, &chat); err != nil {
+		return err
+	}
+
+	req.Messages = chat.Messages
+	req.Tools = chat.Tools
+	req.Truncation = chat.Truncation
+	return nil
+}
+
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(path)
+}
+
+func printTemplateRender(stdout, stderr io.Writer, resp *api.TemplateRenderResponse) error {
+	if _, err := io.WriteString(stdout, resp.Prompt); err != nil {
+		return err
+	}
+
+	// keep the summary on its own line when the prompt doesn't end with one
+	if !strings.HasSuffix(resp.Prompt, "\n") {
+		fmt.Fprintln(stderr)
+	}
+
+	fmt.Fprintf(stderr, "\n%d tokens\n", resp.Tokens)
+	if len(resp.Truncated) > 0 {
+		fmt.Fprintf(stderr, "truncated %d messages to fit the context window: %v\n", len(resp.Truncated), resp.Truncated)
+	}
+	for _, warning := range resp.Warnings {
+		fmt.Fprintf(stderr, "warning: %s\n", warning)
+	}
+
+	return nil
+}
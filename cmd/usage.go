@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func newUsageCmd() *cobra.Command {
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show the tokens and GPU time used by each user",
+		Long: `Show the tokens and GPU time used by each user, model and day.
+
+Users are identified by their API key, or by the OLLAMA_USAGE_HEADER header
+if the server doesn't require keys. Keys without the admin scope only see
+their own usage. Monthly token quotas (OLLAMA_USAGE_QUOTAS) are listed with
+the tokens used this month.`,
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    UsageHandler,
+	}
+
+	usageCmd.Flags().String("identity", "", "Only show the usage of this user")
+	usageCmd.Flags().String("from", "", "First day to show, as YYYY-MM-DD (default the first day of the month)")
+	usageCmd.Flags().String("to", "", "Last day to show, as YYYY-MM-DD (default today)")
+
+	return usageCmd
+}
+
+func UsageHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	var req api.UsageRequest
+	req.Identity, _ = cmd.Flags().GetString("identity")
+	req.From, _ = cmd.Flags().GetString("from")
+	req.To, _ = cmd.Flags().GetString("to")
+
+	resp, err := client.Usage(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Usage) == 0 {
+		fmt.Println("no usage recorded")
+	} else {
+		var data [][]string
+		for _, u := range resp.Usage {
+			data = append(data, []string{
+				u.Day,
+				u.Identity,
+				u.Model,
+				strconv.FormatInt(u.Requests, 10),
+				strconv.FormatInt(u.PromptTokens, 10),
+				strconv.FormatInt(u.EvalTokens, 10),
+				strconv.FormatFloat(u.GPUSeconds, 'f', 1, 64),
+			})
+		}
+
+		renderTable([]string{"DAY", "IDENTITY", "MODEL", "REQUESTS", "PROMPT TOKENS", "EVAL TOKENS", "GPU SECONDS"}, data)
+	}
+
+	if len(resp.Quotas) > 0 {
+		var data [][]string
+		for _, q := range resp.Quotas {
+			data = append(data, []string{
+				q.Identity,
+				strconv.FormatInt(q.Used, 10),
+				strconv.FormatInt(q.MonthlyTokens, 10),
+			})
+		}
+
+		fmt.Println()
+		renderTable([]string{"IDENTITY", "USED THIS MONTH", "MONTHLY QUOTA"}, data)
+	}
+
+	return nil
+}
+
+func renderTable(header []string, data [][]string) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("    ")
+	table.AppendBulk(data)
+	table.Render()
+}
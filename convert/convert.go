@@ -144,11 +144,16 @@ func ConvertAdapter(fsys fs.FS, ws io.WriteSeeker, baseKV ggml.KV) error {
 		return errors.New("unsupported architecture")
 	}
 
-	ts, err := parseTensors(fsys, strings.NewReplacer(conv.Replacements()...))
+	replacer := strings.NewReplacer(conv.Replacements()...)
+	ts, err := parseTensors(fsys, replacer)
 	if err != nil {
 		return err
 	}
 
+	if err := validateTensors(fsys, replacer, conv, nil, ts, nil); err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal(bts, conv); err != nil {
 		return err
 	}
@@ -160,7 +165,13 @@ func ConvertAdapter(fsys fs.FS, ws io.WriteSeeker, baseKV ggml.KV) error {
 // and files it finds in the input path.
 // Supported input model formats include safetensors.
 // Supported input tokenizers files include tokenizer.json (preferred) and tokenizer.model.
-func ConvertModel(fsys fs.FS, ws io.WriteSeeker) error {
+// Problems that don't prevent the conversion are passed to warn, or logged if
+// warn is nil.
+func ConvertModel(fsys fs.FS, ws io.WriteSeeker, warn func(error)) error {
+	if warn == nil {
+		warn = func(err error) { slog.Warn(err.Error()) }
+	}
+
 	bts, err := fs.ReadFile(fsys, "config.json")
 	if err != nil {
 		return err
@@ -227,10 +238,15 @@ func ConvertModel(fsys fs.FS, ws io.WriteSeeker) error {
 		slog.Debug("vocabulary", "size", len(t.Vocabulary.Tokens))
 	}
 
-	ts, err := parseTensors(fsys, strings.NewReplacer(conv.Replacements()...))
+	replacer := strings.NewReplacer(conv.Replacements()...)
+	ts, err := parseTensors(fsys, replacer)
 	if err != nil {
 		return err
 	}
 
+	if err := validateTensors(fsys, replacer, conv, bts, ts, warn); err != nil {
+		return err
+	}
+
 	return conv.writeFile(ws, conv.KV(t), conv.Tensors(ts))
 }
@@ -167,6 +167,44 @@ func (p *llamaModel) Replacements() []string {
 	}
 }
 
+func (p *llamaModel) expectedShapes() map[string][]uint64 {
+	embd := uint64(cmp.Or(p.HiddenSize, p.NEmbd))
+	heads := uint64(cmp.Or(p.NumAttentionHeads, p.NHead))
+	if embd == 0 || heads == 0 {
+		return nil
+	}
+
+	headsKV := cmp.Or(uint64(p.NumKeyValueHeads), heads)
+	headDim := cmp.Or(uint64(p.HeadDim), embd/heads)
+	ff := uint64(cmp.Or(p.IntermediateSize, p.NInner))
+
+	shapes := map[string][]uint64{
+		"output_norm.weight": {embd},
+	}
+
+	if vocab := uint64(p.VocabSize); vocab > 0 {
+		shapes["token_embd.weight"] = []uint64{vocab, embd}
+		shapes["output.weight"] = []uint64{vocab, embd}
+	}
+
+	for i := range cmp.Or(p.NLayers, p.NumHiddenLayers, p.NLayer) {
+		blk := fmt.Sprintf("blk.%d.", i)
+		shapes[blk+"attn_norm.weight"] = []uint64{embd}
+		shapes[blk+"ffn_norm.weight"] = []uint64{embd}
+		shapes[blk+"attn_q.weight"] = []uint64{heads * headDim, embd}
+		shapes[blk+"attn_k.weight"] = []uint64{headsKV * headDim, embd}
+		shapes[blk+"attn_v.weight"] = []uint64{headsKV * headDim, embd}
+		shapes[blk+"attn_output.weight"] = []uint64{embd, heads * headDim}
+		if ff > 0 {
+			shapes[blk+"ffn_gate.weight"] = []uint64{ff, embd}
+			shapes[blk+"ffn_up.weight"] = []uint64{ff, embd}
+			shapes[blk+"ffn_down.weight"] = []uint64{embd, ff}
+		}
+	}
+
+	return shapes
+}
+
 func (p *llamaModel) repack(name string, data []float32, shape []uint64) ([]float32, error) {
 	var dims []int
 	for _, dim := range shape {
@@ -24,6 +24,7 @@ type safetensorMetadata struct {
 
 func parseSafetensors(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]Tensor, error) {
 	var ts []Tensor
+	names := make(map[string]string)
 	for _, p := range ps {
 		f, err := fsys.Open(p)
 		if err != nil {
@@ -49,8 +50,6 @@ func parseSafetensors(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]T
 		keys := maps.Keys(headers)
 		slices.Sort(keys)
 
-		names := make(map[string]struct{}, len(keys))
-
 		for _, key := range keys {
 			if value := headers[key]; value.Type != "" {
 				// bitsandbytes quantized models are unsupported
@@ -58,10 +57,13 @@ func parseSafetensors(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]T
 					return nil, errors.New("unsupported safetensors model")
 				}
 				ggufName := replacer.Replace(key)
-				if _, ok := names[ggufName]; ok {
+				if other, ok := names[ggufName]; ok {
+					if other != p {
+						return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model in %s and %s", ggufName, other, p)
+					}
 					return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model", ggufName)
 				}
-				names[ggufName] = struct{}{}
+				names[ggufName] = p
 				ts = append(ts, safetensor{
 					fs:     fsys,
 					path:   p,
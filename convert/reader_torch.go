@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"fmt"
 	"io"
 	"io/fs"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 func parseTorch(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]Tensor, error) {
 	var ts []Tensor
+	names := make(map[string]string)
 	for _, p := range ps {
 		pt, err := pytorch.Load(p)
 		if err != nil {
@@ -18,17 +20,32 @@ func parseTorch(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]Tensor,
 		}
 
 		for _, k := range pt.(*types.Dict).Keys() {
-			t := pt.(*types.Dict).MustGet(k)
+			t := pt.(*types.Dict).MustGet(k).(*pytorch.Tensor)
 
 			var shape []uint64
-			for dim := range t.(*pytorch.Tensor).Size {
+			for _, dim := range t.Size {
 				shape = append(shape, uint64(dim))
 			}
 
+			name := replacer.Replace(k.(string))
+			if other, ok := names[name]; ok {
+				if other != p {
+					return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model in %s and %s", name, other, p)
+				}
+				return nil, fmt.Errorf("duplicate tensor name '%s' was found for this model", name)
+			}
+			names[name] = p
+
+			dtype, length := torchStorage(t.Source)
 			ts = append(ts, torch{
-				storage: t.(*pytorch.Tensor).Source,
+				storage:       t.Source,
+				path:          p,
+				dtype:         dtype,
+				storageOffset: t.StorageOffset,
+				storageLength: length,
+				stride:        t.Stride,
 				tensorBase: &tensorBase{
-					name:  replacer.Replace(k.(string)),
+					name:  name,
 					shape: shape,
 				},
 			})
@@ -38,11 +55,66 @@ func parseTorch(fsys fs.FS, replacer *strings.Replacer, ps ...string) ([]Tensor,
 	return ts, nil
 }
 
+// torchStorage returns the safetensors dtype of the elements of s, or its Go
+// type if it has no safetensors equivalent, and the number of elements read
+// into s
+func torchStorage(s pytorch.StorageInterface) (string, int) {
+	switch s := s.(type) {
+	case *pytorch.FloatStorage:
+		return "F32", len(s.Data)
+	case *pytorch.HalfStorage:
+		return "F16", len(s.Data)
+	case *pytorch.BFloat16Storage:
+		return "BF16", len(s.Data)
+	case *pytorch.DoubleStorage:
+		return "F64", len(s.Data)
+	case *pytorch.CharStorage:
+		return "I8", len(s.Data)
+	case *pytorch.ShortStorage:
+		return "I16", len(s.Data)
+	case *pytorch.IntStorage:
+		return "I32", len(s.Data)
+	case *pytorch.LongStorage:
+		return "I64", len(s.Data)
+	case *pytorch.ByteStorage:
+		return "U8", len(s.Data)
+	case *pytorch.BoolStorage:
+		return "BOOL", len(s.Data)
+	default:
+		return fmt.Sprintf("%T", s), 0
+	}
+}
+
 type torch struct {
 	storage pytorch.StorageInterface
+	path    string
+	dtype   string
+
+	// storageOffset and stride locate the elements of the tensor in its
+	// storage, which holds storageLength elements
+	storageOffset int
+	storageLength int
+	stride        []int
+
 	*tensorBase
 }
 
+// extent returns the number of storage elements needed to hold the tensor
+func (pt torch) extent() int {
+	n := pt.storageOffset + 1
+	for i, dim := range pt.shape {
+		if dim == 0 {
+			return pt.storageOffset
+		}
+
+		if i < len(pt.stride) {
+			n += (int(dim) - 1) * pt.stride[i]
+		}
+	}
+
+	return n
+}
+
 func (pt torch) WriteTo(w io.Writer) (int64, error) {
 	return 0, nil
 }
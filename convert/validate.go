@@ -0,0 +1,371 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// ValidationError is returned by ConvertModel and ConvertAdapter when the
+// input checkpoint is incomplete or inconsistent. It lists every problem found
+// rather than only the first.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid model: " + e.Problems[0].Error()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid model: %d problems found", len(e.Problems))
+	for _, p := range e.Problems {
+		sb.WriteString("\n  ")
+		sb.WriteString(p.Error())
+	}
+
+	return sb.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// tensorShaper is implemented by converters that know the shapes of the input
+// tensors they expect. Shapes are keyed by tensor name after replacements and
+// are in the checkpoint's order, not the GGUF order.
+type tensorShaper interface {
+	expectedShapes() map[string][]uint64
+}
+
+// shardIndex is the layout of model.safetensors.index.json and
+// pytorch_model.bin.index.json
+type shardIndex struct {
+	WeightMap map[string]string `json:"weight_map"`
+}
+
+var shardPattern = regexp.MustCompile(`^(.*)-(\d+)-of-(\d+)\.(safetensors|bin)$`)
+
+// safetensorsTypeSize is the size in bytes of each dtype WriteTo can read
+var safetensorsTypeSize = map[string]int64{
+	"F32":  4,
+	"F16":  2,
+	"BF16": 2,
+}
+
+// torchDTypes maps the torch_dtype of config.json to safetensors dtypes
+var torchDTypes = map[string]string{
+	"float32":  "F32",
+	"float16":  "F16",
+	"bfloat16": "BF16",
+}
+
+// checkpointConfig is the part of config.json used to validate tensors
+type checkpointConfig struct {
+	TorchDType      string `json:"torch_dtype"`
+	VocabSize       uint64 `json:"vocab_size"`
+	HiddenSize      uint64 `json:"hidden_size"`
+	NEmbd           uint64 `json:"n_embd"`
+	DModel          uint64 `json:"d_model"`
+	NumHiddenLayers uint32 `json:"num_hidden_layers"`
+	NLayers         uint32 `json:"n_layers"`
+	NLayer          uint32 `json:"n_layer"`
+}
+
+func (c checkpointConfig) blockCount() uint32 {
+	return cmp.Or(c.NumHiddenLayers, c.NLayers, c.NLayer)
+}
+
+// shapes returns the shapes config.json implies for tensors every
+// architecture names the same way
+func (c checkpointConfig) shapes() map[string][]uint64 {
+	shapes := make(map[string][]uint64)
+
+	embd := cmp.Or(c.HiddenSize, c.NEmbd, c.DModel)
+	if embd == 0 {
+		return shapes
+	}
+
+	shapes["output_norm.weight"] = []uint64{embd}
+
+	if c.VocabSize > 0 {
+		shapes["token_embd.weight"] = []uint64{c.VocabSize, embd}
+	}
+
+	for i := range c.blockCount() {
+		shapes[fmt.Sprintf("blk.%d.attn_norm.weight", i)] = []uint64{embd}
+	}
+
+	return shapes
+}
+
+// validateTensors checks the parsed tensors against the files in fsys,
+// against config.json if it's set, and, if conv implements tensorShaper,
+// against the shapes the converter expects. Weight matrices whose dtype
+// differs from the torch_dtype of config.json are passed to warn rather than
+// failing the validation, since the tensors are converted from their own
+// dtype.
+func validateTensors(fsys fs.FS, replacer *strings.Replacer, conv any, config []byte, ts []Tensor, warn func(error)) error {
+	var problems []error
+
+	var c checkpointConfig
+	if config != nil {
+		if err := json.Unmarshal(config, &c); err != nil {
+			return fmt.Errorf("config.json: %w", err)
+		}
+	}
+
+	problems = append(problems, validateShards(fsys, replacer, ts)...)
+
+	for _, t := range ts {
+		pt, ok := t.(torch)
+		if !ok {
+			continue
+		}
+
+		if _, ok := safetensorsTypeSize[pt.dtype]; !ok {
+			problems = append(problems, fmt.Errorf("%s: tensor %s has unsupported dtype %s", pt.path, pt.Name(), pt.dtype))
+			continue
+		}
+
+		if n := pt.extent(); n > pt.storageLength {
+			problems = append(problems, fmt.Errorf("%s: tensor %s needs %d elements but its storage has only %d; the file may be truncated", pt.path, pt.Name(), n, pt.storageLength))
+		}
+	}
+
+	// norms and biases are often kept in float32 whatever the checkpoint's
+	// dtype, so only weight matrices are compared with torch_dtype
+	if want, ok := torchDTypes[c.TorchDType]; ok {
+		for _, t := range ts {
+			var path, dtype string
+			switch t := t.(type) {
+			case safetensor:
+				path, dtype = t.path, t.dtype
+			case torch:
+				path, dtype = t.path, t.dtype
+			default:
+				continue
+			}
+
+			if len(t.Shape()) >= 2 && dtype != want {
+				warn(fmt.Errorf("%s: tensor %s is %s but config.json declares torch_dtype %s", path, t.Name(), dtype, c.TorchDType))
+			}
+		}
+	}
+
+	sizes := make(map[string]int64)
+	for _, t := range ts {
+		st, ok := t.(safetensor)
+		if !ok {
+			continue
+		}
+
+		typeSize, ok := safetensorsTypeSize[st.dtype]
+		if !ok {
+			problems = append(problems, fmt.Errorf("%s: tensor %s has unsupported dtype %s", st.path, st.Name(), st.dtype))
+			continue
+		}
+
+		elements := int64(1)
+		for _, n := range st.Shape() {
+			elements *= int64(n)
+		}
+
+		if st.size != elements*typeSize {
+			problems = append(problems, fmt.Errorf("%s: tensor %s is %d bytes but shape %v of %s needs %d bytes", st.path, st.Name(), st.size, st.Shape(), st.dtype, elements*typeSize))
+		}
+
+		size, ok := sizes[st.path]
+		if !ok {
+			fi, err := fs.Stat(fsys, st.path)
+			if err != nil {
+				problems = append(problems, err)
+				continue
+			}
+
+			size = fi.Size()
+			sizes[st.path] = size
+		}
+
+		if end := st.offset + st.size; end > size {
+			problems = append(problems, fmt.Errorf("%s: tensor %s ends at byte %d but the file is only %d bytes; the file may be truncated", st.path, st.Name(), end, size))
+		}
+	}
+
+	if blockCount := c.blockCount(); blockCount > 0 {
+		seen := make(map[uint64]bool)
+		for _, t := range ts {
+			if n, ok := blockIndex(t.Name()); ok {
+				if n >= uint64(blockCount) {
+					problems = append(problems, fmt.Errorf("tensor %s is outside the %d layers declared in config.json", t.Name(), blockCount))
+				}
+				seen[n] = true
+			}
+		}
+
+		if len(seen) > 0 {
+			for i := range uint64(blockCount) {
+				if !seen[i] {
+					problems = append(problems, fmt.Errorf("no tensors found for layer %d", i))
+				}
+			}
+		}
+	}
+
+	expected := c.shapes()
+	if shaper, ok := conv.(tensorShaper); ok {
+		// the converter knows its layout better than the generic shapes
+		maps.Copy(expected, shaper.expectedShapes())
+	}
+
+	for _, t := range ts {
+		if want, ok := expected[t.Name()]; ok && !slices.Equal(t.Shape(), want) {
+			problems = append(problems, fmt.Errorf("tensor %s has shape %v, expected %v", t.Name(), t.Shape(), want))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// validateShards checks that every shard of a sharded checkpoint is present
+// and, if a shard index exists, that it agrees with the parsed tensors.
+func validateShards(fsys fs.FS, replacer *strings.Replacer, ts []Tensor) []error {
+	var problems []error
+
+	for _, pattern := range []string{"*.safetensors", "*.bin"} {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return []error{err}
+		}
+
+		groups := make(map[string]map[int]bool)
+		totals := make(map[string]int)
+		for _, m := range matches {
+			parts := shardPattern.FindStringSubmatch(m)
+			if parts == nil {
+				continue
+			}
+
+			prefix := parts[1] + "." + parts[4]
+			n, _ := strconv.Atoi(parts[2])
+			total, _ := strconv.Atoi(parts[3])
+			if _, ok := groups[prefix]; !ok {
+				groups[prefix] = make(map[int]bool)
+			}
+			groups[prefix][n] = true
+			totals[prefix] = max(totals[prefix], total)
+		}
+
+		prefixes := maps.Keys(groups)
+		slices.Sort(prefixes)
+
+		for _, prefix := range prefixes {
+			for i := 1; i <= totals[prefix]; i++ {
+				if !groups[prefix][i] {
+					name, ext, _ := strings.Cut(prefix, ".")
+					problems = append(problems, fmt.Errorf("missing shard %s-%05d-of-%05d.%s", name, i, totals[prefix], ext))
+				}
+			}
+		}
+	}
+
+	paths := make(map[string]string)
+	for _, t := range ts {
+		if st, ok := t.(safetensor); ok {
+			paths[st.Name()] = st.path
+		}
+	}
+
+	for _, name := range []string{"model.safetensors.index.json", "pytorch_model.bin.index.json"} {
+		bts, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return append(problems, err)
+		}
+
+		var index shardIndex
+		if err := json.Unmarshal(bts, &index); err != nil {
+			return append(problems, fmt.Errorf("%s: %w", name, err))
+		}
+
+		keys := maps.Keys(index.WeightMap)
+		slices.Sort(keys)
+
+		missing := make(map[string]bool)
+		for _, key := range keys {
+			file := index.WeightMap[key]
+			if _, ok := missing[file]; ok {
+				continue
+			}
+
+			_, err := fs.Stat(fsys, file)
+			missing[file] = err != nil
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s references missing shard %s", name, file))
+			}
+		}
+
+		// the index uses checkpoint names; pytorch tensors don't carry their
+		// file so only safetensors can be cross-checked
+		if !strings.HasSuffix(name, ".safetensors.index.json") {
+			continue
+		}
+
+		indexed := make(map[string]bool, len(index.WeightMap))
+		for _, key := range keys {
+			file := index.WeightMap[key]
+			tensor := replacer.Replace(key)
+			indexed[tensor] = true
+			if missing[file] {
+				continue
+			}
+
+			if path, ok := paths[tensor]; !ok {
+				problems = append(problems, fmt.Errorf("tensor %s listed in %s was not found in %s", key, name, file))
+			} else if path != file {
+				problems = append(problems, fmt.Errorf("tensor %s listed in %s for %s was found in %s", key, name, file, path))
+			}
+		}
+
+		tensors := maps.Keys(paths)
+		slices.Sort(tensors)
+
+		for _, tensor := range tensors {
+			if !indexed[tensor] {
+				problems = append(problems, fmt.Errorf("tensor %s in %s is not listed in %s", tensor, paths[tensor], name))
+			}
+		}
+	}
+
+	return problems
+}
+
+// blockIndex returns the layer number of a tensor named blk.N.*
+func blockIndex(name string) (uint64, bool) {
+	rest, ok := strings.CutPrefix(name, "blk.")
+	if !ok {
+		return 0, false
+	}
+
+	n, _, ok := strings.Cut(rest, ".")
+	if !ok {
+		return 0, false
+	}
+
+	i, err := strconv.ParseUint(n, 10, 64)
+	return i, err == nil
+}
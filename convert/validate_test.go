@@ -0,0 +1,311 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/maps"
+)
+
+// writeSafetensors writes a safetensors file named name with zeroed F32
+// tensors of the given shapes, dropping the last truncate bytes
+func writeSafetensors(t *testing.T, dir, name string, shapes map[string][]int, truncate int) {
+	t.Helper()
+
+	keys := maps.Keys(shapes)
+	slices.Sort(keys)
+
+	td := make(map[string]*tensorData)
+	var offset int
+	for _, k := range keys {
+		n := 4
+		for _, d := range shapes[k] {
+			n *= d
+		}
+
+		td[k] = &tensorData{Offsets: []int{offset, offset + n}, Type: "F32", Shape: shapes[k]}
+		offset += n
+	}
+
+	header, err := json.Marshal(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, int64(len(header))); err != nil {
+		t.Fatal(err)
+	}
+	b.Write(header)
+	b.Write(make([]byte, offset-truncate))
+
+	if err := os.WriteFile(filepath.Join(dir, name), b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestLlama(t *testing.T, dir string, files map[string]map[string][]int) {
+	t.Helper()
+
+	for name, shapes := range files {
+		writeSafetensors(t, dir, name, shapes, 0)
+	}
+
+	config := `{
+		"architectures": ["LlamaForCausalLM"],
+		"vocab_size": 4,
+		"hidden_size": 8,
+		"intermediate_size": 16,
+		"num_attention_heads": 2,
+		"num_hidden_layers": 2
+	}`
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLlamaLayer(i string) map[string][]int {
+	return map[string][]int{
+		"model.layers." + i + ".input_layernorm.weight":          {8},
+		"model.layers." + i + ".self_attn.q_proj.weight":         {8, 8},
+		"model.layers." + i + ".self_attn.k_proj.weight":         {8, 8},
+		"model.layers." + i + ".self_attn.v_proj.weight":         {8, 8},
+		"model.layers." + i + ".self_attn.o_proj.weight":         {8, 8},
+		"model.layers." + i + ".post_attention_layernorm.weight": {8},
+		"model.layers." + i + ".mlp.gate_proj.weight":            {16, 8},
+		"model.layers." + i + ".mlp.up_proj.weight":              {16, 8},
+		"model.layers." + i + ".mlp.down_proj.weight":            {8, 16},
+	}
+}
+
+func TestConvertValidation(t *testing.T) {
+	shard1 := testLlamaLayer("0")
+	shard1["model.embed_tokens.weight"] = []int{4, 8}
+
+	shard2 := testLlamaLayer("1")
+	shard2["model.norm.weight"] = []int{8}
+
+	index := func(t *testing.T, dir string, weights map[string]string) {
+		t.Helper()
+
+		b, err := json.Marshal(shardIndex{WeightMap: weights})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "model.safetensors.index.json"), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fullIndex := make(map[string]string)
+	for k := range shard1 {
+		fullIndex[k] = "model-00001-of-00002.safetensors"
+	}
+	for k := range shard2 {
+		fullIndex[k] = "model-00002-of-00002.safetensors"
+	}
+
+	cases := []struct {
+		name     string
+		setup    func(t *testing.T, dir string)
+		want     []string
+		warnings int
+	}{
+		{
+			name: "valid",
+			setup: func(t *testing.T, dir string) {
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model-00001-of-00002.safetensors": shard1,
+					"model-00002-of-00002.safetensors": shard2,
+				})
+				index(t, dir, fullIndex)
+			},
+		},
+		{
+			name: "missing shard",
+			setup: func(t *testing.T, dir string) {
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model-00001-of-00002.safetensors": shard1,
+				})
+				index(t, dir, fullIndex)
+			},
+			want: []string{
+				"missing shard model-00002-of-00002.safetensors",
+				"model.safetensors.index.json references missing shard model-00002-of-00002.safetensors",
+				"no tensors found for layer 1",
+			},
+		},
+		{
+			name: "truncated",
+			setup: func(t *testing.T, dir string) {
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model-00001-of-00002.safetensors": shard1,
+				})
+				writeSafetensors(t, dir, "model-00002-of-00002.safetensors", shard2, 4)
+			},
+			want: []string{
+				"model-00002-of-00002.safetensors: tensor output_norm.weight ends at byte",
+			},
+		},
+		{
+			name: "index mismatch",
+			setup: func(t *testing.T, dir string) {
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model-00001-of-00002.safetensors": shard1,
+					"model-00002-of-00002.safetensors": shard2,
+				})
+
+				weights := maps.Clone(fullIndex)
+				weights["model.norm.weight"] = "model-00001-of-00002.safetensors"
+				delete(weights, "model.embed_tokens.weight")
+				index(t, dir, weights)
+			},
+			want: []string{
+				"tensor model.norm.weight listed in model.safetensors.index.json for model-00001-of-00002.safetensors was found in model-00002-of-00002.safetensors",
+				"tensor token_embd.weight in model-00001-of-00002.safetensors is not listed in model.safetensors.index.json",
+			},
+		},
+		{
+			name: "shape mismatch",
+			setup: func(t *testing.T, dir string) {
+				bad := maps.Clone(shard2)
+				bad["model.layers.1.self_attn.k_proj.weight"] = []int{4, 8}
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model-00001-of-00002.safetensors": shard1,
+					"model-00002-of-00002.safetensors": bad,
+				})
+			},
+			want: []string{
+				"tensor blk.1.attn_k.weight has shape [4 8], expected [8 8]",
+			},
+		},
+		{
+			name: "dtype mismatch",
+			setup: func(t *testing.T, dir string) {
+				writeTestLlama(t, dir, map[string]map[string][]int{
+					"model.safetensors": shard1,
+				})
+
+				config := `{"architectures": ["LlamaForCausalLM"], "torch_dtype": "bfloat16", "vocab_size": 4, "hidden_size": 8, "num_attention_heads": 2}`
+				if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			// checkpoints often declare another dtype than the one
+			// they're stored in, which doesn't affect the conversion
+			warnings: 8,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			f, err := os.CreateTemp(t.TempDir(), "f16")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var warnings []error
+			err = ConvertModel(os.DirFS(dir), f, func(err error) { warnings = append(warnings, err) })
+			if len(warnings) != tt.warnings {
+				t.Errorf("expected %d warnings, got %d: %v", tt.warnings, len(warnings), warnings)
+			}
+
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+
+			if len(verr.Problems) != len(tt.want) {
+				t.Errorf("expected %d problems, got %d: %v", len(tt.want), len(verr.Problems), verr)
+			}
+
+			for _, want := range tt.want {
+				if !slices.ContainsFunc(verr.Problems, func(p error) bool {
+					return strings.HasPrefix(p.Error(), want)
+				}) {
+					t.Errorf("missing problem %q in %v", want, verr)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTorch(t *testing.T) {
+	config := []byte(`{"torch_dtype": "float16", "hidden_size": 8}`)
+
+	tensor := func(name, dtype string, shape []uint64, stride []int, offset, length int) Tensor {
+		return torch{
+			path:          "pytorch_model.bin",
+			dtype:         dtype,
+			storageOffset: offset,
+			storageLength: length,
+			stride:        stride,
+			tensorBase:    &tensorBase{name: name, shape: shape},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		tensor Tensor
+		want   string
+	}{
+		{"valid", tensor("blk.0.attn_q.weight", "F16", []uint64{8, 8}, []int{8, 1}, 0, 64), ""},
+		{"view", tensor("blk.0.attn_q.weight", "F16", []uint64{4, 8}, []int{8, 1}, 32, 64), ""},
+		{"truncated", tensor("blk.0.attn_q.weight", "F16", []uint64{8, 8}, []int{8, 1}, 0, 60), "needs 64 elements but its storage has only 60"},
+		{"unsupported dtype", tensor("blk.0.attn_q.weight", "I64", []uint64{8}, []int{1}, 0, 8), "unsupported dtype I64"},
+		{"float32 norm", tensor("output_norm.weight", "F32", []uint64{8}, []int{1}, 0, 8), ""},
+		{"shape mismatch", tensor("output_norm.weight", "F16", []uint64{4}, []int{1}, 0, 4), "has shape [4], expected [8]"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTensors(os.DirFS(t.TempDir()), strings.NewReplacer(), nil, config, []Tensor{tt.tensor}, func(err error) { t.Error(err) })
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("dtype mismatch", func(t *testing.T) {
+		var warnings []error
+		mismatch := tensor("blk.0.attn_q.weight", "F32", []uint64{8, 8}, []int{8, 1}, 0, 64)
+		if err := validateTensors(os.DirFS(t.TempDir()), strings.NewReplacer(), nil, config, []Tensor{mismatch}, func(err error) { warnings = append(warnings, err) }); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "is F32 but config.json declares torch_dtype float16"; len(warnings) != 1 || !strings.Contains(warnings[0].Error(), want) {
+			t.Errorf("expected a warning containing %q, got %v", want, warnings)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/format"
+)
+
+// fakeMinimumMemory is the default minimum memory of simulated GPUs, matching
+// the minimum used for CUDA and ROCm devices
+const fakeMinimumMemory = 457 * format.MebiByte
+
+// FakeDevice describes a simulated GPU. Memory sizes are in bytes.
+type FakeDevice struct {
+	ID          string `json:"id"`
+	Library     string `json:"library"`
+	Variant     string `json:"variant,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Compute     string `json:"compute,omitempty"`
+	DriverMajor int    `json:"driver_major,omitempty"`
+	DriverMinor int    `json:"driver_minor,omitempty"`
+
+	TotalMemory uint64 `json:"total_memory"`
+
+	// FreeMemory defaults to TotalMemory
+	FreeMemory uint64 `json:"free_memory,omitempty"`
+
+	// MinimumMemory defaults to the minimum for CUDA and ROCm devices
+	MinimumMemory *uint64 `json:"minimum_memory,omitempty"`
+
+	UnreliableFreeMemory bool `json:"unreliable_free_memory,omitempty"`
+}
+
+// FakeSystem is the layout of the file read by FakeProvider
+type FakeSystem struct {
+	// CPU describes system memory, which defaults to the real memory of
+	// this system
+	CPU *struct {
+		TotalMemory uint64 `json:"total_memory"`
+		FreeMemory  uint64 `json:"free_memory"`
+		FreeSwap    uint64 `json:"free_swap,omitempty"`
+		Cores       int    `json:"cores,omitempty"`
+	} `json:"cpu,omitempty"`
+
+	GPUs []FakeDevice `json:"gpus"`
+}
+
+// FakeProvider reports the simulated devices described by a JSON file in the
+// FakeSystem layout, so scheduling can be exercised without the hardware. The
+// file is read on every call so free memory can be changed while running.
+// CUDA devices below the minimum compute capability are reported as
+// unsupported just as real ones are.
+type FakeProvider struct {
+	path string
+}
+
+func NewFakeProvider(path string) *FakeProvider {
+	return &FakeProvider{path: path}
+}
+
+func (p *FakeProvider) GPUInfo() GpuInfoList {
+	_, gpus, _ := p.read()
+	if len(gpus) == 0 {
+		return p.CPUInfo()
+	}
+
+	return gpus
+}
+
+func (p *FakeProvider) CPUInfo() GpuInfoList {
+	cpu, _, _ := p.read()
+	return GpuInfoList{cpu.GpuInfo}
+}
+
+func (p *FakeProvider) SystemInfo() SystemInfo {
+	cpu, gpus, unsupported := p.read()
+	return SystemInfo{
+		System:          cpu,
+		GPUs:            gpus,
+		UnsupportedGPUs: unsupported,
+		DiscoveryErrors: []string{},
+	}
+}
+
+func (p *FakeProvider) read() (CPUInfo, GpuInfoList, []UnsupportedGPUInfo) {
+	cpu := CPUInfo{GpuInfo: GpuInfo{Library: "cpu", ID: "0"}}
+
+	system, err := p.load()
+	if err != nil {
+		slog.Error("unable to read simulated GPUs", "path", p.path, "error", err)
+	}
+
+	if system.CPU != nil {
+		cpu.TotalMemory = system.CPU.TotalMemory
+		cpu.FreeMemory = system.CPU.FreeMemory
+		cpu.FreeSwap = system.CPU.FreeSwap
+		if system.CPU.Cores > 0 {
+			cpu.CPUs = []CPU{{ID: "0", CoreCount: system.CPU.Cores, ThreadCount: system.CPU.Cores}}
+		}
+	} else if mem, err := GetCPUMem(); err == nil {
+		cpu.memInfo = mem
+	}
+
+	var gpus GpuInfoList
+	var unsupported []UnsupportedGPUInfo
+	for _, d := range system.GPUs {
+		gpu := GpuInfo{
+			Library:              d.Library,
+			Variant:              d.Variant,
+			ID:                   d.ID,
+			Name:                 d.Name,
+			Compute:              d.Compute,
+			DriverMajor:          d.DriverMajor,
+			DriverMinor:          d.DriverMinor,
+			MinimumMemory:        fakeMinimumMemory,
+			UnreliableFreeMemory: d.UnreliableFreeMemory,
+		}
+		gpu.TotalMemory = d.TotalMemory
+		gpu.FreeMemory = min(d.TotalMemory, d.FreeMemory)
+		if d.FreeMemory == 0 {
+			gpu.FreeMemory = d.TotalMemory
+		}
+		if d.MinimumMemory != nil {
+			gpu.MinimumMemory = *d.MinimumMemory
+		}
+
+		if d.Library == "cuda" && !cudaComputeSupported(d.Compute) {
+			unsupported = append(unsupported, UnsupportedGPUInfo{
+				GpuInfo: gpu,
+				Reason:  fmt.Sprintf("compute capability %s is below the minimum %s.%s", d.Compute, CudaComputeMajorMin, CudaComputeMinorMin),
+			})
+			continue
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	return cpu, gpus, unsupported
+}
+
+func (p *FakeProvider) load() (FakeSystem, error) {
+	var system FakeSystem
+
+	bts, err := os.ReadFile(p.path)
+	if err != nil {
+		return system, err
+	}
+
+	if err := json.Unmarshal(bts, &system); err != nil {
+		return system, err
+	}
+
+	for i, d := range system.GPUs {
+		if d.Library == "" || d.ID == "" {
+			return FakeSystem{CPU: system.CPU}, fmt.Errorf("gpu %d: id and library are required", i)
+		}
+	}
+
+	return system, nil
+}
+
+// cudaComputeSupported reports whether a compute capability such as "3.7"
+// meets CudaComputeMajorMin and CudaComputeMinorMin. Capabilities that can't
+// be parsed are assumed to be supported.
+func cudaComputeSupported(compute string) bool {
+	major, minor, ok := strings.Cut(compute, ".")
+	if !ok {
+		return true
+	}
+
+	maj, err := strconv.Atoi(major)
+	if err != nil {
+		return true
+	}
+
+	mnr, err := strconv.Atoi(minor)
+	if err != nil {
+		return true
+	}
+
+	minMajor, _ := strconv.Atoi(CudaComputeMajorMin)
+	minMinor, _ := strconv.Atoi(CudaComputeMinorMin)
+	return maj > minMajor || (maj == minMajor && mnr >= minMinor)
+}
@@ -0,0 +1,87 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/format"
+)
+
+func TestFakeProvider(t *testing.T) {
+	// K80 builds lower the minimum compute capability to 3.7 with ldflags
+	major, minor := CudaComputeMajorMin, CudaComputeMinorMin
+	CudaComputeMajorMin, CudaComputeMinorMin = "3", "7"
+	t.Cleanup(func() { CudaComputeMajorMin, CudaComputeMinorMin = major, minor })
+
+	path := filepath.Join(t.TempDir(), "gpus.json")
+	write := func(t *testing.T, s string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(s), 0o644))
+	}
+
+	write(t, `{
+		"cpu": {"total_memory": 34359738368, "free_memory": 17179869184, "cores": 8},
+		"gpus": [
+			{"id": "GPU-0", "library": "cuda", "variant": "v11", "name": "Tesla K80", "compute": "3.7", "total_memory": 12884901888, "free_memory": 12000000000},
+			{"id": "GPU-1", "library": "cuda", "variant": "v11", "name": "Tesla K80", "compute": "3.7", "total_memory": 12884901888, "minimum_memory": 0},
+			{"id": "GPU-2", "library": "cuda", "name": "Tesla K20", "compute": "3.5", "total_memory": 5368709120}
+		]
+	}`)
+
+	p := NewFakeProvider(path)
+
+	gpus := p.GPUInfo()
+	require.Len(t, gpus, 2)
+	assert.Equal(t, "GPU-0", gpus[0].ID)
+	assert.Equal(t, "cuda_v11", gpus[0].RunnerName())
+	assert.Equal(t, uint64(12000000000), gpus[0].FreeMemory)
+	assert.Equal(t, uint64(fakeMinimumMemory), gpus[0].MinimumMemory)
+	assert.Equal(t, gpus[1].TotalMemory, gpus[1].FreeMemory, "free memory defaults to total")
+	assert.Zero(t, gpus[1].MinimumMemory)
+
+	cpu := p.CPUInfo()
+	require.Len(t, cpu, 1)
+	assert.Equal(t, "cpu", cpu[0].Library)
+	assert.Equal(t, uint64(32*format.GibiByte), cpu[0].TotalMemory)
+
+	info := p.SystemInfo()
+	assert.Len(t, info.GPUs, 2)
+	require.Len(t, info.UnsupportedGPUs, 1)
+	assert.Equal(t, "GPU-2", info.UnsupportedGPUs[0].ID)
+	assert.Equal(t, 8, info.GetOptimalThreadCount())
+
+	// the file is reread so free memory can change between calls
+	write(t, `{"gpus": [{"id": "GPU-0", "library": "cuda", "total_memory": 1000, "free_memory": 10}]}`)
+	gpus = p.GPUInfo()
+	require.Len(t, gpus, 1)
+	assert.Equal(t, uint64(10), gpus[0].FreeMemory)
+
+	// without usable GPUs only the CPU is reported, like real discovery
+	write(t, `{"cpu": {"total_memory": 1000, "free_memory": 500}, "gpus": []}`)
+	gpus = p.GPUInfo()
+	require.Len(t, gpus, 1)
+	assert.Equal(t, "cpu", gpus[0].Library)
+	assert.Equal(t, uint64(500), gpus[0].FreeMemory)
+
+	write(t, `{"gpus": [{"library": "cuda"}]}`)
+	gpus = p.GPUInfo()
+	require.Len(t, gpus, 1)
+	assert.Equal(t, "cpu", gpus[0].Library)
+}
+
+func TestSetProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpus.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"gpus": [{"id": "0", "library": "rocm", "total_memory": 1000}]}`), 0o644))
+
+	SetProvider(NewFakeProvider(path))
+	t.Cleanup(func() { SetProvider(nil) })
+
+	gpus := GetGPUInfo()
+	require.Len(t, gpus, 1)
+	assert.Equal(t, "rocm", gpus[0].Library)
+	assert.Len(t, GetSystemInfo().GPUs, 1)
+}
@@ -63,13 +63,6 @@ var (
 	bootstrapErrors []error
 )
 
-// With our current CUDA compile flags, older than 5.0 will not work properly
-// (string values used to allow ldflags overrides at build time)
-var (
-	CudaComputeMajorMin = "5"
-	CudaComputeMinorMin = "0"
-)
-
 var RocmComputeMajorMin = "9"
 
 // TODO find a better way to detect iGPU instead of minimum memory
@@ -174,18 +167,18 @@ func initOneAPIHandles() *oneapiHandles {
 	return oHandles
 }
 
-func GetCPUInfo() GpuInfoList {
+func getCPUInfo() GpuInfoList {
 	gpuMutex.Lock()
 	if !bootstrapped {
 		gpuMutex.Unlock()
-		GetGPUInfo()
+		getGPUInfo()
 	} else {
 		gpuMutex.Unlock()
 	}
 	return GpuInfoList{cpus[0].GpuInfo}
 }
 
-func GetGPUInfo() GpuInfoList {
+func getGPUInfo() GpuInfoList {
 	// TODO - consider exploring lspci (and equivalent on windows) to check for
 	// GPUs so we can report warnings if we see Nvidia/AMD but fail to load the libraries
 	gpuMutex.Lock()
@@ -697,8 +690,8 @@ func (l GpuInfoList) GetVisibleDevicesEnv() (string, string) {
 	}
 }
 
-func GetSystemInfo() SystemInfo {
-	gpus := GetGPUInfo()
+func getSystemInfo() SystemInfo {
+	gpus := getGPUInfo()
 	gpuMutex.Lock()
 	defer gpuMutex.Unlock()
 	discoveryErrors := []string{}
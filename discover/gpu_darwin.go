@@ -21,7 +21,7 @@ const (
 	metalMinimumMemory = 512 * format.MebiByte
 )
 
-func GetGPUInfo() GpuInfoList {
+func getGPUInfo() GpuInfoList {
 	mem, _ := GetCPUMem()
 	if runtime.GOARCH == "amd64" {
 		return []GpuInfo{
@@ -44,7 +44,7 @@ func GetGPUInfo() GpuInfoList {
 	return []GpuInfo{info}
 }
 
-func GetCPUInfo() GpuInfoList {
+func getCPUInfo() GpuInfoList {
 	mem, _ := GetCPUMem()
 	return []GpuInfo{
 		{
@@ -67,7 +67,7 @@ func (l GpuInfoList) GetVisibleDevicesEnv() (string, string) {
 	return "", ""
 }
 
-func GetSystemInfo() SystemInfo {
+func getSystemInfo() SystemInfo {
 	mem, _ := GetCPUMem()
 	query := "hw.perflevel0.physicalcpu"
 	perfCores, err := syscall.SysctlUint32(query)
@@ -94,6 +94,6 @@ func GetSystemInfo() SystemInfo {
 				},
 			},
 		},
-		GPUs: GetGPUInfo(),
+		GPUs: getGPUInfo(),
 	}
 }
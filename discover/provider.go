@@ -0,0 +1,70 @@
+package discover
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// Provider discovers the devices available for inference. The default
+// provider probes the GPU libraries and sysfs; others can replace it to run
+// the scheduler against simulated hardware.
+type Provider interface {
+	// GPUInfo returns the usable GPUs with their current free memory, or a
+	// single cpu entry if there are none
+	GPUInfo() GpuInfoList
+
+	// CPUInfo returns a single cpu entry describing system memory
+	CPUInfo() GpuInfoList
+
+	// SystemInfo describes the system and all discovered devices
+	SystemInfo() SystemInfo
+}
+
+// systemProvider discovers the real devices of this system
+type systemProvider struct{}
+
+func (systemProvider) GPUInfo() GpuInfoList   { return getGPUInfo() }
+func (systemProvider) CPUInfo() GpuInfoList   { return getCPUInfo() }
+func (systemProvider) SystemInfo() SystemInfo { return getSystemInfo() }
+
+var (
+	providerMu sync.Mutex
+	provider   Provider
+)
+
+// SetProvider replaces the provider used by GetGPUInfo, GetCPUInfo and
+// GetSystemInfo. A nil provider restores the default.
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+func currentProvider() Provider {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider == nil {
+		if path := envconfig.FakeGPUs(); path != "" {
+			slog.Warn("using simulated GPUs", "OLLAMA_FAKE_GPUS", path)
+			provider = NewFakeProvider(path)
+		} else {
+			provider = systemProvider{}
+		}
+	}
+
+	return provider
+}
+
+func GetGPUInfo() GpuInfoList {
+	return currentProvider().GPUInfo()
+}
+
+func GetCPUInfo() GpuInfoList {
+	return currentProvider().CPUInfo()
+}
+
+func GetSystemInfo() SystemInfo {
+	return currentProvider().SystemInfo()
+}
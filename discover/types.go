@@ -7,6 +7,13 @@ import (
 	"github.com/ollama/ollama/format"
 )
 
+// With our current CUDA compile flags, older than 5.0 will not work properly
+// (string values used to allow ldflags overrides at build time)
+var (
+	CudaComputeMajorMin = "5"
+	CudaComputeMinorMin = "0"
+)
+
 type memInfo struct {
 	TotalMemory uint64 `json:"total_memory,omitempty"`
 	FreeMemory  uint64 `json:"free_memory,omitempty"`
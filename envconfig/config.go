@@ -170,6 +170,8 @@ var (
 	NewEngine = Bool("OLLAMA_NEW_ENGINE")
 	// ContextLength sets the default context length
 	ContextLength = Uint("OLLAMA_CONTEXT_LENGTH", 2048)
+	// Mirror serves the local models to other instances as a pull-through registry mirror
+	Mirror = Bool("OLLAMA_MIRROR")
 )
 
 func String(s string) func() string {
@@ -179,7 +181,35 @@ func String(s string) func() string {
 }
 
 var (
+	// APIKey is the API key clients send to the server
+	APIKey = String("OLLAMA_API_KEY")
+	// APIKeys is the path of a JSON file with the API keys that can access the server
+	APIKeys    = String("OLLAMA_API_KEYS")
 	LLMLibrary = String("OLLAMA_LLM_LIBRARY")
+	// FakeGPUs is the path of a JSON file describing simulated GPUs to use instead of discovering real ones
+	FakeGPUs = String("OLLAMA_FAKE_GPUS")
+	// Policy is the path of a JSON file with the lifecycle policies of models
+	Policy = String("OLLAMA_POLICY")
+	// RegistryConfig is the path of a Docker config.json with registry credentials
+	RegistryConfig = String("OLLAMA_REGISTRY_CONFIG")
+	// RegistryMirror is the URL of an Ollama instance pulls from the default registry are sent to
+	RegistryMirror = String("OLLAMA_REGISTRY_MIRROR")
+	// TrustPolicy is the path of a JSON file with the keys trusted to sign the models of each namespace
+	TrustPolicy = String("OLLAMA_TRUST_POLICY")
+	// UsageHeader is the request header that identifies users for usage accounting when requests have no API key
+	UsageHeader = String("OLLAMA_USAGE_HEADER")
+	// UsageQuotas is the path of a JSON file with the monthly token quotas of users
+	UsageQuotas = String("OLLAMA_USAGE_QUOTAS")
+	// TLSCert and TLSKey are the paths of the PEM certificate and key the server serves HTTPS with
+	TLSCert = String("OLLAMA_TLS_CERT")
+	TLSKey  = String("OLLAMA_TLS_KEY")
+	// TLSClientCA is the path of a PEM bundle of the CAs the server verifies client certificates with
+	TLSClientCA = String("OLLAMA_TLS_CLIENT_CA")
+	// TLSCA is the path of a PEM bundle of the CAs clients verify the server's certificate with
+	TLSCA = String("OLLAMA_TLS_CA")
+	// TLSClientCert and TLSClientKey are the paths of the PEM certificate and key clients send to the server
+	TLSClientCert = String("OLLAMA_TLS_CLIENT_CERT")
+	TLSClientKey  = String("OLLAMA_TLS_CLIENT_KEY")
 
 	CudaVisibleDevices    = String("CUDA_VISIBLE_DEVICES")
 	HipVisibleDevices     = String("HIP_VISIBLE_DEVICES")
@@ -211,6 +241,8 @@ var (
 	MaxQueue = Uint("OLLAMA_MAX_QUEUE", 512)
 	// MaxVRAM sets a maximum VRAM override in bytes. MaxVRAM can be configured via the OLLAMA_MAX_VRAM environment variable.
 	MaxVRAM = Uint("OLLAMA_MAX_VRAM", 0)
+	// MaxPulls sets the maximum number of models pulled at once. MaxPulls can be configured via the OLLAMA_MAX_PULLS environment variable.
+	MaxPulls = Uint("OLLAMA_MAX_PULLS", 3)
 )
 
 func Uint64(key string, defaultValue uint64) func() uint64 {
@@ -230,6 +262,12 @@ func Uint64(key string, defaultValue uint64) func() uint64 {
 // Set aside VRAM per GPU
 var GpuOverhead = Uint64("OLLAMA_GPU_OVERHEAD", 0)
 
+// MaxDownloadRate limits the combined download rate of all pulls in bytes per second
+var MaxDownloadRate = Uint64("OLLAMA_MAX_DOWNLOAD_RATE", 0)
+
+// StoreQuota is the maximum size of the model store in bytes. The least recently used models are removed to make room for pulls.
+var StoreQuota = Uint64("OLLAMA_STORE_QUOTA", 0)
+
 type EnvVar struct {
 	Name        string
 	Value       any
@@ -239,21 +277,36 @@ type EnvVar struct {
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
 		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", Debug(), "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
+		"OLLAMA_API_KEYS":          {"OLLAMA_API_KEYS", APIKeys(), "Path to a JSON file with the API keys that can access the server"},
 		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
 		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Quantization type for the K/V cache (default: f16)"},
 		"OLLAMA_GPU_OVERHEAD":      {"OLLAMA_GPU_OVERHEAD", GpuOverhead(), "Reserve a portion of VRAM per GPU (bytes)"},
 		"OLLAMA_HOST":              {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
 		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
 		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
+		"OLLAMA_FAKE_GPUS":         {"OLLAMA_FAKE_GPUS", FakeGPUs(), "Path to a JSON file describing simulated GPUs, for testing"},
 		"OLLAMA_LOAD_TIMEOUT":      {"OLLAMA_LOAD_TIMEOUT", LoadTimeout(), "How long to allow model loads to stall before giving up (default \"5m\")"},
 		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
 		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
+		"OLLAMA_MAX_PULLS":         {"OLLAMA_MAX_PULLS", MaxPulls(), "Maximum number of models pulled at once (default: 3)"},
+		"OLLAMA_MAX_DOWNLOAD_RATE": {"OLLAMA_MAX_DOWNLOAD_RATE", MaxDownloadRate(), "Maximum combined download rate of pulls (bytes per second)"},
+		"OLLAMA_MIRROR":            {"OLLAMA_MIRROR", Mirror(), "Serve local models to other Ollama instances as a registry mirror"},
 		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
 		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
 		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
 		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
+		"OLLAMA_POLICY":            {"OLLAMA_POLICY", Policy(), "Path to a JSON file with policies to pin, preload and unload models"},
+		"OLLAMA_REGISTRY_CONFIG":   {"OLLAMA_REGISTRY_CONFIG", RegistryConfig(), "Path to a Docker config.json with registry credentials (default: ~/.docker/config.json)"},
+		"OLLAMA_REGISTRY_MIRROR":   {"OLLAMA_REGISTRY_MIRROR", RegistryMirror(), "URL of an Ollama registry mirror to pull models through"},
 		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowedOrigins(), "A comma separated list of allowed origins"},
 		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
+		"OLLAMA_STORE_QUOTA":       {"OLLAMA_STORE_QUOTA", StoreQuota(), "Maximum size of the models directory (bytes); least recently used models are removed to make room for pulls"},
+		"OLLAMA_TLS_CERT":          {"OLLAMA_TLS_CERT", TLSCert(), "Path to a PEM certificate to serve HTTPS with; reloaded when it changes"},
+		"OLLAMA_TLS_KEY":           {"OLLAMA_TLS_KEY", TLSKey(), "Path to the PEM private key of OLLAMA_TLS_CERT"},
+		"OLLAMA_TLS_CLIENT_CA":     {"OLLAMA_TLS_CLIENT_CA", TLSClientCA(), "Path to a PEM bundle of CAs; clients must present a certificate signed by one"},
+		"OLLAMA_TRUST_POLICY":      {"OLLAMA_TRUST_POLICY", TrustPolicy(), "Path to a JSON file with the keys trusted to sign the models of each namespace"},
+		"OLLAMA_USAGE_HEADER":      {"OLLAMA_USAGE_HEADER", UsageHeader(), "Request header that identifies users for usage accounting when requests have no API key"},
+		"OLLAMA_USAGE_QUOTAS":      {"OLLAMA_USAGE_QUOTAS", UsageQuotas(), "Path to a JSON file with the monthly token quotas of users"},
 		"OLLAMA_MULTIUSER_CACHE":   {"OLLAMA_MULTIUSER_CACHE", MultiUserCache(), "Optimize prompt caching for multi-user scenarios"},
 		"OLLAMA_CONTEXT_LENGTH":    {"OLLAMA_CONTEXT_LENGTH", ContextLength(), "Context length to use unless otherwise specified (default: 2048)"},
 		"OLLAMA_NEW_ENGINE":        {"OLLAMA_NEW_ENGINE", NewEngine(), "Enable the new Ollama engine"},
@@ -0,0 +1,292 @@
+package envconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// kind is the type of a setting, used to check its value in a config file
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindUint
+	kindDuration
+	kindHost
+	kindList
+)
+
+// kinds are the settings that can be set in a config file
+var kinds = map[string]kind{
+	"OLLAMA_API_KEYS":          kindString,
+	"OLLAMA_DEBUG":             kindBool,
+	"OLLAMA_FLASH_ATTENTION":   kindBool,
+	"OLLAMA_KV_CACHE_TYPE":     kindString,
+	"OLLAMA_GPU_OVERHEAD":      kindUint,
+	"OLLAMA_HOST":              kindHost,
+	"OLLAMA_KEEP_ALIVE":        kindDuration,
+	"OLLAMA_LLM_LIBRARY":       kindString,
+	"OLLAMA_FAKE_GPUS":         kindString,
+	"OLLAMA_LOAD_TIMEOUT":      kindDuration,
+	"OLLAMA_MAX_LOADED_MODELS": kindUint,
+	"OLLAMA_MAX_QUEUE":         kindUint,
+	"OLLAMA_MAX_PULLS":         kindUint,
+	"OLLAMA_MAX_DOWNLOAD_RATE": kindUint,
+	"OLLAMA_MIRROR":            kindBool,
+	"OLLAMA_MODELS":            kindString,
+	"OLLAMA_NOHISTORY":         kindBool,
+	"OLLAMA_NOPRUNE":           kindBool,
+	"OLLAMA_NUM_PARALLEL":      kindUint,
+	"OLLAMA_POLICY":            kindString,
+	"OLLAMA_REGISTRY_CONFIG":   kindString,
+	"OLLAMA_REGISTRY_MIRROR":   kindString,
+	"OLLAMA_ORIGINS":           kindList,
+	"OLLAMA_SCHED_SPREAD":      kindBool,
+	"OLLAMA_STORE_QUOTA":       kindUint,
+	"OLLAMA_TLS_CERT":          kindString,
+	"OLLAMA_TLS_KEY":           kindString,
+	"OLLAMA_TLS_CLIENT_CA":     kindString,
+	"OLLAMA_TRUST_POLICY":      kindString,
+	"OLLAMA_USAGE_HEADER":      kindString,
+	"OLLAMA_USAGE_QUOTAS":      kindString,
+	"OLLAMA_MULTIUSER_CACHE":   kindBool,
+	"OLLAMA_CONTEXT_LENGTH":    kindUint,
+	"OLLAMA_NEW_ENGINE":        kindBool,
+	"OLLAMA_INTEL_GPU":         kindBool,
+
+	"HTTP_PROXY":  kindString,
+	"HTTPS_PROXY": kindString,
+	"NO_PROXY":    kindString,
+
+	"CUDA_VISIBLE_DEVICES":     kindString,
+	"HIP_VISIBLE_DEVICES":      kindString,
+	"ROCR_VISIBLE_DEVICES":     kindString,
+	"GPU_DEVICE_ORDINAL":       kindString,
+	"HSA_OVERRIDE_GFX_VERSION": kindString,
+}
+
+// fromFile are the settings set by the config file
+var fromFile = make(map[string]bool)
+
+// ConfigKey returns the key of the setting name in a config file, which is
+// the name in lower case without the OLLAMA_ prefix, e.g. OLLAMA_KEEP_ALIVE
+// is keep_alive.
+func ConfigKey(name string) string {
+	return strings.TrimPrefix(strings.ToLower(name), "ollama_")
+}
+
+// DefaultConfigPath returns the config file read when none is given.
+// Default is $HOME/.ollama/config.toml
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "config.toml")
+}
+
+// LoadConfig reads the TOML config file at path. If path is empty, the
+// default config file is read if it exists. Settings in the environment
+// take precedence over the file. The remaining settings are set in the
+// environment so they're seen by the processes the server starts.
+//
+// Unknown keys and invalid values are errors.
+func LoadConfig(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigPath()
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	vals, err := parseConfig(bts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, val := range vals {
+		if _, ok := lookupEnv(name); ok {
+			continue
+		}
+
+		if err := os.Setenv(name, val); err != nil {
+			return err
+		}
+
+		fromFile[name] = true
+	}
+
+	return nil
+}
+
+// parseConfig returns the values of the settings in a config file, keyed by
+// their environment variable.
+func parseConfig(bts []byte) (map[string]string, error) {
+	var m map[string]any
+	if err := toml.Unmarshal(bts, &m); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(kinds))
+	for name := range kinds {
+		names[ConfigKey(name)] = name
+	}
+
+	vals := make(map[string]string, len(m))
+	for k, v := range m {
+		name, ok := names[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", k)
+		}
+
+		s, err := configValue(kinds[name], v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+
+		vals[name] = s
+	}
+
+	return vals, nil
+}
+
+// configValue checks v is a valid value of kind k and returns it as it
+// would be set in the environment.
+func configValue(k kind, v any) (string, error) {
+	switch k {
+	case kindBool:
+		switch v := v.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			if _, err := strconv.ParseBool(v); err == nil {
+				return v, nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid boolean %v", v)
+	case kindUint:
+		switch v := v.(type) {
+		case int64:
+			if v >= 0 {
+				return strconv.FormatInt(v, 10), nil
+			}
+		case string:
+			if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+				return v, nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid unsigned integer %v", v)
+	case kindDuration:
+		switch v := v.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case string:
+			if _, err := time.ParseDuration(v); err == nil {
+				return v, nil
+			} else if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return v, nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid duration %v", v)
+	case kindHost:
+		if s, ok := v.(string); ok {
+			return s, checkHost(s)
+		}
+
+		return "", fmt.Errorf("invalid host %v", v)
+	case kindList:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return "", fmt.Errorf("invalid list item %v", item)
+				}
+
+				items[i] = s
+			}
+
+			return strings.Join(items, ","), nil
+		}
+
+		return "", fmt.Errorf("invalid list %v", v)
+	default:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		}
+
+		return "", fmt.Errorf("invalid string %v", v)
+	}
+}
+
+// checkHost reports whether s is a host that Host accepts without falling
+// back to its defaults.
+func checkHost(s string) error {
+	scheme, hostport, ok := strings.Cut(s, "://")
+	if !ok {
+		hostport = s
+	} else if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("invalid scheme %q", scheme)
+	}
+
+	hostport, _, _ = strings.Cut(hostport, "/")
+	if _, port, err := net.SplitHostPort(hostport); err == nil {
+		if n, err := strconv.ParseInt(port, 10, 32); err != nil || n > 65535 || n < 0 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	return nil
+}
+
+// lookupEnv looks up the environment variable name. Proxy variables are
+// also looked up in lower case.
+func lookupEnv(name string) (string, bool) {
+	if s, ok := os.LookupEnv(name); ok {
+		return s, true
+	}
+
+	if strings.HasSuffix(name, "_PROXY") {
+		return os.LookupEnv(strings.ToLower(name))
+	}
+
+	return "", false
+}
+
+// Source returns where the setting name comes from: "config" if it was set
+// by the config file, "env" if it is set in the environment and "default"
+// otherwise.
+func Source(name string) string {
+	if fromFile[name] {
+		return "config"
+	} else if _, ok := os.LookupEnv(name); ok {
+		return "env"
+	}
+
+	return "default"
+}
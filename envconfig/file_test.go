@@ -0,0 +1,130 @@
+package envconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unsetenv unsets key for the duration of the test
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, key := range []string{"OLLAMA_HOST", "OLLAMA_KEEP_ALIVE", "OLLAMA_NUM_PARALLEL", "OLLAMA_ORIGINS", "OLLAMA_DEBUG", "OLLAMA_MODELS", "CUDA_VISIBLE_DEVICES"} {
+		unsetenv(t, key)
+	}
+	t.Setenv("OLLAMA_NUM_PARALLEL", "2")
+	t.Cleanup(func() { clear(fromFile) })
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(`
+host = "0.0.0.0:8080"
+keep_alive = "1h"
+num_parallel = 4
+origins = ["http://example.com", "http://example.org"]
+debug = true
+cuda_visible_devices = 0
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := Host().String(); s != "http://0.0.0.0:8080" {
+		t.Errorf("expected host from config, got %s", s)
+	}
+
+	if d := KeepAlive(); d != time.Hour {
+		t.Errorf("expected keep alive from config, got %s", d)
+	}
+
+	if n := NumParallel(); n != 2 {
+		t.Errorf("expected environment to override config, got %d", n)
+	}
+
+	if s := Var("OLLAMA_ORIGINS"); s != "http://example.com,http://example.org" {
+		t.Errorf("expected origins from config, got %s", s)
+	}
+
+	if !Debug() {
+		t.Error("expected debug from config")
+	}
+
+	if s := CudaVisibleDevices(); s != "0" {
+		t.Errorf("expected cuda visible devices from config, got %q", s)
+	}
+
+	for name, source := range map[string]string{
+		"OLLAMA_HOST":         "config",
+		"OLLAMA_NUM_PARALLEL": "env",
+		"OLLAMA_MODELS":       "default",
+	} {
+		if s := Source(name); s != source {
+			t.Errorf("%s: expected source %s, got %s", name, source, s)
+		}
+	}
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if err := LoadConfig(""); err != nil {
+		t.Errorf("expected missing default config to be ignored, got %v", err)
+	}
+
+	if err := LoadConfig(filepath.Join(home, "missing.toml")); err == nil {
+		t.Error("expected missing config to be an error")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cases := map[string]struct {
+		input string
+		err   bool
+	}{
+		"valid":              {`models = "/srv/models"` + "\n" + `keep_alive = -1` + "\n" + `noprune = "1"`, false},
+		"unknown key":        {`model = "/srv/models"`, true},
+		"table":              {"[server]\nhost = \"0.0.0.0\"", true},
+		"invalid bool":       {`debug = "yes please"`, true},
+		"negative uint":      {`num_parallel = -1`, true},
+		"invalid duration":   {`keep_alive = "forever"`, true},
+		"invalid port":       {`host = "0.0.0.0:99999"`, true},
+		"invalid scheme":     {`host = "ftp://0.0.0.0"`, true},
+		"invalid list":       {`origins = [1, 2]`, true},
+		"invalid string":     {`models = true`, true},
+		"invalid toml":       {`host = `, true},
+		"environment prefix": {`ollama_host = "0.0.0.0"`, true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tt.input))
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	for name := range AsMap() {
+		// lower case proxy variables are set by their upper case key
+		if name == strings.ToLower(name) {
+			continue
+		}
+
+		if _, ok := kinds[name]; !ok {
+			t.Errorf("%s can't be set in a config file", name)
+		}
+	}
+}
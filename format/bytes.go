@@ -3,6 +3,8 @@ package format
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -61,3 +63,44 @@ func HumanBytes2(b uint64) string {
 		return fmt.Sprintf("%d B", b)
 	}
 }
+
+// ParseBytes parses a size such as "512", "100KB", "1.5 GB" or "10MiB" to
+// bytes. Sizes without a unit are in bytes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	var unit float64
+	switch strings.ToUpper(strings.TrimSpace(s[i:])) {
+	case "", "B":
+		unit = Byte
+	case "K", "KB":
+		unit = KiloByte
+	case "M", "MB":
+		unit = MegaByte
+	case "G", "GB":
+		unit = GigaByte
+	case "T", "TB":
+		unit = TeraByte
+	case "KIB":
+		unit = KibiByte
+	case "MIB":
+		unit = MebiByte
+	case "GIB":
+		unit = GibiByte
+	default:
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(value * unit), nil
+}
@@ -89,3 +89,36 @@ func TestHumanBytes2(t *testing.T) {
 		})
 	}
 }
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"0":      0,
+		"512":    512,
+		"512B":   512,
+		"100KB":  100 * KiloByte,
+		"1.5 GB": 1500 * MegaByte,
+		"10MiB":  10 * MebiByte,
+		"2m":     2 * MegaByte,
+	}
+
+	for input, expected := range cases {
+		t.Run(input, func(t *testing.T) {
+			n, err := ParseBytes(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != expected {
+				t.Errorf("expected %d, got %d", expected, n)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "MB", "ten", "10XB", "-1", "1.2.3"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseBytes(input); err == nil {
+				t.Errorf("expected %q to be invalid", input)
+			}
+		})
+	}
+}
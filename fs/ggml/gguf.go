@@ -356,6 +356,7 @@ func writeGGUFString(w io.Writer, s string) error {
 }
 
 type array struct {
+	typ    uint32
 	size   int
 	values []any
 }
@@ -364,6 +365,16 @@ func (a *array) MarshalJSON() ([]byte, error) {
 	return json.Marshal(a.values)
 }
 
+// ArrayLen returns the number of elements in a decoded key-value, or -1 if v
+// is not an array.
+func ArrayLen(v any) int {
+	if a, ok := v.(*array); ok {
+		return a.size
+	}
+
+	return -1
+}
+
 func readGGUFV1Array(llm *gguf, r io.Reader) (*array, error) {
 	t, err := readGGUF[uint32](llm, r)
 	if err != nil {
@@ -375,9 +386,9 @@ func readGGUFV1Array(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{typ: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
-		a.values = make([]any, 0, int(n))
+		a.values = make([]any, int(n))
 	}
 
 	for i := range n {
@@ -437,7 +448,7 @@ func readGGUFArray(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{typ: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
 		a.values = make([]any, int(n))
 	}
@@ -541,6 +552,8 @@ func WriteGGUF(ws io.WriteSeeker, kv KV, ts []Tensor) error {
 		}
 	})
 
+	var alignment int64 = 32
+
 	var s uint64
 	for _, t := range ts {
 		t.Offset = s
@@ -548,9 +561,9 @@ func WriteGGUF(ws io.WriteSeeker, kv KV, ts []Tensor) error {
 			return err
 		}
 		s += t.Size()
+		s += uint64(ggufPadding(int64(s), alignment))
 	}
 
-	var alignment int64 = 32
 	for _, t := range ts {
 		if err := ggufWriteTensor(ws, t, alignment); err != nil {
 			return err
@@ -560,6 +573,42 @@ func WriteGGUF(ws io.WriteSeeker, kv KV, ts []Tensor) error {
 	return nil
 }
 
+// RewriteGGUF writes a copy of the GGUF model f, read from r, to ws with its
+// key-values replaced by kv. Tensor data is copied as-is so the model is not
+// re-quantized. f must have been decoded with a negative maxArraySize so that
+// every array value can be written back.
+func RewriteGGUF(ws io.WriteSeeker, r io.ReaderAt, f *GGML, kv KV) error {
+	kv = maps.Clone(kv)
+
+	// general.parameter_count is derived on decode and general.alignment is
+	// fixed by WriteGGUF
+	delete(kv, "general.parameter_count")
+	delete(kv, "general.alignment")
+
+	tensors := f.Tensors()
+	ts := make([]Tensor, len(tensors.Items()))
+	for i, t := range tensors.Items() {
+		ts[i] = Tensor{
+			Name: t.Name,
+			Kind: t.Kind,
+			// WriteGGUF expects shapes in reverse order, as produced by convert
+			Shape:    slices.Clone(t.Shape),
+			WriterTo: tensorReader{io.NewSectionReader(r, int64(tensors.Offset+t.Offset), int64(t.Size()))},
+		}
+		slices.Reverse(ts[i].Shape)
+	}
+
+	return WriteGGUF(ws, kv, ts)
+}
+
+type tensorReader struct {
+	*io.SectionReader
+}
+
+func (t tensorReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, t.SectionReader)
+}
+
 func ggufWriteKV(ws io.WriteSeeker, k string, v any) error {
 	slog.Debug(k, "type", fmt.Sprintf("%T", v))
 	if err := binary.Write(ws, binary.LittleEndian, uint64(len(k))); err != nil {
@@ -572,10 +621,26 @@ func ggufWriteKV(ws io.WriteSeeker, k string, v any) error {
 
 	var err error
 	switch v := v.(type) {
+	case uint8:
+		err = writeGGUF(ws, ggufTypeUint8, v)
+	case int8:
+		err = writeGGUF(ws, ggufTypeInt8, v)
+	case uint16:
+		err = writeGGUF(ws, ggufTypeUint16, v)
+	case int16:
+		err = writeGGUF(ws, ggufTypeInt16, v)
 	case uint32:
 		err = writeGGUF(ws, ggufTypeUint32, v)
+	case int32:
+		err = writeGGUF(ws, ggufTypeInt32, v)
+	case uint64:
+		err = writeGGUF(ws, ggufTypeUint64, v)
+	case int64:
+		err = writeGGUF(ws, ggufTypeInt64, v)
 	case float32:
 		err = writeGGUF(ws, ggufTypeFloat32, v)
+	case float64:
+		err = writeGGUF(ws, ggufTypeFloat64, v)
 	case bool:
 		err = writeGGUF(ws, ggufTypeBool, v)
 	case string:
@@ -608,6 +673,8 @@ func ggufWriteKV(ws io.WriteSeeker, k string, v any) error {
 				return err
 			}
 		}
+	case *array:
+		err = writeGGUFDecodedArray(ws, k, v)
 	default:
 		return fmt.Errorf("improper type for '%s'", k)
 	}
@@ -615,6 +682,47 @@ func ggufWriteKV(ws io.WriteSeeker, k string, v any) error {
 	return err
 }
 
+// writeGGUFDecodedArray writes an array previously read by readGGUFArray. The
+// array must have been fully collected, i.e. decoded with a large enough
+// maxArraySize.
+func writeGGUFDecodedArray(ws io.WriteSeeker, k string, a *array) error {
+	if a.size > 0 && len(a.values) != a.size {
+		return fmt.Errorf("array values for '%s' were not collected", k)
+	}
+
+	if err := binary.Write(ws, binary.LittleEndian, ggufTypeArray); err != nil {
+		return err
+	}
+
+	if err := binary.Write(ws, binary.LittleEndian, a.typ); err != nil {
+		return err
+	}
+
+	if err := binary.Write(ws, binary.LittleEndian, uint64(a.size)); err != nil {
+		return err
+	}
+
+	for _, e := range a.values {
+		if s, ok := e.(string); ok {
+			if err := binary.Write(ws, binary.LittleEndian, uint64(len(s))); err != nil {
+				return err
+			}
+
+			if _, err := io.WriteString(ws, s); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := binary.Write(ws, binary.LittleEndian, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func ggufWriteTensorInfo(ws io.WriteSeeker, t Tensor) error {
 	slog.Debug(t.Name, "kind", t.Kind, "shape", t.Shape, "offset", t.Offset)
 	if err := binary.Write(ws, binary.LittleEndian, uint64(len(t.Name))); err != nil {
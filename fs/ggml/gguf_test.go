@@ -0,0 +1,104 @@
+package ggml
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRewriteGGUF(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "model.gguf")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := WriteGGUF(f, KV{
+		"general.architecture":    "llama",
+		"llama.rope.freq_base":    float32(10000),
+		"tokenizer.chat_template": "broken",
+		"tokenizer.ggml.tokens":   []string{"a", "b", "c"},
+		"tokenizer.ggml.scores":   []float32{0, 1, 2},
+	}, []Tensor{
+		// odd sized tensors exercise padding between tensor data
+		{Name: "token_embd.weight", Kind: 0, Shape: []uint64{3, 1}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{1}, 12))},
+		{Name: "blk.0.attn_norm.weight", Kind: 0, Shape: []uint64{5}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{2}, 20))},
+		{Name: "output.weight", Kind: 1, Shape: []uint64{3, 1}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{3}, 6))},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err := Decode(f, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := m.KV()
+	kv["tokenizer.chat_template"] = "fixed"
+	kv["llama.rope.freq_base"] = float32(500000)
+
+	var b bytes.Buffer
+	out, err := os.Create(filepath.Join(t.TempDir(), "rewritten.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if err := RewriteGGUF(out, f, m, kv); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, _, err := Decode(out, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rewritten.KV().ChatTemplate(); got != "fixed" {
+		t.Errorf("chat template = %q, want %q", got, "fixed")
+	}
+
+	if got := rewritten.KV().Float("rope.freq_base"); got != 500000 {
+		t.Errorf("rope.freq_base = %v, want 500000", got)
+	}
+
+	if diff := cmp.Diff([]string{"a", "b", "c"}, rewritten.KV().Strings("tokenizer.ggml.tokens")); diff != "" {
+		t.Errorf("tokens mismatch (-want +got):\n%s", diff)
+	}
+
+	want := map[string][]byte{
+		"token_embd.weight":      bytes.Repeat([]byte{1}, 12),
+		"blk.0.attn_norm.weight": bytes.Repeat([]byte{2}, 20),
+		"output.weight":          bytes.Repeat([]byte{3}, 6),
+	}
+
+	tensors := rewritten.Tensors()
+	for _, tt := range tensors.Items() {
+		b.Reset()
+		if _, err := io.Copy(&b, io.NewSectionReader(out, int64(tensors.Offset+tt.Offset), int64(tt.Size()))); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b.Bytes(), want[tt.Name]) {
+			t.Errorf("%s data = %v, want %v", tt.Name, b.Bytes(), want[tt.Name])
+		}
+	}
+
+	if diff := cmp.Diff(m.Tensors().Items(), tensors.Items(), cmp.Comparer(func(a, b *Tensor) bool {
+		return a.Name == b.Name && a.Kind == b.Kind && cmp.Equal(a.Shape, b.Shape)
+	})); diff != "" {
+		t.Errorf("tensors mismatch (-want +got):\n%s", diff)
+	}
+}
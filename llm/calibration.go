@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/runner/common"
+)
+
+// Calibration replaces the estimated graph size of a model with one derived
+// from the VRAM its runner actually used with the same options
+type Calibration struct {
+	// Graph is the measured peak usage less the estimated weights and KV cache
+	Graph uint64 `json:"graph"`
+
+	// FullOffload is set if all layers were offloaded when measured, in which
+	// case Graph replaces the full offload graph size, otherwise the partial
+	FullOffload bool `json:"full_offload"`
+
+	Devices    []common.DeviceMemory `json:"devices"`
+	MeasuredAt time.Time             `json:"measured_at"`
+}
+
+// calibrationStore persists calibrations in the models directory, keyed by
+// model digest and the options that affect memory usage
+type calibrationStore struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]Calibration
+}
+
+var calibrations calibrationStore
+
+func (c *calibrationStore) load() error {
+	path := filepath.Join(envconfig.Models(), "calibration.json")
+	if c.entries != nil && c.path == path {
+		return nil
+	}
+
+	c.path = path
+	c.entries = make(map[string]Calibration)
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bts, &c.entries)
+}
+
+func (c *calibrationStore) get(key string) (Calibration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		slog.Warn("unable to read memory calibration", "error", err)
+		return Calibration{}, false
+	}
+
+	cal, ok := c.entries[key]
+	return cal, ok
+}
+
+func (c *calibrationStore) set(key string, cal Calibration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		slog.Warn("discarding unreadable memory calibration", "error", err)
+	}
+
+	c.entries[key] = cal
+
+	bts, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// calibrationKey identifies a model and the options which change its graph
+// size. It returns an empty string if the model has no digest, e.g. in tests.
+func calibrationKey(modelPath string, gpus []discover.GpuInfo, projectors []string, opts api.Options, kvCacheType string) string {
+	digest := filepath.Base(modelPath)
+	if modelPath == "" || len(gpus) == 0 || gpus[0].Library == "cpu" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:library=%s,gpus=%d,ctx=%d,batch=%d,kv=%s,fa=%t,projectors=%d",
+		digest,
+		gpus[0].Library,
+		len(gpus),
+		opts.NumCtx,
+		min(opts.NumCtx, opts.NumBatch),
+		kvCacheType,
+		envconfig.FlashAttention(),
+		len(projectors),
+	)
+}
+
+// lookupCalibration returns the calibration recorded for key, if any
+func lookupCalibration(key string) (Calibration, bool) {
+	if key == "" {
+		return Calibration{}, false
+	}
+
+	return calibrations.get(key)
+}
+
+// newCalibration derives the graph size from the peak usage a runner measured
+// on each GPU and the estimate it was started with. The estimated weights and
+// KV cache on each GPU are trusted; everything else is attributed to the graph.
+func newCalibration(estimate MemoryEstimate, gpus discover.GpuInfoList, totalLayers uint64, usage common.MemoryUsage) (Calibration, bool) {
+	cal := Calibration{
+		FullOffload: uint64(estimate.Layers) >= totalLayers,
+		Devices:     usage.Devices,
+		MeasuredAt:  time.Now(),
+	}
+
+	var measured bool
+	for _, d := range usage.Devices {
+		for i, gpu := range gpus {
+			if gpu.ID != d.ID || i >= len(estimate.GPUSizes) || estimate.GPUSizes[i] == 0 {
+				continue
+			}
+
+			var weights uint64
+			if estimate.GPUSizes[i] > estimate.Graph {
+				weights = estimate.GPUSizes[i] - estimate.Graph
+			}
+
+			if d.Peak > weights {
+				cal.Graph = max(cal.Graph, d.Peak-weights)
+			}
+			measured = true
+		}
+	}
+
+	return cal, measured
+}
+
+// recordCalibration saves the graph size measured by the runner so later
+// estimates for the same model and options can use it
+func (s *llmServer) recordCalibration(usage common.MemoryUsage) {
+	cal, ok := newCalibration(s.estimate, s.gpus, s.totalLayers, usage)
+	if !ok || s.estimate.calibrationKey == "" {
+		return
+	}
+
+	slog.Info("calibrated memory estimate", "model", s.modelPath, "estimated_graph", format.HumanBytes2(s.estimate.Graph), "measured_graph", format.HumanBytes2(cal.Graph))
+	if err := calibrations.set(s.estimate.calibrationKey, cal); err != nil {
+		slog.Warn("unable to save memory calibration", "error", err)
+	}
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/runner/common"
+)
+
+func TestCalibration(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_KV_CACHE_TYPE", "")
+
+	modelPath := filepath.Join(t.TempDir(), "sha256-0123")
+	f, err := os.Create(modelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var tensors []ggml.Tensor
+	for _, name := range []string{"blk.0.attn.weight", "blk.1.attn.weight", "output.weight"} {
+		tensors = append(tensors, ggml.Tensor{Name: name, Kind: 0, Shape: []uint64{1, 1, 1, 1}, WriterTo: bytes.NewReader(make([]byte, 32))})
+	}
+
+	if err := ggml.WriteGGUF(f, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.context_length":          uint32(32),
+		"llama.embedding_length":        uint32(4096),
+		"llama.block_count":             uint32(2),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(32),
+		"tokenizer.ggml.tokens":         []string{" "},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, tensors); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadModel(modelPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpus := discover.GpuInfoList{{Library: "cuda", ID: "GPU-0"}}
+	gpus[0].FreeMemory = 16 * format.GibiByte
+	opts := api.DefaultOptions()
+	opts.NumGPU = -1
+
+	estimate := EstimateGPULayers(gpus, m, modelPath, nil, opts)
+	if estimate.calibrated {
+		t.Fatal("expected uncalibrated estimate")
+	}
+	if estimate.Layers != 3 {
+		t.Fatalf("expected full offload, got %d layers", estimate.Layers)
+	}
+
+	weights := estimate.GPUSizes[0] - estimate.Graph
+	measured := uint64(512 * format.MebiByte)
+	s := &llmServer{
+		modelPath:   modelPath,
+		estimate:    estimate,
+		gpus:        gpus,
+		totalLayers: 3,
+	}
+	s.recordCalibration(common.MemoryUsage{
+		Devices: []common.DeviceMemory{{ID: "GPU-0", Library: "cuda", Load: weights, Peak: weights + measured}},
+		Batched: true,
+	})
+
+	// drop the cached entries to read back what was written
+	calibrations.entries = nil
+
+	estimate = EstimateGPULayers(gpus, m, modelPath, nil, opts)
+	if !estimate.calibrated {
+		t.Fatal("expected calibrated estimate")
+	}
+	if estimate.Graph != measured {
+		t.Errorf("expected graph %d, got %d", measured, estimate.Graph)
+	}
+	if estimate.graphFullOffload != measured {
+		t.Errorf("expected full offload graph %d, got %d", measured, estimate.graphFullOffload)
+	}
+
+	// a different context size is a different calibration
+	opts.NumCtx *= 2
+	if estimate := EstimateGPULayers(gpus, m, modelPath, nil, opts); estimate.calibrated {
+		t.Error("expected calibration to be keyed by context size")
+	}
+
+	// estimates without a model path never use calibration
+	opts.NumCtx /= 2
+	if estimate := EstimateGPULayers(gpus, m, "", nil, opts); estimate.calibrated {
+		t.Error("expected no calibration without a model path")
+	}
+}
@@ -15,12 +15,12 @@ import (
 )
 
 // This algorithm looks for a complete fit to determine if we need to unload other models
-func PredictServerFit(allGpus discover.GpuInfoList, f *ggml.GGML, adapters, projectors []string, opts api.Options) (bool, uint64) {
+func PredictServerFit(allGpus discover.GpuInfoList, f *ggml.GGML, modelPath string, adapters, projectors []string, opts api.Options) (bool, uint64) {
 	// Split up the GPUs by type and try them
 	var estimatedVRAM uint64
 	for _, gpus := range allGpus.ByLibrary() {
 		var layerCount int
-		estimate := EstimateGPULayers(gpus, f, projectors, opts)
+		estimate := EstimateGPULayers(gpus, f, modelPath, projectors, opts)
 		layerCount, estimatedVRAM = estimate.Layers, estimate.VRAMSize
 		if opts.NumGPU < 0 {
 			if layerCount > 0 && layerCount >= int(f.KV().BlockCount()+1) {
@@ -54,24 +54,36 @@ type MemoryEstimate struct {
 	// For multi-GPU scenarios, this is the size in bytes per GPU
 	GPUSizes []uint64
 
+	// The number of layers placed on each GPU
+	GPULayers []int
+
+	// The size of the KV cache for all layers and its type, empty for the default f16
+	KV          uint64
+	KVCacheType string
+
+	// The size of the projector weights and graph, which occupy the main GPU
+	Projector uint64
+
 	// internal fields for logging purposes
 	inferenceLibrary    string
 	layersRequested     int
 	layersModel         int
 	availableList       []string
-	kv                  uint64
 	allocationsList     []string
 	memoryWeights       uint64
 	memoryLayerOutput   uint64
 	graphFullOffload    uint64
 	graphPartialOffload uint64
+	calibrationKey      string
+	calibrated          bool
 
 	projectorWeights, projectorGraph uint64
 }
 
 // Given a model and one or more GPU targets, predict how many layers and bytes we can load, and the total size
 // The GPUs provided must all be the same Library
-func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []string, opts api.Options) MemoryEstimate {
+// If modelPath is set, graph sizes measured by previous runs of the model with the same options replace the heuristics
+func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, modelPath string, projectors []string, opts api.Options) MemoryEstimate {
 	// Graph size for a partial offload, applies to all GPUs
 	var graphPartialOffload uint64
 
@@ -157,6 +169,16 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 		graphFullOffload = graphPartialOffload
 	}
 
+	calibrationKey := calibrationKey(modelPath, gpus, projectors, opts, kvct)
+	calibrated, isCalibrated := lookupCalibration(calibrationKey)
+	if isCalibrated {
+		if calibrated.FullOffload && len(gpus) == 1 {
+			graphFullOffload = calibrated.Graph
+		} else {
+			graphPartialOffload = calibrated.Graph
+		}
+	}
+
 	if layer, ok := layers["output_norm"]; ok {
 		memoryLayerOutput += layer.Size()
 	}
@@ -311,16 +333,21 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 		VRAMSize:  0,
 		GPUSizes:  []uint64{},
 
+		KV:          kv,
+		KVCacheType: kvct,
+		Projector:   projectorWeights + projectorGraph,
+
 		inferenceLibrary:    gpus[0].Library,
 		layersRequested:     opts.NumGPU,
 		layersModel:         int(f.KV().BlockCount()) + 1,
 		availableList:       availableList,
-		kv:                  kv,
 		allocationsList:     allocationsList,
 		memoryWeights:       memoryWeights,
 		memoryLayerOutput:   memoryLayerOutput,
 		graphFullOffload:    graphFullOffload,
 		graphPartialOffload: graphPartialOffload,
+		calibrationKey:      calibrationKey,
+		calibrated:          isCalibrated,
 		projectorWeights:    projectorWeights,
 		projectorGraph:      projectorGraph,
 	}
@@ -338,6 +365,7 @@ func EstimateGPULayers(gpus []discover.GpuInfo, f *ggml.GGML, projectors []strin
 	estimate.TotalSize = memoryRequiredTotal
 	estimate.TensorSplit = tensorSplit
 	estimate.GPUSizes = gpuAllocations
+	estimate.GPULayers = layerCounts
 	return estimate
 }
 
@@ -367,7 +395,7 @@ func (m MemoryEstimate) LogValue() slog.Value {
 				// memory required to offload layers.estimate layers
 				"partial", format.HumanBytes2(m.VRAMSize),
 				// memory of KV cache
-				"kv", format.HumanBytes2(m.kv),
+				"kv", format.HumanBytes2(m.KV),
 				// Allocations across the GPUs
 				"allocations", m.allocationsList,
 			),
@@ -386,6 +414,8 @@ func (m MemoryEstimate) LogValue() slog.Value {
 				"full", format.HumanBytes2(m.graphFullOffload),
 				// memory of graph when not fully offloaded
 				"partial", format.HumanBytes2(m.graphPartialOffload),
+				// graph size was measured by a previous run
+				"calibrated", m.calibrated,
 			),
 		),
 	}
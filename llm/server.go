@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/semaphore"
@@ -31,6 +32,7 @@ import (
 	"github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/llama"
 	"github.com/ollama/ollama/model"
+	"github.com/ollama/ollama/runner/common"
 )
 
 type LlamaServer interface {
@@ -67,6 +69,7 @@ type llmServer struct {
 
 	estimate    MemoryEstimate
 	totalLayers uint64
+	calibrated  atomic.Bool // set once the runner's measured memory usage has been recorded
 	// gpuCount     int
 	gpus         discover.GpuInfoList // Recorded just before the model loaded, free space will be incorrect
 	loadDuration time.Duration        // Record how long it took the model to load
@@ -109,7 +112,7 @@ func NewLlamaServer(gpus discover.GpuInfoList, modelPath string, f *ggml.GGML, a
 		gpus = discover.GetCPUInfo()
 	}
 
-	estimate := EstimateGPULayers(gpus, f, projectors, opts)
+	estimate := EstimateGPULayers(gpus, f, modelPath, projectors, opts)
 	if len(gpus) > 1 || gpus[0].Library != "cpu" {
 		switch {
 		case gpus[0].Library == "metal" && estimate.VRAMSize > systemTotalMemory:
@@ -491,6 +494,8 @@ type ServerStatusResp struct {
 	SlotsProcessing int     `json:"slots_processing"`
 	Error           string  `json:"error"`
 	Progress        float32 `json:"progress"`
+
+	Memory *common.MemoryUsage `json:"memory,omitempty"`
 }
 
 func (s *llmServer) getServerStatus(ctx context.Context) (ServerStatus, error) {
@@ -532,6 +537,10 @@ func (s *llmServer) getServerStatus(ctx context.Context) (ServerStatus, error) {
 		return ServerStatusError, fmt.Errorf("health unmarshal encode response: %w", err)
 	}
 
+	if status.Memory != nil && status.Memory.Batched && s.calibrated.CompareAndSwap(false, true) {
+		s.recordCalibration(*status.Memory)
+	}
+
 	switch status.Status {
 	case "ok":
 		return ServerStatusReady, nil
@@ -872,6 +881,11 @@ func (s *llmServer) Completion(ctx context.Context, req CompletionRequest, fn fu
 					EvalCount:          c.Timings.PredictedN,
 					EvalDuration:       parseDurationMs(c.Timings.PredictedMS),
 				})
+
+				// the runner measures memory usage after its first batch
+				if s.estimate.calibrationKey != "" && !s.calibrated.Load() {
+					s.getServerStatus(ctx)
+				}
 				return nil
 			}
 		}
@@ -74,6 +74,30 @@ func TestChatMiddleware(t *testing.T) {
 				Stream: &False,
 			},
 		},
+		{
+			name: "chat handler with reasoning",
+			body: `{
+				"model": "test-model",
+				"messages": [
+					{"role": "user", "content": "Hello"},
+					{"role": "assistant", "content": "Hi!", "reasoning_content": "The user said hello."},
+					{"role": "user", "content": "How are you?"}
+				]
+			}`,
+			req: api.ChatRequest{
+				Model: "test-model",
+				Messages: []api.Message{
+					{Role: "user", Content: "Hello"},
+					{Role: "assistant", Content: "Hi!", Thinking: "The user said hello."},
+					{Role: "user", Content: "How are you?"},
+				},
+				Options: map[string]any{
+					"temperature": 1.0,
+					"top_p":       1.0,
+				},
+				Stream: &False,
+			},
+		},
 		{
 			name: "chat handler with options",
 			body: `{
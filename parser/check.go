@@ -0,0 +1,214 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template"
+	"github.com/ollama/ollama/types/model"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// A Diagnostic is a problem found by Check. Line and Column are 1-based and
+// zero for problems with the Modelfile as a whole. File is empty for the
+// checked Modelfile and set to the path of an included one.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(d.File)
+		sb.WriteString(":")
+	}
+
+	if d.Line > 0 {
+		fmt.Fprintf(&sb, "%d:%d:", d.Line, d.Column)
+	}
+
+	if sb.Len() > 0 {
+		sb.WriteString(" ")
+	}
+
+	fmt.Fprintf(&sb, "%s: %s", d.Severity, d.Message)
+	return sb.String()
+}
+
+// HasErrors reports whether any of diags is an error.
+func HasErrors(diags []Diagnostic) bool {
+	return slices.ContainsFunc(diags, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// Check parses the Modelfile in r and checks it the way "ollama create" uses
+// it, reporting every problem found rather than stopping at the first. Paths
+// are relative to relativeDir. exists, if not nil, reports whether a model
+// named by a FROM line is available locally.
+func Check(r io.Reader, relativeDir string, exists func(name string) bool) []Diagnostic {
+	c := checker{exists: exists}
+	c.check(r, "", relativeDir, nil)
+
+	if !c.hasFrom {
+		c.diags = append(c.diags, Diagnostic{Severity: SeverityError, Message: errMissingFrom.Error()})
+	}
+
+	return c.diags
+}
+
+type checker struct {
+	exists  func(name string) bool
+	hasFrom bool
+	diags   []Diagnostic
+}
+
+// check checks the Modelfile in r, which is file when included by the
+// Modelfiles in stack.
+func (c *checker) check(r io.Reader, file, relativeDir string, stack []string) {
+	var diags []Diagnostic
+	f, positions, err := parse(r, &diags)
+	if err != nil {
+		diags = append(diags, Diagnostic{Severity: SeverityError, Message: err.Error()})
+	}
+
+	for i := range diags {
+		diags[i].File = file
+	}
+	c.diags = append(c.diags, diags...)
+
+	if f == nil {
+		return
+	}
+
+	for i, cmd := range f.Commands {
+		pos := positions[i]
+		report := func(severity Severity, format string, args ...any) {
+			c.diags = append(c.diags, Diagnostic{
+				Severity: severity,
+				File:     file,
+				Line:     pos.line,
+				Column:   pos.column,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		switch cmd.Name {
+		case "model":
+			c.hasFrom = true
+			c.checkFrom(cmd.Args, relativeDir, report)
+		case "adapter":
+			path, err := expandPath(cmd.Args, relativeDir)
+			if err == nil {
+				_, err = fileDigestMap(path)
+			}
+
+			if err != nil {
+				report(SeverityError, "adapter %s: %v", cmd.Args, err)
+			}
+		case "include":
+			path, err := expandPath(cmd.Args, relativeDir)
+			if err != nil {
+				report(SeverityError, "include %s: %v", cmd.Args, err)
+				continue
+			}
+
+			if i := slices.Index(stack, path); i >= 0 {
+				report(SeverityError, "%v: %s", errIncludeCycle, strings.Join(append(stack[i:], path), " -> "))
+				continue
+			}
+
+			included, err := os.Open(path)
+			if err != nil {
+				report(SeverityError, "include %s: %v", cmd.Args, err)
+				continue
+			}
+
+			c.check(included, path, filepath.Dir(path), append(stack, path))
+			included.Close()
+		case "template", "system", "license":
+			value := cmd.Args
+			if cmd.File {
+				path, err := expandPath(cmd.Args, relativeDir)
+				if err != nil {
+					report(SeverityError, "%s @%s: %v", cmd.Name, cmd.Args, err)
+					continue
+				}
+
+				bts, err := os.ReadFile(path)
+				if err != nil {
+					report(SeverityError, "%s @%s: %v", cmd.Name, cmd.Args, err)
+					continue
+				}
+
+				value = string(bts)
+			}
+
+			if cmd.Name == "template" {
+				if _, err := template.Parse(value); err != nil {
+					report(SeverityError, "invalid template: %v", err)
+				}
+			}
+		case "message":
+			// roles are checked while parsing
+		default:
+			if slices.Contains(deprecatedParameters, cmd.Name) {
+				report(SeverityWarning, "parameter %s is deprecated and is ignored", cmd.Name)
+				continue
+			}
+
+			if _, err := api.FormatParams(map[string][]string{cmd.Name: {cmd.Args}}); err != nil {
+				report(SeverityError, "parameter %s: %v", cmd.Name, err)
+			}
+		}
+	}
+}
+
+// checkFrom checks the target of a FROM line, which is a path to model files
+// if it exists or looks like a path, or else the name of a model.
+func (c *checker) checkFrom(from, relativeDir string, report func(Severity, string, ...any)) {
+	path, err := expandPath(from, relativeDir)
+	if err != nil {
+		report(SeverityError, "%s: %v", from, err)
+		return
+	}
+
+	if _, err := os.Stat(path); err == nil || looksLikePath(from) {
+		if _, err := fileDigestMap(path); err != nil {
+			report(SeverityError, "%s: %v", from, err)
+		}
+		return
+	}
+
+	name := model.ParseName(from)
+	if !name.IsValid() {
+		report(SeverityError, "%q is not a file or a valid model name", from)
+		return
+	}
+
+	if c.exists != nil && !c.exists(from) {
+		report(SeverityWarning, "model %s was not found locally and will be pulled", from)
+	}
+}
+
+func looksLikePath(s string) bool {
+	return filepath.IsAbs(s) ||
+		strings.HasPrefix(s, ".") ||
+		strings.HasPrefix(s, "~") ||
+		strings.HasPrefix(s, "/") ||
+		strings.HasPrefix(s, "\\") ||
+		slices.Contains([]string{".gguf", ".bin", ".safetensors"}, filepath.Ext(s))
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "model.gguf"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte("{{ .Prompt "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "base"), []byte("PARAMETER top_k ten\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "loop"), []byte("INCLUDE loop\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		input  string
+		expect []Diagnostic
+	}{
+		{
+			name:  "valid",
+			input: "FROM ./model.gguf\nPARAMETER temperature 0.5\nTEMPLATE {{ .Prompt }}\n",
+		},
+		{
+			name: "parameters",
+			input: `FROM ./model.gguf
+PARAMETER temprature 0.5
+PARAMETER top_k ten
+  PARAMETER penalize_newline true
+`,
+			expect: []Diagnostic{
+				{Severity: SeverityError, Line: 2, Column: 1, Message: "parameter temprature: unknown parameter 'temprature'"},
+				{Severity: SeverityError, Line: 3, Column: 1, Message: "parameter top_k: invalid int value [ten]"},
+				{Severity: SeverityWarning, Line: 4, Column: 3, Message: "parameter penalize_newline is deprecated and is ignored"},
+			},
+		},
+		{
+			name:  "syntax",
+			input: "FROM ./model.gguf\nBADCOMMAND foo\nMESSAGE robot hi\nSYSTEM ok\n",
+			expect: []Diagnostic{
+				{Severity: SeverityError, Line: 2, Column: 11, Message: errInvalidCommand.Error()},
+				{Severity: SeverityError, Line: 3, Column: 14, Message: errInvalidMessageRole.Error()},
+			},
+		},
+		{
+			name:  "templates",
+			input: "FROM ./model.gguf\nTEMPLATE \"{{ .Prompt \"\nTEMPLATE @bad.tmpl\nSYSTEM @missing.txt\n",
+			expect: []Diagnostic{
+				{Severity: SeverityError, Line: 2, Column: 1, Message: "invalid template: template: :1: unclosed action"},
+				{Severity: SeverityError, Line: 3, Column: 1, Message: "invalid template: template: :1: unclosed action"},
+				{Severity: SeverityError, Line: 4, Column: 1, Message: "system @missing.txt: open " + filepath.Join(dir, "missing.txt") + ": no such file or directory"},
+			},
+		},
+		{
+			name:  "missing from",
+			input: "FROM ./missing.gguf\nADAPTER ./missing\n",
+			expect: []Diagnostic{
+				{Severity: SeverityError, Line: 1, Column: 1, Message: "./missing.gguf: stat " + filepath.Join(dir, "missing.gguf") + ": no such file or directory"},
+				{Severity: SeverityError, Line: 2, Column: 1, Message: "adapter ./missing: stat " + filepath.Join(dir, "missing") + ": no such file or directory"},
+			},
+		},
+		{
+			name:  "model names",
+			input: "FROM llama3\nFROM missing\nFROM not a name\n",
+			expect: []Diagnostic{
+				{Severity: SeverityWarning, Line: 2, Column: 1, Message: "model missing was not found locally and will be pulled"},
+				{Severity: SeverityError, Line: 3, Column: 1, Message: `"not a name" is not a file or a valid model name`},
+			},
+		},
+		{
+			name:  "includes",
+			input: "INCLUDE base\nINCLUDE loop\n",
+			expect: []Diagnostic{
+				{Severity: SeverityError, File: filepath.Join(dir, "base"), Line: 1, Column: 1, Message: "parameter top_k: invalid int value [ten]"},
+				{Severity: SeverityError, File: filepath.Join(dir, "loop"), Line: 1, Column: 1, Message: "include cycle: " + filepath.Join(dir, "loop") + " -> " + filepath.Join(dir, "loop")},
+				{Severity: SeverityError, Message: "no FROM line"},
+			},
+		},
+		{
+			name:  "unterminated",
+			input: "FROM ./model.gguf\nSYSTEM \"\"\"You are\na bot.\n",
+			expect: []Diagnostic{
+				{Severity: SeverityError, Line: 2, Column: 1, Message: "unterminated quoted value"},
+			},
+		},
+	}
+
+	exists := func(name string) bool { return name == "llama3" }
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(strings.NewReader(tt.input), dir, exists)
+			if diff := cmp.Diff(tt.expect, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+
+			if HasErrors(got) != HasErrors(tt.expect) {
+				t.Errorf("expected HasErrors %t", HasErrors(tt.expect))
+			}
+		})
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	cases := []struct {
+		d      Diagnostic
+		expect string
+	}{
+		{Diagnostic{Severity: SeverityError, File: "Modelfile", Line: 2, Column: 3, Message: "oops"}, "Modelfile:2:3: error: oops"},
+		{Diagnostic{Severity: SeverityWarning, Line: 2, Column: 3, Message: "hmm"}, "2:3: warning: hmm"},
+		{Diagnostic{Severity: SeverityError, Message: "no FROM line"}, "error: no FROM line"},
+	}
+
+	for _, tt := range cases {
+		if got := tt.d.String(); got != tt.expect {
+			t.Errorf("expected %q, got %q", tt.expect, got)
+		}
+	}
+}
@@ -40,6 +40,12 @@ var deprecatedParameters = []string{"penalize_newline"}
 
 // CreateRequest creates a new *api.CreateRequest from an existing Modelfile
 func (f Modelfile) CreateRequest(relativeDir string) (*api.CreateRequest, error) {
+	expanded, err := f.Expand(relativeDir)
+	if err != nil {
+		return nil, err
+	}
+	f = *expanded
+
 	req := &api.CreateRequest{}
 
 	var messages []api.Message
@@ -269,6 +275,10 @@ func filesForModel(path string) ([]string, error) {
 type Command struct {
 	Name string
 	Args string
+
+	// File is set when Args is the path of a file holding the value, as in
+	// TEMPLATE @template.tmpl
+	File bool
 }
 
 func (c Command) String() string {
@@ -276,7 +286,22 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter":
+	case "include":
+		fmt.Fprintf(&sb, "INCLUDE %s", quote(c.Args))
+	case "license", "template", "system":
+		if c.File {
+			fmt.Fprintf(&sb, "%s @%s", strings.ToUpper(c.Name), c.Args)
+			break
+		}
+
+		// an unquoted value starting with @ would be read back as a file
+		args := quote(c.Args)
+		if strings.HasPrefix(c.Args, "@") {
+			args = quoted(c.Args)
+		}
+
+		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), args)
+	case "adapter":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
@@ -302,7 +327,8 @@ const (
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"include\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errIncludeCycle       = errors.New("include cycle")
 )
 
 type ParserError struct {
@@ -317,7 +343,37 @@ func (e *ParserError) Error() string {
 	return e.Msg
 }
 
+// ParseFile parses a Modelfile. It must have a FROM line unless it includes
+// another Modelfile, which is left to Expand.
 func ParseFile(r io.Reader) (*Modelfile, error) {
+	f, err := parseFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range f.Commands {
+		if cmd.Name == "model" || cmd.Name == "include" {
+			return f, nil
+		}
+	}
+
+	return nil, errMissingFrom
+}
+
+func parseFile(r io.Reader) (*Modelfile, error) {
+	f, _, err := parse(r, nil)
+	return f, err
+}
+
+// position is the line and column where a command starts
+type position struct {
+	line, column int
+}
+
+// parse parses the commands in r along with their positions. It stops at the
+// first error unless diags is set, in which case errors are added to diags
+// and parsing continues on the next line.
+func parse(r io.Reader, diags *[]Diagnostic) (*Modelfile, []position, error) {
 	var cmd Command
 	var curr state
 	var currLine int = 1
@@ -325,6 +381,37 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 	var role string
 
 	var f Modelfile
+	var positions []position
+
+	// line and column track the position of the current rune for
+	// diagnostics; unlike currLine they count \r\n as a single newline
+	line, column := 1, 0
+	var start position
+
+	// fail returns err, or adds it to diags and skips the rest of the line
+	// the error is on
+	fail := func(err error, r rune) error {
+		if diags == nil {
+			return err
+		}
+
+		msg := err.Error()
+		if perr := (*ParserError)(nil); errors.As(err, &perr) {
+			msg = perr.Msg
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			msg = "invalid or incomplete command"
+		}
+
+		*diags = append(*diags, Diagnostic{Severity: SeverityError, Line: line, Column: column, Message: msg})
+
+		b.Reset()
+		role = ""
+		curr = stateComment
+		if isNewline(r) {
+			curr = stateNil
+		}
+		return nil
+	}
 
 	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
 	br := bufio.NewReader(transform.NewReader(r, tr))
@@ -334,21 +421,35 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if isNewline(r) {
 			currLine++
 		}
 
+		switch {
+		case r == '\n':
+			line++
+			column = 0
+		case r != '\r':
+			column++
+		}
+
 		next, r, err := parseRuneForState(r, curr)
 		if errors.Is(err, io.ErrUnexpectedEOF) {
-			return nil, fmt.Errorf("%w: %s", err, b.String())
+			if err := fail(fmt.Errorf("%w: %s", err, b.String()), r); err != nil {
+				return nil, nil, err
+			}
+			continue
 		} else if err != nil {
-			return nil, &ParserError{
+			if err := fail(&ParserError{
 				LineNumber: currLine,
 				Msg:        err.Error(),
+			}, r); err != nil {
+				return nil, nil, err
 			}
+			continue
 		}
 
 		// process the state transition, some transitions need to be intercepted and redirected
@@ -356,10 +457,13 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 			switch curr {
 			case stateName:
 				if !isValidCommand(b.String()) {
-					return nil, &ParserError{
+					if err := fail(&ParserError{
 						LineNumber: currLine,
 						Msg:        errInvalidCommand.Error(),
+					}, r); err != nil {
+						return nil, nil, err
 					}
+					continue
 				}
 
 				// next state sometimes depends on the current buffer value
@@ -380,20 +484,25 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 				cmd.Name = b.String()
 			case stateMessage:
 				if !isValidMessageRole(b.String()) {
-					return nil, &ParserError{
+					if err := fail(&ParserError{
 						LineNumber: currLine,
 						Msg:        errInvalidMessageRole.Error(),
+					}, r); err != nil {
+						return nil, nil, err
 					}
+					continue
 				}
 
 				role = b.String()
 			case stateComment, stateNil:
-				// pass
+				if next == stateName {
+					start = position{line, column}
+				}
 			case stateValue:
 				s, ok := unquote(strings.TrimSpace(b.String()))
 				if !ok || isSpace(r) {
 					if _, err := b.WriteRune(r); err != nil {
-						return nil, err
+						return nil, nil, err
 					}
 
 					continue
@@ -404,8 +513,8 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 					role = ""
 				}
 
-				cmd.Args = s
-				f.Commands = append(f.Commands, cmd)
+				f.Commands = append(f.Commands, valueCommand(cmd.Name, s, b.String()))
+				positions = append(positions, start)
 			}
 
 			b.Reset()
@@ -414,7 +523,7 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 
 		if strconv.IsPrint(r) {
 			if _, err := b.WriteRune(r); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 	}
@@ -426,28 +535,137 @@ func ParseFile(r io.Reader) (*Modelfile, error) {
 	case stateValue:
 		s, ok := unquote(strings.TrimSpace(b.String()))
 		if !ok {
-			return nil, io.ErrUnexpectedEOF
+			if diags == nil {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+
+			*diags = append(*diags, Diagnostic{Severity: SeverityError, Line: start.line, Column: start.column, Message: "unterminated quoted value"})
+			break
 		}
 
 		if role != "" {
 			s = role + ": " + s
 		}
 
-		cmd.Args = s
-		f.Commands = append(f.Commands, cmd)
+		f.Commands = append(f.Commands, valueCommand(cmd.Name, s, b.String()))
+		positions = append(positions, start)
 	default:
-		return nil, io.ErrUnexpectedEOF
+		if diags == nil {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+
+		*diags = append(*diags, Diagnostic{Severity: SeverityError, Line: start.line, Column: start.column, Message: "missing value"})
 	}
 
-	for _, cmd := range f.Commands {
+	return &f, positions, nil
+}
+
+// valueCommand returns the command name with the value s, which was
+// unquoted from raw. An unquoted LICENSE, TEMPLATE or SYSTEM value starting
+// with @ is the path of a file holding the value.
+func valueCommand(name, s, raw string) Command {
+	switch name {
+	case "license", "template", "system":
+		if path, ok := strings.CutPrefix(strings.TrimSpace(raw), "@"); ok && path != "" {
+			return Command{Name: name, Args: path, File: true}
+		}
+	}
+
+	return Command{Name: name, Args: s}
+}
+
+// Expand returns f with its INCLUDE lines replaced by the commands of the
+// included Modelfiles and the file references of its LICENSE, TEMPLATE and
+// SYSTEM lines replaced by the contents of the files. Paths are relative to
+// the Modelfile they appear in, starting with relativeDir for f. The result
+// must have a FROM line, which may come from an included Modelfile.
+func (f Modelfile) Expand(relativeDir string) (*Modelfile, error) {
+	cmds, err := f.expand(relativeDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
 		if cmd.Name == "model" {
-			return &f, nil
+			return &Modelfile{Commands: cmds}, nil
 		}
 	}
 
 	return nil, errMissingFrom
 }
 
+// expand expands the commands of f, which was included by the Modelfiles in
+// stack.
+func (f Modelfile) expand(relativeDir string, stack []string) ([]Command, error) {
+	var cmds []Command
+	for _, c := range f.Commands {
+		switch {
+		case c.Name == "include":
+			path, err := expandPath(c.Args, relativeDir)
+			if err != nil {
+				return nil, err
+			}
+
+			if i := slices.Index(stack, path); i >= 0 {
+				return nil, fmt.Errorf("%w: %s", errIncludeCycle, strings.Join(append(stack[i:], path), " -> "))
+			}
+
+			included, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+
+			expanded, err := included.expand(filepath.Dir(path), append(stack, path))
+			if err != nil {
+				return nil, err
+			}
+
+			cmds = append(cmds, expanded...)
+		case c.File:
+			path, err := expandPath(c.Args, relativeDir)
+			if err != nil {
+				return nil, err
+			}
+
+			bts, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			cmds = append(cmds, Command{Name: c.Name, Args: string(bts)})
+		case len(stack) > 0 && (c.Name == "model" || c.Name == "adapter"):
+			// paths in included Modelfiles are relative to the included
+			// Modelfile, anything else is a model name
+			if path, err := expandPath(c.Args, relativeDir); err == nil {
+				if _, err := os.Stat(path); err == nil {
+					c.Args = path
+				}
+			}
+
+			cmds = append(cmds, c)
+		default:
+			cmds = append(cmds, c)
+		}
+	}
+
+	return cmds, nil
+}
+
+func parsePath(path string) (*Modelfile, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := parseFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f, nil
+}
+
 func parseRuneForState(r rune, cs state) (state, rune, error) {
 	switch cs {
 	case stateNil:
@@ -509,16 +727,21 @@ func parseRuneForState(r rune, cs state) (state, rune, error) {
 
 func quote(s string) string {
 	if strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasSuffix(s, " ") {
-		if strings.Contains(s, "\"") {
-			return `"""` + s + `"""`
-		}
-
-		return `"` + s + `"`
+		return quoted(s)
 	}
 
 	return s
 }
 
+// quoted returns s in quotes, using triple quotes if s contains a quote
+func quoted(s string) string {
+	if strings.Contains(s, "\"") {
+		return `"""` + s + `"""`
+	}
+
+	return `"` + s + `"`
+}
+
 func unquote(s string) (string, bool) {
 	// TODO: single quotes
 	if len(s) >= 3 && s[:3] == `"""` {
@@ -562,7 +785,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "parameter", "message":
+	case "from", "include", "license", "template", "system", "adapter", "parameter", "message":
 		return true
 	default:
 		return false
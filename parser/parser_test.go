@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"unicode/utf16"
@@ -830,3 +831,112 @@ func TestCreateRequestFiles(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFileInclude(t *testing.T) {
+	input := `
+INCLUDE ./base/Modelfile
+TEMPLATE @template.tmpl
+SYSTEM "@not a file"
+`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expected := []Command{
+		{Name: "include", Args: "./base/Modelfile"},
+		{Name: "template", Args: "template.tmpl", File: true},
+		{Name: "system", Args: "@not a file"},
+	}
+
+	assert.Equal(t, expected, modelfile.Commands)
+	assert.Equal(t, "INCLUDE ./base/Modelfile\nTEMPLATE @template.tmpl\nSYSTEM \"@not a file\"\n", modelfile.String())
+
+	// the value is still not a file once written and read back
+	roundtrip, err := ParseFile(strings.NewReader(modelfile.String()))
+	require.NoError(t, err)
+	assert.Equal(t, expected, roundtrip.Commands)
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("base/model.gguf", "")
+	writeFile("base/template.tmpl", "{{ .Prompt }}")
+	writeFile("base/Modelfile", `FROM ./model.gguf
+TEMPLATE @template.tmpl
+PARAMETER temperature 0.5
+MESSAGE user Hello
+`)
+	writeFile("params/Modelfile", "PARAMETER top_k 10\n")
+	writeFile("system.txt", "You are a bot.")
+	writeFile("cycle/a", "INCLUDE b\n")
+	writeFile("cycle/b", "INCLUDE a\n")
+
+	cases := []struct {
+		name     string
+		input    string
+		expected []Command
+		err      error
+	}{
+		{
+			name: "inherit",
+			input: `INCLUDE base/Modelfile
+INCLUDE params/Modelfile
+SYSTEM @system.txt
+PARAMETER temperature 0.8
+`,
+			expected: []Command{
+				{Name: "model", Args: filepath.Join(dir, "base", "model.gguf")},
+				{Name: "template", Args: "{{ .Prompt }}"},
+				{Name: "temperature", Args: "0.5"},
+				{Name: "message", Args: "user: Hello"},
+				{Name: "top_k", Args: "10"},
+				{Name: "system", Args: "You are a bot."},
+				{Name: "temperature", Args: "0.8"},
+			},
+		},
+		{
+			name:     "model name",
+			input:    "FROM llama3\nINCLUDE params/Modelfile\n",
+			expected: []Command{{Name: "model", Args: "llama3"}, {Name: "top_k", Args: "10"}},
+		},
+		{
+			name:  "missing from",
+			input: "INCLUDE params/Modelfile\n",
+			err:   errMissingFrom,
+		},
+		{
+			name:  "cycle",
+			input: "FROM llama3\nINCLUDE cycle/a\n",
+			err:   errIncludeCycle,
+		},
+		{
+			name:  "missing file",
+			input: "FROM llama3\nSYSTEM @missing.txt\n",
+			err:   os.ErrNotExist,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			modelfile, err := ParseFile(strings.NewReader(tt.input))
+			require.NoError(t, err)
+
+			expanded, err := modelfile.Expand(dir)
+			require.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, tt.expected, expanded.Commands)
+			}
+		})
+	}
+}
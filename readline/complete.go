@@ -0,0 +1,70 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Completer returns the completions of the last word of line, which is the
+// text before the cursor. Words are separated by spaces and each completion
+// replaces the whole word. A completion ending in "/" is a directory and
+// isn't followed by a space.
+type Completer func(line string) []string
+
+// complete completes the word before the cursor. A single completion is
+// inserted, otherwise the completions are extended to their common prefix or
+// listed if there's nothing to extend.
+func (i *Instance) complete(buf *Buffer) *Buffer {
+	var line string
+	if buf.Pos > 0 {
+		line = buf.StringNM(0, buf.Pos)
+	}
+
+	word := []rune(line[strings.LastIndexByte(line, ' ')+1:])
+
+	completions := i.Completer(line)
+	switch len(completions) {
+	case 0:
+		fmt.Print(string(rune(CharBell)))
+		return buf
+	case 1:
+		for _, r := range []rune(completions[0])[len(word):] {
+			buf.Add(r)
+		}
+
+		if !strings.HasSuffix(completions[0], "/") {
+			buf.Add(' ')
+		}
+
+		return buf
+	}
+
+	if prefix := []rune(commonPrefix(completions)); len(prefix) > len(word) {
+		for _, r := range prefix[len(word):] {
+			buf.Add(r)
+		}
+
+		return buf
+	}
+
+	s, pos := buf.String(), buf.Pos
+	buf.MoveToEnd()
+	fmt.Print("\n" + strings.Join(completions, "  ") + "\n")
+	return i.redraw(s, pos)
+}
+
+// commonPrefix returns the longest prefix of all of ss.
+func commonPrefix(ss []string) string {
+	prefix := []rune(ss[0])
+	for _, s := range ss[1:] {
+		rs := []rune(s)
+		n := 0
+		for n < len(prefix) && n < len(rs) && prefix[n] == rs[n] {
+			n++
+		}
+
+		prefix = prefix[:n]
+	}
+
+	return string(prefix)
+}
@@ -0,0 +1,99 @@
+package readline
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editBuffer opens the contents of buf in an external editor. If the edited
+// text isn't empty, it is printed after the prompt and returned with true.
+// Otherwise the text to continue editing is returned with false.
+func (i *Instance) editBuffer(buf *Buffer) (string, bool) {
+	s := buf.String()
+	buf.MoveToEnd()
+
+	output, err := i.edit(s)
+	if err != nil {
+		fmt.Printf("\nerror: %v\n", err)
+		return s, false
+	}
+
+	buf.Replace(nil)
+	if strings.TrimSpace(output) == "" {
+		fmt.Print(CursorBOL + ClearToEOL)
+		return "", false
+	}
+
+	fmt.Println(strings.ReplaceAll(output, "\n", "\n"+i.Prompt.AltPrompt))
+
+	// the history is saved one line per entry
+	if !strings.Contains(output, "\n") {
+		i.History.Add(output)
+	}
+
+	return output, true
+}
+
+// edit opens s in the editor named by VISUAL or EDITOR and returns the text
+// once the editor exits.
+func (i *Instance) edit(s string) (string, error) {
+	f, err := os.CreateTemp("", "ollama-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(s); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	args := strings.Fields(cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), defaultEditor()))
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fd := os.Stdin.Fd()
+	if err := UnsetRawMode(fd, i.Terminal.termios); err != nil {
+		return "", err
+	}
+
+	err = cmd.Run()
+
+	termios, rawErr := SetRawMode(fd)
+	if rawErr != nil {
+		return "", rawErr
+	}
+	i.Terminal.termios = termios
+
+	// editors may turn bracketed paste off when they exit
+	fmt.Print(StartBracketedPaste)
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	bts, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(bts), "\r\n"), nil
+}
+
+func defaultEditor() string {
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+
+	return "vi"
+}
@@ -149,3 +149,19 @@ func (h *History) Save() error {
 
 	return nil
 }
+
+// Search returns the index of the latest line before from that contains
+// query.
+func (h *History) Search(query string, from int) (int, bool) {
+	if query == "" {
+		return 0, false
+	}
+
+	for n := min(from, h.Size()) - 1; n >= 0; n-- {
+		if line, _ := h.Buf.Get(n); strings.Contains(line, query) {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
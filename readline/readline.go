@@ -30,16 +30,17 @@ func (p *Prompt) placeholder() string {
 }
 
 type Terminal struct {
-	outchan chan rune
+	reader  *bufio.Reader
 	rawmode bool
 	termios any
 }
 
 type Instance struct {
-	Prompt   *Prompt
-	Terminal *Terminal
-	History  *History
-	Pasting  bool
+	Prompt    *Prompt
+	Terminal  *Terminal
+	History   *History
+	Completer Completer
+	Pasting   bool
 }
 
 func New(prompt Prompt) (*Instance, error) {
@@ -90,6 +91,7 @@ func (i *Instance) Readline() (string, error) {
 	var esc bool
 	var escex bool
 	var metaDel bool
+	var ctrlX bool
 
 	var currentLineBuf []rune
 
@@ -111,7 +113,20 @@ func (i *Instance) Readline() (string, error) {
 			return "", io.EOF
 		}
 
-		if escex {
+		if ctrlX {
+			ctrlX = false
+
+			if r == CharLineEnd {
+				output, ok := i.editBuffer(buf)
+				if !ok {
+					buf = i.redraw(output, len([]rune(output)))
+					continue
+				}
+
+				return output, nil
+			}
+			continue
+		} else if escex {
 			escex = false
 
 			switch r {
@@ -196,10 +211,40 @@ func (i *Instance) Readline() (string, error) {
 		case CharBackspace, CharCtrlH:
 			buf.Remove()
 		case CharTab:
+			if i.Completer != nil && !i.Pasting {
+				buf = i.complete(buf)
+				continue
+			}
+
 			// todo: convert back to real tabs
 			for range 8 {
 				buf.Add(' ')
 			}
+		case CharBckSearch:
+			buf.MoveToEnd()
+			orig := buf.String()
+			buf.Replace(nil)
+
+			line, r, err := i.search(orig)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Print(CursorBOL + ClearToEOL)
+			buf = i.redraw(line, len([]rune(line)))
+			switch r {
+			case CharEnter, CharCtrlJ:
+				if line != "" {
+					i.History.Add(line)
+				}
+				fmt.Println()
+
+				return line, nil
+			case CharEsc:
+				esc = true
+			}
+		case CharCtrlX:
+			ctrlX = true
 		case CharDelete:
 			if buf.DisplaySize() > 0 {
 				buf.Delete()
@@ -246,6 +291,22 @@ func (i *Instance) HistoryDisable() {
 	i.History.Enabled = false
 }
 
+// redraw prints the prompt followed by s on a new buffer with the cursor at
+// pos and returns the buffer.
+func (i *Instance) redraw(s string, pos int) *Buffer {
+	buf, _ := NewBuffer(i.Prompt)
+	fmt.Print(i.Prompt.prompt())
+	for _, r := range s {
+		buf.Add(r)
+	}
+
+	for buf.Pos > pos {
+		buf.MoveLeft()
+	}
+
+	return buf
+}
+
 func NewTerminal() (*Terminal, error) {
 	fd := os.Stdin.Fd()
 	termios, err := SetRawMode(fd)
@@ -254,32 +315,19 @@ func NewTerminal() (*Terminal, error) {
 	}
 
 	t := &Terminal{
-		outchan: make(chan rune),
+		reader:  bufio.NewReader(os.Stdin),
 		rawmode: true,
 		termios: termios,
 	}
 
-	go t.ioloop()
-
 	return t, nil
 }
 
-func (t *Terminal) ioloop() {
-	buf := bufio.NewReader(os.Stdin)
-
-	for {
-		r, _, err := buf.ReadRune()
-		if err != nil {
-			close(t.outchan)
-			break
-		}
-		t.outchan <- r
-	}
-}
-
+// Read reads the next rune. Stdin is only read while a rune is wanted so
+// programs started in between, such as an editor, get all of their input.
 func (t *Terminal) Read() (rune, error) {
-	r, ok := <-t.outchan
-	if !ok {
+	r, _, err := t.reader.ReadRune()
+	if err != nil {
 		return 0, io.EOF
 	}
 
@@ -0,0 +1,76 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// search incrementally searches the history for lines containing what is
+// typed, starting from the latest line. Typing Ctrl-R again finds the next
+// older line. It returns the line found, or orig if the search is cancelled
+// with Ctrl-C or Ctrl-G, and the key that ended the search.
+func (i *Instance) search(orig string) (string, rune, error) {
+	var query []rune
+	var match string
+	var failing bool
+	pos := i.History.Size()
+
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		width = w
+	}
+
+	find := func(from int) {
+		n, ok := i.History.Search(string(query), from)
+		failing = !ok && len(query) > 0
+		if ok {
+			pos = n
+			match, _ = i.History.Buf.Get(n)
+		}
+	}
+
+	for {
+		status := "reverse-i-search"
+		if failing {
+			status = "failing " + status
+		}
+
+		s := fmt.Sprintf("(%s)`%s': ", status, string(query))
+		s += runewidth.Truncate(match, width-runewidth.StringWidth(s)-1, "")
+		fmt.Print(CursorBOL + ClearToEOL + s)
+
+		r, err := i.Terminal.Read()
+		if err != nil {
+			return "", 0, io.EOF
+		}
+
+		switch r {
+		case CharBckSearch:
+			find(pos)
+		case CharBackspace, CharCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match, pos = "", i.History.Size()
+				find(pos)
+			}
+		case CharInterrupt, CharBell:
+			return orig, r, nil
+		default:
+			if r < CharSpace {
+				if match == "" {
+					return orig, r, nil
+				}
+
+				return match, r, nil
+			}
+
+			query = append(query, r)
+			// the current match may still match the longer query
+			find(pos + 1)
+		}
+	}
+}
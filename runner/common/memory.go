@@ -0,0 +1,136 @@
+package common
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+)
+
+// DeviceMemory is the VRAM used by the runner on a single GPU
+type DeviceMemory struct {
+	ID      string `json:"id"`
+	Library string `json:"library"`
+
+	// Load is the memory in use once the model finished loading
+	Load uint64 `json:"load"`
+
+	// Peak is the largest usage observed, including the first batch
+	Peak uint64 `json:"peak"`
+}
+
+// MemoryUsage is reported by the runner's health endpoint once the model is
+// loaded. Batched is set after the first batch has been processed so that
+// graph allocations are included in Peak.
+type MemoryUsage struct {
+	Devices []DeviceMemory `json:"devices"`
+	Batched bool           `json:"batched"`
+}
+
+// MemoryTracker measures the VRAM used by this process as the drop in free
+// memory reported by each GPU since the tracker was created. Other processes
+// allocating on the same GPUs will skew the measurement.
+type MemoryTracker struct {
+	mu       sync.Mutex
+	baseline map[string]uint64
+	usage    *MemoryUsage
+}
+
+// NewMemoryTracker records the current free memory of every GPU. It must be
+// called before the model is loaded.
+func NewMemoryTracker() *MemoryTracker {
+	t := &MemoryTracker{baseline: make(map[string]uint64)}
+	for _, gpu := range discover.GetGPUInfo() {
+		if gpu.Library == "cpu" {
+			continue
+		}
+
+		t.baseline[gpu.ID] = gpu.FreeMemory
+	}
+
+	return t
+}
+
+// Loaded measures usage after the model has been loaded. Like the other
+// methods, it does nothing on a nil tracker so runners without GPUs can skip
+// tracking.
+func (t *MemoryTracker) Loaded() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := &MemoryUsage{}
+	for _, gpu := range t.measure() {
+		usage.Devices = append(usage.Devices, DeviceMemory{ID: gpu.ID, Library: gpu.Library, Load: gpu.Load, Peak: gpu.Load})
+	}
+
+	t.usage = usage
+}
+
+// Batched measures usage after the first batch. Later calls are ignored.
+func (t *MemoryTracker) Batched() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.usage == nil || t.usage.Batched {
+		return
+	}
+
+	for _, gpu := range t.measure() {
+		for i := range t.usage.Devices {
+			if d := &t.usage.Devices[i]; d.ID == gpu.ID {
+				d.Peak = max(d.Peak, gpu.Load)
+			}
+		}
+	}
+
+	t.usage.Batched = true
+	for _, d := range t.usage.Devices {
+		slog.Info("measured gpu memory", "id", d.ID, "library", d.Library, "load", format.HumanBytes2(d.Load), "peak", format.HumanBytes2(d.Peak))
+	}
+}
+
+// Usage returns the measurements so far, or nil if the model hasn't loaded.
+func (t *MemoryTracker) Usage() *MemoryUsage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.usage == nil {
+		return nil
+	}
+
+	usage := *t.usage
+	usage.Devices = append([]DeviceMemory(nil), t.usage.Devices...)
+	return &usage
+}
+
+func (t *MemoryTracker) measure() []DeviceMemory {
+	var devices []DeviceMemory
+	for _, gpu := range discover.GetGPUInfo() {
+		before, ok := t.baseline[gpu.ID]
+		if !ok {
+			continue
+		}
+
+		var used uint64
+		if before > gpu.FreeMemory {
+			used = before - gpu.FreeMemory
+		}
+
+		devices = append(devices, DeviceMemory{ID: gpu.ID, Library: gpu.Library, Load: used})
+	}
+
+	return devices
+}
@@ -261,6 +261,9 @@ type Server struct {
 	// KV cache
 	cache *InputCache
 
+	// measures the VRAM actually used, nil when no layers are offloaded
+	memory *common.MemoryTracker
+
 	// next sequence for prompt processing to avoid starvation
 	nextSeq int
 }
@@ -437,6 +440,8 @@ func (s *Server) processBatch(tokenBatch *llama.Batch, embedBatch *llama.Batch)
 		return fmt.Errorf("failed to decode batch: %w", err)
 	}
 
+	s.memory.Batched()
+
 	if crossAttention {
 		// synchronize state to ensure the cross attention batch is complete.
 		// needed specifically for multi-GPU systems otherwise an inflight
@@ -565,6 +570,32 @@ type Options struct {
 	Stop             []string `json:"stop"`
 }
 
+// defaultOptions returns the default options of the api package, which the
+// options of completion requests override. Options the server handles itself,
+// such as the thinking delimiters, are left out.
+func defaultOptions() Options {
+	opts := api.DefaultOptions()
+	return Options{
+		Runner:           opts.Runner,
+		NumKeep:          opts.NumKeep,
+		Seed:             opts.Seed,
+		NumPredict:       opts.NumPredict,
+		TopK:             opts.TopK,
+		TopP:             opts.TopP,
+		MinP:             opts.MinP,
+		TypicalP:         opts.TypicalP,
+		RepeatLastN:      opts.RepeatLastN,
+		Temperature:      opts.Temperature,
+		RepeatPenalty:    opts.RepeatPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		Mirostat:         opts.Mirostat,
+		MirostatTau:      opts.MirostatTau,
+		MirostatEta:      opts.MirostatEta,
+		Stop:             opts.Stop,
+	}
+}
+
 type ImageData struct {
 	Data          []byte `json:"data"`
 	ID            int    `json:"id"`
@@ -604,7 +635,7 @@ type CompletionResponse struct {
 
 func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	var req CompletionRequest
-	req.Options = Options(api.DefaultOptions())
+	req.Options = defaultOptions()
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
@@ -790,8 +821,9 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 }
 
 type HealthResponse struct {
-	Status   string  `json:"status"`
-	Progress float32 `json:"progress"`
+	Status   string              `json:"status"`
+	Progress float32             `json:"progress"`
+	Memory   *common.MemoryUsage `json:"memory,omitempty"`
 }
 
 type ServerStatus int
@@ -818,6 +850,7 @@ func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(&HealthResponse{
 		Status:   s.status.ToString(),
 		Progress: s.progress,
+		Memory:   s.memory.Usage(),
 	}); err != nil {
 		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 	}
@@ -879,6 +912,8 @@ func (s *Server) loadModel(
 		panic(err)
 	}
 
+	s.memory.Loaded()
+
 	s.status = ServerStatusReady
 	s.ready.Done()
 }
@@ -961,6 +996,10 @@ func Execute(args []string) error {
 		},
 	}
 
+	if *nGpuLayers > 0 {
+		server.memory = common.NewMemoryTracker()
+	}
+
 	server.ready.Add(1)
 	go server.loadModel(params, *mpath, lpaths, *ppath, *kvSize, *kvCacheType, *flashAttention, *threads, *multiUserCache)
 
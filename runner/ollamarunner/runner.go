@@ -251,6 +251,9 @@ type Server struct {
 	// KV cache
 	cache *InputCache
 
+	// measures the VRAM actually used, nil when no layers are offloaded
+	memory *common.MemoryTracker
+
 	// multimodalHash generates hashes for comparing equality
 	// of non-text data
 	multimodalHash maphash.Hash
@@ -391,6 +394,8 @@ func (s *Server) processBatch() error {
 		return fmt.Errorf("failed to decode batch: %w", err)
 	}
 
+	s.memory.Batched()
+
 	logits := modelOutput.Floats()
 
 	for i, seq := range s.seqs {
@@ -519,6 +524,32 @@ type Options struct {
 	Stop             []string `json:"stop"`
 }
 
+// defaultOptions returns the default options of the api package, which the
+// options of completion requests override. Options the server handles itself,
+// such as the thinking delimiters, are left out.
+func defaultOptions() Options {
+	opts := api.DefaultOptions()
+	return Options{
+		Runner:           opts.Runner,
+		NumKeep:          opts.NumKeep,
+		Seed:             opts.Seed,
+		NumPredict:       opts.NumPredict,
+		TopK:             opts.TopK,
+		TopP:             opts.TopP,
+		MinP:             opts.MinP,
+		TypicalP:         opts.TypicalP,
+		RepeatLastN:      opts.RepeatLastN,
+		Temperature:      opts.Temperature,
+		RepeatPenalty:    opts.RepeatPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		Mirostat:         opts.Mirostat,
+		MirostatTau:      opts.MirostatTau,
+		MirostatEta:      opts.MirostatEta,
+		Stop:             opts.Stop,
+	}
+}
+
 type ImageData struct {
 	Data          []byte `json:"data"`
 	ID            int    `json:"id"`
@@ -558,7 +589,7 @@ type CompletionResponse struct {
 
 func (s *Server) completion(w http.ResponseWriter, r *http.Request) {
 	var req CompletionRequest
-	req.Options = Options(api.DefaultOptions())
+	req.Options = defaultOptions()
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
@@ -738,8 +769,9 @@ func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
 }
 
 type HealthResponse struct {
-	Status   string  `json:"status"`
-	Progress float32 `json:"progress"`
+	Status   string              `json:"status"`
+	Progress float32             `json:"progress"`
+	Memory   *common.MemoryUsage `json:"memory,omitempty"`
 }
 
 type ServerStatus int
@@ -766,6 +798,7 @@ func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(&HealthResponse{
 		Status:   s.status.ToString(),
 		Progress: s.progress,
+		Memory:   s.memory.Usage(),
 	}); err != nil {
 		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
 	}
@@ -816,6 +849,8 @@ func (s *Server) loadModel(
 	s.seqs = make([]*Sequence, s.parallel)
 	s.seqsSem = semaphore.NewWeighted(int64(s.parallel))
 
+	s.memory.Loaded()
+
 	s.status = ServerStatusReady
 	s.ready.Done()
 }
@@ -893,6 +928,10 @@ func Execute(args []string) error {
 		FlashAttention: *flashAttention,
 	}
 
+	if *numGPULayers > 0 {
+		server.memory = common.NewMemoryTracker()
+	}
+
 	server.ready.Add(1)
 	go server.loadModel(*mpath, params, lpaths, *parallel, *kvCacheType, *kvSize, *multiUserCache)
 
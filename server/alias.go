@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+// MediaTypeAlias is the media type of an alias, which is stored in the
+// manifest directory in place of a manifest and refers to another model by
+// name. Aliases are resolved when they are read so an alias follows its
+// target as it is pulled or created again.
+const MediaTypeAlias = "application/vnd.ollama.alias.v1+json"
+
+// maxAliasDepth is the most aliases followed to resolve a name
+const maxAliasDepth = 8
+
+var (
+	errAliasDepth    = errors.New("too many levels of aliases")
+	errNotAlias      = errors.New("not an alias")
+	errAliasSelf     = errors.New("alias cannot refer to itself")
+	errAliasNotFound = errors.New("alias target not found")
+)
+
+type aliasRef struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	MediaType     string `json:"mediaType"`
+	Target        string `json:"target"`
+}
+
+// parseAlias returns the target of the alias in bts, or false if bts is not
+// an alias.
+func parseAlias(bts []byte) (model.Name, bool) {
+	var ref aliasRef
+	if err := json.Unmarshal(bts, &ref); err != nil || ref.MediaType != MediaTypeAlias {
+		return model.Name{}, false
+	}
+
+	return model.ParseName(ref.Target), true
+}
+
+// readAlias returns the target of the alias n. It returns errNotAlias if n
+// is a model.
+func readAlias(n model.Name) (model.Name, error) {
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	bts, err := os.ReadFile(filepath.Join(manifests, n.Filepath()))
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	target, ok := parseAlias(bts)
+	if !ok {
+		return model.Name{}, fmt.Errorf("%s: %w", n.DisplayShortest(), errNotAlias)
+	}
+
+	return target, nil
+}
+
+// SetAlias points the alias at target, creating the alias if it doesn't
+// exist. The alias is replaced atomically so readers see either the old or
+// the new target. An existing model can't be replaced by an alias.
+func SetAlias(alias, target model.Name) error {
+	if !alias.IsFullyQualified() {
+		return model.Unqualified(alias)
+	}
+	if !target.IsFullyQualified() {
+		return model.Unqualified(target)
+	}
+
+	// follow the target to check it exists and doesn't lead back to the alias
+	for n, depth := target, 0; ; depth++ {
+		if n.Filepath() == alias.Filepath() {
+			return errAliasSelf
+		}
+
+		if depth >= maxAliasDepth {
+			return errAliasDepth
+		}
+
+		next, err := readAlias(n)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", errAliasNotFound, target.DisplayShortest())
+		} else if errors.Is(err, errNotAlias) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		n = next
+	}
+
+	if _, err := readAlias(alias); errors.Is(err, errNotAlias) {
+		return fmt.Errorf("model %s already exists and is not an alias", alias.DisplayShortest())
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(manifests, alias.Filepath())
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".alias-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(aliasRef{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeAlias,
+		Target:        target.String(),
+	}); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// RemoveAlias removes the alias, leaving its target in place.
+func RemoveAlias(alias model.Name) error {
+	if _, err := readAlias(alias); err != nil {
+		return err
+	}
+
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(manifests, alias.Filepath())); err != nil {
+		return err
+	}
+
+	return PruneDirectory(manifests)
+}
+
+// Aliases returns the target of every alias, including aliases whose
+// target no longer exists.
+func Aliases() (map[model.Name]model.Name, error) {
+	manifests, err := GetManifestPath()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(manifests, "*", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[model.Name]model.Name)
+	for _, match := range matches {
+		rel, err := filepath.Rel(manifests, match)
+		if err != nil {
+			continue
+		}
+
+		n := model.ParseNameFromFilepath(rel)
+		if !n.IsValid() {
+			continue
+		}
+
+		target, err := readAlias(n)
+		if err != nil {
+			continue
+		}
+
+		aliases[n] = target
+	}
+
+	return aliases, nil
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/openai"
+)
+
+// The scopes of API keys. Admin keys can also use inference routes.
+const (
+	scopeInference = "inference"
+	scopeAdmin     = "admin"
+)
+
+// APIKeys are the keys that can access the server. They're read from the
+// JSON file named by OLLAMA_API_KEYS when the server starts and again on
+// SIGHUP. Without the file, the server doesn't require keys.
+type APIKeys struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// APIKey is a single key in [APIKeys]. Keys are sent as bearer tokens in the
+// Authorization header.
+type APIKey struct {
+	// Name identifies the key in logs and usage. Usage is kept across
+	// reloads for keys with the same name.
+	Name string `json:"name"`
+	Key  string `json:"key"`
+
+	// Scope is inference, the default, to use and list models, or admin to
+	// also pull, push, create, copy and delete them
+	Scope string `json:"scope,omitempty"`
+
+	// RequestsPerMinute limits the requests made with the key
+	RequestsPerMinute int64 `json:"requests_per_minute,omitempty"`
+
+	// TokensPerMinute limits the tokens generated for requests made with
+	// the key. A request is allowed while the limit isn't used up, so the
+	// limit can be exceeded by the tokens of requests in progress.
+	TokensPerMinute int64 `json:"tokens_per_minute,omitempty"`
+}
+
+// minKeyLength is the shortest key allowed
+const minKeyLength = 16
+
+// readAPIKeys reads the API keys in the file at path.
+func readAPIKeys(path string) (*APIKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+
+	var keys APIKeys
+	if err := d.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	secrets := make(map[string]bool)
+	for i, k := range keys.Keys {
+		switch {
+		case k.Name == "":
+			return nil, fmt.Errorf("%s: key %d: name is required", path, i)
+		case names[k.Name]:
+			return nil, fmt.Errorf("%s: %s: duplicate name", path, k.Name)
+		case len(k.Key) < minKeyLength:
+			return nil, fmt.Errorf("%s: %s: key must be at least %d characters", path, k.Name, minKeyLength)
+		case secrets[k.Key]:
+			return nil, fmt.Errorf("%s: %s: duplicate key", path, k.Name)
+		case k.Scope != "" && k.Scope != scopeInference && k.Scope != scopeAdmin:
+			return nil, fmt.Errorf("%s: %s: invalid scope %q", path, k.Name, k.Scope)
+		case k.RequestsPerMinute < 0 || k.TokensPerMinute < 0:
+			return nil, fmt.Errorf("%s: %s: limits cannot be negative", path, k.Name)
+		}
+
+		names[k.Name] = true
+		secrets[k.Key] = true
+	}
+
+	return &keys, nil
+}
+
+// apiKeyring holds the API keys in use. A nil keyring allows every request.
+type apiKeyring struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]*apiKey
+
+	// usage is kept by name across reloads
+	usage map[string]*apiKeyUsage
+}
+
+// apiKey is an API key in use
+type apiKey struct {
+	APIKey
+	*apiKeyUsage
+}
+
+// apiKeyUsage holds the limits and usage of an API key
+type apiKeyUsage struct {
+	requests tokenBucket
+	tokens   tokenBucket
+
+	requestCount atomic.Int64
+	promptTokens atomic.Int64
+	evalTokens   atomic.Int64
+}
+
+// load reads the keys in the file at path and replaces the keys in use,
+// keeping the current keys if the file is invalid.
+func (k *apiKeyring) load(path string) error {
+	keys, err := readAPIKeys(path)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.usage == nil {
+		k.usage = make(map[string]*apiKeyUsage)
+	}
+
+	k.keys = make(map[[sha256.Size]byte]*apiKey)
+	for _, ak := range keys.Keys {
+		ak.Scope = cmp.Or(ak.Scope, scopeInference)
+
+		usage, ok := k.usage[ak.Name]
+		if !ok {
+			usage = &apiKeyUsage{}
+			k.usage[ak.Name] = usage
+		}
+		usage.requests.SetLimit(ak.RequestsPerMinute)
+		usage.tokens.SetLimit(ak.TokensPerMinute)
+
+		k.keys[sha256.Sum256([]byte(ak.Key))] = &apiKey{APIKey: ak, apiKeyUsage: usage}
+	}
+
+	return nil
+}
+
+// apiKeyError is an error authorizing a request
+type apiKeyError struct {
+	status     int
+	message    string
+	retryAfter time.Duration
+}
+
+func (e *apiKeyError) Error() string {
+	return e.message
+}
+
+// check returns the key of r if it is allowed to make a request to a route
+// of scope, taking a request from the limits of the key.
+func (k *apiKeyring) check(r *http.Request, scope string) (*apiKey, *apiKeyError) {
+	if k == nil {
+		return nil, nil
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || secret == "" {
+		return nil, &apiKeyError{status: http.StatusUnauthorized, message: "missing API key"}
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[sha256.Sum256([]byte(secret))]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, &apiKeyError{status: http.StatusUnauthorized, message: "invalid API key"}
+	}
+
+	if scope == scopeAdmin && key.Scope != scopeAdmin {
+		return nil, &apiKeyError{status: http.StatusForbidden, message: fmt.Sprintf("API key %q doesn't have the admin scope", key.Name)}
+	}
+
+	if scope == scopeInference {
+		if d := key.tokens.take(0); d > 0 {
+			return nil, &apiKeyError{status: http.StatusTooManyRequests, message: fmt.Sprintf("API key %q exceeded its limit of %d tokens per minute", key.Name, key.TokensPerMinute), retryAfter: d}
+		}
+	}
+
+	if d := key.requests.take(1); d > 0 {
+		return nil, &apiKeyError{status: http.StatusTooManyRequests, message: fmt.Sprintf("API key %q exceeded its limit of %d requests per minute", key.Name, key.RequestsPerMinute), retryAfter: d}
+	}
+
+	key.requestCount.Add(1)
+	return key, nil
+}
+
+// write writes e to w as the response to r, in the format of the OpenAI API
+// for its routes
+func (e *apiKeyError) write(w http.ResponseWriter, r *http.Request) {
+	switch e.status {
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ollama"`)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(e.retryAfter.Seconds()))))
+	}
+
+	var body any = gin.H{"error": e.message}
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		body = openai.NewError(e.status, e.message)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Debug("couldn't write error", "error", err)
+	}
+}
+
+// apiKeyContextKey is the gin context key of the API key of a request
+const apiKeyContextKey = "apiKey"
+
+// authorize returns a middleware that requires an API key of scope, or of the
+// admin scope, if the server has API keys.
+func (s *Server) authorize(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := s.keys.check(c.Request, scope)
+		if err != nil {
+			c.Abort()
+			err.write(c.Writer, c.Request)
+			return
+		}
+
+		if key != nil {
+			c.Set(apiKeyContextKey, key)
+		}
+
+		c.Next()
+	}
+}
+
+// guard requires an API key of the scope of each path in scopes for requests
+// to it before passing them to h. Paths ending in a slash also match the
+// paths under them.
+func (k *apiKeyring) guard(h http.Handler, scopes map[string]string) http.Handler {
+	if k == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for path, scope := range scopes {
+			if r.URL.Path == path || strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path) {
+				if _, err := k.check(r, scope); err != nil {
+					err.write(w, r)
+					return
+				}
+				break
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// record records the tokens used by a request made with k
+func (k *apiKey) record(m api.Metrics) {
+	k.promptTokens.Add(int64(m.PromptEvalCount))
+	k.evalTokens.Add(int64(m.EvalCount))
+	k.tokens.debit(int64(m.EvalCount))
+}
+
+// list returns the keys in use with their usage, by name
+func (k *apiKeyring) list() []api.KeyStatus {
+	statuses := []api.KeyStatus{}
+	if k == nil {
+		return statuses
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		statuses = append(statuses, api.KeyStatus{
+			Name:              key.Name,
+			Scope:             key.Scope,
+			RequestsPerMinute: key.RequestsPerMinute,
+			TokensPerMinute:   key.TokensPerMinute,
+			Requests:          key.requestCount.Load(),
+			PromptTokens:      key.promptTokens.Load(),
+			EvalTokens:        key.evalTokens.Load(),
+		})
+	}
+
+	slices.SortFunc(statuses, func(a, b api.KeyStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return statuses
+}
+
+func (s *Server) ListKeysHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, api.ListKeysResponse{Keys: s.keys.list()})
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/openai"
+	"github.com/ollama/ollama/server/internal/client/ollama"
+)
+
+const (
+	testAdminKey     = "admin-0123456789abcdef"
+	testInferenceKey = "inference-0123456789abcdef"
+)
+
+func writeAPIKeys(t *testing.T, keys string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadAPIKeys(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"valid", `{"keys": [{"name": "ci", "key": "0123456789abcdef"}, {"name": "ops", "key": "fedcba9876543210", "scope": "admin", "requests_per_minute": 60, "tokens_per_minute": 10000}]}`, false},
+		{"unknown key", `{"keys": [{"name": "ci", "key": "0123456789abcdef", "scopes": "admin"}]}`, true},
+		{"missing name", `{"keys": [{"key": "0123456789abcdef"}]}`, true},
+		{"duplicate name", `{"keys": [{"name": "ci", "key": "0123456789abcdef"}, {"name": "ci", "key": "fedcba9876543210"}]}`, true},
+		{"short key", `{"keys": [{"name": "ci", "key": "secret"}]}`, true},
+		{"duplicate key", `{"keys": [{"name": "ci", "key": "0123456789abcdef"}, {"name": "ops", "key": "0123456789abcdef"}]}`, true},
+		{"invalid scope", `{"keys": [{"name": "ci", "key": "0123456789abcdef", "scope": "root"}]}`, true},
+		{"negative limit", `{"keys": [{"name": "ci", "key": "0123456789abcdef", "requests_per_minute": -1}]}`, true},
+		{"invalid json", `{"keys": [`, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAPIKeys(writeAPIKeys(t, tt.input))
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	path := writeAPIKeys(t, `{"keys": [
+		{"name": "admin", "key": "`+testAdminKey+`", "scope": "admin"},
+		{"name": "inference", "key": "`+testInferenceKey+`", "requests_per_minute": 3}
+	]}`)
+
+	s := Server{keys: &apiKeyring{}}
+	if err := s.keys.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	do := func(method, path, key, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(t.Context(), method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("open", func(t *testing.T) {
+		if resp := do(http.MethodGet, "/api/version", "", ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		resp := do(http.MethodGet, "/api/tags", "", "")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+		if got := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+			t.Errorf("WWW-Authenticate = %q; want Bearer", got)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		if resp := do(http.MethodGet, "/api/tags", "0123456789abcdef", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("openai", func(t *testing.T) {
+		resp := do(http.MethodGet, "/v1/models", "", "")
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+
+		var e openai.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Error.Message != "missing API key" {
+			t.Errorf("error = %+v; want missing API key", e)
+		}
+	})
+
+	t.Run("admin scope", func(t *testing.T) {
+		if resp := do(http.MethodDelete, "/api/delete", testInferenceKey, `{"model": "missing"}`); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusForbidden)
+		}
+
+		// the admin key reaches the handler
+		if resp := do(http.MethodDelete, "/api/delete", testAdminKey, `{"model": "missing"}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusNotFound)
+		}
+
+		// admin keys can use inference routes
+		if resp := do(http.MethodGet, "/api/tags", testAdminKey, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("request limit", func(t *testing.T) {
+		// requests rejected for their scope aren't counted
+		for range 3 {
+			if resp := do(http.MethodGet, "/api/tags", testInferenceKey, ""); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+			}
+		}
+
+		resp := do(http.MethodGet, "/api/tags", testInferenceKey, "")
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("expected Retry-After")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		if resp := do(http.MethodGet, "/api/keys", testInferenceKey, ""); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusForbidden)
+		}
+
+		resp := do(http.MethodGet, "/api/keys", testAdminKey, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+
+		var keys api.ListKeysResponse
+		if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keys.Keys) != 2 || keys.Keys[0].Name != "admin" || keys.Keys[1].Name != "inference" {
+			t.Fatalf("keys = %+v; want admin and inference", keys.Keys)
+		}
+		if keys.Keys[1].Requests != 3 || keys.Keys[1].RequestsPerMinute != 3 {
+			t.Errorf("inference = %+v; want 3 requests of 3 per minute", keys.Keys[1])
+		}
+	})
+}
+
+func TestAPIKeyTokenLimit(t *testing.T) {
+	path := writeAPIKeys(t, `{"keys": [{"name": "ci", "key": "`+testInferenceKey+`", "tokens_per_minute": 100}]}`)
+
+	var k apiKeyring
+	if err := k.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+	r.Header.Set("Authorization", "Bearer "+testInferenceKey)
+
+	key, err := k.check(r, scopeInference)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key.record(api.Metrics{PromptEvalCount: 10, EvalCount: 150})
+
+	if _, err := k.check(r, scopeInference); err == nil || err.status != http.StatusTooManyRequests {
+		t.Errorf("err = %v; want too many requests", err)
+	}
+
+	// usage is kept when the keys are reloaded
+	if err := k.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := k.list()
+	if len(statuses) != 1 || statuses[0].PromptTokens != 10 || statuses[0].EvalTokens != 150 {
+		t.Errorf("statuses = %+v; want 10 prompt and 150 eval tokens", statuses)
+	}
+
+	// an invalid file keeps the keys in use
+	if err := k.load(writeAPIKeys(t, `{"keys": [{"name": "ci"}]}`)); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(k.list()) != 1 {
+		t.Error("keys were replaced by an invalid file")
+	}
+}
+
+func TestAPIKeyMirror(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_MIRROR", "1")
+
+	s := Server{keys: &apiKeyring{}}
+	if err := s.keys.load(writeAPIKeys(t, `{"keys": [{"name": "inference", "key": "`+testInferenceKey+`"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.GenerateRoutes(&ollama.Registry{HTTPClient: panicOnRoundTrip})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the registry API of the mirror requires a key like the rest of the API
+	for key, want := range map[string]int{"": http.StatusUnauthorized, testInferenceKey: http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("/v2/ with %q: status = %d; want %d", key, w.Code, want)
+		}
+	}
+}
+
+func TestAPIKeyGuard(t *testing.T) {
+	path := writeAPIKeys(t, `{"keys": [
+		{"name": "admin", "key": "`+testAdminKey+`", "scope": "admin"},
+		{"name": "inference", "key": "`+testInferenceKey+`"}
+	]}`)
+
+	var k apiKeyring
+	if err := k.load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	h := k.guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), map[string]string{"/api/pull": scopeAdmin, "/v2/": scopeInference})
+
+	cases := []struct {
+		path string
+		key  string
+		want int
+	}{
+		{"/api/pull", "", http.StatusUnauthorized},
+		{"/api/pull", testInferenceKey, http.StatusForbidden},
+		{"/api/pull", testAdminKey, http.StatusOK},
+		{"/api/version", "", http.StatusOK},
+		{"/v2/", "", http.StatusUnauthorized},
+		{"/v2/library/smol/manifests/latest", "", http.StatusUnauthorized},
+		{"/v2/library/smol/manifests/latest", testInferenceKey, http.StatusOK},
+	}
+
+	for _, tt := range cases {
+		r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		if tt.key != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with %q: status = %d; want %d", tt.path, tt.key, w.Code, tt.want)
+		}
+	}
+}
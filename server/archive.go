@@ -0,0 +1,330 @@
+package server
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/types/model"
+)
+
+// Models are archived in the OCI image layout so the archives can also be
+// used by other tools. See
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+const (
+	ociLayoutVersion  = "1.0.0"
+	ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+
+	// ociRefName is the annotation holding the name of a model in the index
+	ociRefName = "org.opencontainers.image.ref.name"
+)
+
+var errInvalidArchive = errors.New("invalid archive")
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// archiveEntry is a file in an archive. Files with no data are blobs read
+// from the blob store.
+type archiveEntry struct {
+	name   string
+	size   int64
+	data   []byte
+	digest string
+}
+
+// exportEntries returns the files of the archive of the model n with
+// manifest m in the order they are written. The layout and index come
+// first so the archive can be read as a stream.
+func exportEntries(n model.Name, m *Manifest) ([]archiveEntry, error) {
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	index, err := json.Marshal(ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociIndexMediaType,
+		Manifests: []ociDescriptor{{
+			MediaType:   m.MediaType,
+			Digest:      digest,
+			Size:        int64(len(manifest)),
+			Annotations: map[string]string{ociRefName: n.String()},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := json.Marshal(ociLayout{ImageLayoutVersion: ociLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []archiveEntry{
+		{name: "oci-layout", data: layout},
+		{name: "index.json", data: index},
+		{name: blobEntryName(digest), data: manifest},
+	}
+
+	seen := map[string]bool{digest: true}
+	for _, layer := range append(m.Layers, m.Config) {
+		if layer.Digest == "" || seen[layer.Digest] {
+			continue
+		}
+		seen[layer.Digest] = true
+
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		// the size of the file is used rather than the size in the
+		// manifest so the size of the archive is exact
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, archiveEntry{name: blobEntryName(layer.Digest), size: fi.Size(), digest: layer.Digest})
+	}
+
+	for i := range entries {
+		if entries[i].data != nil {
+			entries[i].size = int64(len(entries[i].data))
+		}
+	}
+
+	return entries, nil
+}
+
+// blobEntryName returns the name of the blob with digest in an archive,
+// e.g. blobs/sha256/<hex>
+func blobEntryName(digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", algorithm, encoded)
+}
+
+// archiveSize returns the size of the tar archive of entries written by
+// writeArchive. Headers and files are padded to 512 byte blocks and the
+// archive ends with two zero blocks.
+func archiveSize(entries []archiveEntry) int64 {
+	size := int64(2 * 512)
+	for _, e := range entries {
+		size += 512 + (e.size+511)/512*512
+	}
+
+	return size
+}
+
+// writeArchive writes entries to w as a tar archive.
+func writeArchive(w io.Writer, entries []archiveEntry) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Size:     e.size,
+			Mode:     0o644,
+			ModTime:  now,
+			// GNU headers hold sizes too large for USTAR without the
+			// extra headers of PAX, which keeps archiveSize exact
+			Format: tar.FormatGNU,
+		}); err != nil {
+			return err
+		}
+
+		if e.data != nil {
+			if _, err := tw.Write(e.data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := copyBlob(tw, e.digest, e.size); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func copyBlob(w io.Writer, digest string, size int64) error {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(w, f, size)
+	return err
+}
+
+// importArchive reads the models in the tar archive r into the blob store
+// and writes their manifests. Blobs already in the blob store are skipped,
+// the others are verified against their digests. It returns the names of
+// the imported models.
+func importArchive(r io.Reader) ([]model.Name, error) {
+	var layout *ociLayout
+	var index *ociIndex
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == "oci-layout":
+			if err := json.NewDecoder(tr).Decode(&layout); err != nil {
+				return nil, fmt.Errorf("%w: oci-layout: %v", errInvalidArchive, err)
+			}
+		case name == "index.json":
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return nil, fmt.Errorf("%w: index.json: %v", errInvalidArchive, err)
+			}
+		case strings.HasPrefix(name, "blobs/sha256/"):
+			digest := "sha256:" + strings.TrimPrefix(name, "blobs/sha256/")
+			if err := importBlob(tr, digest, hdr.Size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if layout == nil || layout.ImageLayoutVersion != ociLayoutVersion {
+		return nil, fmt.Errorf("%w: missing or unsupported oci-layout", errInvalidArchive)
+	}
+
+	if index == nil || len(index.Manifests) == 0 {
+		return nil, fmt.Errorf("%w: no models in index.json", errInvalidArchive)
+	}
+
+	// check every model before writing any manifest so a bad archive
+	// doesn't leave some of its models imported
+	names := make([]model.Name, len(index.Manifests))
+	manifests := make([]Manifest, len(index.Manifests))
+	for i, desc := range index.Manifests {
+		names[i] = model.ParseName(desc.Annotations[ociRefName])
+		if !names[i].IsValid() {
+			return nil, fmt.Errorf("%w: invalid model name %q", errInvalidArchive, desc.Annotations[ociRefName])
+		}
+
+		p, err := GetBlobsPath(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidArchive, names[i].DisplayShortest(), err)
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: missing manifest %s", errInvalidArchive, names[i].DisplayShortest(), desc.Digest)
+		}
+
+		if err := json.Unmarshal(bts, &manifests[i]); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidArchive, names[i].DisplayShortest(), err)
+		}
+
+		for _, layer := range append(manifests[i].Layers, manifests[i].Config) {
+			if layer.Digest == "" {
+				continue
+			}
+
+			p, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", errInvalidArchive, names[i].DisplayShortest(), err)
+			}
+
+			if _, err := os.Stat(p); err != nil {
+				return nil, fmt.Errorf("%w: %s: missing blob %s", errInvalidArchive, names[i].DisplayShortest(), layer.Digest)
+			}
+		}
+	}
+
+	for i, n := range names {
+		if err := WriteManifest(n, manifests[i].Config, manifests[i].Layers); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// importBlob writes the blob with digest from r to the blob store unless
+// it's already there. The blob is verified before it's moved into place so
+// an existing blob is never replaced.
+func importBlob(r io.Reader, digest string, size int64) error {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+
+	if _, err := os.Stat(p); err == nil {
+		slog.Debug("blob already exists", "digest", digest)
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+"-partial-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return err
+	}
+
+	if fileDigest := fmt.Sprintf("sha256:%x", h.Sum(nil)); fileDigest != digest || n != size {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, fileDigest)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(p); err == nil {
+		// written by another import while this one was copied
+		return nil
+	}
+
+	return os.Rename(f.Name(), p)
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// exportTestModel creates the model test and returns its archive
+func exportTestModel(t *testing.T) []byte {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:    "test",
+		Files:    map[string]string{"test.gguf": digest},
+		Template: "{{ .Prompt }}",
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	n := model.ParseName("test")
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := exportEntries(n, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := writeArchive(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(b.Len()) != archiveSize(entries) {
+		t.Errorf("expected archive size %d, got %d", archiveSize(entries), b.Len())
+	}
+
+	return b.Bytes()
+}
+
+// rewriteArchive returns a copy of the archive bts with the files for which
+// fn returns false dropped. fn may change the contents of the files.
+func rewriteArchive(t *testing.T, bts []byte, fn func(name string, data []byte) ([]byte, bool)) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	tr := tar.NewReader(bytes.NewReader(bts))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, ok := fn(hdr.Name, data)
+		if !ok {
+			continue
+		}
+
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestExportImport(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	archive := exportTestModel(t)
+
+	var names []string
+	var index ociIndex
+	rewriteArchive(t, archive, func(name string, data []byte) ([]byte, bool) {
+		names = append(names, name)
+		if name == "index.json" {
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return data, true
+	})
+
+	// the config, template and model blobs follow the manifest
+	if len(names) != 6 || names[0] != "oci-layout" || names[1] != "index.json" || names[2] != blobEntryName(index.Manifests[0].Digest) {
+		t.Errorf("unexpected archive files %v", names)
+	}
+
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[ociRefName] != "registry.ollama.ai/library/test:latest" {
+		t.Errorf("unexpected index %+v", index)
+	}
+
+	// import into an empty models directory
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	imported, err := importArchive(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported) != 1 || imported[0].DisplayShortest() != "test:latest" {
+		t.Errorf("expected test:latest to be imported, got %v", imported)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Template.String() != "{{ .Prompt }}" {
+		t.Errorf("expected imported template, got %q", m.Template.String())
+	}
+
+	// blobs that exist are kept as they are
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(m.ModelPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := importArchive(bytes.NewReader(archive)); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(m.ModelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fi.ModTime().Equal(old) {
+		t.Error("expected existing blob not to be written again")
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	archive := exportTestModel(t)
+
+	var index ociIndex
+	rewriteArchive(t, archive, func(name string, data []byte) ([]byte, bool) {
+		if name == "index.json" {
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return data, true
+	})
+	manifest := blobEntryName(index.Manifests[0].Digest)
+
+	cases := map[string]struct {
+		fn  func(name string, data []byte) ([]byte, bool)
+		err error
+	}{
+		"corrupt blob": {func(name string, data []byte) ([]byte, bool) {
+			if name != "oci-layout" && name != "index.json" && name != manifest {
+				data = append(data, '!')
+			}
+			return data, true
+		}, errDigestMismatch},
+		"missing blob": {func(name string, data []byte) ([]byte, bool) {
+			return data, name == "oci-layout" || name == "index.json" || name == manifest
+		}, errInvalidArchive},
+		"missing index": {func(name string, data []byte) ([]byte, bool) {
+			return data, name != "index.json"
+		}, errInvalidArchive},
+		"missing layout": {func(name string, data []byte) ([]byte, bool) {
+			return data, name != "oci-layout"
+		}, errInvalidArchive},
+		"missing name": {func(name string, data []byte) ([]byte, bool) {
+			if name == "index.json" {
+				return bytes.ReplaceAll(data, []byte(ociRefName), []byte("name")), true
+			}
+			return data, true
+		}, errInvalidArchive},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+			_, err := importArchive(bytes.NewReader(rewriteArchive(t, archive, tt.fn)))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			if _, err := GetModel("test"); err == nil {
+				t.Error("expected no model to be imported")
+			}
+		})
+	}
+
+	t.Run("existing blob", func(t *testing.T) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+		var digests []string
+		corrupt := rewriteArchive(t, archive, func(name string, data []byte) ([]byte, bool) {
+			if name != "oci-layout" && name != "index.json" && name != manifest {
+				digests = append(digests, "sha256:"+path.Base(name))
+				data = append(data, '!')
+			}
+			return data, true
+		})
+
+		// a blob of a different size already in the store is kept when the
+		// archive's copy doesn't match its digest
+		p, err := GetBlobsPath(digests[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte("existing"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := importArchive(bytes.NewReader(corrupt)); !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected %v, got %v", errDigestMismatch, err)
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(bts) != "existing" {
+			t.Errorf("expected existing blob to be kept, got %q", bts)
+		}
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		if _, err := importArchive(bytes.NewReader([]byte("not an archive"))); !errors.Is(err, errInvalidArchive) {
+			t.Errorf("expected %v, got %v", errInvalidArchive, err)
+		}
+	})
+}
+
+func TestExportImportHandlers(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	exportTestModel(t)
+
+	var s Server
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := api.NewClient(u, srv.Client())
+
+	var b bytes.Buffer
+	if err := client.Export(context.Background(), &api.ExportRequest{Model: "test"}, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var statusErr api.StatusError
+	if err := client.Export(context.Background(), &api.ExportRequest{Model: "missing"}, io.Discard); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	resp, err := client.Import(context.Background(), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Models) != 1 || resp.Models[0] != "test:latest" {
+		t.Errorf("expected test:latest to be imported, got %v", resp.Models)
+	}
+
+	if _, err := client.Import(context.Background(), bytes.NewReader([]byte("not an archive"))); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %v", err)
+	}
+}
@@ -95,6 +95,12 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		} else if r.Files != nil {
 			baseLayers, err = convertModelFromFiles(r.Files, baseLayers, false, fn)
 			if err != nil {
+				var verr *convert.ValidationError
+				if errors.As(err, &verr) {
+					ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
+					return
+				}
+
 				for _, badReq := range []error{errNoFilesProvided, errOnlyGGUFSupported, errUnknownType} {
 					if errors.Is(err, badReq) {
 						ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
@@ -265,7 +271,11 @@ func convertFromSafetensors(files map[string]string, baseLayers []*layerGGML, is
 	if !isAdapter {
 		fn(api.ProgressResponse{Status: "converting model"})
 		mediaType = "application/vnd.ollama.image.model"
-		if err := convert.ConvertModel(os.DirFS(tmpDir), t); err != nil {
+		warn := func(err error) {
+			fn(api.ProgressResponse{Status: "warning: " + err.Error()})
+		}
+		if err := convert.ConvertModel(os.DirFS(tmpDir), t, warn); err != nil {
+			reportValidationProblems(err, fn)
 			return nil, err
 		}
 	} else {
@@ -276,6 +286,7 @@ func convertFromSafetensors(files map[string]string, baseLayers []*layerGGML, is
 		fn(api.ProgressResponse{Status: "converting adapter"})
 		mediaType = "application/vnd.ollama.image.adapter"
 		if err := convert.ConvertAdapter(os.DirFS(tmpDir), t, kv); err != nil {
+			reportValidationProblems(err, fn)
 			return nil, err
 		}
 	}
@@ -307,6 +318,17 @@ func convertFromSafetensors(files map[string]string, baseLayers []*layerGGML, is
 	return layers, nil
 }
 
+// reportValidationProblems streams each problem found while validating the
+// input checkpoint so clients see all of them, not only the final error.
+func reportValidationProblems(err error, fn func(resp api.ProgressResponse)) {
+	var verr *convert.ValidationError
+	if errors.As(err, &verr) {
+		for _, p := range verr.Problems {
+			fn(api.ProgressResponse{Status: "invalid model: " + p.Error()})
+		}
+	}
+}
+
 func kvFromLayers(baseLayers []*layerGGML) (ggml.KV, error) {
 	for _, l := range baseLayers {
 		if l.GGML != nil {
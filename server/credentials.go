@@ -0,0 +1,284 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// registryConfig is the part of a Docker config.json that holds registry
+// credentials. Registries are keyed by host, optionally with a scheme and
+// path as written by docker login.
+type registryConfig struct {
+	Auths       map[string]registryAuth `json:"auths"`
+	CredsStore  string                  `json:"credsStore"`
+	CredHelpers map[string]string       `json:"credHelpers"`
+}
+
+type registryAuth struct {
+	// Auth is the base64 encoding of username:password
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// registryCredentials are the credentials for a single registry.
+type registryCredentials struct {
+	Username string
+	Password string
+
+	// IdentityToken is an OAuth2 refresh token exchanged for registry tokens
+	IdentityToken string
+}
+
+// registryConfigPath returns the path of the registry config, which is
+// OLLAMA_REGISTRY_CONFIG or the Docker config in DOCKER_CONFIG or
+// $HOME/.docker.
+func registryConfigPath() (string, error) {
+	if s := envconfig.RegistryConfig(); s != "" {
+		return s, nil
+	}
+
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// registryHost returns the host of a registry as it is keyed in the registry
+// config. Docker Hub is keyed by its index.
+func registryHost(s string) string {
+	if _, rest, ok := strings.Cut(s, "://"); ok {
+		s = rest
+	}
+
+	s, _, _ = strings.Cut(s, "/")
+	switch s {
+	case "docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	}
+
+	return s
+}
+
+// lookupCredentials returns the credentials for the registry at host from
+// the registry config, asking a credential helper if one is configured for
+// host. It returns nil if there are no credentials for host.
+func lookupCredentials(ctx context.Context, host string) (*registryCredentials, error) {
+	path, err := registryConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config registryConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	host = registryHost(host)
+	for k, helper := range config.CredHelpers {
+		if registryHost(k) == host {
+			return credentialHelper(ctx, helper, k)
+		}
+	}
+
+	for k, auth := range config.Auths {
+		if registryHost(k) != host {
+			continue
+		}
+
+		creds := registryCredentials{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+		}
+
+		if auth.Auth != "" {
+			bts, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: invalid auth: %w", path, k, err)
+			}
+
+			creds.Username, creds.Password, _ = strings.Cut(string(bts), ":")
+		}
+
+		// an empty entry means the credentials are in the credential store
+		if creds != (registryCredentials{}) {
+			return &creds, nil
+		}
+	}
+
+	if config.CredsStore != "" {
+		return credentialHelper(ctx, config.CredsStore, host)
+	}
+
+	return nil, nil
+}
+
+// credentialHelper gets the credentials for serverURL from the Docker
+// credential helper docker-credential-<name>. It returns nil if the helper
+// has no credentials for serverURL.
+func credentialHelper(ctx context.Context, name, serverURL string) (*registryCredentials, error) {
+	program := "docker-credential-" + name
+
+	cmd := exec.CommandContext(ctx, program, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(string(out), "credentials not found") {
+			return nil, nil
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s: %w: %s", program, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return nil, fmt.Errorf("%s: %w", program, err)
+	}
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", program, err)
+	}
+
+	// helpers return identity tokens with this username
+	if resp.Username == "<token>" {
+		return &registryCredentials{IdentityToken: resp.Secret}, nil
+	}
+
+	return &registryCredentials{Username: resp.Username, Password: resp.Secret}, nil
+}
+
+// authenticate answers the challenge in the WWW-Authenticate header of a
+// response from the registry at host by setting the credentials of opts.
+// Registries with credentials in the registry config use the standard
+// Basic or Bearer token flow. Other registries get a token signed with the
+// Ollama key.
+func authenticate(ctx context.Context, header, host string, opts *registryOptions) error {
+	creds, err := lookupCredentials(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	scheme, _, _ := strings.Cut(header, " ")
+	if strings.EqualFold(scheme, "basic") {
+		if creds == nil || creds.Username == "" {
+			return errUnauthorized
+		}
+
+		opts.Username, opts.Password = creds.Username, creds.Password
+		return nil
+	}
+
+	challenge := parseRegistryChallenge(header)
+
+	var token string
+	if creds != nil {
+		token, err = getRegistryToken(ctx, challenge, creds)
+	} else {
+		token, err = getAuthorizationToken(ctx, challenge)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts.Token = token
+	return nil
+}
+
+// getRegistryToken gets a token for challenge from its realm following the
+// Docker registry token authentication spec. An identity token is exchanged
+// with the OAuth2 refresh token grant, otherwise the realm is asked with
+// basic auth.
+func getRegistryToken(ctx context.Context, challenge registryChallenge, creds *registryCredentials) (string, error) {
+	realm, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return "", err
+	}
+
+	values := realm.Query()
+	if challenge.Service != "" {
+		values.Set("service", challenge.Service)
+	}
+
+	for _, scope := range strings.Fields(challenge.Scope) {
+		values.Add("scope", scope)
+	}
+
+	var response *http.Response
+	if creds.IdentityToken != "" {
+		values.Set("grant_type", "refresh_token")
+		values.Set("refresh_token", creds.IdentityToken)
+		values.Set("client_id", "ollama")
+
+		headers := make(http.Header)
+		headers.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		realm.RawQuery = ""
+		response, err = makeRequest(ctx, http.MethodPost, realm, headers, strings.NewReader(values.Encode()), &registryOptions{})
+	} else {
+		realm.RawQuery = values.Encode()
+		response, err = makeRequest(ctx, http.MethodGet, realm, nil, nil, &registryOptions{
+			Username: creds.Username,
+			Password: creds.Password,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("%d: %v", response.StatusCode, err)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		if len(body) > 0 {
+			return "", fmt.Errorf("%d: %s", response.StatusCode, body)
+		}
+
+		return "", fmt.Errorf("%d", response.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+
+	return cmp.Or(token.Token, token.AccessToken), nil
+}
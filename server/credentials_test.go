@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func writeRegistryConfig(t *testing.T, config string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_REGISTRY_CONFIG", path)
+}
+
+func TestLookupCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper is a shell script")
+	}
+
+	// a credential helper that knows helper.example.com and
+	// store.example.com and nothing else
+	bin := t.TempDir()
+	for _, name := range []string{"test", "store"} {
+		script := `#!/bin/sh
+read host
+case "$host" in
+helper.example.com) echo '{"ServerURL":"helper.example.com","Username":"alice","Secret":"s3cret"}' ;;
+store.example.com) echo '{"ServerURL":"store.example.com","Username":"<token>","Secret":"refresh"}' ;;
+*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+		if err := os.WriteFile(filepath.Join(bin, "docker-credential-"+name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	auth := base64.StdEncoding.EncodeToString([]byte("bob:hunter2"))
+	writeRegistryConfig(t, fmt.Sprintf(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": %q},
+			"harbor.example.com:8443": {"username": "carol", "password": "pw"},
+			"empty.example.com": {}
+		},
+		"credHelpers": {"helper.example.com": "test"},
+		"credsStore": "store"
+	}`, auth))
+
+	cases := []struct {
+		host   string
+		expect *registryCredentials
+	}{
+		{"registry-1.docker.io", &registryCredentials{Username: "bob", Password: "hunter2"}},
+		{"harbor.example.com:8443", &registryCredentials{Username: "carol", Password: "pw"}},
+		{"harbor.example.com", nil},
+		{"helper.example.com", &registryCredentials{Username: "alice", Password: "s3cret"}},
+		{"store.example.com", &registryCredentials{IdentityToken: "refresh"}},
+		{"empty.example.com", nil},
+		{"unknown.example.com", nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.host, func(t *testing.T) {
+			creds, err := lookupCredentials(context.Background(), tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.expect, creds); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// testRegistry is an OCI distribution registry that keeps blobs and
+// manifests in memory and requires the credentials alice:s3cret.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   map[string][]byte
+
+	// basic makes the registry challenge for basic auth rather than a token
+	basic bool
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, `{"access_token": "token"}`)
+		return
+	}
+
+	authorized := req.Header.Get("Authorization") == "Bearer token"
+	if r.basic {
+		user, pass, ok := req.BasicAuth()
+		authorized = ok && user == "alice" && pass == "s3cret"
+	}
+
+	if !authorized {
+		if r.basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test",scope="repository:library/test:pull,push"`, req.Host))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/library/test/")
+	switch {
+	case strings.HasPrefix(path, "blobs/uploads/"):
+		id := strings.TrimPrefix(path, "blobs/uploads/")
+		switch req.Method {
+		case http.MethodPost:
+			r.uploads["1"] = nil
+			w.Header().Set("Location", "/v2/library/test/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPatch:
+			bts, _ := io.ReadAll(req.Body)
+			r.uploads[id] = append(r.uploads[id], bts...)
+			w.Header().Set("Location", "/v2/library/test/blobs/uploads/"+id)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			r.blobs[req.URL.Query().Get("digest")] = r.uploads[id]
+			w.WriteHeader(http.StatusCreated)
+		}
+	case strings.HasPrefix(path, "blobs/"):
+		bts, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(len(bts)))
+		if req.Method == http.MethodGet {
+			w.Write(bts)
+		}
+	case strings.HasPrefix(path, "manifests/"):
+		tag := strings.TrimPrefix(path, "manifests/")
+		if req.Method == http.MethodPut {
+			r.manifests[tag], _ = io.ReadAll(req.Body)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		bts, ok := r.manifests[tag]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write(bts)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPushPullPrivateRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, basic := range []bool{false, true} {
+		t.Run(fmt.Sprintf("basic=%t", basic), func(t *testing.T) {
+			t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+			reg := &testRegistry{
+				blobs:     make(map[string][]byte),
+				manifests: make(map[string][]byte),
+				uploads:   make(map[string][]byte),
+				basic:     basic,
+			}
+
+			srv := httptest.NewServer(reg)
+			defer srv.Close()
+
+			host := strings.TrimPrefix(srv.URL, "http://")
+			name := host + "/library/test:latest"
+
+			auth := base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+			writeRegistryConfig(t, fmt.Sprintf(`{"auths": {%q: {"auth": %q}}}`, host, auth))
+
+			var s Server
+			_, digest := createBinFile(t, nil, nil)
+			if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+				Model: name,
+				Files: map[string]string{"test.gguf": digest},
+			}); w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			fn := func(api.ProgressResponse) {}
+			if err := PushModel(context.Background(), name, &registryOptions{Insecure: true}, fn); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := reg.manifests["latest"]; !ok {
+				t.Fatal("expected manifest to be pushed")
+			}
+
+			if _, ok := reg.blobs[digest]; !ok {
+				t.Errorf("expected blob %s to be pushed", digest)
+			}
+
+			// pull into an empty models directory
+			t.Setenv("OLLAMA_MODELS", t.TempDir())
+			if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, fn); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := GetModel(name); err != nil {
+				t.Errorf("expected pulled model, got %v", err)
+			}
+
+			// without credentials the registry refuses access
+			writeRegistryConfig(t, `{}`)
+			if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, fn); err == nil {
+				t.Error("expected pull without credentials to fail")
+			}
+		})
+	}
+}
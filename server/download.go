@@ -23,6 +23,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
@@ -35,6 +36,10 @@ var (
 
 var blobDownloadManager sync.Map
 
+// downloadRate limits the combined rate of all downloads to
+// OLLAMA_MAX_DOWNLOAD_RATE
+var downloadRate rateLimiter
+
 type blobDownload struct {
 	Name   string
 	Digest string
@@ -44,6 +49,10 @@ type blobDownload struct {
 
 	Parts []*blobDownloadPart
 
+	// limiters limit the download rate. A blob pulled by several models at
+	// once is downloaded at the limit of the first.
+	limiters []*rateLimiter
+
 	context.CancelFunc
 
 	done       chan struct{}
@@ -128,8 +137,6 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *r
 		return err
 	}
 
-	b.done = make(chan struct{})
-
 	for _, partFilePath := range partFilePaths {
 		part, err := b.readPart(partFilePath)
 		if err != nil {
@@ -223,7 +230,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 
 	_ = file.Truncate(b.Total)
 
-	directURL, err := func() (*url.URL, error) {
+	directURL, directOpts, err := func() (*url.URL, *registryOptions, error) {
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
@@ -254,15 +261,23 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 			if err != nil {
 				slog.Warn("failed to get direct URL; backing off and retrying", "err", err)
 				if err := backoff(ctx); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				continue
 			}
 			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusOK {
-				return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+			switch {
+			case resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest:
+				// credentials aren't sent to the redirect, which is usually a
+				// signed URL on another host
+				directURL, err := resp.Location()
+				return directURL, &registryOptions{}, err
+			case resp.StatusCode == http.StatusOK:
+				// the registry serves the blob itself
+				return resp.Request.URL, newOpts, nil
+			default:
+				return nil, nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
 			}
-			return resp.Location()
 		}
 	}()
 	if err != nil {
@@ -281,7 +296,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 			var err error
 			for try := 0; try < maxRetries; try++ {
 				w := io.NewOffsetWriter(file, part.StartsAt())
-				err = b.downloadChunk(inner, directURL, w, part)
+				err = b.downloadChunk(inner, directURL, w, part, directOpts)
 				switch {
 				case errors.Is(err, context.Canceled), errors.Is(err, syscall.ENOSPC):
 					// return immediately if the context is canceled or the device is out of space
@@ -325,21 +340,23 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 	return nil
 }
 
-func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w io.Writer, part *blobDownloadPart) error {
+func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w io.Writer, part *blobDownloadPart, opts *registryOptions) error {
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", part.StartsAt(), part.StopsAt()-1))
-		resp, err := http.DefaultClient.Do(req)
+		headers := make(http.Header)
+		headers.Set("Range", fmt.Sprintf("bytes=%d-%d", part.StartsAt(), part.StopsAt()-1))
+		resp, err := makeRequest(ctx, http.MethodGet, requestURL, headers, nil, opts)
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
-		n, err := io.CopyN(w, io.TeeReader(resp.Body, part), part.Size-part.Completed.Load())
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		body := newLimitedReader(ctx, resp.Body, b.limiters...)
+		n, err := io.CopyN(w, io.TeeReader(body, part), part.Size-part.Completed.Load())
 		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
 			// rollback progress
 			b.Completed.Add(-n)
@@ -484,13 +501,22 @@ func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ erro
 		return true, nil
 	}
 
-	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
+	downloadRate.SetLimit(int64(envconfig.MaxDownloadRate()))
+
+	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{
+		Name:     fp,
+		Digest:   opts.digest,
+		limiters: []*rateLimiter{&downloadRate, opts.regOpts.RateLimit},
+		done:     make(chan struct{}),
+	})
 	download := data.(*blobDownload)
 	if !ok {
 		requestURL := opts.mp.BaseURL()
 		requestURL = requestURL.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
 		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
 			blobDownloadManager.Delete(opts.digest)
+			download.err = err
+			close(download.done)
 			return false, err
 		}
 
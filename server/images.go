@@ -51,6 +51,17 @@ type registryOptions struct {
 	Password string
 	Token    string
 
+	// APIKey is sent as a bearer token in place of answering the
+	// registry's authentication challenges, for registry mirrors that are
+	// Ollama servers with API keys.
+	APIKey string
+
+	// Sign signs the manifest of a pushed model
+	Sign bool
+
+	// RateLimit limits the download rate of a pulled model
+	RateLimit *rateLimiter
+
 	CheckRedirect func(req *http.Request, via []*http.Request) error
 }
 
@@ -234,6 +245,8 @@ func GetModel(name string) (*Model, error) {
 		return nil, err
 	}
 
+	lastUsed.Touch(model.ParseName(name))
+
 	model := &Model{
 		Name:      mp.GetFullTagname(),
 		ShortName: mp.GetShortTagname(),
@@ -383,6 +396,11 @@ func deleteUnusedLayers(deleteMap map[string]struct{}) error {
 
 	// only delete the files which are still in the deleteMap
 	for k := range deleteMap {
+		if modelPulls.pending(k) {
+			// the blob of a model still being pulled
+			continue
+		}
+
 		fp, err := GetBlobsPath(k)
 		if err != nil {
 			slog.Info(fmt.Sprintf("couldn't get file path for '%s': %v", k, err))
@@ -411,6 +429,11 @@ func PruneLayers() error {
 	}
 
 	for _, blob := range blobs {
+		if modelPulls.pending(blob.Name()) {
+			// keep the blobs and partial downloads of restored pulls
+			continue
+		}
+
 		name := blob.Name()
 		name = strings.ReplaceAll(name, "-", ":")
 
@@ -518,11 +541,51 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	}
 	defer resp.Body.Close()
 
+	if regOpts.Sign {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifestJSON))
+		if err := pushSignature(ctx, mp, digest, regOpts, fn); err != nil {
+			return fmt.Errorf("sign manifest: %w", err)
+		}
+	}
+
 	fn(api.ProgressResponse{Status: "success"})
 
 	return nil
 }
 
+// registryMirror returns the path of mp on the registry mirror set by
+// OLLAMA_REGISTRY_MIRROR. Only models from the default registry are pulled
+// through the mirror.
+func registryMirror(mp ModelPath) (ModelPath, bool) {
+	s := envconfig.RegistryMirror()
+	if s == "" || mp.Registry != DefaultRegistry {
+		return ModelPath{}, false
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		slog.Warn("invalid OLLAMA_REGISTRY_MIRROR, ignoring", "mirror", s, "error", err)
+		return ModelPath{}, false
+	}
+
+	mp.ProtocolScheme = u.Scheme
+	mp.Registry = u.Host
+	return mp, true
+}
+
+// mirrorOptions returns the options of requests to the registry mirror: the
+// options of regOpts with the key in OLLAMA_API_KEY, since a mirror with API
+// keys doesn't issue tokens.
+func mirrorOptions(regOpts *registryOptions) *registryOptions {
+	opts := *regOpts
+	opts.APIKey = envconfig.APIKey()
+	return &opts
+}
+
 func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
 	mp := ParseModelPath(name)
 
@@ -548,9 +611,27 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 
 	fn(api.ProgressResponse{Status: "pulling manifest"})
 
-	manifest, err = pullModelManifest(ctx, mp, regOpts)
-	if err != nil {
-		return fmt.Errorf("pull model manifest: %s", err)
+	var remote ModelPath
+	remoteOpts := regOpts
+	if mirror, ok := registryMirror(mp); ok {
+		mirrorOpts := mirrorOptions(regOpts)
+		if manifest, err = pullModelManifest(ctx, mirror, mirrorOpts); err == nil {
+			remote, remoteOpts = mirror, mirrorOpts
+		} else {
+			slog.Warn("couldn't pull from registry mirror, pulling from upstream", "mirror", mirror.BaseURL(), "error", err)
+		}
+	}
+
+	if remote == (ModelPath{}) {
+		remote = mp
+		manifest, err = pullModelManifest(ctx, mp, regOpts)
+		if err != nil {
+			return fmt.Errorf("pull model manifest: %s", err)
+		}
+	}
+
+	if err := verifyManifest(ctx, mp, remote, manifest, remoteOpts); err != nil {
+		return err
 	}
 
 	var layers []Layer
@@ -559,12 +640,18 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		layers = append(layers, manifest.Config)
 	}
 
+	release, err := makeRoom(model.ParseName(name), layers, fn)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	skipVerify := make(map[string]bool)
 	for _, layer := range layers {
 		cacheHit, err := downloadBlob(ctx, downloadOpts{
-			mp:      mp,
+			mp:      remote,
 			digest:  layer.Digest,
-			regOpts: regOpts,
+			regOpts: remoteOpts,
 			fn:      fn,
 		})
 		if err != nil {
@@ -633,19 +720,25 @@ func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptio
 	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
 
 	headers := make(http.Header)
-	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json, application/vnd.oci.image.manifest.v1+json")
 	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	var m Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+	if err := json.Unmarshal(bts, &m); err != nil {
 		return nil, err
 	}
 
-	return &m, err
+	m.digest = fmt.Sprintf("%x", sha256.Sum256(bts))
+	return &m, nil
 }
 
 // GetSHA256Digest returns the SHA256 hash of a given buffer and returns it, and the size of buffer
@@ -676,13 +769,15 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 		case resp.StatusCode == http.StatusUnauthorized:
 			resp.Body.Close()
 
+			// API keys are sent as is, there's no challenge to answer
+			if regOpts != nil && regOpts.APIKey != "" {
+				return nil, errUnauthorized
+			}
+
 			// Handle authentication error with one retry
-			challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-			token, err := getAuthorizationToken(ctx, challenge)
-			if err != nil {
+			if err := authenticate(ctx, resp.Header.Get("www-authenticate"), requestURL.Host, regOpts); err != nil {
 				return nil, err
 			}
-			regOpts.Token = token
 			if body != nil {
 				_, err = body.Seek(0, io.SeekStart)
 				if err != nil {
@@ -737,7 +832,9 @@ func makeRequest(ctx context.Context, method string, requestURL *url.URL, header
 	}
 
 	if regOpts != nil {
-		if regOpts.Token != "" {
+		if regOpts.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+regOpts.APIKey)
+		} else if regOpts.Token != "" {
 			req.Header.Set("Authorization", "Bearer "+regOpts.Token)
 		} else if regOpts.Username != "" && regOpts.Password != "" {
 			req.SetBasicAuth(regOpts.Username, regOpts.Password)
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/server/internal/cache/blob"
+	"github.com/ollama/ollama/server/internal/client/ollama"
+)
+
+func TestRegistryMirror(t *testing.T) {
+	cases := []struct {
+		mirror string
+		name   string
+		expect string
+	}{
+		{"", "llama3", ""},
+		{"http://mirror.local:11434", "llama3", "http://mirror.local:11434"},
+		{"https://mirror.local", "llama3", "https://mirror.local"},
+		{"mirror.local:11434", "llama3", "http://mirror.local:11434"},
+		{"mirror.local:11434", "registry.ollama.ai/library/llama3", "http://mirror.local:11434"},
+		{"mirror.local:11434", "example.com/library/llama3", ""},
+		{"http://", "llama3", ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.mirror+"/"+tt.name, func(t *testing.T) {
+			t.Setenv("OLLAMA_REGISTRY_MIRROR", tt.mirror)
+
+			mp := ParseModelPath(tt.name)
+			mirror, ok := registryMirror(mp)
+			if ok != (tt.expect != "") {
+				t.Fatalf("expected mirror %t, got %t", tt.expect != "", ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if s := mirror.BaseURL().String(); s != tt.expect {
+				t.Errorf("expected base URL %s, got %s", tt.expect, s)
+			}
+
+			if mirror.GetNamespaceRepository() != mp.GetNamespaceRepository() || mirror.Tag != mp.Tag {
+				t.Errorf("expected %s, got %s", mp.GetFullTagname(), mirror.GetFullTagname())
+			}
+		})
+	}
+}
+
+func TestPullRegistryMirror(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	reg := &testRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		uploads:   make(map[string][]byte),
+		basic:     true,
+	}
+
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	auth := base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	writeRegistryConfig(t, fmt.Sprintf(`{"auths": {%q: {"auth": %q}}}`, host, auth))
+
+	// push a model to the mirror as it would be cached from upstream
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: host + "/library/test",
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	fn := func(api.ProgressResponse) {}
+	if err := PushModel(context.Background(), host+"/library/test", &registryOptions{Insecure: true}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	// models from the default registry are pulled through the mirror
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRY_MIRROR", srv.URL)
+	if err := PullModel(context.Background(), "test", &registryOptions{}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.ShortName != "test:latest" {
+		t.Errorf("expected test:latest, got %s", m.ShortName)
+	}
+}
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+func TestPullRegistryMirrorAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_MIRROR", "1")
+
+	// the mirror serves the models it has while upstream is unreachable
+	s := Server{keys: &apiKeyring{}}
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := s.keys.load(writeAPIKeys(t, `{"keys": [{"name": "inference", "key": "`+testInferenceKey+`"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := blob.Open(envconfig.Models())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.GenerateRoutes(&ollama.Registry{Cache: c, HTTPClient: &http.Client{Transport: offlineTransport{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRY_MIRROR", srv.URL)
+	t.Setenv("OLLAMA_API_KEY", testInferenceKey)
+
+	fn := func(api.ProgressResponse) {}
+	if err := PullModel(t.Context(), "test", &registryOptions{}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetModel("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a wrong key isn't answered with a challenge
+	mirror, _ := registryMirror(ParseModelPath("test"))
+	t.Setenv("OLLAMA_API_KEY", "wrong")
+	if _, err := pullModelManifest(t.Context(), mirror, mirrorOptions(&registryOptions{})); !errors.Is(err, errUnauthorized) {
+		t.Errorf("err = %v; want %v", err, errUnauthorized)
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/ollama/ollama/server/internal/internal/backoff"
 	"github.com/ollama/ollama/server/internal/internal/names"
 	"github.com/ollama/ollama/server/internal/internal/syncs"
+	"github.com/ollama/ollama/server/internal/trust"
 
 	_ "embed"
 )
@@ -228,6 +229,11 @@ type Registry struct {
 	// Mask, if set, is the name used to convert non-fully qualified names
 	// to fully qualified names. If empty, [DefaultMask] is used.
 	Mask string
+
+	// Trust, if set, is the trust policy that pulled models must satisfy
+	// before they are linked into the cache. If nil, all models are
+	// trusted.
+	Trust *trust.Policy
 }
 
 func (r *Registry) cache() (*blob.DiskCache, error) {
@@ -270,6 +276,10 @@ func DefaultRegistry() (*Registry, error) {
 	if err != nil {
 		return nil, err
 	}
+	rc.Trust, err = trust.Read(os.Getenv("OLLAMA_TRUST_POLICY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OLLAMA_TRUST_POLICY: %w", err)
+	}
 	maxStreams := os.Getenv("OLLAMA_REGISTRY_MAXSTREAMS")
 	if maxStreams != "" {
 		var err error
@@ -447,6 +457,10 @@ func (r *Registry) Pull(ctx context.Context, name string) error {
 		return fmt.Errorf("%w: no layers", ErrManifestInvalid)
 	}
 
+	if err := r.verify(ctx, scheme, n, m); err != nil {
+		return err
+	}
+
 	c, err := r.cache()
 	if err != nil {
 		return err
@@ -591,6 +605,69 @@ func (r *Registry) Pull(ctx context.Context, name string) error {
 	return c.Link(m.Name, md)
 }
 
+// verify checks the manifest m of n satisfies the trust policy of r.
+// Signatures are never signed themselves, so they are always trusted.
+func (r *Registry) verify(ctx context.Context, scheme string, n names.Name, m *Manifest) error {
+	if !r.Trust.Enforced(n.Host(), n.Namespace()) || trust.IsSignatureTag(n.Tag()) {
+		return nil
+	}
+
+	digest := blob.DigestFromBytes(m.Data).String()
+	signatures, err := r.signatures(ctx, scheme, n, digest)
+	if err != nil {
+		return fmt.Errorf("pull signatures: %w", err)
+	}
+
+	return r.Trust.Verify(n.Host(), n.Namespace(), digest, signatures)
+}
+
+// signatures returns the signatures of the manifest of n with digest.
+func (r *Registry) signatures(ctx context.Context, scheme string, n names.Name, digest string) ([]string, error) {
+	base := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, n.Host(), n.Namespace(), n.Model())
+
+	res, err := r.send(ctx, "GET", base+"/manifests/"+trust.SignatureTag(digest), nil)
+	if err != nil {
+		var re *Error
+		if errors.Is(err, ErrModelNotFound) || errors.As(err, &re) && re.Status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+
+	var signatures []string
+	for _, l := range m.Layers {
+		if l.MediaType != trust.MediaType {
+			continue
+		}
+
+		data, err := func() ([]byte, error) {
+			res, err := r.send(ctx, "GET", base+"/blobs/"+l.Digest.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			return io.ReadAll(io.LimitReader(res.Body, 64<<10))
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		if blob.DigestFromBytes(data) != l.Digest {
+			return nil, fmt.Errorf("signature %s: digest mismatch", l.Digest)
+		}
+
+		signatures = append(signatures, string(data))
+	}
+
+	return signatures, nil
+}
+
 // Unlink is like [blob.DiskCache.Unlink], but makes name fully qualified
 // before attempting to unlink the model.
 func (r *Registry) Unlink(name string) (ok bool, _ error) {
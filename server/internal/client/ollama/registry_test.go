@@ -20,9 +20,13 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/auth"
 	"github.com/ollama/ollama/server/internal/cache/blob"
 	"github.com/ollama/ollama/server/internal/chunks"
 	"github.com/ollama/ollama/server/internal/testutil"
+	"github.com/ollama/ollama/server/internal/trust"
 )
 
 func TestManifestMarshalJSON(t *testing.T) {
@@ -400,6 +404,58 @@ func TestRegistryPullNotCached(t *testing.T) {
 	}
 }
 
+func TestRegistryPullTrusted(t *testing.T) {
+	key := testutil.WriteKey(t)
+
+	manifest := fmt.Sprintf(`{"layers":[{"digest":%q,"size":9}]}`, blob.DigestFromBytes("some data"))
+	signature, err := auth.Sign(t.Context(), []byte(blob.DigestFromBytes(manifest).String()))
+	testutil.Check(t, err)
+	sigManifest := fmt.Sprintf(`{"layers":[{"digest":%q,"size":%d,"mediaType":%q}]}`, blob.DigestFromBytes(signature), len(signature), trust.MediaType)
+
+	var signed bool
+	rc, _ := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/blobs/"+blob.DigestFromBytes("some data").String()):
+			io.WriteString(w, "some data")
+		case strings.HasSuffix(r.URL.Path, "/blobs/"+blob.DigestFromBytes(signature).String()):
+			io.WriteString(w, signature)
+		case strings.HasSuffix(r.URL.Path, ".sig"):
+			if !signed {
+				w.WriteHeader(404)
+				io.WriteString(w, `{"errors": [{"code": "MANIFEST_UNKNOWN", "message": "manifest unknown"}]}`)
+				return
+			}
+			io.WriteString(w, sigManifest)
+		default:
+			io.WriteString(w, manifest)
+		}
+	})
+
+	rc.Trust, err = trust.Parse(fmt.Appendf(nil, `{"namespaces": {"registry.ollama.ai/library": [%q]}}`, ssh.MarshalAuthorizedKey(key)))
+	testutil.Check(t, err)
+
+	err = rc.Pull(t.Context(), "model")
+	if !errors.Is(err, trust.ErrUntrusted) {
+		t.Fatalf("err = %v; want %v", err, trust.ErrUntrusted)
+	}
+	_, err = rc.ResolveLocal("model")
+	checkNotExist(t, err)
+
+	signed = true
+	testutil.Check(t, rc.Pull(t.Context(), "model"))
+	_, err = rc.ResolveLocal("model")
+	testutil.Check(t, err)
+
+	// signed by a key that isn't trusted
+	rc.Trust, err = trust.Parse(fmt.Appendf(nil, `{"namespaces": {"registry.ollama.ai/library": [%q]}}`, ssh.MarshalAuthorizedKey(testutil.WriteKey(t))))
+	testutil.Check(t, err)
+
+	err = rc.Pull(t.Context(), "model")
+	if !errors.Is(err, trust.ErrUntrusted) {
+		t.Fatalf("err = %v; want %v", err, trust.ErrUntrusted)
+	}
+}
+
 func TestRegistryPullCached(t *testing.T) {
 	cached := blob.DigestFromBytes("exists")
 	rc, _ := newClient(t, func(w http.ResponseWriter, r *http.Request) {
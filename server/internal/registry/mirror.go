@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ollama/ollama/server/internal/cache/blob"
+	"github.com/ollama/ollama/server/internal/client/ollama"
+)
+
+const manifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// aliasMediaType is the media type of the aliases the server stores in the
+// manifest directory in place of a manifest. Aliases are only known locally,
+// so the mirror serves the model an alias refers to.
+const aliasMediaType = "application/vnd.ollama.alias.v1+json"
+
+// maxAliasDepth is the most aliases followed to resolve a name
+const maxAliasDepth = 8
+
+// mirrorResolveTTL is how long a manifest resolved from the upstream registry
+// is reused before the upstream registry is asked again.
+var mirrorResolveTTL = 30 * time.Second
+
+type resolveCache struct {
+	mu       sync.Mutex
+	resolved map[string]resolvedManifest // by name
+}
+
+type resolvedManifest struct {
+	m  *ollama.Manifest
+	at time.Time
+}
+
+func (c *resolveCache) get(name string) (*ollama.Manifest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.resolved[name]
+	if !ok || time.Since(r.at) >= mirrorResolveTTL {
+		return nil, false
+	}
+	return r.m, true
+}
+
+func (c *resolveCache) put(name string, m *ollama.Manifest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resolved == nil {
+		c.resolved = make(map[string]resolvedManifest)
+	}
+	for k, r := range c.resolved {
+		if time.Since(r.at) >= mirrorResolveTTL {
+			delete(c.resolved, k)
+		}
+	}
+	c.resolved[name] = resolvedManifest{m: m, at: time.Now()}
+}
+
+// mirrorPulls coalesces the upstream pulls of concurrent requests for the
+// same model, so a model is only downloaded once no matter how many
+// instances ask for it while it is being pulled.
+var mirrorPulls singleflight.Group
+
+// mirrorResolves holds the manifests recently resolved from the upstream
+// registry, so each request for a model doesn't have to ask upstream.
+var mirrorResolves resolveCache
+
+// handleMirror handles the read-only subset of the OCI distribution API that
+// Ollama uses to pull models:
+//
+//	GET /v2/
+//	GET /v2/<namespace>/<model>/manifests/<tag or digest>
+//	GET /v2/<namespace>/<model>/blobs/<digest>
+//
+// HEAD requests are handled like GET requests, without the body.
+func (s *Local) handleMirror(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return errMethodNotAllowed
+	}
+
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.URL.Path == "/v2/" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")
+	if len(parts) != 4 {
+		return errNotFound
+	}
+
+	repo, kind, ref := parts[0]+"/"+parts[1], parts[2], parts[3]
+	switch kind {
+	case "manifests":
+		return s.serveManifest(w, r, repo, ref)
+	case "blobs":
+		d, err := blob.ParseDigest(ref)
+		if err != nil {
+			return &serverError{400, "bad_request", err.Error()}
+		}
+		return s.serveBlob(w, r, d, "application/octet-stream")
+	default:
+		return errNotFound
+	}
+}
+
+// serveManifest serves the manifest of repo at ref, which is either a tag or
+// the digest of a manifest in the local disk cache.
+func (s *Local) serveManifest(w http.ResponseWriter, r *http.Request, repo, ref string) error {
+	if d, err := blob.ParseDigest(ref); err == nil {
+		if err := s.resolveManifestDigest(d); err != nil {
+			return err
+		}
+		return s.serveBlob(w, r, d, manifestMediaType)
+	}
+
+	m, err := s.mirror(r.Context(), repo+":"+ref)
+	if errors.Is(err, ollama.ErrModelNotFound) {
+		return &serverError{404, "not_found", "model not found"}
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", manifestMediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.Data)))
+	w.Header().Set("Docker-Content-Digest", blob.DigestFromBytes(m.Data).String())
+	if r.Method == "GET" {
+		w.Write(m.Data)
+	}
+	return nil
+}
+
+// resolveManifestDigest makes sure the manifest with the digest d is in the
+// blob store if a model in the local disk cache has it. The manifests of
+// models stored by the classic store are only copied to the blob store when
+// they are resolved, so the models are resolved until one has the digest d.
+func (s *Local) resolveManifestDigest(d blob.Digest) error {
+	c, err := s.cache()
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.Get(d); err == nil {
+		return nil
+	}
+
+	for name, err := range c.Links() {
+		if err != nil {
+			return err
+		}
+
+		if md, err := c.Resolve(name); err == nil && md == d {
+			return nil
+		}
+	}
+	return nil
+}
+
+// serveBlob serves the blob d from the local disk cache. Range requests are
+// supported so clients can download large blobs in parts.
+func (s *Local) serveBlob(w http.ResponseWriter, r *http.Request, d blob.Digest, contentType string) error {
+	c, err := s.cache()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(c.GetFile(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &serverError{404, "not_found", "blob not found"}
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Docker-Content-Digest", d.String())
+	http.ServeContent(w, r, "", info.ModTime(), f)
+	return nil
+}
+
+// mirror returns the manifest of name from the local disk cache, first
+// pulling the model from the upstream registry if it is missing or out of
+// date. If the upstream registry can't be reached, the cached manifest is
+// returned as is. Local aliases are followed to the model they refer to.
+func (s *Local) mirror(ctx context.Context, name string) (*ollama.Manifest, error) {
+	for range maxAliasDepth {
+		local, err := s.Client.ResolveLocal(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, ollama.ErrModelNotFound) {
+			return nil, err
+		}
+
+		if local != nil {
+			if target, ok := parseAlias(local.Data); ok {
+				name = target
+				continue
+			}
+		}
+
+		return s.mirrorManifest(ctx, name, local)
+	}
+
+	return nil, fmt.Errorf("%s: too many levels of aliases", name)
+}
+
+func (s *Local) mirrorManifest(ctx context.Context, name string, local *ollama.Manifest) (*ollama.Manifest, error) {
+	remote, err := s.resolveUpstream(ctx, name)
+	if err != nil {
+		if local != nil {
+			s.Logger.WarnContext(ctx, "serving cached manifest", "name", name, "error", err)
+			return local, nil
+		}
+		return nil, err
+	}
+
+	if local != nil && bytes.Equal(local.Data, remote.Data) {
+		return local, nil
+	}
+
+	// The pull is shared by all waiting requests, so it must not be
+	// canceled when the request that started it goes away.
+	_, err, _ = mirrorPulls.Do(name, func() (any, error) {
+		s.Logger.InfoContext(ctx, "pulling upstream", "name", name)
+		return nil, s.Client.Pull(context.WithoutCancel(ctx), name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Client.ResolveLocal(name)
+}
+
+// resolveUpstream resolves name in the upstream registry, reusing the
+// manifest resolved within the last mirrorResolveTTL.
+func (s *Local) resolveUpstream(ctx context.Context, name string) (*ollama.Manifest, error) {
+	if m, ok := mirrorResolves.get(name); ok {
+		return m, nil
+	}
+
+	m, err := s.Client.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrorResolves.put(name, m)
+	return m, nil
+}
+
+// parseAlias returns the name of the model the alias in data refers to, or
+// false if data isn't an alias.
+func parseAlias(data []byte) (string, bool) {
+	var ref struct {
+		MediaType string `json:"mediaType"`
+		Target    string `json:"target"`
+	}
+	if err := json.Unmarshal(data, &ref); err != nil || ref.MediaType != aliasMediaType {
+		return "", false
+	}
+	return ref.Target, true
+}
+
+func (s *Local) cache() (*blob.DiskCache, error) {
+	if s.Client.Cache != nil {
+		return s.Client.Cache, nil
+	}
+	return ollama.DefaultCache()
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +40,16 @@ type Local struct {
 	// Prune, if set, is called to prune the local disk cache after a model
 	// is deleted.
 	Prune func() error // optional
+
+	// Mirror, if set, serves the models in the local disk cache to other
+	// Ollama instances with the registry API under /v2/, pulling models
+	// from the upstream registry when they are missing or out of date.
+	Mirror bool
+
+	// MirrorOnly, if set, passes the Ollama API requests that Local would
+	// otherwise handle to Fallback, so that only the registry API is
+	// served by Local.
+	MirrorOnly bool
 }
 
 // serverError is like ollama.Error, but with a Status field for the HTTP
@@ -110,18 +121,21 @@ func (s *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Local) serveHTTP(rec *statusCodeRecorder, r *http.Request) {
 	var errattr slog.Attr
 	proxied, err := func() (bool, error) {
-		switch r.URL.Path {
-		case "/api/delete":
+		switch {
+		case s.Mirror && strings.HasPrefix(r.URL.Path, "/v2/"):
+			return false, s.handleMirror(rec, r)
+		case s.MirrorOnly:
+		case r.URL.Path == "/api/delete":
 			return false, s.handleDelete(rec, r)
-		case "/api/pull":
+		case r.URL.Path == "/api/pull":
 			return false, s.handlePull(rec, r)
-		default:
-			if s.Fallback != nil {
-				s.Fallback.ServeHTTP(rec, r)
-				return true, nil
-			}
-			return false, errNotFound
 		}
+
+		if s.Fallback != nil {
+			s.Fallback.ServeHTTP(rec, r)
+			return true, nil
+		}
+		return false, errNotFound
 	}()
 	if err != nil {
 		// We always log the error, so fill in the error log attribute
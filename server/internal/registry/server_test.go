@@ -14,6 +14,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/ollama/ollama/server/internal/cache/blob"
@@ -285,3 +286,168 @@ func checkErrorResponse(t *testing.T, got *httptest.ResponseRecorder, status int
 		errorf("Message = %q; want to contain %q", e.Message, msg)
 	}
 }
+
+func TestServerMirror(t *testing.T) {
+	var offline atomic.Bool
+	var blobPulls, manifestResolves atomic.Int32
+	modelsHandler := http.FileServerFS(registryFS())
+	s := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if offline.Load() {
+			w.WriteHeader(503)
+			io.WriteString(w, `{"error": "unavailable"}`)
+			return
+		}
+		if r.URL.Path == "/v2/library/unknown/manifests/latest" {
+			w.WriteHeader(404)
+			io.WriteString(w, `{"errors": [{"code": "MANIFEST_UNKNOWN", "message": "manifest unknown"}]}`)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/blobs/") {
+			blobPulls.Add(1)
+		}
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			manifestResolves.Add(1)
+		}
+		modelsHandler.ServeHTTP(w, r)
+	})
+	s.Mirror = true
+
+	got := s.send(t, "GET", "/v2/", ``)
+	if got.Code != 200 {
+		t.Fatalf("Code = %d; want 200", got.Code)
+	}
+
+	want, err := fs.ReadFile(registryFS(), "v2/library/smol/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent requests for a model that isn't cached share one pull
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := s.send(t, "GET", "/v2/library/smol/manifests/latest", ``)
+			if got.Code != 200 {
+				t.Errorf("Code = %d; want 200", got.Code)
+			}
+			if !bytes.Equal(got.Body.Bytes(), want) {
+				t.Errorf("body = %q; want %q", got.Body, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := blobPulls.Load(); n != 2 {
+		t.Errorf("upstream blob requests = %d; want 2", n)
+	}
+
+	// the upstream manifest is reused for a while
+	resolves := manifestResolves.Load()
+	got = s.send(t, "GET", "/v2/library/smol/manifests/latest", ``)
+	if got.Code != 200 || !bytes.Equal(got.Body.Bytes(), want) {
+		t.Errorf("cached resolve: Code = %d, body = %q", got.Code, got.Body)
+	}
+	if n := manifestResolves.Load(); n != resolves {
+		t.Errorf("upstream manifest requests = %d; want %d", n, resolves)
+	}
+
+	// aliases are served as the model they refer to
+	alias := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.ollama.alias.v1+json","target":"example.com/library/smol:latest"}`)
+	ad, err := s.Client.Cache.Import(bytes.NewReader(alias), int64(len(alias)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Client.Cache.Link("example.com/library/prod:latest", ad); err != nil {
+		t.Fatal(err)
+	}
+
+	got = s.send(t, "GET", "/v2/library/prod/manifests/latest", ``)
+	if got.Code != 200 || !bytes.Equal(got.Body.Bytes(), want) {
+		t.Errorf("alias: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	d := blob.DigestFromBytes(want)
+	got = s.send(t, "HEAD", "/v2/library/smol/manifests/"+d.String(), ``)
+	if got.Code != 200 || got.Header().Get("Docker-Content-Digest") != d.String() {
+		t.Errorf("manifest by digest: Code = %d, Docker-Content-Digest = %q", got.Code, got.Header().Get("Docker-Content-Digest"))
+	}
+
+	// manifests of models in the classic store aren't in the blob store
+	// until they are resolved
+	classic := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","layers":[]}`)
+	cd, err := s.Client.Cache.Import(bytes.NewReader(classic), int64(len(classic)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Client.Cache.Link("example.com/library/classic:latest", cd); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(s.Client.Cache.GetFile(cd)); err != nil {
+		t.Fatal(err)
+	}
+
+	got = s.send(t, "GET", "/v2/library/classic/manifests/"+cd.String(), ``)
+	if got.Code != 200 || !bytes.Equal(got.Body.Bytes(), classic) {
+		t.Errorf("classic manifest by digest: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	got = s.send(t, "GET", "/v2/library/classic/manifests/sha256:"+strings.Repeat("0", 64), ``)
+	checkErrorResponse(t, got, 404, "not_found", "blob not found")
+
+	layer := "/v2/library/smol/blobs/sha256:68e0ec597aee59d35f8dc44942d7b17d471ade10d3aca07a5bb7177713950312"
+	got = s.send(t, "GET", layer, ``)
+	if got.Code != 200 || got.Body.String() != "GGUF\n" {
+		t.Errorf("blob: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	got = s.send(t, "HEAD", layer, ``)
+	if got.Code != 200 || got.Header().Get("Content-Length") != "5" || got.Body.Len() != 0 {
+		t.Errorf("HEAD blob: Code = %d, Content-Length = %q, body = %q", got.Code, got.Header().Get("Content-Length"), got.Body)
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), "GET", layer, nil)
+	req.Header.Set("Range", "bytes=1-2")
+	got = s.sendRequest(t, req)
+	if got.Code != 206 || got.Body.String() != "GU" {
+		t.Errorf("range: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	got = s.send(t, "GET", "/v2/library/smol/blobs/sha256:"+strings.Repeat("0", 64), ``)
+	checkErrorResponse(t, got, 404, "not_found", "blob not found")
+
+	got = s.send(t, "GET", "/v2/library/smol/blobs/latest", ``)
+	checkErrorResponse(t, got, 400, "bad_request", "invalid digest")
+
+	got = s.send(t, "GET", "/v2/library/unknown/manifests/latest", ``)
+	checkErrorResponse(t, got, 404, "not_found", "model not found")
+
+	got = s.send(t, "PUT", "/v2/library/smol/manifests/latest", `{}`)
+	checkErrorResponse(t, got, 405, "method_not_allowed", "method not allowed")
+
+	// cached models are served while upstream is unavailable
+	offline.Store(true)
+	ttl := mirrorResolveTTL
+	mirrorResolveTTL = 0
+	t.Cleanup(func() { mirrorResolveTTL = ttl })
+	got = s.send(t, "GET", "/v2/library/smol/manifests/latest", ``)
+	if got.Code != 200 || !bytes.Equal(got.Body.Bytes(), want) {
+		t.Errorf("offline: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	got = s.send(t, "GET", "/v2/library/prod/manifests/latest", ``)
+	if got.Code != 200 || !bytes.Equal(got.Body.Bytes(), want) {
+		t.Errorf("offline alias: Code = %d, body = %q", got.Code, got.Body)
+	}
+
+	got = s.send(t, "GET", "/v2/library/other/manifests/latest", ``)
+	if got.Code < 400 {
+		t.Errorf("offline uncached: Code = %d; want error", got.Code)
+	}
+
+	// only the registry API is served in mirror only mode
+	s.MirrorOnly = true
+	got = s.send(t, "POST", "/api/pull", `{"model": "smol"}`)
+	checkErrorResponse(t, got, 404, "not_found", "not found")
+}
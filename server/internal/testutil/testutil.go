@@ -2,12 +2,17 @@ package testutil
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // LogWriter returns an [io.Writer] that logs each Write using t.Log.
@@ -100,3 +105,39 @@ func WriteFile[S []byte | string](t testing.TB, name string, data S) {
 		t.Fatal(err)
 	}
 }
+
+// WriteKey sets the home directory to a new temporary directory with a new
+// Ed25519 key in .ollama/id_ed25519, the key used by [auth.Sign], and returns
+// its public key.
+func WriteKey(t testing.TB) ssh.PublicKey {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer.PublicKey()
+}
@@ -0,0 +1,140 @@
+// Package trust verifies the signatures of models against a trust policy
+// listing the public keys allowed to sign the models of each namespace.
+//
+// # Signatures
+//
+// A signature is made with [auth.Sign] over the digest of a model's
+// manifest, e.g. "sha256:<hex>". It is pushed to the model's repository as
+// a manifest tagged with [SignatureTag] of the digest, which has a layer
+// with the media type [MediaType] for each signature.
+package trust
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/auth"
+)
+
+// MediaType is the media type of a signature layer
+const MediaType = "application/vnd.ollama.image.signature"
+
+// ErrUntrusted is returned when a model in a namespace of the policy isn't
+// signed by one of its trusted keys.
+var ErrUntrusted = errors.New("model signature not trusted")
+
+// Policy is a trust policy. It is read from the JSON file named by
+// OLLAMA_TRUST_POLICY.
+type Policy struct {
+	// Namespaces maps a namespace, written as host/namespace, to the
+	// public keys trusted to sign its models in authorized_keys format,
+	// e.g. "ssh-ed25519 AAAA...". Models in other namespaces don't have
+	// to be signed.
+	Namespaces map[string][]string `json:"namespaces"`
+
+	keys map[string][]ssh.PublicKey
+}
+
+// Read reads the policy in the file at path. If path is empty, it returns a
+// nil policy, which trusts every model.
+func Read(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := Parse(bts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// Parse parses a policy in JSON.
+func Parse(bts []byte) (*Policy, error) {
+	d := json.NewDecoder(bytes.NewReader(bts))
+	d.DisallowUnknownFields()
+
+	var p Policy
+	if err := d.Decode(&p); err != nil {
+		return nil, err
+	}
+
+	p.keys = make(map[string][]ssh.PublicKey, len(p.Namespaces))
+	for ns, keys := range p.Namespaces {
+		host, namespace, ok := strings.Cut(ns, "/")
+		if !ok || host == "" || namespace == "" || strings.Contains(namespace, "/") {
+			return nil, fmt.Errorf("invalid namespace %q, want host/namespace", ns)
+		}
+
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%s: no keys", ns)
+		}
+
+		for _, key := range keys {
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid key %q: %w", ns, key, err)
+			}
+
+			p.keys[strings.ToLower(ns)] = append(p.keys[strings.ToLower(ns)], publicKey)
+		}
+	}
+
+	return &p, nil
+}
+
+// Enforced reports whether models in namespace on host must be signed.
+func (p *Policy) Enforced(host, namespace string) bool {
+	return p != nil && len(p.keys[strings.ToLower(host+"/"+namespace)]) > 0
+}
+
+// Verify checks that one of signatures is a signature of digest made by a
+// key trusted for namespace on host. It returns nil if the namespace isn't
+// in the policy.
+func (p *Policy) Verify(host, namespace, digest string, signatures []string) error {
+	if !p.Enforced(host, namespace) {
+		return nil
+	}
+
+	if len(signatures) == 0 {
+		return fmt.Errorf("%w: %s/%s requires signed models and %s is not signed", ErrUntrusted, host, namespace, digest)
+	}
+
+	for _, signature := range signatures {
+		publicKey, err := auth.Verify([]byte(digest), signature)
+		if err != nil {
+			continue
+		}
+
+		for _, trusted := range p.keys[strings.ToLower(host+"/"+namespace)] {
+			if bytes.Equal(publicKey.Marshal(), trusted.Marshal()) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s is not signed by a key trusted for %s/%s", ErrUntrusted, digest, host, namespace)
+}
+
+// SignatureTag returns the tag of the signatures of the manifest with
+// digest, e.g. sha256-<hex>.sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// IsSignatureTag reports whether tag is the tag of signatures.
+func IsSignatureTag(tag string) bool {
+	return strings.HasPrefix(tag, "sha256-") && strings.HasSuffix(tag, ".sig")
+}
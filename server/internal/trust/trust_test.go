@@ -0,0 +1,134 @@
+package trust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/server/internal/testutil"
+)
+
+const digest = "sha256:68e0ec597aee59d35f8dc44942d7b17d471ade10d3aca07a5bb7177713950312"
+
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestParse(t *testing.T) {
+	key := authorizedKey(testutil.WriteKey(t))
+
+	cases := map[string]struct {
+		input string
+		err   bool
+	}{
+		"valid":             {fmt.Sprintf(`{"namespaces": {"registry.ollama.ai/myorg": [%q]}}`, key), false},
+		"key with comment":  {fmt.Sprintf(`{"namespaces": {"registry.ollama.ai/myorg": [%q]}}`, key+" alice@example.com"), false},
+		"empty":             {`{}`, false},
+		"no host":           {fmt.Sprintf(`{"namespaces": {"myorg": [%q]}}`, key), true},
+		"model":             {fmt.Sprintf(`{"namespaces": {"registry.ollama.ai/myorg/model": [%q]}}`, key), true},
+		"no keys":           {`{"namespaces": {"registry.ollama.ai/myorg": []}}`, true},
+		"invalid key":       {`{"namespaces": {"registry.ollama.ai/myorg": ["ssh-ed25519 AAAA"]}}`, true},
+		"unknown field":     {`{"models": {}}`, true},
+		"invalid json":      {`{`, true},
+		"namespaces string": {`{"namespaces": "registry.ollama.ai/myorg"}`, true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	p, err := Read("")
+	if err != nil || p != nil {
+		t.Fatalf("expected no policy, got %v, %v", p, err)
+	}
+
+	if p.Enforced("registry.ollama.ai", "library") {
+		t.Error("expected nil policy not to be enforced")
+	}
+
+	if err := p.Verify("registry.ollama.ai", "library", digest, nil); err != nil {
+		t.Errorf("expected nil policy to trust unsigned models, got %v", err)
+	}
+
+	if _, err := Read(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected missing policy to be an error, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	// sign with a key that isn't trusted
+	testutil.WriteKey(t)
+	untrusted, err := auth.Sign(context.Background(), []byte(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := testutil.WriteKey(t)
+	signature, err := auth.Sign(context.Background(), []byte(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Parse(fmt.Appendf(nil, `{"namespaces": {"registry.ollama.ai/MyOrg": [%q]}}`, authorizedKey(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := strings.Replace(digest, "68e0", "0000", 1)
+
+	cases := []struct {
+		name       string
+		host       string
+		namespace  string
+		digest     string
+		signatures []string
+		err        error
+	}{
+		{"trusted", "registry.ollama.ai", "myorg", digest, []string{signature}, nil},
+		{"one trusted", "registry.ollama.ai", "myorg", digest, []string{untrusted, "invalid", signature}, nil},
+		{"unsigned", "registry.ollama.ai", "myorg", digest, nil, ErrUntrusted},
+		{"untrusted", "registry.ollama.ai", "myorg", digest, []string{untrusted}, ErrUntrusted},
+		{"other digest", "registry.ollama.ai", "myorg", other, []string{signature}, ErrUntrusted},
+		{"malformed", "registry.ollama.ai", "myorg", digest, []string{"invalid"}, ErrUntrusted},
+		{"other namespace", "registry.ollama.ai", "library", digest, nil, nil},
+		{"other host", "example.com", "myorg", digest, nil, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Verify(tt.host, tt.namespace, tt.digest, tt.signatures)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSignatureTag(t *testing.T) {
+	tag := SignatureTag(digest)
+	if tag != "sha256-68e0ec597aee59d35f8dc44942d7b17d471ade10d3aca07a5bb7177713950312.sig" {
+		t.Errorf("unexpected tag %s", tag)
+	}
+
+	if !IsSignatureTag(tag) {
+		t.Errorf("expected %s to be a signature tag", tag)
+	}
+
+	if IsSignatureTag("latest") {
+		t.Error("expected latest not to be a signature tag")
+	}
+}
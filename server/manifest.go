@@ -23,6 +23,17 @@ type Manifest struct {
 	filepath string
 	fi       os.FileInfo
 	digest   string
+
+	// target is the name the manifest was resolved through when it was
+	// read from an alias
+	target model.Name
+
+	// resolved is the model an alias refers to in the end, following the
+	// aliases that target is
+	resolved model.Name
+
+	// dangling is set for an alias whose target doesn't exist
+	dangling bool
 }
 
 func (m *Manifest) Size() (size int64) {
@@ -60,7 +71,14 @@ func (m *Manifest) RemoveLayers() error {
 	return nil
 }
 
+// ParseNamedManifest reads the manifest of n, following n if it is an
+// alias. The manifest of an alias has the contents of its target but is
+// removed and listed as the alias.
 func ParseNamedManifest(n model.Name) (*Manifest, error) {
+	return parseNamedManifest(n, 0)
+}
+
+func parseNamedManifest(n model.Name, depth int) (*Manifest, error) {
 	if !n.IsFullyQualified() {
 		return nil, model.Unqualified(n)
 	}
@@ -72,7 +90,6 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 
 	p := filepath.Join(manifests, n.Filepath())
 
-	var m Manifest
 	f, err := os.Open(p)
 	if err != nil {
 		return nil, err
@@ -85,7 +102,32 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 	}
 
 	sha256sum := sha256.New()
-	if err := json.NewDecoder(io.TeeReader(f, sha256sum)).Decode(&m); err != nil {
+	bts, err := io.ReadAll(io.TeeReader(f, sha256sum))
+	if err != nil {
+		return nil, err
+	}
+
+	if target, ok := parseAlias(bts); ok {
+		if depth >= maxAliasDepth {
+			return nil, fmt.Errorf("%s: %w", n.DisplayShortest(), errAliasDepth)
+		}
+
+		m, err := parseNamedManifest(target, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		m.filepath = p
+		m.fi = fi
+		m.target = target
+		if !m.resolved.IsValid() {
+			m.resolved = target
+		}
+		return m, nil
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(bts, &m); err != nil {
 		return nil, err
 	}
 
@@ -162,6 +204,13 @@ func Manifests(continueOnError bool) (map[model.Name]*Manifest, error) {
 			}
 
 			m, err := ParseNamedManifest(n)
+			if errors.Is(err, os.ErrNotExist) {
+				// an alias whose target was removed is kept so it refers
+				// to the target again if it's pulled or created
+				if target, aerr := readAlias(n); aerr == nil {
+					m, err = &Manifest{filepath: match, fi: fi, target: target, dangling: true}, nil
+				}
+			}
 			if err != nil {
 				if !continueOnError {
 					return nil, fmt.Errorf("%s %w", n, err)
@@ -83,6 +83,21 @@ func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 		if s := layer.GGML.KV().ChatTemplate(); s != "" {
 			if t, err := template.Named(s); err != nil {
 				slog.Debug("template detection", "error", err)
+
+				// use the model's own template if no bundled template is similar
+				t, err := jinjaChatTemplate(layer, s)
+				if err != nil {
+					slog.Debug("jinja template detection", "error", err)
+					continue
+				}
+
+				layer, err := NewLayer(strings.NewReader(t), "application/vnd.ollama.image.template")
+				if err != nil {
+					return nil, err
+				}
+
+				layer.status = "using the model's jinja chat template"
+				layers = append(layers, &layerGGML{layer, nil})
 			} else {
 				layer, err := NewLayer(t.Reader(), "application/vnd.ollama.image.template")
 				if err != nil {
@@ -112,6 +127,44 @@ func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 	return layers, nil
 }
 
+// jinjaChatTemplate returns the model's Jinja chat template prefixed with the
+// model's eos_token so it renders as it does in transformers. bos_token is
+// left empty since the runner adds it when tokenizing.
+func jinjaChatTemplate(layer *layerGGML, s string) (string, error) {
+	t, err := template.Parse(s)
+	if err != nil {
+		return "", err
+	} else if !t.IsJinja() {
+		return "", errors.New("chat template is not a jinja template")
+	}
+
+	blobpath, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	blob, err := os.Open(blobpath)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	// the vocabulary is larger than the arrays collected by default
+	f, _, err := ggml.Decode(blob, -1)
+	if err != nil {
+		return "", err
+	}
+
+	kv := f.KV()
+	if id, ok := kv["tokenizer.ggml.eos_token_id"].(uint32); ok {
+		if tokens := kv.Strings("tokenizer.ggml.tokens"); int(id) < len(tokens) {
+			s = "{% set eos_token = " + template.Quote(tokens[id]) + " %}\n" + s
+		}
+	}
+
+	return s, nil
+}
+
 func detectContentType(r io.Reader) (string, error) {
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, r); err != nil {
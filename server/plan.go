@@ -0,0 +1,169 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+)
+
+// Plan reports how model would be placed if it were scheduled now with opts.
+// It follows the same steps as processPending but loads and unloads nothing.
+// numParallel overrides OLLAMA_NUM_PARALLEL if it's greater than zero.
+func (s *Scheduler) Plan(ctx context.Context, model *Model, opts api.Options, numParallel int) (*api.PlanResponse, error) {
+	req := &LlmRequest{
+		ctx:        ctx,
+		model:      model,
+		opts:       opts,
+		origNumCtx: opts.NumCtx,
+	}
+
+	f, err := llm.LoadModel(model.ModelPath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if numParallel <= 0 {
+		numParallel = int(envconfig.NumParallel())
+	}
+	if checkMllamaModelFamily(model) || model.CheckCapabilities(CapabilityCompletion) != nil {
+		numParallel = 1
+	}
+
+	var plan api.PlanResponse
+
+	// runners which would be unloaded, including a loaded instance of this
+	// model which would be reused, are left out of the memory accounting
+	runners := s.loadedRunners()
+	var evicted []*runnerRef
+	evict := func(r *runnerRef) {
+		evicted = append(evicted, r)
+		runners = slices.DeleteFunc(runners, func(e *runnerRef) bool { return e == r })
+	}
+
+	if i := slices.IndexFunc(runners, func(r *runnerRef) bool { return r.modelPath == model.ModelPath }); i >= 0 {
+		runner := runners[i]
+		if runner.needsReload(ctx, req) {
+			plan.Evict = append(plan.Evict, runner.model.ShortName)
+		} else {
+			plan.Loaded = true
+			numParallel = runner.numParallel
+		}
+		evict(runner)
+	}
+
+	var gpus discover.GpuInfoList
+	for {
+		if opts.NumGPU == 0 {
+			gpus = s.getCpuFn()
+		} else {
+			gpus = s.getGpuFn()
+		}
+
+		// free memory reported by the GPUs still includes runners we plan to
+		// evict, so give it back before accounting for the rest
+		for _, r := range evicted {
+			r.refMu.Lock()
+			if r.llama != nil {
+				for i := range gpus {
+					if gpus[i].Library == "cpu" {
+						gpus[i].FreeMemory += r.estimatedTotal - r.estimatedVRAM
+					} else {
+						gpus[i].FreeMemory += r.llama.EstimatedVRAMByGPU(gpus[i].ID)
+					}
+					gpus[i].FreeMemory = min(gpus[i].FreeMemory, gpus[i].TotalMemory)
+				}
+			}
+			r.refMu.Unlock()
+		}
+
+		maxRunners := int(envconfig.MaxRunners())
+		if maxRunners <= 0 {
+			maxRunners = defaultModelsPerGPU * len(gpus)
+			if slices.ContainsFunc(gpus, func(g discover.GpuInfo) bool { return g.UnreliableFreeMemory }) {
+				maxRunners = len(gpus)
+			}
+		}
+
+		var unload *runnerRef
+		if len(runners) >= maxRunners {
+			unload = runnerToUnload(slices.Clone(runners))
+		} else if len(gpus) == 1 && gpus[0].Library == "cpu" {
+			if numParallel <= 0 {
+				numParallel = defaultParallel
+			}
+
+			req.opts.NumCtx = req.origNumCtx * numParallel
+			if len(runners) == 0 {
+				break
+			}
+
+			estimate := llm.EstimateGPULayers(gpus, f, model.ModelPath, model.ProjectorPaths, req.opts)
+			if estimate.TotalSize <= gpus[0].FreeMemory {
+				break
+			}
+
+			unload = runnerToUnload(slices.Clone(runners))
+		} else if len(runners) == 0 {
+			if g := pickBestFullFitByLibrary(req, f, gpus, &numParallel); g != nil {
+				gpus = g
+			} else {
+				gpus = pickBestPartialFitByLibrary(req, f, gpus, &numParallel)
+			}
+			break
+		} else {
+			updateFreeSpace(gpus, runners)
+			if g := pickBestFullFitByLibrary(req, f, gpus, &numParallel); g != nil {
+				gpus = g
+				break
+			}
+
+			unload = runnerToUnload(slices.Clone(runners))
+		}
+
+		plan.Evict = append(plan.Evict, unload.model.ShortName)
+		evict(unload)
+	}
+
+	estimate := llm.EstimateGPULayers(gpus, f, model.ModelPath, model.ProjectorPaths, req.opts)
+
+	// mirrors NewLlamaServer, which falls back to the CPU if nothing fits
+	if gpus[0].Library != "cpu" && gpus[0].Library != "metal" && estimate.Layers == 0 {
+		gpus = s.getCpuFn()
+		estimate = llm.EstimateGPULayers(gpus, f, model.ModelPath, model.ProjectorPaths, req.opts)
+	}
+
+	plan.Model = model.ShortName
+	plan.Library = gpus[0].Library
+	plan.NumParallel = numParallel
+	plan.NumCtx = req.opts.NumCtx
+	plan.KVCacheType = cmp.Or(estimate.KVCacheType, "f16")
+	plan.Layers = estimate.Layers
+	plan.TotalLayers = int(f.KV().BlockCount()) + 1
+	plan.Size = int64(estimate.TotalSize)
+	plan.SizeVRAM = int64(estimate.VRAMSize)
+	plan.KVCache = int64(estimate.KV)
+	plan.Graph = int64(estimate.Graph)
+	plan.Projector = int64(estimate.Projector)
+
+	for i, gpu := range gpus {
+		if i >= len(estimate.GPULayers) || estimate.GPULayers[i] == 0 {
+			continue
+		}
+
+		plan.GPUs = append(plan.GPUs, api.PlanGPU{
+			ID:      gpu.ID,
+			Library: gpu.Library,
+			Name:    gpu.Name,
+			Layers:  estimate.GPULayers[i],
+			Size:    int64(estimate.GPUSizes[i]),
+			Free:    int64(gpu.FreeMemory),
+		})
+	}
+
+	return &plan, nil
+}
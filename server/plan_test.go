@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/format"
+)
+
+func TestPlan(t *testing.T) {
+	t.Setenv("OLLAMA_NUM_PARALLEL", "1")
+	t.Setenv("OLLAMA_MAX_LOADED_MODELS", "0")
+
+	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = getGpuFn
+	s.getCpuFn = getCpuFn
+
+	a := newScenarioRequest(t, ctx, "ollama-model-a", 0, nil)
+	a.req.model.ShortName = "a"
+
+	t.Run("nothing loaded", func(t *testing.T) {
+		plan, err := s.Plan(ctx, a.req.model, a.req.opts, 0)
+		require.NoError(t, err)
+		require.Equal(t, "metal", plan.Library)
+		require.Equal(t, 1, plan.NumParallel)
+		require.Equal(t, a.req.opts.NumCtx, plan.NumCtx)
+		require.Equal(t, "f16", plan.KVCacheType)
+		require.Equal(t, 2, plan.TotalLayers)
+		require.Positive(t, plan.KVCache)
+		require.Len(t, plan.GPUs, 1)
+		require.Equal(t, plan.SizeVRAM, plan.GPUs[0].Size)
+		require.Empty(t, plan.Evict)
+		require.False(t, plan.Loaded)
+	})
+
+	t.Run("num parallel", func(t *testing.T) {
+		plan, err := s.Plan(ctx, a.req.model, a.req.opts, 2)
+		require.NoError(t, err)
+		require.Equal(t, 2, plan.NumParallel)
+		require.Equal(t, 2*a.req.opts.NumCtx, plan.NumCtx)
+	})
+
+	b := newScenarioRequest(t, ctx, "ollama-model-b", 0, nil)
+	b.req.model.ShortName = "b"
+	big := &runnerRef{
+		model:          b.req.model,
+		modelPath:      b.req.model.ModelPath,
+		llama:          &mockLlm{estimatedVRAMByGPU: map[string]uint64{"": 24*format.GigaByte - 1}},
+		estimatedVRAM:  24*format.GigaByte - 1,
+		estimatedTotal: 24*format.GigaByte - 1,
+		numParallel:    1,
+	}
+
+	s.loadedMu.Lock()
+	s.loaded[big.modelPath] = big
+	s.loadedMu.Unlock()
+
+	t.Run("evicts", func(t *testing.T) {
+		plan, err := s.Plan(ctx, a.req.model, a.req.opts, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, plan.Evict)
+		require.Len(t, plan.GPUs, 1)
+
+		s.loadedMu.Lock()
+		require.Len(t, s.loaded, 1, "plan must not unload anything")
+		s.loadedMu.Unlock()
+	})
+
+	t.Run("already loaded", func(t *testing.T) {
+		opts := b.req.opts
+		big.Options = &opts
+		plan, err := s.Plan(ctx, b.req.model, b.req.opts, 0)
+		require.NoError(t, err)
+		require.True(t, plan.Loaded)
+		require.Empty(t, plan.Evict)
+	})
+
+	t.Run("cpu", func(t *testing.T) {
+		opts := a.req.opts
+		opts.NumGPU = 0
+		plan, err := s.Plan(ctx, a.req.model, opts, 0)
+		require.NoError(t, err)
+		require.Equal(t, "cpu", plan.Library)
+		require.Zero(t, plan.SizeVRAM)
+		require.Empty(t, plan.GPUs)
+	})
+}
+
+func TestPlanSimulatedGPUs(t *testing.T) {
+	t.Setenv("OLLAMA_NUM_PARALLEL", "1")
+
+	path := filepath.Join(t.TempDir(), "gpus.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"cpu": {"total_memory": 34359738368, "free_memory": 34359738368},
+		"gpus": [
+			{"id": "GPU-0", "library": "cuda", "variant": "v11", "compute": "5.2", "total_memory": 12884901888},
+			{"id": "GPU-1", "library": "cuda", "variant": "v11", "compute": "5.2", "total_memory": 12884901888}
+		]
+	}`), 0o644))
+
+	discover.SetProvider(discover.NewFakeProvider(path))
+	t.Cleanup(func() { discover.SetProvider(nil) })
+
+	ctx, done := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+	a := newScenarioRequest(t, ctx, "ollama-model-a", 0, nil)
+
+	plan, err := s.Plan(ctx, a.req.model, a.req.opts, 0)
+	require.NoError(t, err)
+	require.Equal(t, "cuda", plan.Library)
+	require.Len(t, plan.GPUs, 1)
+
+	t.Setenv("OLLAMA_SCHED_SPREAD", "1")
+	opts := a.req.opts
+	opts.NumGPU = -1
+	plan, err = s.Plan(ctx, a.req.model, opts, 0)
+	require.NoError(t, err)
+	require.Len(t, plan.GPUs, 2)
+	require.Equal(t, "GPU-0", plan.GPUs[0].ID)
+	require.Equal(t, "GPU-1", plan.GPUs[1].ID)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// A Policy sets how long models stay loaded. It is read from the JSON file
+// named by OLLAMA_POLICY when the server starts and again on SIGHUP.
+type Policy struct {
+	Models []ModelPolicy `json:"models"`
+}
+
+// ModelPolicy is the lifecycle policy of a single model.
+type ModelPolicy struct {
+	Model string `json:"model"`
+
+	// Pin keeps the model loaded once it is loaded. A pinned model isn't
+	// unloaded when it is idle, when a request sets keep_alive or to make
+	// room for another model.
+	Pin bool `json:"pin,omitempty"`
+
+	// Preload loads the model when the policy is loaded
+	Preload bool `json:"preload,omitempty"`
+
+	// MaxIdle is the longest the model stays loaded while idle. It caps the
+	// keep_alive of requests and OLLAMA_KEEP_ALIVE.
+	MaxIdle *api.Duration `json:"max_idle,omitempty"`
+
+	// Options are the options the model is preloaded with
+	Options map[string]any `json:"options,omitempty"`
+}
+
+var errAllPinned = errors.New("maximum number of loaded models reached and every loaded model is pinned")
+
+// keepAlive returns how long a model with policy p stays loaded while idle
+// when d is requested.
+func (p ModelPolicy) keepAlive(d time.Duration) time.Duration {
+	if p.Pin {
+		return time.Duration(math.MaxInt64)
+	}
+
+	if p.MaxIdle != nil && d > p.MaxIdle.Duration {
+		return p.MaxIdle.Duration
+	}
+
+	return d
+}
+
+// readPolicy reads the policy in the file at path.
+func readPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+
+	var p Policy
+	if err := d.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, mp := range p.Models {
+		if !model.ParseName(mp.Model).IsValid() {
+			return nil, fmt.Errorf("%s: invalid model name %q", path, mp.Model)
+		}
+
+		if mp.Pin && mp.MaxIdle != nil {
+			return nil, fmt.Errorf("%s: %s: max_idle cannot be set for a pinned model", path, mp.Model)
+		}
+	}
+
+	return &p, nil
+}
+
+// loadPolicy reads the policy in the file at path and applies it to the
+// scheduler, then preloads models in the background. Model names are
+// resolved when the policy is loaded, so models pulled afterwards are
+// picked up on the next reload.
+func (s *Server) loadPolicy(ctx context.Context, path string) error {
+	p, err := readPolicy(path)
+	if err != nil {
+		return err
+	}
+
+	policies := make(map[string]ModelPolicy)
+	var preload []ModelPolicy
+	for _, mp := range p.Models {
+		m, err := GetModel(mp.Model)
+		if err != nil {
+			slog.Warn("skipping policy for model", "model", mp.Model, "error", err)
+			continue
+		}
+
+		policies[m.ModelPath] = mp
+		if mp.Preload {
+			preload = append(preload, mp)
+		}
+	}
+
+	s.sched.setPolicies(policies)
+
+	go func() {
+		// one at a time so preloads are scheduled like queued requests
+		for _, mp := range preload {
+			if err := s.preload(ctx, mp); err != nil {
+				slog.Error("failed to preload model", "model", mp.Model, "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// preload loads the model of mp, returning once it is loaded. The model
+// then stays loaded for as long as its policy allows.
+func (s *Server) preload(ctx context.Context, mp ModelPolicy) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slog.Info("preloading model", "model", mp.Model)
+	_, _, _, err := s.scheduleRunner(ctx, mp.Model, nil, mp.Options, nil)
+	return err
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+func TestReadPolicy(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"valid", `{"models": [{"model": "llama3.2", "pin": true, "preload": true}, {"model": "nomic-embed-text", "max_idle": "10m"}]}`, false},
+		{"unknown key", `{"models": [{"model": "llama3.2", "pinned": true}]}`, true},
+		{"invalid name", `{"models": [{"model": "not a name"}]}`, true},
+		{"pinned with max idle", `{"models": [{"model": "llama3.2", "pin": true, "max_idle": "10m"}]}`, true},
+		{"invalid json", `{"models": [`, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := readPolicy(path)
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	loaded := make(chan *LlmRequest, 1)
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mockRunner{}),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ discover.GpuInfoList, _ int) {
+				req.successCh <- &runnerRef{llama: &mockRunner{}}
+				loaded <- req
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.sched.Run(ctx)
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:  "test",
+		Files:  map[string]string{"file.gguf": digest},
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"models": [
+		{"model": "test", "pin": true, "preload": true, "options": {"num_ctx": 1024}},
+		{"model": "missing", "preload": true}
+	]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.loadPolicy(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case req := <-loaded:
+		if req.origNumCtx != 1024 {
+			t.Errorf("expected num_ctx 1024, got %d", req.origNumCtx)
+		}
+
+		if req.sessionDuration == nil || req.sessionDuration.Duration != time.Duration(math.MaxInt64) {
+			t.Errorf("expected pinned model to be kept loaded, got %v", req.sessionDuration)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for preload")
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := s.sched.policy(m.ModelPath); !ok || !p.Pin {
+		t.Errorf("expected policy for %s, got %+v", m.ModelPath, p)
+	}
+
+	if len(s.sched.policies) != 1 {
+		t.Errorf("expected policies for found models only, got %d", len(s.sched.policies))
+	}
+}
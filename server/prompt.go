@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/ollama/ollama/api"
@@ -21,10 +22,9 @@ var errTooManyImages = errors.New("vision model only supports a single image per
 
 // chatPrompt accepts a list of messages and returns the prompt and images that should be used for the next chat turn.
 // chatPrompt truncates any messages that exceed the context window of the model, making sure to always include 1) the
-// latest message and 2) system messages
-func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool) (prompt string, images []llm.ImageData, _ error) {
-	var system []api.Message
-
+// latest message and 2) system messages. The other messages are dropped by truncation, and the indexes of the dropped
+// messages are returned.
+func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool, truncation truncationStrategy) (prompt string, images []llm.ImageData, dropped []int, _ error) {
 	isMllama := checkMllamaModelFamily(m)
 
 	var imageNumTokens int
@@ -37,53 +37,68 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 		imageNumTokens = 768
 	}
 
-	n := len(msgs) - 1
-	// in reverse, find all messages that fit into context window
-	for i := n; i >= 0; i-- {
-		if isMllama && len(msgs[i].Images) > 1 {
-			return "", nil, errTooManyImages
-		}
-
-		// always include the last message
-		if i == n {
-			continue
-		}
-
-		system = make([]api.Message, 0)
-		for j := range i {
-			if msgs[j].Role == "system" {
-				system = append(system, msgs[j])
-			}
+	numImageTokens := func(msg api.Message) int {
+		if m.ProjectorPaths == nil {
+			return 0
 		}
+		return imageNumTokens * len(msg.Images)
+	}
 
+	render := func(msgs []api.Message) (int, error) {
 		var b bytes.Buffer
-		if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[i:]...), Tools: tools}); err != nil {
-			return "", nil, err
+		if err := m.Template.Execute(&b, template.Values{Messages: msgs, Tools: tools}); err != nil {
+			return 0, err
 		}
 
 		s, err := tokenize(ctx, b.String())
 		if err != nil {
-			return "", nil, err
+			return 0, err
 		}
 
 		ctxLen := len(s)
-		if m.ProjectorPaths != nil {
-			for _, m := range msgs[i:] {
-				ctxLen += imageNumTokens * len(m.Images)
-			}
+		for _, msg := range msgs {
+			ctxLen += numImageTokens(msg)
 		}
 
-		if ctxLen > opts.NumCtx {
-			slog.Debug("truncating input messages which exceed context length", "truncated", len(msgs[i:]))
-			break
-		} else {
-			n = i
+		return ctxLen, nil
+	}
+
+	ctxLen, err := render(msgs)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if ctxLen > opts.NumCtx {
+		if truncation == nil {
+			truncation = truncateOldest{}
 		}
+
+		count := func(msg api.Message) (int, error) {
+			n, err := messageTokens.count(ctx, m, tokenize, msg)
+			return n + numImageTokens(msg), err
+		}
+
+		msgs, dropped, err = truncate(ctx, msgs, opts.NumCtx, ctxLen-opts.NumCtx, truncation, count, render)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		slog.Debug("truncating input messages which exceed context length", "truncated", len(dropped))
+	} else {
+		// image tags are added to the content below so leave the
+		// caller's messages as they are
+		msgs = slices.Clone(msgs)
 	}
 
-	currMsgIdx := n
+	if isMllama {
+		for _, msg := range msgs {
+			if len(msg.Images) > 1 {
+				return "", nil, nil, errTooManyImages
+			}
+		}
+	}
 
-	for cnt, msg := range msgs[currMsgIdx:] {
+	for cnt, msg := range msgs {
 		prefix := ""
 		imgPrompt := ""
 		prompt := msg.Content
@@ -100,18 +115,18 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 				} else {
 					data, opts, err := mllama.Preprocess(bytes.NewReader(i))
 					if err != nil {
-						return "", nil, err
+						return "", nil, nil, err
 					}
 
 					buf := new(bytes.Buffer)
 					err = binary.Write(buf, binary.LittleEndian, data)
 					if err != nil {
-						return "", nil, err
+						return "", nil, nil, err
 					}
 
 					ar, ok := opts["aspectRatioIndex"].(int)
 					if !ok {
-						return "", nil, fmt.Errorf("missing aspect ratio for image")
+						return "", nil, nil, fmt.Errorf("missing aspect ratio for image")
 					}
 
 					imgData = llm.ImageData{
@@ -137,16 +152,15 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 
 			images = append(images, imgData)
 		}
-		msgs[currMsgIdx+cnt].Content = prefix + imgPrompt + prompt
+		msgs[cnt].Content = prefix + imgPrompt + prompt
 	}
 
-	// truncate any messages that do not fit into the context window
 	var b bytes.Buffer
-	if err := m.Template.Execute(&b, template.Values{Messages: append(system, msgs[currMsgIdx:]...), Tools: tools}); err != nil {
-		return "", nil, err
+	if err := m.Template.Execute(&b, template.Values{Messages: msgs, Tools: tools}); err != nil {
+		return "", nil, nil, err
 	}
 
-	return b.String(), images, nil
+	return b.String(), images, dropped, nil
 }
 
 func checkMllamaModelFamily(m *Model) bool {
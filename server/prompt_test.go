@@ -5,6 +5,7 @@ import (
 	"context"
 	"image"
 	"image/png"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -318,7 +319,7 @@ func TestChatPrompt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			model := tt.model
 			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
-			prompt, images, err := chatPrompt(context.TODO(), &model, mockRunner{}.Tokenize, &opts, tt.msgs, nil)
+			prompt, images, _, err := chatPrompt(context.TODO(), &model, mockRunner{}.Tokenize, &opts, tt.msgs, nil, nil)
 			if tt.error == nil && err != nil {
 				t.Fatal(err)
 			} else if tt.error != nil && err != tt.error {
@@ -351,3 +352,179 @@ func TestChatPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestChatPromptTruncation(t *testing.T) {
+	tmpl, err := template.Parse(`{{- range .Messages }}{{ .Role }}: {{ .Content }}
+{{- range .ToolCalls }} {{ .Function.Name }}(){{ end }}
+{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := []api.ToolCall{{Function: api.ToolCallFunction{Name: "get_weather"}}}
+	msgs := []api.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "one one one one"},
+		{Role: "assistant", Content: "two two two two"},
+		{Role: "user", Content: "three three three three"},
+		{Role: "assistant", ToolCalls: call},
+		{Role: "tool", Content: "four four four four"},
+		{Role: "assistant", Content: "five five five five"},
+		{Role: "user", Content: "six six six six"},
+	}
+
+	summarize := func(_ context.Context, msgs []api.Message, _ int) (string, error) {
+		var roles []string
+		for _, msg := range msgs {
+			roles = append(roles, msg.Role)
+		}
+		return strings.Join(roles, ","), nil
+	}
+
+	cases := []struct {
+		name     string
+		limit    int
+		strategy truncationStrategy
+		prompt   string
+		dropped  []int
+	}{
+		{
+			name:     "fits",
+			limit:    64,
+			strategy: truncateOldest{},
+			prompt:   "system: Be brief.\nuser: one one one one\nassistant: two two two two\nuser: three three three three\nassistant:  get_weather()\ntool: four four four four\nassistant: five five five five\nuser: six six six six\n",
+		},
+		{
+			name:     "oldest",
+			limit:    24,
+			strategy: truncateOldest{},
+			prompt:   "system: Be brief.\nassistant:  get_weather()\ntool: four four four four\nassistant: five five five five\nuser: six six six six\n",
+			dropped:  []int{1, 2, 3},
+		},
+		{
+			name:     "oldest keeps the system and last message",
+			limit:    1,
+			strategy: truncateOldest{},
+			prompt:   "system: Be brief.\nuser: six six six six\n",
+			dropped:  []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:     "keep last",
+			limit:    34,
+			strategy: truncateKeepLast{n: 2},
+			prompt:   "system: Be brief.\nassistant: five five five five\nuser: six six six six\n",
+			dropped:  []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:     "keep last groups tool results",
+			limit:    34,
+			strategy: truncateKeepLast{n: 3},
+			prompt:   "system: Be brief.\nassistant:  get_weather()\ntool: four four four four\nassistant: five five five five\nuser: six six six six\n",
+			dropped:  []int{1, 2, 3},
+		},
+		{
+			name:     "middle",
+			limit:    30,
+			strategy: truncateMiddle{},
+			prompt:   "system: Be brief.\nuser: one one one one\nassistant:  get_weather()\ntool: four four four four\nassistant: five five five five\nuser: six six six six\n",
+			dropped:  []int{2, 3},
+		},
+		{
+			name:     "summarize",
+			limit:    30,
+			strategy: truncateSummarize{summarize: summarize},
+			prompt:   "system: Be brief.\n\nSummary of the earlier conversation:\nuser,assistant,user\nassistant:  get_weather()\ntool: four four four four\nassistant: five five five five\nuser: six six six six\n",
+			dropped:  []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			model := Model{Template: tmpl, ModelPath: t.Name()}
+			opts := api.Options{Runner: api.Runner{NumCtx: tt.limit}}
+			prompt, _, dropped, err := chatPrompt(context.TODO(), &model, mockRunner{}.Tokenize, &opts, msgs, nil, tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.prompt, prompt); diff != "" {
+				t.Errorf("prompt mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.dropped, dropped); diff != "" {
+				t.Errorf("dropped mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDropOrder(t *testing.T) {
+	cases := []struct {
+		strategy truncationStrategy
+		n        int
+		order    []int
+		atLeast  int
+	}{
+		{truncateOldest{}, 4, []int{0, 1, 2, 3}, 0},
+		{truncateKeepLast{n: 1}, 4, []int{0, 1, 2, 3}, 4},
+		{truncateKeepLast{n: 3}, 4, []int{0, 1, 2, 3}, 2},
+		{truncateKeepLast{n: 10}, 4, []int{0, 1, 2, 3}, 0},
+		{truncateMiddle{}, 0, []int{}, 0},
+		{truncateMiddle{}, 1, []int{0}, 0},
+		{truncateMiddle{}, 4, []int{2, 1, 3, 0}, 0},
+		{truncateMiddle{}, 5, []int{2, 1, 3, 0, 4}, 0},
+	}
+
+	for _, tt := range cases {
+		order, atLeast := tt.strategy.dropOrder(tt.n)
+		if diff := cmp.Diff(tt.order, order); diff != "" {
+			t.Errorf("%T(%d) order mismatch (-want +got):\n%s", tt.strategy, tt.n, diff)
+		}
+
+		if atLeast != tt.atLeast {
+			t.Errorf("%T(%d) expected to drop at least %d, got %d", tt.strategy, tt.n, tt.atLeast, atLeast)
+		}
+	}
+}
+
+func TestMessageTokensCached(t *testing.T) {
+	var calls int
+	tokenize := func(ctx context.Context, s string) ([]int, error) {
+		calls++
+		return mockRunner{}.Tokenize(ctx, s)
+	}
+
+	tmpl, err := template.Parse(`{{ range .Messages }}{{ .Content }} {{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := Model{Template: tmpl, ModelPath: t.Name()}
+	opts := api.Options{Runner: api.Runner{NumCtx: 4}}
+	msgs := []api.Message{
+		{Role: "user", Content: "one two three"},
+		{Role: "assistant", Content: "four five six"},
+		{Role: "user", Content: "seven eight nine"},
+	}
+
+	// the first turn tokenizes the full prompt, each dropped message and
+	// the truncated prompt
+	if _, _, _, err := chatPrompt(context.TODO(), &model, tokenize, &opts, msgs, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 4 {
+		t.Errorf("expected 4 calls to tokenize, got %d", calls)
+	}
+
+	// the next turn only tokenizes the prompts since the dropped messages
+	// are cached
+	calls = 0
+	if _, _, _, err := chatPrompt(context.TODO(), &model, tokenize, &opts, msgs, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls to tokenize, got %d", calls)
+	}
+}
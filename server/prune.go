@@ -0,0 +1,478 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/types/model"
+)
+
+var errStoreQuota = errors.New("not enough space in the model store")
+
+// lastUsedInterval is how often the last use of a model is written. Uses
+// within the interval of the last written use aren't recorded.
+const lastUsedInterval = time.Minute
+
+// lastUsed records when models were last used in last-used.json in the models
+// directory
+var lastUsed lastUsedStore
+
+type lastUsedStore struct {
+	mu sync.Mutex
+
+	// written is the last use written for each model, by path of the file
+	// and model
+	written map[string]time.Time
+}
+
+func lastUsedPath() string {
+	return filepath.Join(envconfig.Models(), "last-used.json")
+}
+
+func lastUsedKey(n model.Name) string {
+	return strings.ToLower(n.String())
+}
+
+// readLastUsed returns when each model was last used, by lastUsedKey
+func readLastUsed() (map[string]time.Time, error) {
+	bts, err := os.ReadFile(lastUsedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]time.Time{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var times map[string]time.Time
+	if err := json.Unmarshal(bts, &times); err != nil {
+		return nil, fmt.Errorf("%s: %w", lastUsedPath(), err)
+	}
+
+	return times, nil
+}
+
+// Touch records that the model n was used now.
+func (s *lastUsedStore) Touch(n model.Name) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := lastUsedPath()
+	key := path + "\x00" + lastUsedKey(n)
+
+	now := time.Now()
+	if now.Sub(s.written[key]) < lastUsedInterval {
+		return
+	}
+
+	if err := s.write(path, func(times map[string]time.Time) { times[lastUsedKey(n)] = now }); err != nil {
+		slog.Warn("couldn't record model use", "model", n.DisplayShortest(), "error", err)
+		return
+	}
+
+	if s.written == nil {
+		s.written = make(map[string]time.Time)
+	}
+	s.written[key] = now
+}
+
+// forget removes the last uses of models
+func (s *lastUsedStore) forget(names ...model.Name) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := lastUsedPath()
+	for _, n := range names {
+		delete(s.written, path+"\x00"+lastUsedKey(n))
+	}
+
+	return s.write(path, func(times map[string]time.Time) {
+		for _, n := range names {
+			delete(times, lastUsedKey(n))
+		}
+	})
+}
+
+func (s *lastUsedStore) write(path string, fn func(map[string]time.Time)) error {
+	times, err := readLastUsed()
+	if err != nil {
+		return err
+	}
+
+	fn(times)
+
+	bts, err := json.Marshal(times)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path+".tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// storeSize returns the size of the blobs in the models directory, including
+// partial downloads
+func storeSize() (int64, error) {
+	p, err := GetBlobsPath("")
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+	}
+
+	return size, nil
+}
+
+// pinnedModels returns the models pinned by the policy in OLLAMA_POLICY,
+// which aren't removed to free space
+func pinnedModels() ([]model.Name, error) {
+	path := envconfig.Policy()
+	if path == "" {
+		return nil, nil
+	}
+
+	p, err := readPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pinned []model.Name
+	for _, mp := range p.Models {
+		if !mp.Pin {
+			continue
+		}
+
+		n := model.ParseName(mp.Model)
+		pinned = append(pinned, n)
+		if m, err := ParseNamedManifest(n); err == nil && m.resolved.IsValid() {
+			pinned = append(pinned, m.resolved)
+		}
+	}
+
+	return pinned, nil
+}
+
+type pruneOptions struct {
+	// OlderThan removes the models not used for longer than this, if it
+	// isn't zero
+	OlderThan time.Duration
+
+	// Need is the space needed in the store. If OLLAMA_STORE_QUOTA is set,
+	// the least recently used models are removed until the store has Need
+	// bytes free under the quota.
+	Need int64
+
+	// Keep are models that aren't removed
+	Keep []model.Name
+
+	// DryRun reports the models that would be removed without removing them
+	DryRun bool
+}
+
+// pruneModels removes the least recently used models that aren't pinned by
+// OLLAMA_POLICY, with the blobs no other model uses. It returns
+// errStoreQuota with the models it removed if the store still doesn't have
+// the space needed.
+func pruneModels(opts pruneOptions) (*api.PruneResponse, error) {
+	manifests, err := Manifests(true)
+	if err != nil {
+		return nil, err
+	}
+
+	times, err := readLastUsed()
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, err := pinnedModels()
+	if err != nil {
+		return nil, err
+	}
+	keep := append(pinned, opts.Keep...)
+
+	type candidate struct {
+		name     model.Name
+		manifest *Manifest
+		lastUsed time.Time
+	}
+
+	refs := make(map[string]int)
+	sizes := make(map[string]int64)
+	var candidates []candidate
+	for n, m := range manifests {
+		if m.target.IsValid() {
+			// an alias, which is used when its target is used
+			continue
+		}
+
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest != "" {
+				refs[layer.Digest]++
+				sizes[layer.Digest] = layer.Size
+			}
+		}
+
+		if slices.ContainsFunc(keep, n.EqualFold) {
+			continue
+		}
+
+		c := candidate{name: n, manifest: m, lastUsed: m.fi.ModTime()}
+		if t, ok := times[lastUsedKey(n)]; ok && t.After(c.lastUsed) {
+			c.lastUsed = t
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	// uses of aliases count as uses of their targets
+	for n, m := range manifests {
+		if !m.target.IsValid() {
+			continue
+		}
+
+		t, ok := times[lastUsedKey(n)]
+		if !ok {
+			continue
+		}
+
+		for i := range candidates {
+			if candidates[i].name.EqualFold(m.resolved) && t.After(candidates[i].lastUsed) {
+				candidates[i].lastUsed = t
+			}
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+
+	quota := int64(envconfig.StoreQuota())
+
+	var size int64
+	if quota > 0 {
+		if size, err = storeSize(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	resp := api.PruneResponse{Models: []api.PrunedModel{}}
+	var removed []model.Name
+	for _, c := range candidates {
+		old := opts.OlderThan > 0 && now.Sub(c.lastUsed) > opts.OlderThan
+		full := quota > 0 && size+opts.Need > quota
+		if !old && !full {
+			// the rest were used more recently
+			break
+		}
+
+		var blobs []string
+		var freed int64
+		for _, layer := range append(c.manifest.Layers, c.manifest.Config) {
+			if layer.Digest == "" {
+				continue
+			}
+
+			refs[layer.Digest]--
+			if refs[layer.Digest] == 0 && !modelPulls.pending(layer.Digest) {
+				blobs = append(blobs, layer.Digest)
+				freed += sizes[layer.Digest]
+			}
+		}
+
+		size -= freed
+		resp.Size += freed
+		resp.Models = append(resp.Models, api.PrunedModel{
+			Name:     c.name.DisplayShortest(),
+			LastUsed: c.lastUsed,
+			Size:     freed,
+		})
+
+		if opts.DryRun {
+			continue
+		}
+
+		slog.Info("removing model", "model", c.name.DisplayShortest(), "last_used", c.lastUsed, "size", format.HumanBytes(freed))
+		if err := c.manifest.Remove(); err != nil {
+			return nil, err
+		}
+
+		for _, digest := range blobs {
+			p, err := GetBlobsPath(digest)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		removed = append(removed, c.name)
+	}
+
+	if len(removed) > 0 {
+		if err := lastUsed.forget(removed...); err != nil {
+			slog.Warn("couldn't forget removed models", "error", err)
+		}
+	}
+
+	if quota > 0 && size+opts.Need > quota {
+		return &resp, fmt.Errorf("%w: %s is needed but only %s of the %s quota is free and no other models can be removed", errStoreQuota, format.HumanBytes(opts.Need), format.HumanBytes(max(quota-size, 0)), format.HumanBytes(quota))
+	}
+
+	return &resp, nil
+}
+
+// storeReservations holds the blobs that pulls are downloading, so that
+// concurrent pulls make room for each other's blobs and not only their own.
+var storeReservations reservations
+
+type reservations struct {
+	mu sync.Mutex
+
+	// sizes are the sizes of the reserved blobs and refs how many pulls
+	// reserved them, by digest
+	sizes map[string]int64
+	refs  map[string]int
+}
+
+// remaining returns how much of the blob with digest isn't in the store yet,
+// counting its partial download as in the store since storeSize counts it.
+func remaining(digest string, size int64) (int64, error) {
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := os.Stat(p); err == nil {
+		return 0, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	partials, err := filepath.Glob(p + "-partial*")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, partial := range partials {
+		if fi, err := os.Stat(partial); err == nil && fi.Mode().IsRegular() {
+			size -= fi.Size()
+		}
+	}
+
+	return max(size, 0), nil
+}
+
+// makeRoom removes the least recently used models until the blobs of layers
+// that aren't in the store fit in OLLAMA_STORE_QUOTA, along with the blobs
+// other pulls are downloading. The blobs are reserved until release is
+// called when they're downloaded.
+func makeRoom(n model.Name, layers []Layer, fn func(api.ProgressResponse)) (release func(), _ error) {
+	release = func() {}
+	if envconfig.StoreQuota() == 0 {
+		return release, nil
+	}
+
+	storeReservations.mu.Lock()
+	defer storeReservations.mu.Unlock()
+
+	var missing []Layer
+	for _, layer := range layers {
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return release, err
+		}
+
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, layer)
+		} else if err != nil {
+			return release, err
+		}
+	}
+
+	if len(missing) == 0 {
+		return release, nil
+	}
+
+	sizes := maps.Clone(storeReservations.sizes)
+	if sizes == nil {
+		sizes = make(map[string]int64)
+	}
+	for _, layer := range missing {
+		sizes[layer.Digest] = layer.Size
+	}
+
+	var need int64
+	for digest, size := range sizes {
+		r, err := remaining(digest, size)
+		if err != nil {
+			return release, err
+		}
+		need += r
+	}
+
+	if need > 0 {
+		resp, err := pruneModels(pruneOptions{Need: need, Keep: []model.Name{n}})
+		if resp != nil {
+			for _, m := range resp.Models {
+				fn(api.ProgressResponse{Status: fmt.Sprintf("removed %s to free space", m.Name)})
+			}
+		}
+		if err != nil {
+			return release, err
+		}
+	}
+
+	r := &storeReservations
+	if r.sizes == nil {
+		r.sizes = make(map[string]int64)
+		r.refs = make(map[string]int)
+	}
+	for _, layer := range missing {
+		r.sizes[layer.Digest] = layer.Size
+		r.refs[layer.Digest]++
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, layer := range missing {
+			if r.refs[layer.Digest]--; r.refs[layer.Digest] == 0 {
+				delete(r.refs, layer.Digest)
+				delete(r.sizes, layer.Digest)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// createPruneModel creates a model with its own blobs and sets when it was
+// pulled
+func createPruneModel(t *testing.T, name string, pulled time.Time) {
+	t.Helper()
+
+	var s Server
+	_, digest := createBinFile(t, map[string]any{"general.name": name}, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: name,
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	m, err := ParseNamedManifest(model.ParseName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(m.filepath, pulled, pulled); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeLastUsed(t *testing.T, times map[string]time.Time) {
+	t.Helper()
+
+	keyed := make(map[string]time.Time)
+	for name, tm := range times {
+		keyed[lastUsedKey(model.ParseName(name))] = tm
+	}
+
+	bts, err := json.Marshal(keyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(lastUsedPath(), bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func prunedNames(resp *api.PruneResponse) []string {
+	var names []string
+	for _, m := range resp.Models {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestPruneModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	now := time.Now()
+	createPruneModel(t, "oldest", now.Add(-90*24*time.Hour))
+	createPruneModel(t, "old", now.Add(-60*24*time.Hour))
+	createPruneModel(t, "recent", now.Add(-60*24*time.Hour))
+	createPruneModel(t, "new", now)
+
+	writeLastUsed(t, map[string]time.Time{
+		"old":    now.Add(-40 * 24 * time.Hour),
+		"recent": now.Add(-time.Hour),
+	})
+
+	resp, err := pruneModels(pruneOptions{OlderThan: 30 * 24 * time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := prunedNames(resp); !slices.Equal(names, []string{"oldest:latest", "old:latest"}) {
+		t.Fatalf("expected the oldest models, got %v", names)
+	}
+
+	if resp.Size == 0 || resp.Size != resp.Models[0].Size+resp.Models[1].Size {
+		t.Errorf("unexpected size %d of %+v", resp.Size, resp.Models)
+	}
+
+	if _, err := GetModel("oldest"); err != nil {
+		t.Fatal("expected a dry run not to remove models")
+	}
+
+	// models pinned by the policy and used through aliases, including
+	// aliases of aliases, are kept
+	policy := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policy, []byte(`{"models": [{"model": "favorite", "pin": true}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OLLAMA_POLICY", policy)
+
+	for _, alias := range [][2]string{
+		{"favorite-v1", "oldest"},
+		{"favorite", "favorite-v1"},
+		{"stable", "old"},
+		{"current", "stable"},
+	} {
+		if err := SetAlias(model.ParseName(alias[0]), model.ParseName(alias[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// GetModel above recorded a use of oldest, so record one of the alias too
+	writeLastUsed(t, map[string]time.Time{
+		"old":     now.Add(-40 * 24 * time.Hour),
+		"recent":  now.Add(-time.Hour),
+		"current": now,
+	})
+
+	if resp, err := pruneModels(pruneOptions{OlderThan: 30 * 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Models) != 0 {
+		t.Fatalf("expected no models to be removed, got %v", prunedNames(resp))
+	}
+
+	t.Setenv("OLLAMA_POLICY", "")
+	if resp, err := pruneModels(pruneOptions{OlderThan: 30 * 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	} else if names := prunedNames(resp); !slices.Equal(names, []string{"oldest:latest"}) {
+		t.Fatalf("expected oldest to be removed, got %v", names)
+	}
+
+	if _, err := GetModel("oldest"); err == nil {
+		t.Error("expected oldest to be removed")
+	}
+
+	for _, name := range []string{"old", "recent", "new"} {
+		if _, err := GetModel(name); err != nil {
+			t.Errorf("expected %s to be kept, got %v", name, err)
+		}
+	}
+
+	// the blobs of the removed model are removed with it
+	manifests, err := Manifests(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := GetBlobsPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := os.ReadDir(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := make(map[string]bool)
+	for _, m := range manifests {
+		for _, layer := range append(m.Layers, m.Config) {
+			used[layer.Digest] = true
+		}
+	}
+
+	for _, blob := range blobs {
+		if !used[strings.Replace(blob.Name(), "-", ":", 1)] {
+			t.Errorf("expected unused blob %s to be removed", blob.Name())
+		}
+	}
+}
+
+func TestPruneQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	now := time.Now()
+	createPruneModel(t, "first", now.Add(-3*time.Hour))
+	createPruneModel(t, "second", now.Add(-2*time.Hour))
+	createPruneModel(t, "third", now.Add(-time.Hour))
+
+	size, err := storeSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for one more byte
+	t.Setenv("OLLAMA_STORE_QUOTA", fmt.Sprint(size+1))
+	if resp, err := pruneModels(pruneOptions{Need: 1}); err != nil || len(resp.Models) != 0 {
+		t.Fatalf("expected no models to be removed, got %v, %v", resp, err)
+	}
+
+	// the least recently used models are removed until the need fits
+	resp, err := pruneModels(pruneOptions{Need: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := prunedNames(resp); !slices.Equal(names, []string{"first:latest"}) {
+		t.Fatalf("expected first to be removed, got %v", names)
+	}
+
+	// a need that can't fit removes every model it can and fails
+	resp, err = pruneModels(pruneOptions{Need: size * 10, Keep: []model.Name{model.ParseName("third")}})
+	if !errors.Is(err, errStoreQuota) {
+		t.Fatalf("expected %v, got %v", errStoreQuota, err)
+	}
+
+	if names := prunedNames(resp); !slices.Equal(names, []string{"second:latest"}) {
+		t.Errorf("expected second to be removed, got %v", names)
+	}
+
+	if _, err := GetModel("third"); err != nil {
+		t.Errorf("expected kept model not to be removed, got %v", err)
+	}
+}
+
+func TestPullStoreQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	now := time.Now()
+	createPruneModel(t, "unused", now.Add(-2*time.Hour))
+	createPruneModel(t, "used", now.Add(-time.Hour))
+
+	reg := newPullRegistry(t, "test")
+	close(reg.release)
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	size, err := storeSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// room for the pulled model only if one model is removed
+	t.Setenv("OLLAMA_STORE_QUOTA", fmt.Sprint(size+1<<20))
+
+	var statuses []string
+	name := strings.TrimPrefix(srv.URL, "http://") + "/library/test"
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(r api.ProgressResponse) {
+		statuses = append(statuses, r.Status)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(statuses, "removed unused:latest to free space") {
+		t.Errorf("expected unused to be removed, got %v", statuses)
+	}
+
+	if _, err := GetModel("used"); err != nil {
+		t.Errorf("expected used to be kept, got %v", err)
+	}
+
+	// without room for the model, the pull fails
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_STORE_QUOTA", "1024")
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {}); !errors.Is(err, errStoreQuota) {
+		t.Errorf("expected %v, got %v", errStoreQuota, err)
+	}
+}
+
+func TestMakeRoom(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	now := time.Now()
+	createPruneModel(t, "first", now.Add(-2*time.Hour))
+	createPruneModel(t, "second", now.Add(-time.Hour))
+
+	size, err := storeSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// smaller than the models so removing one makes room for it
+	const blob = 200
+	layer := func(b byte) Layer {
+		return Layer{Digest: fmt.Sprintf("sha256:%064x", b), Size: blob}
+	}
+
+	var statuses []string
+	fn := func(r api.ProgressResponse) { statuses = append(statuses, r.Status) }
+
+	// room for one blob
+	t.Setenv("OLLAMA_STORE_QUOTA", fmt.Sprint(size+blob))
+	release, err := makeRoom(model.ParseName("a"), []Layer{layer(1)}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 0 {
+		t.Fatalf("expected no models to be removed, got %v", statuses)
+	}
+
+	// a concurrent pull makes room for the blob reserved by the first
+	release2, err := makeRoom(model.ParseName("b"), []Layer{layer(2)}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release2()
+
+	if !slices.Equal(statuses, []string{"removed first:latest to free space"}) {
+		t.Fatalf("expected first to be removed, got %v", statuses)
+	}
+
+	release()
+
+	// a partial download already counts toward the store size
+	p, err := GetBlobsPath(layer(3).Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p+"-partial", make([]byte, blob), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err = storeSize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob reserved by the second pull still needs room
+	t.Setenv("OLLAMA_STORE_QUOTA", fmt.Sprint(size+blob))
+	statuses = nil
+	release3, err := makeRoom(model.ParseName("c"), []Layer{layer(3)}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release3()
+
+	if len(statuses) != 0 {
+		t.Errorf("expected no models to be removed, got %v", statuses)
+	}
+}
+
+func TestGetModelLastUsed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	createPruneModel(t, "test", time.Now().Add(-time.Hour))
+
+	before := time.Now()
+	if _, err := GetModel("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	times, err := readLastUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tm := times[lastUsedKey(model.ParseName("test"))]; tm.Before(before) {
+		t.Errorf("expected use to be recorded, got %v", tm)
+	}
+}
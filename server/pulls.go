@@ -0,0 +1,526 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errPullPaused   = errors.New("pull paused")
+	errPullCanceled = errors.New("pull canceled")
+	errPullNotFound = errors.New("pull not found")
+)
+
+const (
+	pullQueued  = "queued"
+	pullRunning = "running"
+	pullPaused  = "paused"
+)
+
+// modelPulls runs the pulls started by PullHandler
+var modelPulls pullManager
+
+// pullManager runs model pulls in the background, so they continue after the
+// clients that started them disconnect. At most OLLAMA_MAX_PULLS pulls run at
+// once and the rest are queued in the order they were started. Pulls that
+// haven't completed are saved to pulls.json in the models directory, so they
+// can be restored when the server restarts.
+type pullManager struct {
+	mu    sync.Mutex
+	pulls []*pull
+}
+
+// pull is the pull of a model. Its exported fields are saved in pulls.json.
+type pull struct {
+	Model    string `json:"model"`
+	Insecure bool   `json:"insecure,omitempty"`
+	Limit    int64  `json:"limit,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+
+	// Digests are the blobs of the model seen so far. Their partial
+	// downloads are kept until the pull completes or is canceled.
+	Digests []string `json:"digests,omitempty"`
+
+	name     model.Name
+	status   string
+	progress map[string]api.ProgressResponse
+	limiter  rateLimiter
+
+	run    *pullRun
+	cancel context.CancelFunc
+
+	// stop is why a running pull was canceled, errPullPaused or
+	// errPullCanceled
+	stop error
+
+	subscribers map[*pullSubscriber]struct{}
+}
+
+// pullRun is a run of a pull, from when it is queued until it completes,
+// fails or is stopped. A paused pull starts a new run when it is resumed.
+type pullRun struct {
+	done chan struct{}
+	err  error
+}
+
+// pullSubscriber receives the progress of a run of a pull
+type pullSubscriber struct {
+	m    *pullManager
+	p    *pull
+	run  *pullRun
+	ch   chan api.ProgressResponse
+	gone chan struct{}
+}
+
+func (m *pullManager) find(n model.Name) *pull {
+	for _, p := range m.pulls {
+		if p.name.EqualFold(n) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (m *pullManager) remove(p *pull) {
+	m.pulls = slices.DeleteFunc(m.pulls, func(q *pull) bool { return q == p })
+}
+
+// queue queues p to be started by schedule
+func (m *pullManager) queue(p *pull) {
+	p.status = pullQueued
+	p.Paused = false
+	p.run = &pullRun{done: make(chan struct{})}
+}
+
+// schedule starts the queued pulls while fewer than OLLAMA_MAX_PULLS run
+func (m *pullManager) schedule() {
+	maxPulls := int(envconfig.MaxPulls())
+
+	var running int
+	for _, p := range m.pulls {
+		if p.status == pullRunning {
+			running++
+		}
+	}
+
+	for _, p := range m.pulls {
+		if maxPulls > 0 && running >= maxPulls {
+			return
+		}
+
+		if p.status == pullQueued {
+			m.start(p)
+			running++
+		}
+	}
+}
+
+func (m *pullManager) start(p *pull) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.status = pullRunning
+	p.cancel = cancel
+	p.stop = nil
+
+	run := p.run
+	regOpts := &registryOptions{Insecure: p.Insecure, RateLimit: &p.limiter}
+	go func() {
+		defer cancel()
+		err := PullModel(ctx, p.name.DisplayShortest(), regOpts, func(r api.ProgressResponse) {
+			m.update(p, r)
+		})
+
+		m.mu.Lock()
+		canceled := errors.Is(p.stop, errPullCanceled)
+		m.mu.Unlock()
+
+		if canceled {
+			m.removePartial(p)
+		}
+
+		m.finish(p, run, err)
+	}()
+}
+
+func (m *pullManager) finish(p *pull, run *pullRun, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil && p.stop != nil {
+		err = p.stop
+	}
+
+	switch {
+	case errors.Is(err, errPullPaused):
+		p.status = pullPaused
+		p.Paused = true
+	case err != nil && !errors.Is(err, errPullCanceled):
+		slog.Warn("pull failed", "model", p.Model, "error", err)
+		m.remove(p)
+	default:
+		m.remove(p)
+	}
+
+	run.err = err
+	close(run.done)
+
+	m.save()
+	m.schedule()
+}
+
+// update records the progress r of p and sends it to p's subscribers
+func (m *pullManager) update(p *pull, r api.ProgressResponse) {
+	m.mu.Lock()
+	if r.Digest != "" {
+		p.progress[r.Digest] = r
+		if !slices.Contains(p.Digests, r.Digest) {
+			p.Digests = append(p.Digests, r.Digest)
+			m.save()
+		}
+	}
+
+	subscribers := make([]*pullSubscriber, 0, len(p.subscribers))
+	for s := range p.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.send(r)
+	}
+}
+
+// Pull starts pulling the model n, or joins its pull if it has already
+// started, resuming it if it is paused. A limit other than zero replaces the
+// pull's limit in bytes per second.
+func (m *pullManager) Pull(n model.Name, insecure bool, limit int64) *pullSubscriber {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.find(n)
+	if p == nil {
+		p = &pull{
+			Model:       n.DisplayShortest(),
+			Insecure:    insecure,
+			name:        n,
+			progress:    make(map[string]api.ProgressResponse),
+			subscribers: make(map[*pullSubscriber]struct{}),
+		}
+
+		m.pulls = append(m.pulls, p)
+		m.queue(p)
+	} else if p.status == pullPaused {
+		m.queue(p)
+	}
+
+	if limit != 0 {
+		p.Limit = limit
+		p.limiter.SetLimit(limit)
+	}
+
+	s := &pullSubscriber{
+		m:    m,
+		p:    p,
+		run:  p.run,
+		ch:   make(chan api.ProgressResponse, 64),
+		gone: make(chan struct{}),
+	}
+	p.subscribers[s] = struct{}{}
+
+	m.save()
+	m.schedule()
+	return s
+}
+
+// Pause stops the pull of the model n. The blobs downloaded so far are kept
+// until it is resumed.
+func (m *pullManager) Pause(n model.Name) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.find(n)
+	if p == nil {
+		return errPullNotFound
+	}
+
+	switch p.status {
+	case pullQueued:
+		p.status = pullPaused
+		p.Paused = true
+		p.run.err = errPullPaused
+		close(p.run.done)
+		m.save()
+	case pullRunning:
+		p.stop = errPullPaused
+		p.cancel()
+	}
+
+	return nil
+}
+
+// Resume queues the paused pull of the model n.
+func (m *pullManager) Resume(n model.Name) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.find(n)
+	if p == nil {
+		return errPullNotFound
+	}
+
+	if p.status == pullPaused {
+		m.queue(p)
+		m.save()
+		m.schedule()
+	}
+
+	return nil
+}
+
+// Cancel stops the pull of the model n and removes its partial downloads.
+func (m *pullManager) Cancel(n model.Name) error {
+	m.mu.Lock()
+	p := m.find(n)
+	if p == nil {
+		m.mu.Unlock()
+		return errPullNotFound
+	}
+
+	m.remove(p)
+	m.save()
+
+	switch p.status {
+	case pullRunning:
+		// the partial downloads are removed once the pull stops
+		p.stop = errPullCanceled
+		p.cancel()
+		m.mu.Unlock()
+		return nil
+	case pullQueued:
+		p.run.err = errPullCanceled
+		close(p.run.done)
+	}
+
+	m.schedule()
+	m.mu.Unlock()
+
+	m.removePartial(p)
+	return nil
+}
+
+// removePartial removes the partial downloads of the blobs of p that no
+// other pull is downloading.
+func (m *pullManager) removePartial(p *pull) {
+	m.mu.Lock()
+	digests := slices.DeleteFunc(slices.Clone(p.Digests), m.pendingLocked)
+	m.mu.Unlock()
+
+	for _, digest := range digests {
+		if v, ok := blobDownloadManager.Load(digest); ok {
+			// wait for the download to write its progress
+			<-v.(*blobDownload).done
+		}
+
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			continue
+		}
+
+		partials, err := filepath.Glob(fp + "-partial*")
+		if err != nil {
+			continue
+		}
+
+		for _, partial := range partials {
+			if err := os.Remove(partial); err != nil {
+				slog.Warn("couldn't remove partial download", "path", partial, "error", err)
+			}
+		}
+	}
+}
+
+// List returns the status of the pulls in the order they were started.
+func (m *pullManager) List() []api.PullStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]api.PullStatus, 0, len(m.pulls))
+	for _, p := range m.pulls {
+		status := api.PullStatus{
+			Model:  p.Model,
+			Status: p.status,
+			Limit:  p.Limit,
+		}
+
+		for _, r := range p.progress {
+			status.Total += r.Total
+			status.Completed += r.Completed
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// pending reports whether name, a blob digest or the name of a file in the
+// blobs directory, is a blob of a pull that hasn't completed. Such blobs and
+// their partial downloads must not be pruned.
+func (m *pullManager) pending(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pendingLocked(name)
+}
+
+func (m *pullManager) pendingLocked(name string) bool {
+	name = strings.Replace(name, ":", "-", 1)
+	for _, p := range m.pulls {
+		for _, digest := range p.Digests {
+			if strings.HasPrefix(name, strings.Replace(digest, ":", "-", 1)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func pullsPath() string {
+	return filepath.Join(envconfig.Models(), "pulls.json")
+}
+
+// save writes the pulls to pulls.json, or removes it if there are none
+func (m *pullManager) save() {
+	path := pullsPath()
+	if len(m.pulls) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("couldn't remove pulls", "path", path, "error", err)
+		}
+		return
+	}
+
+	bts, err := json.Marshal(m.pulls)
+	if err != nil {
+		slog.Warn("couldn't save pulls", "error", err)
+		return
+	}
+
+	if err := os.WriteFile(path+".tmp", bts, 0o644); err != nil {
+		slog.Warn("couldn't save pulls", "path", path, "error", err)
+		return
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		slog.Warn("couldn't save pulls", "path", path, "error", err)
+	}
+}
+
+// Restore reads the pulls saved by a previous server. They aren't started
+// until Start is called, so their partial downloads can be kept from being
+// pruned first.
+func (m *pullManager) Restore() error {
+	bts, err := os.ReadFile(pullsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var pulls []*pull
+	if err := json.Unmarshal(bts, &pulls); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range pulls {
+		n := model.ParseName(p.Model)
+		if !n.IsValid() || m.find(n) != nil {
+			continue
+		}
+
+		p.name = n
+		p.progress = make(map[string]api.ProgressResponse)
+		p.subscribers = make(map[*pullSubscriber]struct{})
+		p.limiter.SetLimit(p.Limit)
+
+		if p.Paused {
+			p.status = pullPaused
+			p.run = &pullRun{done: make(chan struct{}), err: errPullPaused}
+			close(p.run.done)
+		} else {
+			m.queue(p)
+		}
+
+		m.pulls = append(m.pulls, p)
+		slog.Info("restored pull", "model", p.Model, "paused", p.Paused)
+	}
+
+	return nil
+}
+
+// Start starts the restored pulls.
+func (m *pullManager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedule()
+}
+
+func (s *pullSubscriber) send(r api.ProgressResponse) {
+	if r.Digest != "" {
+		// progress is sent often, so it is dropped if the subscriber is
+		// behind
+		select {
+		case s.ch <- r:
+		case <-s.gone:
+		default:
+		}
+		return
+	}
+
+	select {
+	case s.ch <- r:
+	case <-s.gone:
+	}
+}
+
+// Wait calls fn with the progress of the pull until its run completes, fails
+// or is stopped, and returns the run's error.
+func (s *pullSubscriber) Wait(ctx context.Context, fn func(api.ProgressResponse)) error {
+	defer func() {
+		s.m.mu.Lock()
+		delete(s.p.subscribers, s)
+		s.m.mu.Unlock()
+		close(s.gone)
+	}()
+
+	for {
+		select {
+		case r := <-s.ch:
+			fn(r)
+		case <-s.run.done:
+			for {
+				select {
+				case r := <-s.ch:
+					fn(r)
+				default:
+					return s.run.err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// pullRegistry serves models in the library namespace. The first request
+// for each blob stops halfway until release is closed.
+type pullRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	ranges    []string
+	started   map[string]bool
+
+	release chan struct{}
+}
+
+func newPullRegistry(t *testing.T, models ...string) *pullRegistry {
+	t.Helper()
+
+	r := &pullRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		started:   make(map[string]bool),
+		release:   make(chan struct{}),
+	}
+
+	layer := func(mediaType string, bts []byte) Layer {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(bts))
+		r.blobs[digest] = bts
+		return Layer{MediaType: mediaType, Digest: digest, Size: int64(len(bts))}
+	}
+
+	for _, name := range models {
+		data := make([]byte, 1<<20)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+
+		bts, err := json.Marshal(Manifest{
+			SchemaVersion: 2,
+			MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+			Config:        layer("application/vnd.docker.container.image.v1+json", []byte(`{"model_format":"gguf"}`)),
+			Layers:        []Layer{layer("application/vnd.ollama.image.model", data)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.manifests[name] = bts
+	}
+
+	return r
+}
+
+func (r *pullRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	repo, path, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/library/"), "/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	r.mu.Lock()
+	switch {
+	case strings.HasPrefix(path, "manifests/"):
+		bts, ok := r.manifests[repo]
+		r.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write(bts)
+	case strings.HasPrefix(path, "blobs/"):
+		digest := strings.TrimPrefix(path, "blobs/")
+		bts, ok := r.blobs[digest]
+		stall := req.Method == http.MethodGet && req.Header.Get("Range") != "" && !r.started[digest]
+		if stall {
+			r.started[digest] = true
+		}
+		if req.Method == http.MethodGet {
+			r.ranges = append(r.ranges, req.Header.Get("Range"))
+		}
+		r.mu.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if stall && len(bts) > 1024 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(bts)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(bts[:len(bts)/2])
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.release:
+				w.Write(bts[len(bts)/2:])
+			case <-req.Context().Done():
+			}
+			return
+		}
+
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(bts))
+	default:
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// waitForPull waits until the pull of model has downloaded at least n bytes
+func waitForPull(t *testing.T, model string, n int64) api.PullStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range modelPulls.List() {
+			if status.Model == model && status.Completed >= n {
+				return status
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for pull of %s: %v", model, modelPulls.List())
+	return api.PullStatus{}
+}
+
+func partialDownloads(t *testing.T) []string {
+	t.Helper()
+
+	p, err := GetBlobsPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partials, err := filepath.Glob(filepath.Join(p, "*-partial*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return partials
+}
+
+func TestPullPauseResume(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	reg := newPullRegistry(t, "test")
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	n := model.ParseName(host + "/library/test")
+	fn := func(api.ProgressResponse) {}
+
+	sub := modelPulls.Pull(n, true, 0)
+	waitForPull(t, n.DisplayShortest(), 1<<19)
+
+	if err := modelPulls.Pause(n); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.Wait(context.Background(), fn); !errors.Is(err, errPullPaused) {
+		t.Fatalf("expected %v, got %v", errPullPaused, err)
+	}
+
+	if pulls := modelPulls.List(); len(pulls) != 1 || pulls[0].Status != pullPaused {
+		t.Fatalf("expected paused pull, got %v", pulls)
+	}
+
+	if len(partialDownloads(t)) == 0 {
+		t.Fatal("expected partial download to be kept")
+	}
+
+	// a restarted server restores the paused pull and keeps its download
+	modelPulls = pullManager{}
+	if err := modelPulls.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneLayers(); err != nil {
+		t.Fatal(err)
+	}
+
+	modelPulls.Start()
+
+	if pulls := modelPulls.List(); len(pulls) != 1 || pulls[0].Model != n.DisplayShortest() || pulls[0].Status != pullPaused {
+		t.Fatalf("expected restored paused pull, got %v", pulls)
+	}
+
+	if len(partialDownloads(t)) == 0 {
+		t.Fatal("expected partial download not to be pruned")
+	}
+
+	// pulling the model again resumes it where it stopped
+	sub = modelPulls.Pull(n, true, 0)
+	if err := sub.Wait(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseNamedManifest(n); err != nil {
+		t.Fatal(err)
+	}
+
+	if pulls := modelPulls.List(); len(pulls) != 0 {
+		t.Errorf("expected no pulls, got %v", pulls)
+	}
+
+	if _, err := os.Stat(pullsPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected saved pulls to be removed, got %v", err)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if !slices.Contains(reg.ranges, fmt.Sprintf("bytes=%d-%d", 1<<19, 1<<20-1)) {
+		t.Errorf("expected download to resume halfway, got ranges %v", reg.ranges)
+	}
+}
+
+func TestPullCancel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_MAX_PULLS", "1")
+
+	reg := newPullRegistry(t, "first", "second")
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	first := model.ParseName(host + "/library/first")
+	second := model.ParseName(host + "/library/second")
+	fn := func(api.ProgressResponse) {}
+
+	sub := modelPulls.Pull(first, true, 0)
+	waitForPull(t, first.DisplayShortest(), 1<<19)
+
+	// only one model is pulled at once
+	next := modelPulls.Pull(second, true, 0)
+	if pulls := modelPulls.List(); len(pulls) != 2 || pulls[0].Status != pullRunning || pulls[1].Status != pullQueued {
+		t.Fatalf("expected second pull to be queued, got %v", pulls)
+	}
+
+	if err := modelPulls.Cancel(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.Wait(context.Background(), fn); !errors.Is(err, errPullCanceled) {
+		t.Fatalf("expected %v, got %v", errPullCanceled, err)
+	}
+
+	close(reg.release)
+	if err := next.Wait(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if partials := partialDownloads(t); len(partials) != 0 {
+		t.Errorf("expected partial downloads to be removed, got %v", partials)
+	}
+
+	if _, err := ParseNamedManifest(first); err == nil {
+		t.Error("expected canceled pull not to write a manifest")
+	}
+
+	if _, err := ParseNamedManifest(second); err != nil {
+		t.Error(err)
+	}
+
+	if err := modelPulls.Cancel(first); !errors.Is(err, errPullNotFound) {
+		t.Errorf("expected %v, got %v", errPullNotFound, err)
+	}
+}
+
+func TestPullsHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	reg := newPullRegistry(t, "test")
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	name := host + "/library/test"
+
+	var s Server
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		body := fmt.Sprintf(`{"model": %q, "insecure": true, "limit": %d}`, name, 1<<20)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/api/pull", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+
+		io.Copy(io.Discard, resp.Body)
+	}()
+
+	waitForPull(t, model.ParseName(name).DisplayShortest(), 1<<19)
+
+	// the pull continues after the client disconnects
+	cancel()
+	<-done
+
+	w := createRequest(t, s.ListPullsHandler, nil)
+	var resp api.ListPullsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Pulls) != 1 || resp.Pulls[0].Status != pullRunning || resp.Pulls[0].Limit != 1<<20 {
+		t.Fatalf("expected running pull, got %v", resp.Pulls)
+	}
+
+	if w := createRequest(t, s.PausePullHandler, api.PullControlRequest{Model: "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+
+	if w := createRequest(t, s.PausePullHandler, api.PullControlRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+
+	if w := createRequest(t, s.CancelPullHandler, api.PullControlRequest{Model: name}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(partialDownloads(t)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if pulls := modelPulls.List(); len(pulls) != 0 {
+		t.Errorf("expected no pulls, got %v", pulls)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits a rate in bytes per second with a token bucket that
+// holds up to a second of bytes. The zero value, or a limit of zero, doesn't
+// limit the rate.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int64
+	tokens float64
+	last   time.Time
+}
+
+// SetLimit sets the limit in bytes per second.
+func (l *rateLimiter) SetLimit(limit int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit != l.limit {
+		l.limit = limit
+		l.last = time.Time{}
+	}
+}
+
+// Limit returns the limit in bytes per second.
+func (l *rateLimiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// wait blocks until n more bytes are allowed by the limit.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = float64(l.limit)
+	} else {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.limit), float64(l.limit))
+	}
+	l.last = now
+
+	// reserve the bytes and wait until the bucket is no longer in debt
+	l.tokens -= float64(n)
+	d := time.Duration(-l.tokens / float64(l.limit) * float64(time.Second))
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitedReader reads from r no faster than each of limiters allows
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func newLimitedReader(ctx context.Context, r io.Reader, limiters ...*rateLimiter) io.Reader {
+	return &limitedReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	// read in small chunks so the rate is smooth
+	if len(b) > 32<<10 {
+		b = b[:32<<10]
+	}
+
+	n, err := r.r.Read(b)
+	for _, l := range r.limiters {
+		if l == nil {
+			continue
+		}
+
+		if err := l.wait(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+// tokenBucket allows up to a limit of units a minute, in bursts of up to a
+// minute of units. Unlike rateLimiter, it doesn't wait for units. The zero
+// value, or a limit of zero, allows any number of units.
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  int64
+	tokens float64
+	last   time.Time
+}
+
+// SetLimit sets the limit in units a minute.
+func (b *tokenBucket) SetLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if limit != b.limit {
+		b.limit = limit
+		b.last = time.Time{}
+	}
+}
+
+// refill adds the units allowed since the last call. b.mu must be held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(b.limit)
+	} else {
+		b.tokens = min(b.tokens+now.Sub(b.last).Minutes()*float64(b.limit), float64(b.limit))
+	}
+	b.last = now
+}
+
+// take takes n units if they're available. Otherwise it returns how long
+// until they are.
+func (b *tokenBucket) take(n int64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit <= 0 {
+		return 0
+	}
+
+	b.refill()
+	if b.tokens < float64(n) {
+		return time.Duration((float64(n) - b.tokens) / float64(b.limit) * float64(time.Minute))
+	}
+
+	b.tokens -= float64(n)
+	return 0
+}
+
+// debit takes n units that were already used, even if they aren't
+// available, so that units are only available again once the debt is
+// repaid.
+func (b *tokenBucket) debit(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit <= 0 {
+		return
+	}
+
+	b.refill()
+	b.tokens -= float64(n)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimitedReader(t *testing.T) {
+	var unlimited, limited rateLimiter
+	limited.SetLimit(100 << 10)
+
+	// the first second of bytes is read at once and the rest at the limit
+	start := time.Now()
+	r := newLimitedReader(context.Background(), bytes.NewReader(make([]byte, 150<<10)), &unlimited, &limited, nil)
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 150<<10 {
+		t.Errorf("expected %d bytes, got %d", 150<<10, n)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected read to take about 500ms, took %s", elapsed)
+	}
+
+	// waiting stops when the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limited.SetLimit(1)
+	r = newLimitedReader(ctx, bytes.NewReader(make([]byte, 1<<10)), &limited)
+	if _, err := io.Copy(io.Discard, r); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var b tokenBucket
+	if d := b.take(1 << 20); d != 0 {
+		t.Errorf("expected no limit, got %s", d)
+	}
+
+	// a minute of units is available at once
+	b.SetLimit(60)
+	for i := range 60 {
+		if d := b.take(1); d != 0 {
+			t.Fatalf("expected unit %d to be available, got %s", i, d)
+		}
+	}
+
+	if d := b.take(1); d <= 0 || d > time.Second {
+		t.Errorf("expected about a second until the next unit, got %s", d)
+	}
+
+	// debts are repaid before units are available again
+	b.debit(120)
+	if d := b.take(0); d < time.Minute || d > 2*time.Minute {
+		t.Errorf("expected about two minutes until the debt is repaid, got %s", d)
+	}
+}
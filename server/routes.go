@@ -19,6 +19,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -53,6 +54,13 @@ var mode string = gin.DebugMode
 type Server struct {
 	addr  net.Addr
 	sched *Scheduler
+
+	// keys are the API keys that can access the server, if it requires
+	// them
+	keys *apiKeyring
+
+	// usage records the usage of each user and enforces their quotas
+	usage *usageLedger
 }
 
 func init() {
@@ -181,6 +189,10 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 		caps = append(caps, CapabilityInsert)
 	}
 
+	if !s.checkUsageQuota(c) {
+		return
+	}
+
 	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support generate", req.Model)})
@@ -328,6 +340,7 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 			if cr.Done {
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				s.recordUsage(c, name, gpuShare(r), res.Metrics)
 
 				if !req.Raw {
 					tokens, err := r.Tokenize(c.Request.Context(), prompt+sb.String())
@@ -422,6 +435,10 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		return
 	}
 
+	if !s.checkUsageQuota(c) {
+		return
+	}
+
 	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
@@ -495,6 +512,7 @@ func (s *Server) EmbedHandler(c *gin.Context) {
 		LoadDuration:    checkpointLoaded.Sub(checkpointStart),
 		PromptEvalCount: count,
 	}
+	s.recordUsage(c, name, gpuShare(r), api.Metrics{PromptEvalCount: count, PromptEvalDuration: time.Since(checkpointLoaded)})
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -531,6 +549,10 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
+	if !s.checkUsageQuota(c) {
+		return
+	}
+
 	r, _, _, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{}, req.Options, req.KeepAlive)
 	if err != nil {
 		handleScheduleError(c, req.Model, err)
@@ -543,6 +565,14 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 		return
 	}
 
+	// the prompt is tokenized to count its tokens toward usage
+	tokens, err := r.Tokenize(c.Request.Context(), req.Prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	checkpointStart := time.Now()
 	embedding, err := r.Embedding(c.Request.Context(), req.Prompt)
 	if err != nil {
 		slog.Info(fmt.Sprintf("embedding generation failed: %v", err))
@@ -558,6 +588,7 @@ func (s *Server) EmbeddingsHandler(c *gin.Context) {
 	resp := api.EmbeddingResponse{
 		Embedding: e,
 	}
+	s.recordUsage(c, name, gpuShare(r), api.Metrics{PromptEvalCount: len(tokens), PromptEvalDuration: time.Since(checkpointStart)})
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -585,22 +616,22 @@ func (s *Server) PullHandler(c *gin.Context) {
 		return
 	}
 
+	// the pull continues in the background if the client disconnects
+	sub := modelPulls.Pull(name, req.Insecure, req.Limit)
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
-		fn := func(r api.ProgressResponse) {
-			ch <- r
-		}
-
-		regOpts := &registryOptions{
-			Insecure: req.Insecure,
+		ctx := c.Request.Context()
+		send := func(v any) {
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+			}
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
-
-		if err := PullModel(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+		if err := sub.Wait(ctx, func(r api.ProgressResponse) { send(r) }); err != nil && ctx.Err() == nil {
+			send(gin.H{"error": err.Error()})
 		}
 	}()
 
@@ -612,6 +643,50 @@ func (s *Server) PullHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+func (s *Server) ListPullsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, api.ListPullsResponse{Pulls: modelPulls.List()})
+}
+
+func (s *Server) PausePullHandler(c *gin.Context) {
+	s.controlPull(c, modelPulls.Pause)
+}
+
+func (s *Server) ResumePullHandler(c *gin.Context) {
+	s.controlPull(c, modelPulls.Resume)
+}
+
+func (s *Server) CancelPullHandler(c *gin.Context) {
+	s.controlPull(c, modelPulls.Cancel)
+}
+
+// controlPull calls fn with the model of the pull in the request
+func (s *Server) controlPull(c *gin.Context, fn func(model.Name) error) {
+	var req api.PullControlRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(req.Model)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name %q is invalid", req.Model)})
+		return
+	}
+
+	if err := fn(n); errors.Is(err, errPullNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("pull of '%s' not found", req.Model)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func (s *Server) PushHandler(c *gin.Context) {
 	var req api.PushRequest
 	err := c.ShouldBindJSON(&req)
@@ -643,6 +718,7 @@ func (s *Server) PushHandler(c *gin.Context) {
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Sign:     req.Sign,
 		}
 
 		ctx, cancel := context.WithCancel(c.Request.Context())
@@ -739,6 +815,28 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) PruneHandler(c *gin.Context) {
+	var req api.PruneRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var opts pruneOptions
+	opts.DryRun = req.DryRun
+	if req.OlderThan != nil {
+		opts.OlderThan = req.OlderThan.Duration
+	}
+
+	resp, err := pruneModels(opts)
+	if err != nil && !errors.Is(err, errStoreQuota) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) ShowHandler(c *gin.Context) {
 	var req api.ShowRequest
 	err := c.ShouldBindJSON(&req)
@@ -901,6 +999,10 @@ func (s *Server) ListHandler(c *gin.Context) {
 
 	models := []api.ListModelResponse{}
 	for n, m := range ms {
+		if m.dangling {
+			continue
+		}
+
 		var cf ConfigV2
 
 		if m.Config.Digest != "" {
@@ -981,6 +1083,163 @@ func (s *Server) CopyHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) ExportHandler(c *gin.Context) {
+	var r api.ExportRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(r.Model)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is invalid", r.Model)})
+		return
+	}
+	n, err := getExistingName(n)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := ParseNamedManifest(n)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Model)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := exportEntries(n, m)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the client sees a truncated archive as an error because the
+	// length is set
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Length", strconv.FormatInt(archiveSize(entries), 10))
+	c.Status(http.StatusOK)
+	if err := writeArchive(c.Writer, entries); err != nil {
+		slog.Error("export failed", "model", n.DisplayShortest(), "error", err)
+	}
+}
+
+func (s *Server) ImportHandler(c *gin.Context) {
+	names, err := importArchive(c.Request.Body)
+	if errors.Is(err, errInvalidArchive) || errors.Is(err, errDigestMismatch) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.ImportResponse{Models: make([]string, len(names))}
+	for i, n := range names {
+		resp.Models[i] = n.DisplayShortest()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) SetAliasHandler(c *gin.Context) {
+	var r api.AliasRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alias := model.ParseName(r.Name)
+	if !alias.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid", r.Name)})
+		return
+	}
+	alias, err := getExistingName(alias)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := model.ParseName(r.Target)
+	if !target.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("target %q is invalid", r.Target)})
+		return
+	}
+	target, err = getExistingName(target)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := SetAlias(alias, target); errors.Is(err, errAliasNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Target)})
+	} else if errors.Is(err, errAliasSelf) || errors.Is(err, errAliasDepth) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) ListAliasesHandler(c *gin.Context) {
+	aliases, err := Aliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.ListAliasesResponse{Aliases: []api.AliasResponse{}}
+	for alias, target := range aliases {
+		resp.Aliases = append(resp.Aliases, api.AliasResponse{
+			Name:   alias.DisplayShortest(),
+			Target: target.DisplayShortest(),
+		})
+	}
+
+	slices.SortFunc(resp.Aliases, func(i, j api.AliasResponse) int {
+		return cmp.Compare(i.Name, j.Name)
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) DeleteAliasHandler(c *gin.Context) {
+	var r api.AliasRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alias := model.ParseName(r.Name)
+	if !alias.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid", r.Name)})
+		return
+	}
+	alias, err := getExistingName(alias)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := RemoveAlias(alias); errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alias %q not found", r.Name)})
+	} else if errors.Is(err, errNotAlias) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q is a model, not an alias", r.Name)})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func (s *Server) HeadBlobHandler(c *gin.Context) {
 	path, err := GetBlobsPath(c.Param("digest"))
 	if err != nil {
@@ -1173,33 +1432,52 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 	r.HEAD("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
 	r.GET("/api/version", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": version.Version}) })
 
+	inference := s.authorize(scopeInference)
+	admin := s.authorize(scopeAdmin)
+
 	// Local model cache management (new implementation is at end of function)
-	r.POST("/api/pull", s.PullHandler)
-	r.POST("/api/push", s.PushHandler)
-	r.HEAD("/api/tags", s.ListHandler)
-	r.GET("/api/tags", s.ListHandler)
-	r.POST("/api/show", s.ShowHandler)
-	r.DELETE("/api/delete", s.DeleteHandler)
+	r.POST("/api/pull", admin, s.PullHandler)
+	r.GET("/api/pulls", admin, s.ListPullsHandler)
+	r.POST("/api/pulls/pause", admin, s.PausePullHandler)
+	r.POST("/api/pulls/resume", admin, s.ResumePullHandler)
+	r.DELETE("/api/pulls", admin, s.CancelPullHandler)
+	r.POST("/api/push", admin, s.PushHandler)
+	r.HEAD("/api/tags", inference, s.ListHandler)
+	r.GET("/api/tags", inference, s.ListHandler)
+	r.POST("/api/show", inference, s.ShowHandler)
+	r.DELETE("/api/delete", admin, s.DeleteHandler)
+	r.POST("/api/prune", admin, s.PruneHandler)
 
 	// Create
-	r.POST("/api/create", s.CreateHandler)
-	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
-	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
-	r.POST("/api/copy", s.CopyHandler)
+	r.POST("/api/create", admin, s.CreateHandler)
+	r.POST("/api/blobs/:digest", admin, s.CreateBlobHandler)
+	r.HEAD("/api/blobs/:digest", admin, s.HeadBlobHandler)
+	r.POST("/api/copy", admin, s.CopyHandler)
+	r.POST("/api/export", admin, s.ExportHandler)
+	r.POST("/api/import", admin, s.ImportHandler)
+	r.POST("/api/alias", admin, s.SetAliasHandler)
+	r.GET("/api/alias", inference, s.ListAliasesHandler)
+	r.DELETE("/api/alias", admin, s.DeleteAliasHandler)
+
+	// API keys and usage
+	r.GET("/api/keys", admin, s.ListKeysHandler)
+	r.POST("/api/usage", inference, s.UsageHandler)
 
 	// Inference
-	r.GET("/api/ps", s.PsHandler)
-	r.POST("/api/generate", s.GenerateHandler)
-	r.POST("/api/chat", s.ChatHandler)
-	r.POST("/api/embed", s.EmbedHandler)
-	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.GET("/api/ps", inference, s.PsHandler)
+	r.POST("/api/plan", inference, s.PlanHandler)
+	r.POST("/api/template/render", inference, s.TemplateRenderHandler)
+	r.POST("/api/generate", inference, s.GenerateHandler)
+	r.POST("/api/chat", inference, s.ChatHandler)
+	r.POST("/api/embed", inference, s.EmbedHandler)
+	r.POST("/api/embeddings", inference, s.EmbeddingsHandler)
 
 	// Inference (OpenAI compatibility)
-	r.POST("/v1/chat/completions", openai.ChatMiddleware(), s.ChatHandler)
-	r.POST("/v1/completions", openai.CompletionsMiddleware(), s.GenerateHandler)
-	r.POST("/v1/embeddings", openai.EmbeddingsMiddleware(), s.EmbedHandler)
-	r.GET("/v1/models", openai.ListMiddleware(), s.ListHandler)
-	r.GET("/v1/models/:model", openai.RetrieveMiddleware(), s.ShowHandler)
+	r.POST("/v1/chat/completions", inference, openai.ChatMiddleware(), s.ChatHandler)
+	r.POST("/v1/completions", inference, openai.CompletionsMiddleware(), s.GenerateHandler)
+	r.POST("/v1/embeddings", inference, openai.EmbeddingsMiddleware(), s.EmbedHandler)
+	r.GET("/v1/models", inference, openai.ListMiddleware(), s.ListHandler)
+	r.GET("/v1/models/:model", inference, openai.RetrieveMiddleware(), s.ShowHandler)
 
 	if rc != nil {
 		// wrap old with new
@@ -1209,13 +1487,53 @@ func (s *Server) GenerateRoutes(rc *ollama.Registry) (http.Handler, error) {
 			Fallback: r,
 
 			Prune: PruneLayers,
+
+			Mirror:     envconfig.Mirror(),
+			MirrorOnly: !useClient2,
 		}
-		return rs, nil
+
+		// The registry API of the mirror and, in the new
+		// implementation, pulls and deletes are handled before the
+		// routes above, so their API keys are checked first.
+		scopes := map[string]string{"/v2/": scopeInference}
+		if useClient2 {
+			scopes["/api/pull"] = scopeAdmin
+			scopes["/api/delete"] = scopeAdmin
+		}
+		return s.keys.guard(rs, scopes), nil
 	}
 
 	return r, nil
 }
 
+// reloader reloads a configuration file of the server
+type reloader struct {
+	name string
+	args []any // logged with the result
+	load func() error
+}
+
+// reloadOnSIGHUP runs each of reloaders when the server receives SIGHUP
+func reloadOnSIGHUP(reloaders []reloader) {
+	if len(reloaders) == 0 {
+		return
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			for _, r := range reloaders {
+				if err := r.load(); err != nil {
+					slog.Error("failed to reload "+r.name, slices.Concat(r.args, []any{"error", err})...)
+					continue
+				}
+				slog.Info("reloaded "+r.name, r.args...)
+			}
+		}
+	}()
+}
+
 func Serve(ln net.Listener) error {
 	level := slog.LevelInfo
 	if envconfig.Debug() {
@@ -1246,6 +1564,11 @@ func Serve(ln net.Listener) error {
 		return err
 	}
 
+	// restore the pulls before pruning so their partial downloads are kept
+	if err := modelPulls.Restore(); err != nil {
+		slog.Warn("couldn't restore pulls", "error", err)
+	}
+
 	if !envconfig.NoPrune() {
 		if _, err := Manifests(false); err != nil {
 			slog.Warn("corrupt manifests detected, skipping prune operation.  Re-pull or delete to clear", "error", err)
@@ -1266,10 +1589,52 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
+	modelPulls.Start()
+
 	s := &Server{addr: ln.Addr()}
 
+	var reloaders []reloader
+	if path := envconfig.APIKeys(); path != "" {
+		s.keys = &apiKeyring{}
+		if err := s.keys.load(path); err != nil {
+			return err
+		}
+
+		reloaders = append(reloaders, reloader{"API keys", []any{"path", path}, func() error { return s.keys.load(path) }})
+	}
+
+	s.usage = newUsageLedger(usageDir())
+	if path := envconfig.UsageQuotas(); path != "" {
+		if err := s.usage.loadQuotas(path); err != nil {
+			return err
+		}
+
+		reloaders = append(reloaders, reloader{"usage quotas", []any{"path", path}, func() error { return s.usage.loadQuotas(path) }})
+	}
+
+	go func() {
+		for range time.Tick(usageSaveInterval) {
+			if err := s.usage.save(); err != nil {
+				slog.Warn("couldn't save usage", "error", err)
+			}
+		}
+	}()
+
+	var certs *certReloader
+	if envconfig.TLSCert() != "" || envconfig.TLSKey() != "" || envconfig.TLSClientCA() != "" {
+		certs, err = newCertReloader(envconfig.TLSCert(), envconfig.TLSKey(), envconfig.TLSClientCA())
+		if err != nil {
+			return err
+		}
+
+		// the certificate is also reloaded when its files change
+		reloaders = append(reloaders, reloader{"TLS certificate", []any{"cert", certs.certFile}, certs.load})
+	} else if envconfig.Host().Scheme == "https" {
+		slog.Warn("OLLAMA_HOST is https but OLLAMA_TLS_CERT and OLLAMA_TLS_KEY aren't set, serving HTTP")
+	}
+
 	var rc *ollama.Registry
-	if useClient2 {
+	if useClient2 || envconfig.Mirror() {
 		var err error
 		rc, err = ollama.DefaultRegistry()
 		if err != nil {
@@ -1310,17 +1675,40 @@ func Serve(ln net.Listener) error {
 		srvr.Close()
 		schedDone()
 		sched.unloadAllRunners()
+		if err := s.usage.save(); err != nil {
+			slog.Warn("couldn't save usage", "error", err)
+		}
 		done()
 	}()
 
 	s.sched.Run(schedCtx)
 
+	if path := envconfig.Policy(); path != "" {
+		if err := s.loadPolicy(schedCtx, path); err != nil {
+			return err
+		}
+
+		reloaders = append(reloaders, reloader{"policy", []any{"path", path}, func() error { return s.loadPolicy(schedCtx, path) }})
+	}
+
+	// reload the configuration files on SIGHUP, keeping the current ones
+	// if the new ones are invalid
+	reloadOnSIGHUP(reloaders)
+
 	// At startup we retrieve GPU information so we can get log messages before loading a model
 	// This will log warnings to the log in case we have problems with detected GPUs
 	gpus := discover.GetGPUInfo()
 	gpus.LogDetails()
 
-	err = srvr.Serve(ln)
+	if certs != nil {
+		go certs.watch(ctx.Done())
+
+		slog.Info("serving HTTPS", "cert", certs.certFile, "client_ca", certs.caFile)
+		srvr.TLSConfig = certs.config()
+		err = srvr.ServeTLS(ln, "", "")
+	} else {
+		err = srvr.Serve(ln)
+	}
 	// If server is closed from the signal handler, wait for the ctx to be done
 	// otherwise error out quickly
 	if !errors.Is(err, http.ErrServerClosed) {
@@ -1425,6 +1813,170 @@ func (s *Server) PsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, api.ProcessResponse{Models: models})
 }
 
+func (s *Server) PlanHandler(c *gin.Context) {
+	var req api.PlanRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	m, err := GetModel(req.Model)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	opts, err := modelOptions(m, req.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := s.sched.Plan(c.Request.Context(), m, opts, req.NumParallel)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+func (s *Server) TemplateRenderHandler(c *gin.Context) {
+	var req api.TemplateRenderRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	if !s.checkUsageQuota(c) {
+		return
+	}
+
+	name, err = getExistingName(name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	var tmpl *template.Template
+	if req.Template != "" {
+		tmpl, err = template.Parse(req.Template)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// the runner is only needed for its tokenizer so skip the tools
+	// capability check and report it as a warning instead
+	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), []Capability{CapabilityCompletion}, req.Options, req.KeepAlive)
+	if errors.Is(err, errCapabilityCompletion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
+		return
+	} else if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	if tmpl != nil {
+		m.Template = tmpl
+	}
+
+	if req.System != "" {
+		m.System = req.System
+	}
+
+	msgs := append(m.Messages, req.Messages...)
+	if (len(req.Messages) == 0 || req.Messages[0].Role != "system") && m.System != "" {
+		msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
+	}
+
+	thinkingStart, thinkingEnd := thinkingDelimiters(m, opts)
+	msgs = withThinking(m, msgs, req.KeepThinking, thinkingStart, thinkingEnd)
+
+	truncation, err := truncationFor(req.Truncation, summarizeWith(r, m, opts))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prompt, images, dropped, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools, truncation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := r.Tokenize(c.Request.Context(), prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings := templateWarnings(m, msgs, req.Tools, prompt, len(images))
+	if len(tokens) > opts.NumCtx {
+		warnings = append(warnings, fmt.Sprintf("prompt is %d tokens which exceeds the context length of %d", len(tokens), opts.NumCtx))
+	}
+
+	c.JSON(http.StatusOK, api.TemplateRenderResponse{
+		Prompt:    prompt,
+		Tokens:    len(tokens),
+		Truncated: requestIndexes(dropped, len(msgs)-len(req.Messages)),
+		Warnings:  warnings,
+	})
+}
+
+// templateWarnings reports the parts of a chat request that m's template
+// silently drops when rendering it into prompt.
+func templateWarnings(m *Model, msgs []api.Message, tools []api.Tool, prompt string, images int) []string {
+	var warnings []string
+	vars := m.Template.Vars()
+
+	if !slices.Contains(vars, "messages") {
+		warnings = append(warnings, "template does not use .Messages so it is rendered in legacy .Prompt/.Response mode once per turn")
+	} else if n := len(msgs); n > 0 && msgs[n-1].Content != "" && !strings.Contains(prompt, msgs[n-1].Content) {
+		warnings = append(warnings, "template does not render the content of the last message")
+	}
+
+	if len(tools) > 0 && !slices.Contains(vars, "tools") {
+		warnings = append(warnings, "template does not use .Tools so the tools are ignored")
+	}
+
+	if len(tools) > 0 && m.Template.IsJinja() {
+		warnings = append(warnings, "tool calls are not parsed from the output of jinja templates")
+	}
+
+	if images > 0 {
+		if len(m.ProjectorPaths) == 0 && !checkMllamaModelFamily(m) {
+			warnings = append(warnings, "model does not have a vision projector so images are ignored")
+		} else if !strings.Contains(prompt, "[img-") {
+			warnings = append(warnings, "template does not render the image tags in message content so images are ignored")
+		}
+	}
+
+	return warnings
+}
+
 func (s *Server) ChatHandler(c *gin.Context) {
 	checkpointStart := time.Now()
 
@@ -1479,6 +2031,10 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		return
 	}
 
+	if !s.checkUsageQuota(c) {
+		return
+	}
+
 	r, m, opts, err := s.scheduleRunner(c.Request.Context(), name.String(), caps, req.Options, req.KeepAlive)
 	if errors.Is(err, errCapabilityCompletion) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q does not support chat", req.Model)})
@@ -1506,7 +2062,16 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		msgs = append([]api.Message{{Role: "system", Content: m.System}}, msgs...)
 	}
 
-	prompt, images, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools)
+	thinkingStart, thinkingEnd := thinkingDelimiters(m, opts)
+	msgs = withThinking(m, msgs, req.KeepThinking, thinkingStart, thinkingEnd)
+
+	truncation, err := truncationFor(req.Truncation, summarizeWith(r, m, opts))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prompt, images, dropped, err := chatPrompt(c.Request.Context(), m, r.Tokenize, opts, msgs, req.Tools, truncation)
 	if err != nil {
 		slog.Error("chat prompt error", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -1515,6 +2080,14 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 	slog.Debug("chat request", "images", len(images), "prompt", prompt)
 
+	var thinking *thinkingParser
+	if thinkingEnd != "" {
+		thinking = newThinkingParser(thinkingStart, thinkingEnd, prompt)
+	}
+
+	// r is shadowed by the responses below
+	share := gpuShare(r)
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
@@ -1526,10 +2099,20 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			Format:  req.Format,
 			Options: opts,
 		}, func(r llm.CompletionResponse) {
+			var thoughts string
+			if thinking != nil {
+				thoughts, r.Content = thinking.add(r.Content)
+				if r.Done {
+					t, c := thinking.flush()
+					thoughts += t
+					r.Content += c
+				}
+			}
+
 			res := api.ChatResponse{
 				Model:      req.Model,
 				CreatedAt:  time.Now().UTC(),
-				Message:    api.Message{Role: "assistant", Content: r.Content},
+				Message:    api.Message{Role: "assistant", Content: r.Content, Thinking: thoughts},
 				Done:       r.Done,
 				DoneReason: r.DoneReason,
 				Metrics: api.Metrics{
@@ -1543,6 +2126,8 @@ func (s *Server) ChatHandler(c *gin.Context) {
 			if r.Done {
 				res.TotalDuration = time.Since(checkpointStart)
 				res.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				s.recordUsage(c, name, share, res.Metrics)
+				res.Truncated = requestIndexes(dropped, len(msgs)-len(req.Messages))
 			}
 
 			// TODO: tool call checking and filtering should be moved outside of this callback once streaming
@@ -1575,6 +2160,10 @@ func (s *Server) ChatHandler(c *gin.Context) {
 					res.Message.Content = sb.String()
 				}
 				ch <- res
+			} else if res.Message.Thinking != "" {
+				// thinking can't hold tool calls so stream it right away
+				res.Message.Content = ""
+				ch <- res
 			}
 		}); err != nil {
 			ch <- gin.H{"error": err.Error()}
@@ -1583,11 +2172,12 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 	if req.Stream != nil && !*req.Stream {
 		var resp api.ChatResponse
-		var sb strings.Builder
+		var sb, thoughts strings.Builder
 		for rr := range ch {
 			switch t := rr.(type) {
 			case api.ChatResponse:
 				sb.WriteString(t.Message.Content)
+				thoughts.WriteString(t.Message.Thinking)
 				resp = t
 			case gin.H:
 				msg, ok := t["error"].(string)
@@ -1604,6 +2194,7 @@ func (s *Server) ChatHandler(c *gin.Context) {
 		}
 
 		resp.Message.Content = sb.String()
+		resp.Message.Thinking = thoughts.String()
 
 		if len(req.Tools) > 0 {
 			if toolCalls, ok := m.parseToolCalls(sb.String()); ok {
@@ -1619,6 +2210,19 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+// requestIndexes converts indexes into the messages passed to chatPrompt
+// into indexes into the request's messages, which start at offset after the
+// model's system and template messages.
+func requestIndexes(indexes []int, offset int) []int {
+	var r []int
+	for _, i := range indexes {
+		if i >= offset {
+			r = append(r, i-offset)
+		}
+	}
+	return r
+}
+
 func handleScheduleError(c *gin.Context, name string, err error) {
 	switch {
 	case errors.Is(err, errCapabilities), errors.Is(err, errRequired):
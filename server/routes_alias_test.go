@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	_, digest := createBinFile(t, nil, nil)
+	for _, req := range []api.CreateRequest{
+		{Name: "test", Files: map[string]string{"test.gguf": digest}},
+		{Name: "test2", Files: map[string]string{"test.gguf": digest}, Template: "{{ .Prompt }}"},
+	} {
+		if w := createRequest(t, s.CreateHandler, req); w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	digestOf := func(name string) string {
+		t.Helper()
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.digest
+	}
+
+	t.Run("set", func(t *testing.T) {
+		w := createRequest(t, s.SetAliasHandler, api.AliasRequest{Name: "prod", Target: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		if digestOf("prod") != digestOf("test") {
+			t.Error("expected alias to resolve to its target")
+		}
+	})
+
+	t.Run("repoint", func(t *testing.T) {
+		w := createRequest(t, s.SetAliasHandler, api.AliasRequest{Name: "prod", Target: "test2"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		if digestOf("prod") != digestOf("test2") {
+			t.Error("expected alias to resolve to its new target")
+		}
+
+		checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "prod", "latest"),
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "test", "latest"),
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "test2", "latest"),
+		})
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		w := createRequest(t, s.SetAliasHandler, api.AliasRequest{Name: "stable", Target: "prod"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		if digestOf("stable") != digestOf("test2") {
+			t.Error("expected alias to resolve through another alias")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			req    api.AliasRequest
+			status int
+		}{
+			{"missing target", api.AliasRequest{Name: "prod", Target: "missing"}, http.StatusNotFound},
+			{"existing model", api.AliasRequest{Name: "test", Target: "test2"}, http.StatusConflict},
+			{"self", api.AliasRequest{Name: "prod", Target: "prod"}, http.StatusBadRequest},
+			{"cycle", api.AliasRequest{Name: "prod", Target: "stable"}, http.StatusBadRequest},
+			{"invalid", api.AliasRequest{Name: "prod", Target: "not a name"}, http.StatusBadRequest},
+		}
+
+		for _, tt := range cases {
+			t.Run(tt.name, func(t *testing.T) {
+				w := createRequest(t, s.SetAliasHandler, tt.req)
+				if w.Code != tt.status {
+					t.Errorf("expected status code %d, actual %d: %s", tt.status, w.Code, w.Body.String())
+				}
+			})
+		}
+
+		if digestOf("prod") != digestOf("test2") {
+			t.Error("expected failed requests to leave the alias in place")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := createRequest(t, s.ListAliasesHandler, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ListAliasesResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		expect := []api.AliasResponse{
+			{Name: "prod:latest", Target: "test2:latest"},
+			{Name: "stable:latest", Target: "prod:latest"},
+		}
+
+		if diff := cmp.Diff(expect, resp.Aliases); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := createRequest(t, s.DeleteAliasHandler, api.AliasRequest{Name: "test"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, actual %d", w.Code)
+		}
+
+		w = createRequest(t, s.DeleteAliasHandler, api.AliasRequest{Name: "stable"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		// deleting an alias like a model keeps the model it refers to
+		w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Model: "prod"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "test", "latest"),
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "test2", "latest"),
+		})
+
+		w = createRequest(t, s.DeleteAliasHandler, api.AliasRequest{Name: "prod"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, actual %d", w.Code)
+		}
+	})
+	t.Run("delete target", func(t *testing.T) {
+		w := createRequest(t, s.SetAliasHandler, api.AliasRequest{Name: "prod", Target: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Model: "test"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		// a dangling alias isn't a corrupt manifest, which would skip pruning
+		ms, err := Manifests(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m, ok := ms[model.ParseName("prod")]; !ok || !m.dangling {
+			t.Errorf("expected a dangling alias, got %+v", m)
+		}
+
+		w = createRequest(t, s.ListHandler, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ListResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, m := range resp.Models {
+			names = append(names, m.Name)
+		}
+
+		if diff := cmp.Diff([]string{"test2:latest"}, names); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		w = createRequest(t, s.CreateHandler, api.CreateRequest{Name: "test", Files: map[string]string{"test.gguf": digest}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		if digestOf("prod") != digestOf("test") {
+			t.Error("expected alias to resolve to its recreated target")
+		}
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/fs/ggml"
+	"github.com/ollama/ollama/template"
 )
 
 var stream bool = false
@@ -710,6 +711,41 @@ func TestCreateDetectTemplate(t *testing.T) {
 			filepath.Join(p, "blobs", "sha256-ca239d7bd8ea90e4a5d2e6bf88f8d74a47b14336e73eb4e18bed4dd325018116"),
 		})
 	})
+
+	t.Run("jinja", func(t *testing.T) {
+		_, digest := createBinFile(t, ggml.KV{
+			"tokenizer.chat_template":     "{%- set ns = namespace(turns=0) -%}{%- for message in messages -%}{%- set ns.turns = ns.turns + 1 -%}{{ '<turn index=\"' ~ ns.turns ~ '\" role=\"' ~ message['role'] | lower ~ '\">' ~ message['content'] | trim ~ eos_token }}{%- endfor -%}{%- if add_generation_prompt -%}{{ '<turn role=\"assistant\">' }}{%- endif -%}",
+			"tokenizer.ggml.tokens":       []string{"<unk>", "<s>", "</turn>"},
+			"tokenizer.ggml.eos_token_id": uint32(2),
+		}, nil)
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:   "jinja",
+			Files:  map[string]string{"test.gguf": digest},
+			Stream: &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		m, err := GetModel("jinja")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !m.Template.IsJinja() {
+			t.Fatalf("expected a jinja template, got %q", m.Template.String())
+		}
+
+		var b bytes.Buffer
+		if err := m.Template.Execute(&b, template.Values{Messages: []api.Message{{Role: "user", Content: "Hello"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if expect := `<turn index="1" role="user">Hello</turn><turn role="assistant">`; b.String() != expect {
+			t.Errorf("expected %q, got %q", expect, b.String())
+		}
+	})
 }
 
 func TestDetectModelTypeFromFiles(t *testing.T) {
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/fs/ggml"
+)
+
+func TestTemplateRender(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var mock mockRunner
+	s := Server{
+		sched: &Scheduler{
+			pendingReqCh:  make(chan *LlmRequest, 1),
+			finishedReqCh: make(chan *LlmRequest, 1),
+			expiredCh:     make(chan *runnerRef, 1),
+			unloadedCh:    make(chan any, 1),
+			loaded:        make(map[string]*runnerRef),
+			newServerFn:   newMockServer(&mock),
+			getGpuFn:      discover.GetGPUInfo,
+			getCpuFn:      discover.GetCPUInfo,
+			reschedDelay:  250 * time.Millisecond,
+			loadFn: func(req *LlmRequest, _ *ggml.GGML, _ discover.GpuInfoList, _ int) {
+				req.successCh <- &runnerRef{
+					llama: &mock,
+				}
+			},
+		},
+	}
+
+	go s.sched.Run(context.TODO())
+
+	_, digest := createBinFile(t, ggml.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(1),
+		"llama.context_length":          uint32(8192),
+		"llama.embedding_length":        uint32(4096),
+		"llama.attention.head_count":    uint32(32),
+		"llama.attention.head_count_kv": uint32(8),
+		"tokenizer.ggml.tokens":         []string{""},
+		"tokenizer.ggml.scores":         []float32{0},
+		"tokenizer.ggml.token_type":     []int32{0},
+	}, []ggml.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_down.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_gate.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_up.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.ffn_norm.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_k.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_q.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "blk.0.attn_v.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+		{Name: "output.weight", Shape: []uint64{1}, WriterTo: bytes.NewReader(make([]byte, 4))},
+	})
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:    "test",
+		Files:    map[string]string{"file.gguf": digest},
+		Template: `{{- range .Messages }}{{ .Role }}: {{ .Content }} {{ end }}`,
+		System:   "You are a bot.",
+		Stream:   &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	w = createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model:    "test-legacy",
+		Files:    map[string]string{"file.gguf": digest},
+		Template: `{{ if .System }}{{ .System }} {{ end }}{{ .Prompt }} `,
+		Stream:   &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	weather := api.Tool{
+		Type: "function",
+		Function: api.ToolFunction{
+			Name:        "get_weather",
+			Description: "Get the current weather",
+		},
+	}
+
+	cases := []struct {
+		name   string
+		req    api.TemplateRenderRequest
+		status int
+		expect api.TemplateRenderResponse
+	}{
+		{
+			name: "messages",
+			req: api.TemplateRenderRequest{
+				Model: "test",
+				Messages: []api.Message{
+					{Role: "user", Content: "Hello!"},
+					{Role: "assistant", Content: "Hi there."},
+					{Role: "user", Content: "How are you?"},
+				},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt: "system: You are a bot. user: Hello! assistant: Hi there. user: How are you? ",
+				Tokens: 14,
+			},
+		},
+		{
+			name: "system override",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				System:   "Be brief.",
+				Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt: "system: Be brief. user: Hello! ",
+				Tokens: 5,
+			},
+		},
+		{
+			name: "system message",
+			req: api.TemplateRenderRequest{
+				Model: "test",
+				Messages: []api.Message{
+					{Role: "system", Content: "Be kind."},
+					{Role: "user", Content: "Hello!"},
+				},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt: "system: Be kind. user: Hello! ",
+				Tokens: 5,
+			},
+		},
+		{
+			name: "template override",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				Template: `{{- range .Messages }}<{{ .Role }}>{{ .Content }}</{{ .Role }}>{{ end }}`,
+				Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt: "<system>You are a bot.</system><user>Hello!</user>",
+				Tokens: 4,
+			},
+		},
+		{
+			name: "ignored tools",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				Messages: []api.Message{{Role: "user", Content: "Is it raining?"}},
+				Tools:    api.Tools{weather},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt:   "system: You are a bot. user: Is it raining? ",
+				Tokens:   9,
+				Warnings: []string{"template does not use .Tools so the tools are ignored"},
+			},
+		},
+		{
+			name: "ignored content",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				Template: `{{- range .Messages }}{{ .Role }} {{ end }}`,
+				Messages: []api.Message{{Role: "user", Content: "Hello!"}},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt:   "system user ",
+				Tokens:   2,
+				Warnings: []string{"template does not render the content of the last message"},
+			},
+		},
+		{
+			name: "ignored images",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				Messages: []api.Message{{Role: "user", Content: "What is this?", Images: []api.ImageData{[]byte("image")}}},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt:   "system: You are a bot. user: [img-0]What is this? ",
+				Tokens:   9,
+				Warnings: []string{"model does not have a vision projector so images are ignored"},
+			},
+		},
+		{
+			name: "legacy",
+			req: api.TemplateRenderRequest{
+				Model: "test-legacy",
+				Messages: []api.Message{
+					{Role: "user", Content: "Hello!"},
+					{Role: "assistant", Content: "Hi there."},
+					{Role: "user", Content: "How are you?"},
+				},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt:   "Hello! Hi there.How are you? ",
+				Tokens:   5,
+				Warnings: []string{"template does not use .Messages so it is rendered in legacy .Prompt/.Response mode once per turn"},
+			},
+		},
+		{
+			name: "exceeds context",
+			req: api.TemplateRenderRequest{
+				Model:    "test",
+				Messages: []api.Message{{Role: "user", Content: "one two three four five"}},
+				Options:  map[string]any{"num_ctx": 4},
+			},
+			status: http.StatusOK,
+			expect: api.TemplateRenderResponse{
+				Prompt:   "system: You are a bot. user: one two three four five ",
+				Tokens:   11,
+				Warnings: []string{"prompt is 11 tokens which exceeds the context length of 4"},
+			},
+		},
+		{
+			name:   "invalid template",
+			req:    api.TemplateRenderRequest{Model: "test", Template: "{{ .Prompt "},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing model",
+			req:    api.TemplateRenderRequest{Model: "missing"},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.TemplateRenderHandler, tt.req)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp api.TemplateRenderResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.expect, resp); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("missing body", func(t *testing.T) {
+		w := createRequest(t, s.TemplateRenderHandler, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("unreadable manifests", func(t *testing.T) {
+		manifests, err := GetManifestPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join(manifests, "registry.ollama.ai", "library", "broken")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "latest")); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		w := createRequest(t, s.TemplateRenderHandler, api.TemplateRenderRequest{Model: "test"})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if got := w.Body.String(); !strings.Contains(got, "model 'test' not found") {
+			t.Errorf("expected model not found, got %s", got)
+		}
+	})
+}
@@ -42,6 +42,10 @@ type Scheduler struct {
 	loaded   map[string]*runnerRef
 	loadedMu sync.Mutex
 
+	// policies are the lifecycle policies of models by model path
+	policies   map[string]ModelPolicy
+	policiesMu sync.Mutex
+
 	loadFn       func(req *LlmRequest, f *ggml.GGML, gpus discover.GpuInfoList, numParallel int)
 	newServerFn  func(gpus discover.GpuInfoList, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error)
 	getGpuFn     func() discover.GpuInfoList
@@ -84,6 +88,14 @@ func (s *Scheduler) GetRunner(c context.Context, model *Model, opts api.Options,
 		opts.NumCtx = 4
 	}
 
+	if p, ok := s.policy(model.ModelPath); ok {
+		d := envconfig.KeepAlive()
+		if sessionDuration != nil {
+			d = sessionDuration.Duration
+		}
+		sessionDuration = &api.Duration{Duration: p.keepAlive(d)}
+	}
+
 	req := &LlmRequest{
 		ctx:             c,
 		model:           model,
@@ -155,6 +167,10 @@ func (s *Scheduler) processPending(ctx context.Context) {
 				} else if envconfig.MaxRunners() > 0 && loadedCount >= int(envconfig.MaxRunners()) {
 					slog.Debug("max runners achieved, unloading one to make room", "runner_count", loadedCount)
 					runnerToExpire = s.findRunnerToUnload()
+					if runnerToExpire == nil {
+						pending.errCh <- errAllPinned
+						break
+					}
 				} else {
 					// Either no models are loaded or below envconfig.MaxRunners
 					// Get a refreshed GPU list
@@ -271,6 +287,13 @@ func (s *Scheduler) processPending(ctx context.Context) {
 							break
 						}
 						runnerToExpire = s.findRunnerToUnload()
+						if runnerToExpire == nil {
+							// every loaded model is pinned so load what
+							// fits alongside them instead
+							slog.Debug("loaded models are pinned, loading new model in the remaining space", "model", pending.model.ModelPath)
+							s.loadFn(pending, ggml, pickBestPartialFitByLibrary(pending, ggml, availGpus, &numParallel), numParallel)
+							break
+						}
 					}
 				}
 
@@ -442,6 +465,9 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, gpus discover.GpuInfoLis
 		loading:         true,
 		refCount:        1,
 	}
+	if p, ok := s.policy(req.model.ModelPath); ok {
+		runner.pinned = p.Pin
+	}
 	runner.numParallel = numParallel
 	runner.refMu.Lock()
 
@@ -472,13 +498,18 @@ func (s *Scheduler) load(req *LlmRequest, f *ggml.GGML, gpus discover.GpuInfoLis
 }
 
 func (s *Scheduler) updateFreeSpace(allGpus discover.GpuInfoList) {
+	updateFreeSpace(allGpus, s.loadedRunners())
+}
+
+// updateFreeSpace lowers the free memory of allGpus to account for the
+// predicted usage of runners
+func updateFreeSpace(allGpus discover.GpuInfoList, runners []*runnerRef) {
 	type predKey struct {
 		Library string
 		ID      string
 	}
 	predMap := map[predKey]uint64{} // Sum up the total predicted usage per GPU for all runners
-	s.loadedMu.Lock()
-	for _, r := range s.loaded {
+	for _, r := range runners {
 		r.refMu.Lock()
 		if r.llama != nil {
 			for _, gpu := range allGpus {
@@ -489,7 +520,6 @@ func (s *Scheduler) updateFreeSpace(allGpus discover.GpuInfoList) {
 		}
 		r.refMu.Unlock()
 	}
-	s.loadedMu.Unlock()
 
 	// Now that we've summed up all the GPU usage predictions across all the loaded runners, update the gpu list
 	for i := range allGpus {
@@ -551,6 +581,9 @@ type runnerRef struct {
 	expireTimer     *time.Timer
 	expiresAt       time.Time
 
+	// pinned runners are never unloaded to make room for other runners
+	pinned bool
+
 	model       *Model
 	modelPath   string
 	numParallel int
@@ -711,7 +744,7 @@ func pickBestFullFitByLibrary(req *LlmRequest, f *ggml.GGML, gpus discover.GpuIn
 			req.opts.NumCtx = req.origNumCtx * p
 			if !envconfig.SchedSpread() {
 				for _, g := range sgl {
-					if ok, estimatedVRAM = llm.PredictServerFit([]discover.GpuInfo{g}, f, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
+					if ok, estimatedVRAM = llm.PredictServerFit([]discover.GpuInfo{g}, f, req.model.ModelPath, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
 						slog.Info("new model will fit in available VRAM in single GPU, loading", "model", req.model.ModelPath, "gpu", g.ID, "parallel", p, "available", g.FreeMemory, "required", format.HumanBytes2(estimatedVRAM))
 						*numParallel = p
 						return []discover.GpuInfo{g}
@@ -727,7 +760,7 @@ func pickBestFullFitByLibrary(req *LlmRequest, f *ggml.GGML, gpus discover.GpuIn
 		// Now try all the GPUs
 		for _, p := range numParallelToTry {
 			req.opts.NumCtx = req.origNumCtx * p
-			if ok, estimatedVRAM = llm.PredictServerFit(sgl, f, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
+			if ok, estimatedVRAM = llm.PredictServerFit(sgl, f, req.model.ModelPath, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts); ok {
 				slog.Info("new model will fit in available VRAM, loading", "model", req.model.ModelPath, "library", sgl[0].Library, "parallel", p, "required", format.HumanBytes2(estimatedVRAM))
 				*numParallel = p
 				return sgl
@@ -750,7 +783,7 @@ func pickBestPartialFitByLibrary(req *LlmRequest, f *ggml.GGML, gpus discover.Gp
 	var bestEstimate uint64
 	var bestFit int
 	for i, gl := range byLibrary {
-		_, estimatedVRAM := llm.PredictServerFit(gl, f, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts)
+		_, estimatedVRAM := llm.PredictServerFit(gl, f, req.model.ModelPath, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts)
 		if estimatedVRAM > bestEstimate {
 			bestEstimate = estimatedVRAM
 			bestFit = i
@@ -759,14 +792,24 @@ func pickBestPartialFitByLibrary(req *LlmRequest, f *ggml.GGML, gpus discover.Gp
 	return byLibrary[bestFit]
 }
 
-// findRunnerToUnload finds a runner to unload to make room for a new model
+// findRunnerToUnload finds a runner to unload to make room for a new model.
+// It returns nil if every loaded runner is pinned.
 func (s *Scheduler) findRunnerToUnload() *runnerRef {
-	s.loadedMu.Lock()
-	runnerList := make([]*runnerRef, 0, len(s.loaded))
-	for _, r := range s.loaded {
-		runnerList = append(runnerList, r)
+	var runnerList []*runnerRef
+	for _, runner := range s.loadedRunners() {
+		runner.refMu.Lock()
+		pinned := runner.pinned
+		runner.refMu.Unlock()
+		if !pinned {
+			runnerList = append(runnerList, runner)
+		}
 	}
-	s.loadedMu.Unlock()
+
+	return runnerToUnload(runnerList)
+}
+
+// runnerToUnload picks which of runnerList to unload next
+func runnerToUnload(runnerList []*runnerRef) *runnerRef {
 	if len(runnerList) == 0 {
 		slog.Debug("no loaded runner to unload")
 		return nil
@@ -791,6 +834,17 @@ func (s *Scheduler) findRunnerToUnload() *runnerRef {
 	return runnerList[0]
 }
 
+// loadedRunners returns a snapshot of the loaded runners
+func (s *Scheduler) loadedRunners() []*runnerRef {
+	s.loadedMu.Lock()
+	defer s.loadedMu.Unlock()
+	runnerList := make([]*runnerRef, 0, len(s.loaded))
+	for _, r := range s.loaded {
+		runnerList = append(runnerList, r)
+	}
+	return runnerList
+}
+
 func (s *Scheduler) unloadAllRunners() {
 	s.loadedMu.Lock()
 	defer s.loadedMu.Unlock()
@@ -808,6 +862,11 @@ func (s *Scheduler) expireRunner(model *Model) {
 	runner, ok := s.loaded[model.ModelPath]
 	if ok {
 		runner.refMu.Lock()
+		if runner.pinned {
+			slog.Debug("not unloading pinned model", "modelPath", runner.modelPath)
+			runner.refMu.Unlock()
+			return
+		}
 		runner.expiresAt = time.Now()
 		if runner.expireTimer != nil {
 			runner.expireTimer.Stop()
@@ -821,11 +880,49 @@ func (s *Scheduler) expireRunner(model *Model) {
 	}
 }
 
+// policy returns the lifecycle policy of the model at modelPath
+func (s *Scheduler) policy(modelPath string) (ModelPolicy, bool) {
+	s.policiesMu.Lock()
+	defer s.policiesMu.Unlock()
+	p, ok := s.policies[modelPath]
+	return p, ok
+}
+
+// setPolicies replaces the lifecycle policies of models and applies them to
+// the loaded runners
+func (s *Scheduler) setPolicies(policies map[string]ModelPolicy) {
+	s.policiesMu.Lock()
+	s.policies = policies
+	s.policiesMu.Unlock()
+
+	for _, runner := range s.loadedRunners() {
+		p := policies[runner.modelPath]
+
+		runner.refMu.Lock()
+		d := runner.sessionDuration
+		if runner.pinned && !p.Pin {
+			d = envconfig.KeepAlive()
+		}
+		runner.pinned = p.Pin
+
+		if d = p.keepAlive(d); d != runner.sessionDuration {
+			slog.Debug("applying policy to loaded model", "modelPath", runner.modelPath, "pinned", p.Pin, "duration", d)
+			runner.sessionDuration = d
+			if runner.expireTimer != nil {
+				// the runner is idle so restart its timer
+				runner.expireTimer.Reset(d)
+				runner.expiresAt = time.Now().Add(d)
+			}
+		}
+		runner.refMu.Unlock()
+	}
+}
+
 // If other runners are loaded, make sure the pending request will fit in system memory
 // If not, pick a runner to unload, else return nil and the request can be loaded
 func (s *Scheduler) maybeFindCPURunnerToUnload(req *LlmRequest, f *ggml.GGML, gpus discover.GpuInfoList) *runnerRef {
 	slog.Debug("evaluating if CPU model load will fit in available system memory")
-	estimate := llm.EstimateGPULayers(gpus, f, req.model.ProjectorPaths, req.opts)
+	estimate := llm.EstimateGPULayers(gpus, f, req.model.ModelPath, req.model.ProjectorPaths, req.opts)
 	if estimate.TotalSize <= gpus[0].FreeMemory {
 		slog.Debug("cpu inference mode, model fits in available system memory", "model", format.HumanBytes2(estimate.TotalSize), "available", format.HumanBytes2(gpus[0].FreeMemory))
 		return nil
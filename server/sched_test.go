@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/app/lifecycle"
 	"github.com/ollama/ollama/discover"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/fs/ggml"
 	"github.com/ollama/ollama/llm"
@@ -615,6 +619,83 @@ func TestFindRunnerToUnload(t *testing.T) {
 	require.Equal(t, r1, resp)
 }
 
+func TestFindRunnerToUnloadPinned(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer done()
+
+	r1 := &runnerRef{sessionDuration: 1, numParallel: 1, pinned: true}
+	r2 := &runnerRef{refCount: 1, sessionDuration: 2, numParallel: 1}
+
+	s := InitScheduler(ctx)
+	s.loadedMu.Lock()
+	s.loaded["a"] = r1
+	s.loaded["b"] = r2
+	s.loadedMu.Unlock()
+
+	// the idle runner is pinned so the busy one is picked
+	require.Equal(t, r2, s.findRunnerToUnload())
+
+	r2.pinned = true
+	require.Nil(t, s.findRunnerToUnload())
+}
+
+func TestPolicies(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer done()
+
+	s := InitScheduler(ctx)
+
+	idle := time.AfterFunc(time.Hour, func() {})
+	defer idle.Stop()
+
+	pinned := &runnerRef{modelPath: "pinned", sessionDuration: 5 * time.Minute, expireTimer: idle}
+	capped := &runnerRef{modelPath: "capped", sessionDuration: time.Hour}
+	unpinned := &runnerRef{modelPath: "unpinned", sessionDuration: time.Duration(math.MaxInt64), pinned: true}
+	s.loadedMu.Lock()
+	s.loaded["pinned"] = pinned
+	s.loaded["capped"] = capped
+	s.loaded["unpinned"] = unpinned
+	s.loadedMu.Unlock()
+
+	s.setPolicies(map[string]ModelPolicy{
+		"pinned": {Model: "pinned", Pin: true},
+		"capped": {Model: "capped", MaxIdle: &api.Duration{Duration: time.Minute}},
+	})
+
+	require.True(t, pinned.pinned)
+	require.Equal(t, time.Duration(math.MaxInt64), pinned.sessionDuration)
+	require.Equal(t, time.Minute, capped.sessionDuration)
+	require.False(t, unpinned.pinned)
+	require.Equal(t, envconfig.KeepAlive(), unpinned.sessionDuration)
+
+	cases := []struct {
+		modelPath string
+		requested *api.Duration
+		expect    time.Duration
+	}{
+		{"pinned", &api.Duration{Duration: 0}, time.Duration(math.MaxInt64)},
+		{"capped", nil, time.Minute},
+		{"capped", &api.Duration{Duration: 30 * time.Second}, 30 * time.Second},
+		{"capped", &api.Duration{Duration: time.Duration(math.MaxInt64)}, time.Minute},
+	}
+
+	for _, tt := range cases {
+		_, errCh := s.GetRunner(ctx, &Model{ModelPath: tt.modelPath}, api.DefaultOptions(), tt.requested)
+		require.Empty(t, errCh)
+
+		req := <-s.pendingReqCh
+		require.Equal(t, tt.expect, req.sessionDuration.Duration, tt.modelPath)
+	}
+
+	_, errCh := s.GetRunner(ctx, &Model{ModelPath: "other"}, api.DefaultOptions(), nil)
+	require.Empty(t, errCh)
+	require.Nil(t, (<-s.pendingReqCh).sessionDuration)
+
+	// pinned runners ignore requests to unload them
+	s.expireRunner(&Model{ModelPath: "pinned"})
+	require.Empty(t, s.expiredCh)
+}
+
 func TestNeedsReload(t *testing.T) {
 	ctx, done := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer done()
@@ -750,6 +831,96 @@ func TestHomogeneousGPUs(t *testing.T) {
 	}
 }
 
+// closeHook is a runner that calls onClose when it's closed, so simulated
+// GPUs can release its memory
+type closeHook struct {
+	*mockLlm
+	onClose func()
+}
+
+func (r *closeHook) Close() error {
+	r.onClose()
+	return r.mockLlm.Close()
+}
+
+func TestRequestsSimulatedGPUs(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 2*time.Second)
+	defer done()
+
+	t.Setenv("OLLAMA_MAX_LOADED_MODELS", "0")
+	t.Setenv("OLLAMA_SCHED_SPREAD", "0")
+
+	path := filepath.Join(t.TempDir(), "gpus.json")
+	simulate := func(free0, free1 uint64) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`{
+			"cpu": {"total_memory": %[1]d, "free_memory": %[1]d},
+			"gpus": [
+				{"id": "GPU-0", "library": "cuda", "compute": "5.2", "total_memory": %[2]d, "free_memory": %[3]d},
+				{"id": "GPU-1", "library": "cuda", "compute": "5.2", "total_memory": %[2]d, "free_memory": %[4]d}
+			]
+		}`, 32*format.GibiByte, 8*format.GibiByte, free0, free1)), 0o644))
+	}
+
+	simulate(8*format.GibiByte, 4*format.GibiByte)
+	discover.SetProvider(discover.NewFakeProvider(path))
+	t.Cleanup(func() { discover.SetProvider(nil) })
+
+	// the scheduler discovers the simulated GPUs itself
+	s := InitScheduler(ctx)
+
+	var loadedOn discover.GpuInfoList
+	serve := func(srv llm.LlamaServer) func(discover.GpuInfoList, string, *ggml.GGML, []string, []string, api.Options, int) (llm.LlamaServer, error) {
+		return func(gpus discover.GpuInfoList, model string, f *ggml.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+			loadedOn = gpus
+			return srv, nil
+		}
+	}
+
+	// the first model goes to the GPU with the most free memory
+	a := newScenarioRequest(t, ctx, "ollama-model-a", 7*format.GibiByte, &api.Duration{Duration: time.Minute})
+	a.srv.estimatedVRAMByGPU = map[string]uint64{"GPU-0": 7 * format.GibiByte}
+	aSrv := &closeHook{mockLlm: a.srv, onClose: func() { simulate(8*format.GibiByte, 8*format.GibiByte) }}
+	s.newServerFn = serve(aSrv)
+	s.pendingReqCh <- a.req
+	s.Run(ctx)
+	select {
+	case resp := <-a.req.successCh:
+		require.Equal(t, aSrv, resp.llama)
+	case err := <-a.req.errCh:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	require.Len(t, loadedOn, 1)
+	require.Equal(t, "GPU-0", loadedOn[0].ID)
+
+	// once the first model and something else fill both GPUs, the second
+	// model evicts the first and, when the freed memory shows up, spreads
+	// across both GPUs
+	simulate(300*format.MebiByte, 300*format.MebiByte)
+	t.Setenv("OLLAMA_SCHED_SPREAD", "1")
+
+	b := newScenarioRequest(t, ctx, "ollama-model-b", format.GibiByte, nil)
+	s.newServerFn = serve(b.srv)
+	s.pendingReqCh <- b.req
+	a.ctxDone()
+	select {
+	case resp := <-b.req.successCh:
+		require.Equal(t, b.srv, resp.llama)
+	case err := <-b.req.errCh:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	require.True(t, a.srv.closeCalled)
+	require.Len(t, loadedOn, 2)
+
+	s.loadedMu.Lock()
+	require.Len(t, s.loaded, 1)
+	s.loadedMu.Unlock()
+}
+
 type mockLlm struct {
 	pingResp           error
 	waitResp           error
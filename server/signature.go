@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/server/internal/trust"
+)
+
+// maxSignatureSize is the largest signature read from a registry
+const maxSignatureSize = 64 << 10
+
+// pushSignature signs digest, the digest of the manifest of mp, with the
+// user's key and pushes the signature to the registry. Signatures already
+// pushed for the manifest by other keys are kept.
+func pushSignature(ctx context.Context, mp ModelPath, digest string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	fn(api.ProgressResponse{Status: "signing manifest"})
+
+	signature, err := auth.Sign(ctx, []byte(digest))
+	if err != nil {
+		return err
+	}
+
+	layer, err := NewLayer(strings.NewReader(signature), trust.MediaType)
+	if err != nil {
+		return err
+	}
+
+	sigmp := mp
+	sigmp.Tag = trust.SignatureTag(digest)
+
+	m, err := pullModelManifest(ctx, sigmp, regOpts)
+	if errors.Is(err, os.ErrNotExist) {
+		config, err := NewLayer(strings.NewReader("{}"), "application/vnd.oci.empty.v1+json")
+		if err != nil {
+			return err
+		}
+
+		if err := uploadBlob(ctx, mp, config, regOpts, fn); err != nil {
+			return err
+		}
+
+		m = &Manifest{
+			SchemaVersion: 2,
+			MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+			Config:        config,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for _, l := range m.Layers {
+		if l.Digest == layer.Digest {
+			// already signed with this key
+			return nil
+		}
+	}
+
+	if err := uploadBlob(ctx, mp, layer, regOpts, fn); err != nil {
+		return err
+	}
+
+	m.Layers = append(m.Layers, layer)
+
+	fn(api.ProgressResponse{Status: "pushing signature"})
+	bts, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	requestURL := sigmp.BaseURL().JoinPath("v2", sigmp.GetNamespaceRepository(), "manifests", sigmp.Tag)
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", m.MediaType)
+	resp, err := makeRequestWithRetry(ctx, http.MethodPut, requestURL, headers, bytes.NewReader(bts), regOpts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// pullSignatures returns the signatures of digest, the digest of the
+// manifest of mp, from the registry.
+func pullSignatures(ctx context.Context, mp ModelPath, digest string, regOpts *registryOptions) ([]string, error) {
+	sigmp := mp
+	sigmp.Tag = trust.SignatureTag(digest)
+
+	m, err := pullModelManifest(ctx, sigmp, regOpts)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var signatures []string
+	for _, layer := range m.Layers {
+		if layer.MediaType != trust.MediaType {
+			continue
+		}
+
+		requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "blobs", layer.Digest)
+		resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, regOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		bts, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if d := fmt.Sprintf("sha256:%x", sha256.Sum256(bts)); d != layer.Digest {
+			return nil, fmt.Errorf("signature %s: %w", layer.Digest, errDigestMismatch)
+		}
+
+		signatures = append(signatures, string(bts))
+	}
+
+	return signatures, nil
+}
+
+// verifyManifest checks the manifest of name, pulled from the registry at
+// remote, is signed by a key the trust policy in OLLAMA_TRUST_POLICY trusts
+// for its namespace.
+func verifyManifest(ctx context.Context, name, remote ModelPath, m *Manifest, regOpts *registryOptions) error {
+	policy, err := trust.Read(envconfig.TrustPolicy())
+	if err != nil {
+		return err
+	}
+
+	if !policy.Enforced(name.Registry, name.Namespace) {
+		return nil
+	}
+
+	digest := "sha256:" + m.digest
+	signatures, err := pullSignatures(ctx, remote, digest, regOpts)
+	if err != nil {
+		return fmt.Errorf("pull signatures: %w", err)
+	}
+
+	return policy.Verify(name.Registry, name.Namespace, digest, signatures)
+}
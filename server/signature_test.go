@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/server/internal/testutil"
+	"github.com/ollama/ollama/server/internal/trust"
+)
+
+func writeTrustPolicy(t *testing.T, namespace string, keys ...ssh.PublicKey) {
+	t.Helper()
+
+	var authorized []string
+	for _, key := range keys {
+		authorized = append(authorized, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	}
+
+	bts, err := json.Marshal(trust.Policy{Namespaces: map[string][]string{namespace: authorized}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "trust.json")
+	if err := os.WriteFile(path, bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OLLAMA_TRUST_POLICY", path)
+}
+
+func TestPushPullSigned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	reg := &testRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		uploads:   make(map[string][]byte),
+		basic:     true,
+	}
+
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	name := host + "/library/test:latest"
+
+	auth := base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	writeRegistryConfig(t, fmt.Sprintf(`{"auths": {%q: {"auth": %q}}}`, host, auth))
+
+	var s Server
+	_, digest := createBinFile(t, nil, nil)
+	if w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: name,
+		Files: map[string]string{"test.gguf": digest},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	signatures := func() []Layer {
+		t.Helper()
+		for tag, bts := range reg.manifests {
+			if trust.IsSignatureTag(tag) {
+				var m Manifest
+				if err := json.Unmarshal(bts, &m); err != nil {
+					t.Fatal(err)
+				}
+				return m.Layers
+			}
+		}
+		return nil
+	}
+
+	fn := func(api.ProgressResponse) {}
+	first := testutil.WriteKey(t)
+	for range 2 {
+		if err := PushModel(context.Background(), name, &registryOptions{Insecure: true, Sign: true}, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if layers := signatures(); len(layers) != 1 || layers[0].MediaType != trust.MediaType {
+		t.Fatalf("expected one signature, got %v", layers)
+	}
+
+	// a signature by another key is added to the first
+	second := testutil.WriteKey(t)
+	if err := PushModel(context.Background(), name, &registryOptions{Insecure: true, Sign: true}, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if layers := signatures(); len(layers) != 2 {
+		t.Fatalf("expected two signatures, got %v", layers)
+	}
+
+	untrusted, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	untrustedKey, err := ssh.NewPublicKey(untrusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		namespace string
+		keys      []ssh.PublicKey
+		err       error
+	}{
+		{"first key", host + "/library", []ssh.PublicKey{first}, nil},
+		{"second key", host + "/library", []ssh.PublicKey{untrustedKey, second}, nil},
+		{"untrusted key", host + "/library", []ssh.PublicKey{untrustedKey}, trust.ErrUntrusted},
+		{"other namespace", host + "/other", []ssh.PublicKey{untrustedKey}, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OLLAMA_MODELS", t.TempDir())
+			writeTrustPolicy(t, tt.namespace, tt.keys...)
+
+			err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, fn)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			_, err = GetModel(name)
+			if tt.err == nil && err != nil {
+				t.Errorf("expected pulled model, got %v", err)
+			} else if tt.err != nil && err == nil {
+				t.Error("expected untrusted model not to be pulled")
+			}
+		})
+	}
+
+	// without signatures the model isn't trusted
+	for tag := range reg.manifests {
+		if trust.IsSignatureTag(tag) {
+			delete(reg.manifests, tag)
+		}
+	}
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	writeTrustPolicy(t, host+"/library", first)
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, fn); !errors.Is(err, trust.ErrUntrusted) {
+		t.Errorf("expected %v, got %v", trust.ErrUntrusted, err)
+	}
+}
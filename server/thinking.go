@@ -0,0 +1,158 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ollama/ollama/api"
+)
+
+type thinkingState int
+
+const (
+	// thinkingStart is before the response has started, waiting to see
+	// whether it opens with the start delimiter
+	thinkingStart thinkingState = iota
+	// thinkingOpened is right after the start delimiter
+	thinkingOpened
+	thinkingThinking
+	// thinkingClosed is right after the end delimiter
+	thinkingClosed
+	thinkingContent
+)
+
+// thinkingParser splits the thinking of a thinking model from the content of
+// its response as the response is streamed. Delimiters split across chunks
+// are held back until the next chunk shows whether they are complete.
+type thinkingParser struct {
+	start, end string
+	state      thinkingState
+	buf        string
+}
+
+// newThinkingParser returns a parser for the response to prompt. The
+// response starts with thinking if prompt ends with the start delimiter or
+// there is no start delimiter.
+func newThinkingParser(start, end, prompt string) *thinkingParser {
+	p := thinkingParser{start: start, end: end}
+	if start == "" || strings.HasSuffix(strings.TrimRightFunc(prompt, unicode.IsSpace), start) {
+		p.state = thinkingOpened
+	}
+
+	return &p
+}
+
+// add parses the next chunk of the response, returning the thinking and
+// content it completes.
+func (p *thinkingParser) add(s string) (thinking, content string) {
+	p.buf += s
+
+	var tb, cb strings.Builder
+	for {
+		switch p.state {
+		case thinkingStart:
+			trimmed := strings.TrimLeftFunc(p.buf, unicode.IsSpace)
+			switch {
+			case p.start != "" && strings.HasPrefix(trimmed, p.start):
+				p.buf = trimmed[len(p.start):]
+				p.state = thinkingOpened
+			case p.start != "" && strings.HasPrefix(p.start, trimmed):
+				// wait for the rest of the delimiter
+				return tb.String(), cb.String()
+			default:
+				p.state = thinkingContent
+			}
+		case thinkingOpened, thinkingClosed:
+			p.buf = strings.TrimLeftFunc(p.buf, unicode.IsSpace)
+			if p.buf == "" {
+				return tb.String(), cb.String()
+			}
+
+			p.state++
+		case thinkingThinking:
+			if i := strings.Index(p.buf, p.end); i >= 0 {
+				tb.WriteString(strings.TrimRightFunc(p.buf[:i], unicode.IsSpace))
+				p.buf = p.buf[i+len(p.end):]
+				p.state = thinkingClosed
+				continue
+			}
+
+			// hold back anything that may be the start of the end delimiter,
+			// and trailing space in case the delimiter comes next
+			n := len(p.buf) - overlap(p.buf, p.end)
+			n = len(strings.TrimRightFunc(p.buf[:n], unicode.IsSpace))
+			tb.WriteString(p.buf[:n])
+			p.buf = p.buf[n:]
+			return tb.String(), cb.String()
+		case thinkingContent:
+			cb.WriteString(p.buf)
+			p.buf = ""
+			return tb.String(), cb.String()
+		}
+	}
+}
+
+// flush returns anything held back once the response is done.
+func (p *thinkingParser) flush() (thinking, content string) {
+	buf := p.buf
+	p.buf = ""
+
+	switch p.state {
+	case thinkingThinking:
+		return strings.TrimRightFunc(buf, unicode.IsSpace), ""
+	case thinkingOpened, thinkingClosed:
+		return "", ""
+	default:
+		return "", buf
+	}
+}
+
+// overlap returns the length of the longest suffix of s that is a prefix of
+// delim.
+func overlap(s, delim string) int {
+	for n := min(len(s), len(delim)-1); n > 0; n-- {
+		if strings.HasSuffix(s, delim[:n]) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// thinkingDelimiters returns the delimiters around the thinking of m, from
+// the thinking_start and thinking_end options or else m's template.
+func thinkingDelimiters(m *Model, opts *api.Options) (start, end string) {
+	if opts.ThinkingEnd != "" {
+		return opts.ThinkingStart, opts.ThinkingEnd
+	}
+
+	return m.Template.Thinking()
+}
+
+// withThinking prepares the thinking of earlier messages for the prompt. It
+// is left out unless keep is set, in which case it is put back between the
+// delimiters ahead of the content for templates that don't render it.
+func withThinking(m *Model, msgs []api.Message, keep bool, start, end string) []api.Message {
+	if !slices.ContainsFunc(msgs, func(msg api.Message) bool { return msg.Thinking != "" }) {
+		return msgs
+	}
+
+	msgs = slices.Clone(msgs)
+	inline := keep && !m.Template.RendersThinking() && end != ""
+	for i := range msgs {
+		if msgs[i].Thinking == "" {
+			continue
+		}
+
+		if inline {
+			msgs[i].Content = start + "\n" + msgs[i].Thinking + "\n" + end + "\n\n" + msgs[i].Content
+		}
+
+		if !keep || inline {
+			msgs[i].Thinking = ""
+		}
+	}
+
+	return msgs
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/template"
+)
+
+func TestThinkingParser(t *testing.T) {
+	cases := []struct {
+		name     string
+		prompt   string
+		chunks   []string
+		thinking string
+		content  string
+	}{
+		{
+			name:     "whole",
+			chunks:   []string{"<think>\nThe user said hello.\n</think>\n\nHi!"},
+			thinking: "The user said hello.",
+			content:  "Hi!",
+		},
+		{
+			name:     "split delimiters",
+			chunks:   []string{" <th", "ink>", "The user", " said hello.</", "thi", "nk>", "\n", "\nHi!"},
+			thinking: "The user said hello.",
+			content:  "Hi!",
+		},
+		{
+			name:     "opened in prompt",
+			prompt:   "<|user|>Hello<|assistant|><think>\n",
+			chunks:   []string{"The user said hello.", "</think>", "Hi!"},
+			thinking: "The user said hello.",
+			content:  "Hi!",
+		},
+		{
+			name:    "no thinking",
+			chunks:  []string{"Hi", "! <think> is a tag."},
+			content: "Hi! <think> is a tag.",
+		},
+		{
+			name:    "partial start delimiter",
+			chunks:  []string{"<thi"},
+			content: "<thi",
+		},
+		{
+			name:     "unclosed",
+			chunks:   []string{"<think>The user said hello.</th"},
+			thinking: "The user said hello.</th",
+		},
+		{
+			name:     "empty",
+			chunks:   []string{"<think>\n\n</think>\n\n", "Hi!"},
+			thinking: "",
+			content:  "Hi!",
+		},
+		{
+			name:     "end delimiter in content",
+			chunks:   []string{"<think>Hmm</think>Use </think> to close."},
+			thinking: "Hmm",
+			content:  "Use </think> to close.",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newThinkingParser("<think>", "</think>", tt.prompt)
+
+			var thinking, content string
+			for _, chunk := range tt.chunks {
+				th, c := p.add(chunk)
+				thinking += th
+				content += c
+			}
+
+			th, c := p.flush()
+			thinking += th
+			content += c
+
+			if diff := cmp.Diff(tt.thinking, thinking); diff != "" {
+				t.Errorf("thinking mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.content, content); diff != "" {
+				t.Errorf("content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithThinking(t *testing.T) {
+	msgs := []api.Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi!", Thinking: "The user said hello."},
+		{Role: "user", Content: "How are you?"},
+	}
+
+	plain, err := template.Parse(`{{ range .Messages }}{{ .Content }}{{ end }}</think>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendering, err := template.Parse(`{{ range .Messages }}{{ .Thinking }}{{ .Content }}{{ end }}</think>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		tmpl   *template.Template
+		keep   bool
+		expect api.Message
+	}{
+		{"hidden", plain, false, api.Message{Role: "assistant", Content: "Hi!"}},
+		{"kept inline", plain, true, api.Message{Role: "assistant", Content: "<think>\nThe user said hello.\n</think>\n\nHi!"}},
+		{"kept for template", rendering, true, api.Message{Role: "assistant", Content: "Hi!", Thinking: "The user said hello."}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Model{Template: tt.tmpl}
+			start, end := thinkingDelimiters(&m, &api.Options{})
+			got := withThinking(&m, msgs, tt.keep, start, end)
+			if diff := cmp.Diff(tt.expect, got[1]); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+
+			if msgs[1].Thinking != "The user said hello." || msgs[1].Content != "Hi!" {
+				t.Errorf("messages were modified: %+v", msgs[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the TLS files are checked for changes
+const certCheckInterval = 10 * time.Second
+
+// certReloader holds the certificate the server serves HTTPS with and the
+// CAs it verifies client certificates with, if any. They're read again from
+// their files when the files change, so certificates can be rotated without
+// restarting the server.
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	// modTimes are the modification times of the files when they were
+	// last read
+	modTimes []time.Time
+}
+
+// newCertReloader returns a certReloader for the PEM certificate and key in
+// certFile and keyFile, and the PEM bundle of client CAs in caFile if it's
+// set.
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("OLLAMA_TLS_CERT and OLLAMA_TLS_KEY are both required to serve HTTPS")
+	}
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+// modified returns the modification times of the files of r
+func (r *certReloader) modified() ([]time.Time, error) {
+	var times []time.Time
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, fi.ModTime())
+	}
+	return times, nil
+}
+
+// load reads the files of r, keeping the current certificate and CAs if they
+// are invalid.
+func (r *certReloader) load() error {
+	times, err := r.modified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.certFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = times
+	return nil
+}
+
+// reloadIfChanged reads the files of r again if any of them changed since
+// they were last read. It reports whether they were read.
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	times, err := r.modified()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := !slices.EqualFunc(times, r.modTimes, time.Time.Equal)
+	r.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, r.load()
+}
+
+// watch checks the files of r for changes until done is closed.
+func (r *certReloader) watch(done <-chan struct{}) {
+	t := time.NewTicker(certCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if reloaded, err := r.reloadIfChanged(); err != nil {
+				slog.Error("failed to reload TLS certificate", "cert", r.certFile, "error", err)
+			} else if reloaded {
+				slog.Info("reloaded TLS certificate", "cert", r.certFile)
+			}
+		}
+	}
+}
+
+// config returns a TLS config that serves the current certificate of r, and
+// requires client certificates signed by its CAs if it has them.
+func (r *certReloader) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			return config, nil
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/internal/testca"
+)
+
+func TestCertReloader(t *testing.T) {
+	ca := testca.New(t)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	now := time.Now()
+	certPEM, keyPEM := ca.Issue(t, "first")
+	testca.WriteFile(t, certFile, certPEM, now)
+	testca.WriteFile(t, keyFile, keyPEM, now)
+	testca.WriteFile(t, caFile, ca.PEM(), now)
+
+	if _, err := newCertReloader(certFile, "", ""); err == nil {
+		t.Fatal("expected error without a key")
+	}
+
+	r, err := newCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srvr := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: r.config(),
+	}
+	go srvr.ServeTLS(ln, "", "")
+	defer srvr.Close()
+
+	clientCert, clientKey := ca.Issue(t, "client")
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	// get returns the common name of the server's certificate
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+
+		resp, err := client.Get("https://" + ln.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		return resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	if cn, err := get(pair); err != nil || cn != "first" {
+		t.Fatalf("got %q, %v; want first", cn, err)
+	}
+
+	// client certificates are required
+	if _, err := get(); err == nil {
+		t.Error("expected error without a client certificate")
+	}
+
+	// an unchanged certificate isn't read again
+	if reloaded, err := r.reloadIfChanged(); err != nil || reloaded {
+		t.Fatalf("reloaded = %t, %v; want false", reloaded, err)
+	}
+
+	// a rotated certificate is served to new connections
+	certPEM, keyPEM = ca.Issue(t, "second")
+	testca.WriteFile(t, certFile, certPEM, now.Add(time.Minute))
+	testca.WriteFile(t, keyFile, keyPEM, now.Add(time.Minute))
+
+	if reloaded, err := r.reloadIfChanged(); err != nil || !reloaded {
+		t.Fatalf("reloaded = %t, %v; want true", reloaded, err)
+	}
+
+	if cn, err := get(pair); err != nil || cn != "second" {
+		t.Fatalf("got %q, %v; want second", cn, err)
+	}
+
+	// an invalid certificate keeps the current one
+	testca.WriteFile(t, certFile, []byte("not a certificate"), now.Add(2*time.Minute))
+	if _, err := r.reloadIfChanged(); err == nil {
+		t.Fatal("expected error for an invalid certificate")
+	}
+
+	if cn, err := get(pair); err != nil || cn != "second" {
+		t.Fatalf("got %q, %v; want second", cn, err)
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
+)
+
+// A truncationStrategy decides which messages to leave out of a chat that
+// doesn't fit in the context window. Messages are dropped in groups so that
+// tool results are never separated from the tool calls they answer.
+type truncationStrategy interface {
+	// dropOrder returns the indexes of n groups of messages, oldest first,
+	// in the order they should be dropped. The first atLeast groups in
+	// order are dropped even if the chat would fit without them.
+	dropOrder(n int) (order []int, atLeast int)
+}
+
+// truncateOldest drops the oldest messages first.
+type truncateOldest struct{}
+
+func (truncateOldest) dropOrder(n int) ([]int, int) {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order, 0
+}
+
+// truncateKeepLast drops all but the last n messages at once. Dropping more
+// than needed keeps the start of the prompt stable for the following turns
+// so the runner can reuse its cache instead of truncating on every turn.
+type truncateKeepLast struct {
+	n int
+}
+
+func (t truncateKeepLast) dropOrder(n int) ([]int, int) {
+	order, _ := truncateOldest{}.dropOrder(n)
+	// the last message is kept outside of the droppable groups
+	return order, max(0, n-max(0, t.n-1))
+}
+
+// truncateMiddle drops messages from the middle of the chat outwards,
+// keeping the start of the chat, which often sets up the task, and the
+// latest messages.
+type truncateMiddle struct{}
+
+func (truncateMiddle) dropOrder(n int) ([]int, int) {
+	order := make([]int, 0, n)
+	for i := 0; len(order) < n; i++ {
+		if lo := n/2 - i; i > 0 && lo >= 0 {
+			order = append(order, lo)
+		}
+		if hi := n/2 + i; hi < n {
+			order = append(order, hi)
+		}
+	}
+	return order, 0
+}
+
+// truncateSummarize drops the oldest messages and replaces them with a
+// summary written by summarize.
+type truncateSummarize struct {
+	summarize summarizeFunc
+}
+
+func (truncateSummarize) dropOrder(n int) ([]int, int) {
+	return truncateOldest{}.dropOrder(n)
+}
+
+// summarizeFunc summarizes msgs in at most numPredict tokens.
+type summarizeFunc func(ctx context.Context, msgs []api.Message, numPredict int) (string, error)
+
+// summaryNumPredict is the most tokens generated for a summary, which are
+// set aside in the context window before picking the messages to drop. It is
+// capped at a quarter of the context window.
+const summaryNumPredict = 256
+
+const summarizePrompt = "Summarize the following conversation in a few sentences. Keep any facts, names, decisions and tool results that later messages may depend on. Reply with the summary only."
+
+// truncationFor returns the truncation strategy requested by t. summarize is
+// used by the "summarize" strategy.
+func truncationFor(t *api.Truncation, summarize summarizeFunc) (truncationStrategy, error) {
+	if t == nil {
+		return truncateOldest{}, nil
+	}
+
+	switch t.Strategy {
+	case "", "oldest":
+		return truncateOldest{}, nil
+	case "keep_last":
+		if t.KeepLast < 1 {
+			return nil, fmt.Errorf("keep_last must be at least 1, got %d", t.KeepLast)
+		}
+		return truncateKeepLast{n: t.KeepLast}, nil
+	case "middle":
+		return truncateMiddle{}, nil
+	case "summarize":
+		return truncateSummarize{summarize: summarize}, nil
+	default:
+		return nil, fmt.Errorf("unknown truncation strategy %q", t.Strategy)
+	}
+}
+
+// summarizeWith returns a summarizeFunc that asks the model loaded in r to
+// summarize messages using m's template.
+func summarizeWith(r llm.LlamaServer, m *Model, opts *api.Options) summarizeFunc {
+	return func(ctx context.Context, msgs []api.Message, numPredict int) (string, error) {
+		var sb strings.Builder
+		for _, msg := range msgs {
+			fmt.Fprintf(&sb, "%s: %s\n", msg.Role, msg.Content)
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&sb, "%s: called %s with %s\n", msg.Role, call.Function.Name, call.Function.Arguments.String())
+			}
+		}
+
+		var b bytes.Buffer
+		if err := m.Template.Execute(&b, template.Values{Messages: []api.Message{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: sb.String()},
+		}}); err != nil {
+			return "", err
+		}
+
+		o := *opts
+		o.NumPredict = numPredict
+
+		var summary strings.Builder
+		if err := r.Completion(ctx, llm.CompletionRequest{Prompt: b.String(), Options: &o}, func(r llm.CompletionResponse) {
+			summary.WriteString(r.Content)
+		}); err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(summary.String()), nil
+	}
+}
+
+// droppableGroups splits msgs into the groups of messages that can be
+// dropped together: an assistant message with tool calls is grouped with
+// the tool results that follow it, and other messages are on their own.
+// System messages and the group holding the last message are never dropped.
+func droppableGroups(msgs []api.Message) [][]int {
+	var groups [][]int
+	for i := 0; i < len(msgs); i++ {
+		if msgs[i].Role == "system" {
+			continue
+		}
+
+		group := []int{i}
+		if msgs[i].Role == "assistant" && len(msgs[i].ToolCalls) > 0 {
+			for i+1 < len(msgs) && msgs[i+1].Role == "tool" {
+				i++
+				group = append(group, i)
+			}
+		}
+
+		groups = append(groups, group)
+	}
+
+	if n := len(groups); n > 0 && groups[n-1][len(groups[n-1])-1] == len(msgs)-1 {
+		groups = groups[:n-1]
+	}
+
+	return groups
+}
+
+// truncate drops messages from msgs with strategy until the chat fits in
+// limit tokens. excess is how many tokens over the limit msgs are, count
+// estimates the tokens in a single message and render counts the tokens in
+// a prompt rendered from the remaining messages. It returns the remaining
+// messages along with the indexes of the dropped ones.
+func truncate(ctx context.Context, msgs []api.Message, limit, excess int, strategy truncationStrategy, count func(api.Message) (int, error), render func([]api.Message) (int, error)) ([]api.Message, []int, error) {
+	var reserve int
+	summarize, isSummarize := strategy.(truncateSummarize)
+	if isSummarize {
+		reserve = min(summaryNumPredict, limit/4)
+	}
+
+	excess += reserve
+
+	groups := droppableGroups(msgs)
+	order, atLeast := strategy.dropOrder(len(groups))
+
+	drop := make([]bool, len(msgs))
+	kept := msgs
+	for next := 0; excess > 0 && next < len(order); {
+		// the estimates leave out the template around each message so
+		// they undercount the tokens freed, which may drop a message
+		// fewer than needed but never more
+		var freed int
+		for ; next < len(order) && (next < atLeast || freed < excess); next++ {
+			for _, i := range groups[order[next]] {
+				n, err := count(msgs[i])
+				if err != nil {
+					return nil, nil, err
+				}
+
+				drop[i] = true
+				freed += n
+			}
+		}
+
+		kept = kept[:0:0]
+		for i, msg := range msgs {
+			if !drop[i] {
+				kept = append(kept, msg)
+			}
+		}
+
+		n, err := render(kept)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		excess = n - limit + reserve
+	}
+
+	var dropped []int
+	for i := range msgs {
+		if drop[i] {
+			dropped = append(dropped, i)
+		}
+	}
+
+	if isSummarize && summarize.summarize != nil && len(dropped) > 0 {
+		// summarize the latest of the dropped messages that fit in half
+		// of the context window, leaving room for the instructions
+		var budget int
+		start := len(dropped)
+		for start > 0 {
+			n, err := count(msgs[dropped[start-1]])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if budget+n > limit/2 {
+				break
+			}
+
+			budget += n
+			start--
+		}
+
+		var summarized []api.Message
+		for _, i := range dropped[start:] {
+			summarized = append(summarized, msgs[i])
+		}
+
+		if len(summarized) > 0 {
+			summary, err := summarize.summarize(ctx, summarized, reserve)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			withSummary := slices.Clone(kept)
+			summary = "Summary of the earlier conversation:\n" + summary
+			if len(withSummary) > 0 && withSummary[0].Role == "system" {
+				withSummary[0].Content += "\n\n" + summary
+			} else {
+				withSummary = append([]api.Message{{Role: "system", Content: summary}}, withSummary...)
+			}
+
+			if n, err := render(withSummary); err != nil {
+				return nil, nil, err
+			} else if n <= limit {
+				kept = withSummary
+			} else {
+				slog.Debug("summary of truncated messages exceeds context length", "length", n, "limit", limit)
+			}
+		}
+	}
+
+	return kept, dropped, nil
+}
+
+// maxTokenCounts is the most message token counts kept in messageTokens
+const maxTokenCounts = 1 << 16
+
+// tokenCounts caches the number of tokens in messages by model so the
+// history of a chat is tokenized once instead of on every turn.
+type tokenCounts struct {
+	mu     sync.Mutex
+	counts map[[sha256.Size]byte]int
+}
+
+var messageTokens = tokenCounts{counts: make(map[[sha256.Size]byte]int)}
+
+// count returns the number of tokens in the content and tool calls of msg,
+// not counting images or the template around it.
+func (c *tokenCounts) count(ctx context.Context, m *Model, tokenize tokenizeFunc, msg api.Message) (int, error) {
+	text := msg.Content
+	if len(msg.ToolCalls) > 0 {
+		bts, err := json.Marshal(msg.ToolCalls)
+		if err != nil {
+			return 0, err
+		}
+		text += string(bts)
+	}
+
+	h := sha256.New()
+	io.WriteString(h, m.ModelPath)
+	h.Write([]byte{0})
+	io.WriteString(h, text)
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	c.mu.Lock()
+	n, ok := c.counts[key]
+	c.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	tokens, err := tokenize(ctx, text)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.counts) >= maxTokenCounts {
+		// map iteration order is random so this evicts a random count
+		for k := range c.counts {
+			delete(c.counts, k)
+			break
+		}
+	}
+	c.counts[key] = len(tokens)
+
+	return len(tokens), nil
+}
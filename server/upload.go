@@ -112,7 +112,8 @@ func (b *blobUpload) Prepare(ctx context.Context, requestURL *url.URL, opts *reg
 		slog.Info(fmt.Sprintf("uploading %s in %d %s part(s)", b.Digest[7:19], len(b.Parts), format.HumanBytes(b.Parts[0].Size)))
 	}
 
-	requestURL, err = url.Parse(location)
+	// registries may return a location relative to the request
+	requestURL, err = requestURL.Parse(location)
 	if err != nil {
 		return err
 	}
@@ -240,7 +241,7 @@ func (b *blobUpload) uploadPart(ctx context.Context, method string, requestURL *
 		location = resp.Header.Get("Location")
 	}
 
-	nextURL, err := url.Parse(location)
+	nextURL, err := requestURL.Parse(location)
 	if err != nil {
 		w.Rollback()
 		return err
@@ -278,13 +279,10 @@ func (b *blobUpload) uploadPart(ctx context.Context, method string, requestURL *
 
 	case resp.StatusCode == http.StatusUnauthorized:
 		w.Rollback()
-		challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-		token, err := getAuthorizationToken(ctx, challenge)
-		if err != nil {
+		if err := authenticate(ctx, resp.Header.Get("www-authenticate"), requestURL.Host, opts); err != nil {
 			return err
 		}
 
-		opts.Token = token
 		fallthrough
 	case resp.StatusCode >= http.StatusBadRequest:
 		w.Rollback()
@@ -0,0 +1,542 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errUsageQuota    = errors.New("monthly token quota exceeded")
+	errUsageIdentity = errors.New("usage quotas are set, so requests must be made with an API key or identify their user")
+)
+
+// usageSaveInterval is how often the usage ledger is saved
+const usageSaveInterval = 10 * time.Second
+
+// UsageQuotas are the monthly token quotas of users. They're read from the
+// JSON file named by OLLAMA_USAGE_QUOTAS when the server starts and again on
+// SIGHUP. Quotas count the prompt and generated tokens of a calendar month in
+// UTC.
+type UsageQuotas struct {
+	// Default is the quota of users not in Identities. Zero is unlimited.
+	Default int64 `json:"default,omitempty"`
+
+	// Identities are the quotas of users, by identity. Zero is unlimited.
+	Identities map[string]int64 `json:"identities,omitempty"`
+}
+
+// readUsageQuotas reads the quotas in the file at path.
+func readUsageQuotas(path string) (*UsageQuotas, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+
+	var q UsageQuotas
+	if err := d.Decode(&q); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if q.Default < 0 {
+		return nil, fmt.Errorf("%s: default quota cannot be negative", path)
+	}
+
+	for identity, quota := range q.Identities {
+		switch {
+		case identity == "":
+			return nil, fmt.Errorf("%s: identity is required", path)
+		case quota < 0:
+			return nil, fmt.Errorf("%s: %s: quota cannot be negative", path, identity)
+		}
+	}
+
+	return &q, nil
+}
+
+func usageDir() string {
+	return filepath.Join(envconfig.Models(), "usage")
+}
+
+// usageLedger records the tokens and GPU time used by each user, model and
+// day. Each month is kept in a file in dir, such as 2025-01.json. A nil
+// ledger records nothing and has no quotas.
+type usageLedger struct {
+	dir string
+
+	mu     sync.Mutex
+	months map[string]*usageMonth
+	quotas *UsageQuotas
+}
+
+func newUsageLedger(dir string) *usageLedger {
+	return &usageLedger{dir: dir, months: make(map[string]*usageMonth)}
+}
+
+type usageKey struct {
+	identity, day, model string
+}
+
+// usageMonth is the usage of a single month
+type usageMonth struct {
+	records map[usageKey]*api.UsageRecord
+
+	// tokens are the prompt and generated tokens of each identity
+	tokens map[string]int64
+
+	// dirty is set if the month changed since it was last saved
+	dirty bool
+}
+
+func (u *usageMonth) add(r api.UsageRecord) {
+	k := usageKey{r.Identity, r.Day, r.Model}
+	rec, ok := u.records[k]
+	if !ok {
+		rec = &api.UsageRecord{Identity: r.Identity, Day: r.Day, Model: r.Model}
+		u.records[k] = rec
+	}
+
+	rec.Requests += r.Requests
+	rec.PromptTokens += r.PromptTokens
+	rec.EvalTokens += r.EvalTokens
+	rec.GPUSeconds += r.GPUSeconds
+
+	u.tokens[r.Identity] += r.PromptTokens + r.EvalTokens
+}
+
+func (l *usageLedger) path(month string) string {
+	return filepath.Join(l.dir, month+".json")
+}
+
+// month returns the usage of month, as YYYY-MM, reading it from its file if
+// it isn't loaded. l.mu must be held.
+func (l *usageLedger) month(month string) (*usageMonth, error) {
+	if u, ok := l.months[month]; ok {
+		return u, nil
+	}
+
+	u := &usageMonth{
+		records: make(map[usageKey]*api.UsageRecord),
+		tokens:  make(map[string]int64),
+	}
+
+	bts, err := os.ReadFile(l.path(month))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		var records []api.UsageRecord
+		if err := json.Unmarshal(bts, &records); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.path(month), err)
+		}
+
+		for _, r := range records {
+			u.add(r)
+		}
+	}
+
+	l.months[month] = u
+	return u, nil
+}
+
+// record adds a request by identity to model at now to the ledger. Requests
+// without an identity aren't recorded.
+func (l *usageLedger) record(identity, model string, m api.Metrics, gpuSeconds float64, now time.Time) {
+	if l == nil || identity == "" {
+		return
+	}
+
+	now = now.UTC()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u, err := l.month(now.Format("2006-01"))
+	if err != nil {
+		slog.Warn("couldn't record usage", "identity", identity, "model", model, "error", err)
+		return
+	}
+
+	u.add(api.UsageRecord{
+		Identity:     identity,
+		Day:          now.Format(time.DateOnly),
+		Model:        model,
+		Requests:     1,
+		PromptTokens: int64(m.PromptEvalCount),
+		EvalTokens:   int64(m.EvalCount),
+		GPUSeconds:   gpuSeconds,
+	})
+	u.dirty = true
+}
+
+// save writes the months that changed since they were last saved. Months
+// before the current one are forgotten once they're saved, and read again if
+// they're queried.
+func (l *usageLedger) save() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := time.Now().UTC().Format("2006-01")
+
+	var errs []error
+	for month, u := range l.months {
+		if u.dirty {
+			if err := l.write(month, u); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			u.dirty = false
+		}
+
+		if month != current {
+			delete(l.months, month)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *usageLedger) write(month string, u *usageMonth) error {
+	records := make([]api.UsageRecord, 0, len(u.records))
+	for _, r := range u.records {
+		records = append(records, *r)
+	}
+	slices.SortFunc(records, compareUsage)
+
+	bts, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+
+	path := l.path(month)
+	if err := os.WriteFile(path+".tmp", bts, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func compareUsage(a, b api.UsageRecord) int {
+	return cmp.Or(
+		strings.Compare(a.Day, b.Day),
+		strings.Compare(a.Identity, b.Identity),
+		strings.Compare(a.Model, b.Model),
+	)
+}
+
+// query returns the usage of identity, or of every user if identity is
+// empty, from the day of from to the day of to.
+func (l *usageLedger) query(identity string, from, to time.Time) ([]api.UsageRecord, error) {
+	records := []api.UsageRecord{}
+	if l == nil {
+		return records, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	months, err := l.monthsBetween(from.Format("2006-01"), to.Format("2006-01"))
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	for _, month := range months {
+		u, err := l.month(month)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range u.records {
+			if identity != "" && r.Identity != identity {
+				continue
+			}
+
+			if r.Day < first || r.Day > last {
+				continue
+			}
+
+			records = append(records, *r)
+		}
+	}
+
+	slices.SortFunc(records, compareUsage)
+	return records, nil
+}
+
+// monthsBetween returns the months from first to last, as YYYY-MM, that have
+// usage, so that a query doesn't read every month of a long range. l.mu must
+// be held.
+func (l *usageLedger) monthsBetween(first, last string) ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var months []string
+	for _, entry := range entries {
+		if month, ok := strings.CutSuffix(entry.Name(), ".json"); ok && month >= first && month <= last {
+			months = append(months, month)
+		}
+	}
+
+	for month := range l.months {
+		if month >= first && month <= last && !slices.Contains(months, month) {
+			months = append(months, month)
+		}
+	}
+
+	slices.Sort(months)
+	return months, nil
+}
+
+// loadQuotas reads the quotas in the file at path and replaces the quotas in
+// use, keeping the current quotas if the file is invalid.
+func (l *usageLedger) loadQuotas(path string) error {
+	q, err := readUsageQuotas(path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.quotas = q
+	return nil
+}
+
+// quota returns the monthly token quota of identity, or zero if it doesn't
+// have one. l.mu must be held.
+func (l *usageLedger) quota(identity string) int64 {
+	if l.quotas == nil {
+		return 0
+	}
+
+	if q, ok := l.quotas.Identities[identity]; ok {
+		return q
+	}
+	return l.quotas.Default
+}
+
+// checkQuota returns [errUsageQuota] if identity has used its token quota for
+// the month of now. Requests without an identity can't be counted, so they
+// return [errUsageIdentity] if there's a default quota.
+func (l *usageLedger) checkQuota(identity string, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if identity == "" {
+		if l.quotas != nil && l.quotas.Default > 0 {
+			return errUsageIdentity
+		}
+		return nil
+	}
+
+	quota := l.quota(identity)
+	if quota == 0 {
+		return nil
+	}
+
+	u, err := l.month(now.UTC().Format("2006-01"))
+	if err != nil {
+		// don't turn away every request because the ledger can't be read
+		slog.Warn("couldn't check usage quota", "identity", identity, "error", err)
+		return nil
+	}
+
+	if used := u.tokens[identity]; used >= quota {
+		return fmt.Errorf("%w: %s has used %d of %d tokens", errUsageQuota, identity, used, quota)
+	}
+
+	return nil
+}
+
+// usedQuotas returns the quotas of identity, or of every user with a quota if
+// identity is empty, and the tokens they've used in the month of now.
+func (l *usageLedger) usedQuotas(identity string, now time.Time) ([]api.UsageQuota, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.quotas == nil {
+		return nil, nil
+	}
+
+	u, err := l.month(now.UTC().Format("2006-01"))
+	if err != nil {
+		return nil, err
+	}
+
+	identities := make(map[string]bool)
+	for id := range l.quotas.Identities {
+		identities[id] = true
+	}
+	for id := range u.tokens {
+		identities[id] = true
+	}
+
+	var quotas []api.UsageQuota
+	for id := range identities {
+		if identity != "" && id != identity {
+			continue
+		}
+
+		if q := l.quota(id); q > 0 {
+			quotas = append(quotas, api.UsageQuota{Identity: id, MonthlyTokens: q, Used: u.tokens[id]})
+		}
+	}
+
+	slices.SortFunc(quotas, func(a, b api.UsageQuota) int {
+		return strings.Compare(a.Identity, b.Identity)
+	})
+
+	return quotas, nil
+}
+
+// usageIdentity returns the user of c: the name of its API key, or the value
+// of the OLLAMA_USAGE_HEADER header if it has no key.
+func usageIdentity(c *gin.Context) string {
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		return v.(*apiKey).Name
+	}
+
+	if h := envconfig.UsageHeader(); h != "" {
+		return c.GetHeader(h)
+	}
+
+	return ""
+}
+
+// gpuShare returns the share of the model running in r that is loaded on
+// GPUs, to weight the time spent on requests to it.
+func gpuShare(r llm.LlamaServer) float64 {
+	total := r.EstimatedTotal()
+	if total == 0 {
+		return 0
+	}
+
+	return float64(r.EstimatedVRAM()) / float64(total)
+}
+
+// recordUsage records the tokens and GPU time used by a request to the model
+// name, of which share is loaded on GPUs, against its API key and user.
+func (s *Server) recordUsage(c *gin.Context, name model.Name, share float64, m api.Metrics) {
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		v.(*apiKey).record(m)
+	}
+
+	gpuSeconds := (m.PromptEvalDuration + m.EvalDuration).Seconds() * share
+	s.usage.record(usageIdentity(c), name.DisplayShortest(), m, gpuSeconds, time.Now())
+}
+
+// checkUsageQuota aborts c and returns false if its user has used their
+// monthly token quota.
+func (s *Server) checkUsageQuota(c *gin.Context) bool {
+	now := time.Now().UTC()
+	if err := s.usage.checkQuota(usageIdentity(c), now); errors.Is(err, errUsageIdentity) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	} else if err != nil {
+		next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		c.Header("Retry-After", fmt.Sprint(int(math.Ceil(next.Sub(now).Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) UsageHandler(c *gin.Context) {
+	var req api.UsageRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// keys without the admin scope can only see their own usage
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		if key := v.(*apiKey); key.Scope != scopeAdmin {
+			if req.Identity != "" && req.Identity != key.Name {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key %q can only see its own usage", key.Name)})
+				return
+			}
+			req.Identity = key.Name
+		}
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+
+	if req.From != "" {
+		t, err := time.Parse(time.DateOnly, req.From)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid from date %q", req.From)})
+			return
+		}
+		from = t
+	}
+
+	if req.To != "" {
+		t, err := time.Parse(time.DateOnly, req.To)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid to date %q", req.To)})
+			return
+		}
+		to = t
+	}
+
+	if to.Before(from) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "to date is before from date"})
+		return
+	}
+
+	usage, err := s.usage.query(req.Identity, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	quotas, err := s.usage.usedQuotas(req.Identity, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.UsageResponse{Usage: usage, Quotas: quotas})
+}
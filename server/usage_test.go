@@ -0,0 +1,334 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestReadUsageQuotas(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"valid", `{"default": 1000000, "identities": {"ci": 5000000, "ops": 0}}`, false},
+		{"empty", `{}`, false},
+		{"unknown key", `{"monthly": 1000000}`, true},
+		{"negative default", `{"default": -1}`, true},
+		{"negative quota", `{"identities": {"ci": -1}}`, true},
+		{"empty identity", `{"identities": {"": 1}}`, true},
+		{"invalid json", `{"identities": {`, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quotas.json")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := readUsageQuotas(path)
+			if (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestUsageLedger(t *testing.T) {
+	dir := t.TempDir()
+	l := newUsageLedger(dir)
+
+	now := time.Now().UTC()
+	lastMonth := time.Date(now.Year(), now.Month()-1, 28, 12, 0, 0, 0, time.UTC)
+
+	l.record("alice", "llama3.2", api.Metrics{PromptEvalCount: 10, EvalCount: 20}, 1.5, now)
+	l.record("alice", "llama3.2", api.Metrics{PromptEvalCount: 5, EvalCount: 5}, 0.5, now)
+	l.record("alice", "mistral", api.Metrics{PromptEvalCount: 1, EvalCount: 2}, 0, now)
+	l.record("bob", "llama3.2", api.Metrics{PromptEvalCount: 100, EvalCount: 200}, 3, lastMonth)
+
+	// requests without an identity aren't recorded
+	l.record("", "llama3.2", api.Metrics{PromptEvalCount: 100}, 0, now)
+
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the usage is read back from its files
+	l = newUsageLedger(dir)
+
+	usage, err := l.query("", lastMonth, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage) != 3 {
+		t.Fatalf("usage = %+v; want 3 records", usage)
+	}
+
+	if got := usage[0]; got.Identity != "bob" || got.Day != lastMonth.Format(time.DateOnly) || got.EvalTokens != 200 {
+		t.Errorf("usage[0] = %+v; want bob last month", got)
+	}
+
+	if got := usage[1]; got.Identity != "alice" || got.Model != "llama3.2" || got.Requests != 2 || got.PromptTokens != 15 || got.EvalTokens != 25 || got.GPUSeconds != 2 {
+		t.Errorf("usage[1] = %+v; want alice's two requests to llama3.2", got)
+	}
+
+	// a long range only reads the months with usage
+	usage, err = l.query("", time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 3 {
+		t.Errorf("usage = %+v; want 3 records", usage)
+	}
+	if len(l.months) != 2 {
+		t.Errorf("%d months loaded; want 2", len(l.months))
+	}
+
+	usage, err = l.query("alice", lastMonth, lastMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 0 {
+		t.Errorf("usage = %+v; want none", usage)
+	}
+
+	// months before the current one are forgotten once saved
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.months[lastMonth.Format("2006-01")]; ok {
+		t.Error("last month is still loaded")
+	}
+}
+
+func TestUsageQuota(t *testing.T) {
+	l := newUsageLedger(t.TempDir())
+
+	now := time.Now()
+	l.record("alice", "llama3.2", api.Metrics{PromptEvalCount: 60, EvalCount: 40}, 0, now)
+	l.record("bob", "llama3.2", api.Metrics{PromptEvalCount: 60, EvalCount: 40}, 0, now)
+	l.record("carol", "llama3.2", api.Metrics{PromptEvalCount: 60, EvalCount: 40}, 0, now)
+
+	// without quotas everyone is allowed
+	if err := l.checkQuota("alice", now); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	if err := os.WriteFile(path, []byte(`{"default": 100, "identities": {"bob": 1000, "carol": 0}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.loadQuotas(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.checkQuota("alice", now); !errors.Is(err, errUsageQuota) {
+		t.Errorf("alice: err = %v; want %v", err, errUsageQuota)
+	}
+
+	for _, identity := range []string{"bob", "carol", "dave"} {
+		if err := l.checkQuota(identity, now); err != nil {
+			t.Errorf("%s: err = %v; want nil", identity, err)
+		}
+	}
+
+	// requests without an identity would get around the default quota
+	if err := l.checkQuota("", now); !errors.Is(err, errUsageIdentity) {
+		t.Errorf("no identity: err = %v; want %v", err, errUsageIdentity)
+	}
+
+	// quotas start over each month
+	if err := l.checkQuota("alice", now.AddDate(0, 1, 0)); err != nil {
+		t.Errorf("next month: err = %v; want nil", err)
+	}
+
+	quotas, err := l.usedQuotas("", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []api.UsageQuota{
+		{Identity: "alice", MonthlyTokens: 100, Used: 100},
+		{Identity: "bob", MonthlyTokens: 1000, Used: 100},
+	}
+	if len(quotas) != len(want) || quotas[0] != want[0] || quotas[1] != want[1] {
+		t.Errorf("quotas = %+v; want %+v", quotas, want)
+	}
+}
+
+type gpuRunner struct {
+	llm.LlamaServer
+	vram, total uint64
+}
+
+func (r gpuRunner) EstimatedVRAM() uint64  { return r.vram }
+func (r gpuRunner) EstimatedTotal() uint64 { return r.total }
+
+func TestGPUShare(t *testing.T) {
+	cases := []struct {
+		vram, total uint64
+		want        float64
+	}{
+		{0, 0, 0},
+		{0, 100, 0},
+		{25, 100, 0.25},
+		{100, 100, 1},
+	}
+
+	for _, tt := range cases {
+		if got := gpuShare(gpuRunner{vram: tt.vram, total: tt.total}); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("gpuShare(%d, %d) = %v; want %v", tt.vram, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	s := Server{keys: &apiKeyring{}, usage: newUsageLedger(t.TempDir())}
+	if err := s.keys.load(writeAPIKeys(t, `{"keys": [
+		{"name": "admin", "key": "`+testAdminKey+`", "scope": "admin"},
+		{"name": "inference", "key": "`+testInferenceKey+`"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	if err := os.WriteFile(path, []byte(`{"identities": {"inference": 100}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.usage.loadQuotas(path); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s.usage.record("admin", "llama3.2", api.Metrics{PromptEvalCount: 1, EvalCount: 1}, 0, now)
+	s.usage.record("inference", "llama3.2", api.Metrics{PromptEvalCount: 60, EvalCount: 40}, 0, now)
+
+	h, err := s.GenerateRoutes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	do := func(path, key, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	usage := func(resp *http.Response) api.UsageResponse {
+		t.Helper()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+
+		var u api.UsageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	t.Run("admin", func(t *testing.T) {
+		u := usage(do("/api/usage", testAdminKey, ""))
+		if len(u.Usage) != 2 {
+			t.Errorf("usage = %+v; want both keys", u.Usage)
+		}
+		if len(u.Quotas) != 1 || u.Quotas[0].Used != 100 {
+			t.Errorf("quotas = %+v; want inference's quota", u.Quotas)
+		}
+	})
+
+	t.Run("own usage", func(t *testing.T) {
+		u := usage(do("/api/usage", testInferenceKey, ""))
+		if len(u.Usage) != 1 || u.Usage[0].Identity != "inference" {
+			t.Errorf("usage = %+v; want only inference", u.Usage)
+		}
+
+		if resp := do("/api/usage", testInferenceKey, `{"identity": "admin"}`); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusForbidden)
+		}
+	})
+
+	t.Run("dates", func(t *testing.T) {
+		u := usage(do("/api/usage", testAdminKey, `{"from": "2000-01-01", "to": "2000-01-31"}`))
+		if len(u.Usage) != 0 {
+			t.Errorf("usage = %+v; want none", u.Usage)
+		}
+
+		for _, body := range []string{`{"from": "yesterday"}`, `{"from": "2000-02-01", "to": "2000-01-01"}`} {
+			if resp := do("/api/usage", testAdminKey, body); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: status = %d; want %d", body, resp.StatusCode, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		// the quota is checked before the model is loaded
+		resp := do("/api/embed", testInferenceKey, `{"model": "missing", "input": "hi"}`)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("expected Retry-After")
+		}
+
+		if resp := do("/api/embed", testAdminKey, `{"model": "missing", "input": "hi"}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusNotFound)
+		}
+
+		// rendering a template loads the model too
+		if resp := do("/api/template/render", testInferenceKey, `{"model": "missing", "messages": []}`); resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("template: status = %d; want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+	})
+}
+
+func TestUsageIdentity(t *testing.T) {
+	t.Setenv("OLLAMA_USAGE_HEADER", "X-User")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	c.Request.Header.Set("X-User", "alice")
+
+	if got := usageIdentity(c); got != "alice" {
+		t.Errorf("identity = %q; want alice", got)
+	}
+
+	// the API key takes precedence over the header
+	c.Set(apiKeyContextKey, &apiKey{APIKey: APIKey{Name: "ci"}})
+	if got := usageIdentity(c); got != "ci" {
+		t.Errorf("identity = %q; want ci", got)
+	}
+}
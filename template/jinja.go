@@ -0,0 +1,2661 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/ollama/ollama/api"
+)
+
+// jinja is a chat template written in the subset of Jinja2 used by Hugging
+// Face chat templates (tokenizer.chat_template). Templates are sandboxed:
+// they only see the values passed to them, can't mutate them, and rendering
+// is bounded in output size, loop iterations and recursion. Strings the
+// template builds are bounded like the output and lists like loops.
+type jinja struct {
+	nodes []node
+}
+
+const (
+	jinjaMaxOutput     = 16 << 20
+	jinjaMaxIterations = 1 << 18
+	jinjaMaxDepth      = 64
+)
+
+var (
+	errJinjaOutput     = errors.New("jinja: output too large")
+	errJinjaIterations = errors.New("jinja: too many loop iterations")
+	errJinjaDepth      = errors.New("jinja: maximum recursion depth exceeded")
+
+	errBreak    = errors.New("break")
+	errContinue = errors.New("continue")
+)
+
+// undefined is the value of names and keys that don't exist. It renders as an
+// empty string and is false.
+type undefined struct {
+	name string
+}
+
+// dict is a mapping that remembers insertion order like Python's dict so
+// tojson and items() match the output of transformers
+type dict struct {
+	keys   []string
+	values map[string]any
+}
+
+func newDict() *dict {
+	return &dict{values: make(map[string]any)}
+}
+
+func (d *dict) get(k string) (any, bool) {
+	v, ok := d.values[k]
+	return v, ok
+}
+
+func (d *dict) set(k string, v any) {
+	if _, ok := d.values[k]; !ok {
+		d.keys = append(d.keys, k)
+	}
+
+	d.values[k] = v
+}
+
+// namespace is the mutable object returned by namespace()
+type namespace struct {
+	*dict
+}
+
+// function is a callable value such as a global, a macro or a bound method
+type function func(r *renderer, args []any, kwargs map[string]any) (any, error)
+
+func parseJinjaTemplate(s string) (*jinja, error) {
+	nodes, err := parseJinja(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jinja{nodes: nodes}, nil
+}
+
+// vars returns the names referenced by the template
+func (j *jinja) vars() []string {
+	set := make(map[string]struct{})
+	var walk func(any)
+	walk = func(n any) {
+		switch n := n.(type) {
+		case []node:
+			for _, c := range n {
+				walk(c)
+			}
+		case []expr:
+			for _, c := range n {
+				walk(c)
+			}
+		case *listNode:
+			walk(n.nodes)
+		case *outputNode:
+			walk(n.value)
+		case *ifNode:
+			walk(n.conds)
+			for _, b := range n.bodies {
+				walk(b)
+			}
+			walk(n.els)
+		case *forNode:
+			walk(n.iter)
+			walk(n.cond)
+			walk(n.body)
+			walk(n.els)
+		case *setNode:
+			walk(n.value)
+			walk(n.body)
+		case *macroNode:
+			walk(n.defaults)
+			walk(n.body)
+		case *nameExpr:
+			set[strings.ToLower(n.name)] = struct{}{}
+		case *getExpr:
+			walk(n.obj)
+			walk(n.key)
+		case *sliceExpr:
+			walk(n.start)
+			walk(n.stop)
+			walk(n.step)
+		case *callExpr:
+			walk(n.fn)
+			walk(n.args)
+			walk(maps.Values(n.kwargs))
+		case *filterExpr:
+			walk(n.value)
+			walk(n.args)
+			walk(maps.Values(n.kwargs))
+		case *testExpr:
+			walk(n.value)
+			walk(n.args)
+		case *binaryExpr:
+			walk(n.left)
+			walk(n.right)
+		case *logicalExpr:
+			walk(n.left)
+			walk(n.right)
+		case *notExpr:
+			walk(n.value)
+		case *negExpr:
+			walk(n.value)
+		case *condExpr:
+			walk(n.cond)
+			walk(n.then)
+			walk(n.els)
+		case *listExpr:
+			walk(n.items)
+		case *dictExpr:
+			walk(n.keys)
+			walk(n.values)
+		}
+	}
+
+	walk(j.nodes)
+	return maps.Keys(set)
+}
+
+// execute renders the template with values as global variables
+func (j *jinja) execute(w io.Writer, values map[string]any) error {
+	r := renderer{scope: &scope{vars: values}}
+	if err := r.render(j.nodes); err != nil {
+		if errors.Is(err, errBreak) || errors.Is(err, errContinue) {
+			return fmt.Errorf("jinja: %s outside of a loop", err)
+		}
+
+		return err
+	}
+
+	_, err := w.Write(r.out.Bytes())
+	return err
+}
+
+// executeJinja renders a chat template with messages, tools and
+// add_generation_prompt like transformers' apply_chat_template. If the last
+// message is from the assistant, the output is cut after its content so the
+// model continues that message.
+func (t *Template) executeJinja(w io.Writer, v Values) error {
+	_, collated := collate(v.Messages)
+
+	messages := make([]any, len(collated))
+	for i, m := range collated {
+		messages[i] = jinjaMessage(m)
+	}
+
+	var tools any
+	if len(v.Tools) > 0 {
+		var err error
+		if tools, err = jinjaValue(v.Tools); err != nil {
+			return err
+		}
+	}
+
+	last := len(collated) > 0 && collated[len(collated)-1].Role == "assistant"
+	values := map[string]any{
+		"messages":              messages,
+		"tools":                 tools,
+		"add_generation_prompt": !last,
+		"bos_token":             "",
+		"eos_token":             "",
+		"prompt":                v.Prompt,
+		"suffix":                v.Suffix,
+	}
+
+	if !last {
+		return t.jinja.execute(w, values)
+	}
+
+	var b bytes.Buffer
+	if err := t.jinja.execute(&b, values); err != nil {
+		return err
+	}
+
+	out := b.String()
+	if content := collated[len(collated)-1].Content; content != "" {
+		if i := strings.LastIndex(out, content); i >= 0 {
+			out = out[:i+len(content)]
+		}
+	}
+
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// jinjaMessage converts a message to the layout transformers expects
+func jinjaMessage(m *api.Message) *dict {
+	d := newDict()
+	d.set("role", m.Role)
+	d.set("content", m.Content)
+	if m.Thinking != "" {
+		d.set("reasoning_content", m.Thinking)
+	}
+
+	if len(m.ToolCalls) > 0 {
+		calls := make([]any, len(m.ToolCalls))
+		for i, tc := range m.ToolCalls {
+			fn := newDict()
+			fn.set("name", tc.Function.Name)
+			args, _ := jinjaValue(tc.Function.Arguments)
+			fn.set("arguments", args)
+
+			call := newDict()
+			call.set("type", "function")
+			call.set("function", fn)
+			calls[i] = call
+		}
+
+		d.set("tool_calls", calls)
+	}
+
+	return d
+}
+
+// jinjaValue converts v to template values through its JSON encoding
+func jinjaValue(v any) (any, error) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bts))
+	dec.UseNumber()
+	return decodeJSONValue(dec)
+}
+
+func decodeJSONValue(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			d := newDict()
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				d.set(k.(string), v)
+			}
+
+			_, err := dec.Token()
+			return d, err
+		case '[':
+			l := []any{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				l = append(l, v)
+			}
+
+			_, err := dec.Token()
+			return l, err
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n, nil
+		}
+
+		return t.Float64()
+	}
+
+	return t, nil
+}
+
+type scope struct {
+	vars   map[string]any
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+type renderer struct {
+	out        bytes.Buffer
+	scope      *scope
+	depth      int
+	iterations int
+}
+
+func (r *renderer) push() {
+	r.scope = &scope{vars: make(map[string]any), parent: r.scope}
+}
+
+func (r *renderer) pop() {
+	r.scope = r.scope.parent
+}
+
+func (r *renderer) write(s string) error {
+	if r.out.Len()+len(s) > jinjaMaxOutput {
+		return errJinjaOutput
+	}
+
+	r.out.WriteString(s)
+	return nil
+}
+
+// checkSize returns an error if v is a string or list larger than a template
+// may build
+func checkSize(v any) error {
+	switch v := v.(type) {
+	case string:
+		if len(v) > jinjaMaxOutput {
+			return errJinjaOutput
+		}
+	case []any:
+		if len(v) > jinjaMaxIterations {
+			return errJinjaIterations
+		}
+	}
+
+	return nil
+}
+
+// sized returns v unless it's larger than checkSize allows
+func sized(v any, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSize(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (r *renderer) render(nodes []node) error {
+	for _, n := range nodes {
+		if err := n.render(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type node interface {
+	render(*renderer) error
+}
+
+type textNode struct {
+	text string
+}
+
+func (n *textNode) render(r *renderer) error {
+	return r.write(n.text)
+}
+
+type listNode struct {
+	nodes []node
+}
+
+func (n *listNode) render(r *renderer) error {
+	return r.render(n.nodes)
+}
+
+type outputNode struct {
+	value expr
+}
+
+func (n *outputNode) render(r *renderer) error {
+	v, err := n.value.eval(r)
+	if err != nil {
+		return err
+	}
+
+	return r.write(toString(v))
+}
+
+type ifNode struct {
+	conds  []expr
+	bodies [][]node
+	els    []node
+}
+
+func (n *ifNode) render(r *renderer) error {
+	for i, cond := range n.conds {
+		v, err := cond.eval(r)
+		if err != nil {
+			return err
+		}
+
+		if truthy(v) {
+			return r.render(n.bodies[i])
+		}
+	}
+
+	return r.render(n.els)
+}
+
+type forNode struct {
+	targets []string
+	iter    expr
+	cond    expr
+	body    []node
+	els     []node
+}
+
+func (n *forNode) render(r *renderer) error {
+	v, err := n.iter.eval(r)
+	if err != nil {
+		return err
+	}
+
+	items, err := iterate(v)
+	if err != nil {
+		return err
+	}
+
+	r.push()
+	defer r.pop()
+
+	if n.cond != nil {
+		var filtered []any
+		for _, item := range items {
+			if err := n.assign(r, item); err != nil {
+				return err
+			}
+
+			ok, err := n.cond.eval(r)
+			if err != nil {
+				return err
+			}
+
+			if truthy(ok) {
+				filtered = append(filtered, item)
+			}
+		}
+
+		items = filtered
+	}
+
+	if len(items) == 0 {
+		return r.render(n.els)
+	}
+
+	for i, item := range items {
+		r.iterations++
+		if r.iterations > jinjaMaxIterations {
+			return errJinjaIterations
+		}
+
+		// each iteration has its own scope so assignments don't leak
+		r.scope.vars = make(map[string]any)
+		if err := n.assign(r, item); err != nil {
+			return err
+		}
+
+		r.scope.vars["loop"] = &loop{items: items, index: i}
+
+		if err := r.render(n.body); errors.Is(err, errBreak) {
+			break
+		} else if err != nil && !errors.Is(err, errContinue) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *forNode) assign(r *renderer, item any) error {
+	if len(n.targets) == 1 {
+		r.scope.vars[n.targets[0]] = item
+		return nil
+	}
+
+	values, err := iterate(item)
+	if err != nil {
+		return err
+	}
+
+	if len(values) != len(n.targets) {
+		return fmt.Errorf("jinja: cannot unpack %d values into %d names", len(values), len(n.targets))
+	}
+
+	for i, name := range n.targets {
+		r.scope.vars[name] = values[i]
+	}
+
+	return nil
+}
+
+// loop is the loop variable available inside for loops
+type loop struct {
+	items []any
+	index int
+}
+
+func (l *loop) get(name string) (any, bool) {
+	i, n := l.index, len(l.items)
+	switch name {
+	case "index":
+		return int64(i + 1), true
+	case "index0":
+		return int64(i), true
+	case "revindex":
+		return int64(n - i), true
+	case "revindex0":
+		return int64(n - i - 1), true
+	case "first":
+		return i == 0, true
+	case "last":
+		return i == n-1, true
+	case "length":
+		return int64(n), true
+	case "previtem":
+		if i > 0 {
+			return l.items[i-1], true
+		}
+	case "nextitem":
+		if i < n-1 {
+			return l.items[i+1], true
+		}
+	case "cycle":
+		return function(func(_ *renderer, args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("jinja: cycle requires at least one argument")
+			}
+
+			return args[i%len(args)], nil
+		}), true
+	}
+
+	return nil, false
+}
+
+type loopControlNode struct {
+	name string
+}
+
+func (n *loopControlNode) render(*renderer) error {
+	if n.name == "break" {
+		return errBreak
+	}
+
+	return errContinue
+}
+
+type setNode struct {
+	targets []string
+	attr    string
+	value   expr
+	body    []node
+}
+
+func (n *setNode) render(r *renderer) error {
+	var v any
+	if n.body != nil {
+		out := r.out
+		r.out = bytes.Buffer{}
+		err := r.render(n.body)
+		v, r.out = r.out.String(), out
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if v, err = n.value.eval(r); err != nil {
+			return err
+		}
+	}
+
+	if n.attr != "" {
+		obj, _ := r.scope.lookup(n.targets[0])
+		ns, ok := obj.(*namespace)
+		if !ok {
+			return fmt.Errorf("jinja: cannot assign attribute on %s", typeName(obj))
+		}
+
+		ns.set(n.attr, v)
+		return nil
+	}
+
+	if len(n.targets) == 1 {
+		r.scope.vars[n.targets[0]] = v
+		return nil
+	}
+
+	values, err := iterate(v)
+	if err != nil {
+		return err
+	}
+
+	if len(values) != len(n.targets) {
+		return fmt.Errorf("jinja: cannot unpack %d values into %d names", len(values), len(n.targets))
+	}
+
+	for i, name := range n.targets {
+		r.scope.vars[name] = values[i]
+	}
+
+	return nil
+}
+
+type macroNode struct {
+	name     string
+	params   []string
+	defaults []expr
+	body     []node
+}
+
+func (n *macroNode) render(r *renderer) error {
+	defining := r.scope
+	r.scope.vars[n.name] = function(func(r *renderer, args []any, kwargs map[string]any) (any, error) {
+		if len(args) > len(n.params) {
+			return nil, fmt.Errorf("jinja: macro %s takes %d arguments", n.name, len(n.params))
+		}
+
+		r.depth++
+		defer func() { r.depth-- }()
+		if r.depth > jinjaMaxDepth {
+			return nil, errJinjaDepth
+		}
+
+		caller, out := r.scope, r.out
+		r.scope, r.out = &scope{vars: make(map[string]any), parent: defining}, bytes.Buffer{}
+		defer func() { r.scope, r.out = caller, out }()
+
+		for i, name := range n.params {
+			switch v, ok := kwargs[name]; {
+			case i < len(args):
+				r.scope.vars[name] = args[i]
+			case ok:
+				r.scope.vars[name] = v
+			case n.defaults[i] != nil:
+				v, err := n.defaults[i].eval(r)
+				if err != nil {
+					return nil, err
+				}
+
+				r.scope.vars[name] = v
+			default:
+				r.scope.vars[name] = undefined{name}
+			}
+		}
+
+		if err := r.render(n.body); err != nil {
+			return nil, err
+		}
+
+		if out.Len()+r.out.Len() > jinjaMaxOutput {
+			return nil, errJinjaOutput
+		}
+
+		return r.out.String(), nil
+	})
+
+	return nil
+}
+
+type expr interface {
+	eval(*renderer) (any, error)
+}
+
+type literalExpr struct {
+	value any
+}
+
+func (e *literalExpr) eval(*renderer) (any, error) {
+	return e.value, nil
+}
+
+type nameExpr struct {
+	name string
+}
+
+func (e *nameExpr) eval(r *renderer) (any, error) {
+	if v, ok := r.scope.lookup(e.name); ok {
+		return v, nil
+	}
+
+	if fn, ok := jinjaGlobals[e.name]; ok {
+		return fn, nil
+	}
+
+	return undefined{e.name}, nil
+}
+
+type listExpr struct {
+	items []expr
+}
+
+func (e *listExpr) eval(r *renderer) (any, error) {
+	l := make([]any, len(e.items))
+	for i, item := range e.items {
+		v, err := item.eval(r)
+		if err != nil {
+			return nil, err
+		}
+
+		l[i] = v
+	}
+
+	return l, nil
+}
+
+type dictExpr struct {
+	keys, values []expr
+}
+
+func (e *dictExpr) eval(r *renderer) (any, error) {
+	d := newDict()
+	for i := range e.keys {
+		k, err := e.keys[i].eval(r)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := e.values[i].eval(r)
+		if err != nil {
+			return nil, err
+		}
+
+		d.set(toString(k), v)
+	}
+
+	return d, nil
+}
+
+type getExpr struct {
+	obj, key expr
+}
+
+func (e *getExpr) eval(r *renderer) (any, error) {
+	obj, err := e.obj.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := e.key.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := key.(*slice); ok {
+		return s.apply(obj)
+	}
+
+	return getItem(obj, key)
+}
+
+type slice struct {
+	start, stop, step any
+}
+
+type sliceExpr struct {
+	start, stop, step expr
+}
+
+func (e *sliceExpr) eval(r *renderer) (any, error) {
+	var s slice
+	for _, p := range []struct {
+		e expr
+		v *any
+	}{{e.start, &s.start}, {e.stop, &s.stop}, {e.step, &s.step}} {
+		if p.e == nil {
+			continue
+		}
+
+		v, err := p.e.eval(r)
+		if err != nil {
+			return nil, err
+		}
+
+		*p.v = v
+	}
+
+	return &s, nil
+}
+
+// apply slices a list or string with Python semantics
+func (s *slice) apply(obj any) (any, error) {
+	var n int
+	switch obj := obj.(type) {
+	case string:
+		n = len([]rune(obj))
+	case []any:
+		n = len(obj)
+	default:
+		return nil, fmt.Errorf("jinja: %s is not subscriptable", typeName(obj))
+	}
+
+	step := 1
+	if s.step != nil {
+		i, ok := toInt(s.step)
+		if !ok || i == 0 {
+			return nil, errors.New("jinja: slice step must be a non-zero integer")
+		}
+
+		step = int(i)
+	}
+
+	bound := func(v any, def int) (int, error) {
+		if v == nil {
+			return def, nil
+		}
+
+		i, ok := toInt(v)
+		if !ok {
+			return 0, errors.New("jinja: slice indices must be integers")
+		}
+
+		if i < 0 {
+			i += int64(n)
+		}
+
+		lo, hi := 0, n
+		if step < 0 {
+			lo, hi = -1, n-1
+		}
+
+		return max(lo, min(hi, int(i))), nil
+	}
+
+	start, stop := 0, n
+	if step < 0 {
+		start, stop = n-1, -1
+	}
+
+	start, err := bound(s.start, start)
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err = bound(s.stop, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	var indices []int
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		indices = append(indices, i)
+	}
+
+	switch obj := obj.(type) {
+	case string:
+		runes := []rune(obj)
+		out := make([]rune, len(indices))
+		for i, j := range indices {
+			out[i] = runes[j]
+		}
+
+		return string(out), nil
+	default:
+		l := obj.([]any)
+		out := make([]any, len(indices))
+		for i, j := range indices {
+			out[i] = l[j]
+		}
+
+		return out, nil
+	}
+}
+
+func getItem(obj, key any) (any, error) {
+	switch o := obj.(type) {
+	case *dict:
+		if k, ok := key.(string); ok {
+			if v, ok := o.get(k); ok {
+				return v, nil
+			}
+
+			if m, ok := dictMethod(o, k); ok {
+				return m, nil
+			}
+
+			return undefined{k}, nil
+		}
+	case *namespace:
+		if k, ok := key.(string); ok {
+			if v, ok := o.get(k); ok {
+				return v, nil
+			}
+
+			return undefined{k}, nil
+		}
+	case *loop:
+		if k, ok := key.(string); ok {
+			if v, ok := o.get(k); ok {
+				return v, nil
+			}
+
+			return undefined{k}, nil
+		}
+	case []any:
+		if i, ok := toInt(key); ok {
+			if i < 0 {
+				i += int64(len(o))
+			}
+
+			if i < 0 || i >= int64(len(o)) {
+				return undefined{fmt.Sprint(key)}, nil
+			}
+
+			return o[i], nil
+		}
+	case string:
+		if i, ok := toInt(key); ok {
+			runes := []rune(o)
+			if i < 0 {
+				i += int64(len(runes))
+			}
+
+			if i < 0 || i >= int64(len(runes)) {
+				return undefined{fmt.Sprint(key)}, nil
+			}
+
+			return string(runes[i]), nil
+		}
+
+		if k, ok := key.(string); ok {
+			if m, ok := stringMethod(o, k); ok {
+				return m, nil
+			}
+		}
+	case undefined:
+		return nil, fmt.Errorf("jinja: '%s' is undefined", o.name)
+	case nil:
+		return nil, fmt.Errorf("jinja: 'None' has no attribute '%s'", toString(key))
+	}
+
+	return undefined{toString(key)}, nil
+}
+
+type callExpr struct {
+	fn     expr
+	args   []expr
+	kwargs map[string]expr
+}
+
+func (e *callExpr) eval(r *renderer) (any, error) {
+	fn, err := e.fn.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := fn.(function)
+	if !ok {
+		if u, ok := fn.(undefined); ok {
+			return nil, fmt.Errorf("jinja: '%s' is undefined", u.name)
+		}
+
+		return nil, fmt.Errorf("jinja: %s is not callable", typeName(fn))
+	}
+
+	args, kwargs, err := evalArgs(r, e.args, e.kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return sized(f(r, args, kwargs))
+}
+
+func evalArgs(r *renderer, exprs []expr, kwexprs map[string]expr) ([]any, map[string]any, error) {
+	args := make([]any, len(exprs))
+	for i, e := range exprs {
+		v, err := e.eval(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		args[i] = v
+	}
+
+	kwargs := make(map[string]any, len(kwexprs))
+	for k, e := range kwexprs {
+		v, err := e.eval(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		kwargs[k] = v
+	}
+
+	return args, kwargs, nil
+}
+
+type filterExpr struct {
+	name   string
+	value  expr
+	args   []expr
+	kwargs map[string]expr
+}
+
+func (e *filterExpr) eval(r *renderer) (any, error) {
+	f, ok := jinjaFilters[e.name]
+	if !ok {
+		return nil, fmt.Errorf("jinja: unknown filter '%s'", e.name)
+	}
+
+	v, err := e.value.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	args, kwargs, err := evalArgs(r, e.args, e.kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return sized(f(r, v, args, kwargs))
+}
+
+type testExpr struct {
+	name   string
+	value  expr
+	args   []expr
+	negate bool
+}
+
+func (e *testExpr) eval(r *renderer) (any, error) {
+	t, ok := jinjaTests[e.name]
+	if !ok {
+		return nil, fmt.Errorf("jinja: unknown test '%s'", e.name)
+	}
+
+	v, err := e.value.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	args, _, err := evalArgs(r, e.args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err = t(v, args)
+	return ok != e.negate, err
+}
+
+type notExpr struct {
+	value expr
+}
+
+func (e *notExpr) eval(r *renderer) (any, error) {
+	v, err := e.value.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return !truthy(v), nil
+}
+
+type negExpr struct {
+	value expr
+}
+
+func (e *negExpr) eval(r *renderer) (any, error) {
+	v, err := e.value.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	}
+
+	return nil, fmt.Errorf("jinja: bad operand type for unary -: %s", typeName(v))
+}
+
+type condExpr struct {
+	cond, then, els expr
+}
+
+func (e *condExpr) eval(r *renderer) (any, error) {
+	v, err := e.cond.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if truthy(v) {
+		return e.then.eval(r)
+	} else if e.els != nil {
+		return e.els.eval(r)
+	}
+
+	return undefined{}, nil
+}
+
+type logicalExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *logicalExpr) eval(r *renderer) (any, error) {
+	left, err := e.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if truthy(left) == (e.op == "or") {
+		return left, nil
+	}
+
+	return e.right.eval(r)
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(r *renderer) (any, error) {
+	left, err := e.left.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.right.eval(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	case "not in":
+		ok, err := contains(right, left)
+		return !ok, err
+	case "~":
+		return sized(toString(left)+toString(right), nil)
+	case "<", ">", "<=", ">=":
+		c, err := compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		switch e.op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+
+	return sized(arithmetic(e.op, left, right))
+}
+
+func arithmetic(op string, left, right any) (any, error) {
+	switch l := left.(type) {
+	case string:
+		switch r := right.(type) {
+		case string:
+			if op == "+" {
+				return l + r, nil
+			}
+		case int64:
+			if op == "*" {
+				if r < 0 {
+					r = 0
+				}
+
+				if r > jinjaMaxOutput/int64(max(len(l), 1)) {
+					return nil, errJinjaOutput
+				}
+
+				return strings.Repeat(l, int(r)), nil
+			}
+		}
+	case []any:
+		if r, ok := right.([]any); ok && op == "+" {
+			return append(slices.Clip(l), r...), nil
+		}
+	case bool:
+		return arithmetic(op, boolToInt(l), right)
+	case int64:
+		switch r := right.(type) {
+		case bool:
+			return arithmetic(op, l, boolToInt(r))
+		case int64:
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "*":
+				return l * r, nil
+			case "/":
+				if r == 0 {
+					return nil, errors.New("jinja: division by zero")
+				}
+
+				return float64(l) / float64(r), nil
+			case "//":
+				if r == 0 {
+					return nil, errors.New("jinja: division by zero")
+				}
+
+				q := l / r
+				if (l%r != 0) && ((l < 0) != (r < 0)) {
+					q--
+				}
+
+				return q, nil
+			case "%":
+				if r == 0 {
+					return nil, errors.New("jinja: modulo by zero")
+				}
+
+				m := l % r
+				if m != 0 && ((m < 0) != (r < 0)) {
+					m += r
+				}
+
+				return m, nil
+			case "**":
+				if r >= 0 {
+					return int64(math.Pow(float64(l), float64(r))), nil
+				}
+
+				return math.Pow(float64(l), float64(r)), nil
+			}
+		case float64:
+			return arithmetic(op, float64(l), r)
+		}
+	case float64:
+		if r, ok := toFloat(right); ok {
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "*":
+				return l * r, nil
+			case "/":
+				if r == 0 {
+					return nil, errors.New("jinja: division by zero")
+				}
+
+				return l / r, nil
+			case "//":
+				if r == 0 {
+					return nil, errors.New("jinja: division by zero")
+				}
+
+				return math.Floor(l / r), nil
+			case "%":
+				if r == 0 {
+					return nil, errors.New("jinja: modulo by zero")
+				}
+
+				return l - r*math.Floor(l/r), nil
+			case "**":
+				return math.Pow(l, r), nil
+			}
+		}
+	case undefined:
+		return nil, fmt.Errorf("jinja: '%s' is undefined", l.name)
+	}
+
+	if u, ok := right.(undefined); ok {
+		return nil, fmt.Errorf("jinja: '%s' is undefined", u.name)
+	}
+
+	return nil, fmt.Errorf("jinja: unsupported operand types for %s: %s and %s", op, typeName(left), typeName(right))
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case *dict:
+		return len(v.keys) > 0
+	}
+
+	return true
+}
+
+func toInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case bool:
+		return boolToInt(v), true
+	}
+
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		return float64(boolToInt(v)), true
+	}
+
+	return 0, false
+}
+
+func equal(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+
+		return false
+	}
+
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case undefined:
+		_, ok := b.(undefined)
+		return ok
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, equal)
+	case *dict:
+		b, ok := b.(*dict)
+		if !ok || len(a.keys) != len(b.keys) {
+			return false
+		}
+
+		for k, v := range a.values {
+			if w, ok := b.values[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+
+		return true
+	case *namespace:
+		return a == b
+	}
+
+	return false
+}
+
+func compare(a, b any) (int, error) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+
+			return 0, nil
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+
+	return 0, fmt.Errorf("jinja: cannot compare %s and %s", typeName(a), typeName(b))
+}
+
+func contains(container, item any) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("jinja: 'in <string>' requires string as left operand, not %s", typeName(item))
+		}
+
+		return strings.Contains(c, s), nil
+	case []any:
+		return slices.ContainsFunc(c, func(v any) bool { return equal(v, item) }), nil
+	case *dict:
+		s, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+
+		_, ok = c.values[s]
+		return ok, nil
+	case *namespace:
+		s, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+
+		_, ok = c.values[s]
+		return ok, nil
+	case undefined:
+		return false, fmt.Errorf("jinja: '%s' is undefined", c.name)
+	}
+
+	return false, fmt.Errorf("jinja: argument of type %s is not iterable", typeName(container))
+}
+
+func iterate(v any) ([]any, error) {
+	switch v := v.(type) {
+	case []any:
+		return v, nil
+	case *dict:
+		l := make([]any, len(v.keys))
+		for i, k := range v.keys {
+			l[i] = k
+		}
+
+		return l, nil
+	case string:
+		var l []any
+		for _, r := range v {
+			l = append(l, string(r))
+		}
+
+		return l, nil
+	case undefined, nil:
+		// iterating an undefined value or none yields nothing so templates
+		// can loop over optional fields such as tool_calls
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("jinja: %s is not iterable", typeName(v))
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NoneType"
+	case undefined:
+		return "Undefined"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case *dict:
+		return "dict"
+	case *namespace:
+		return "Namespace"
+	case *loop:
+		return "LoopContext"
+	case function:
+		return "function"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// toString formats v the way Python's str does
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case undefined:
+		return ""
+	}
+
+	return repr(v)
+}
+
+// repr formats v the way Python's repr does
+func repr(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case undefined:
+		return ""
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatFloat(v)
+	case string:
+		q := "'"
+		if strings.Contains(v, "'") && !strings.Contains(v, `"`) {
+			q = `"`
+		}
+
+		var b strings.Builder
+		b.WriteString(q)
+		for _, r := range v {
+			switch {
+			case r == '\\':
+				b.WriteString(`\\`)
+			case string(r) == q:
+				b.WriteString(`\` + q)
+			case r == '\n':
+				b.WriteString(`\n`)
+			case r == '\r':
+				b.WriteString(`\r`)
+			case r == '\t':
+				b.WriteString(`\t`)
+			case !unicode.IsPrint(r):
+				fmt.Fprintf(&b, `\x%02x`, r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteString(q)
+		return b.String()
+	case []any:
+		// items may share large values, so stop once the result is too
+		// large for checkSize and let the caller reject it
+		var b strings.Builder
+		b.WriteByte('[')
+		for i, item := range v {
+			if b.Len() > jinjaMaxOutput {
+				break
+			}
+
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(repr(item))
+		}
+		b.WriteByte(']')
+		return b.String()
+	case *dict:
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, k := range v.keys {
+			if b.Len() > jinjaMaxOutput {
+				break
+			}
+
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(repr(k) + ": " + repr(v.values[k]))
+		}
+		b.WriteByte('}')
+		return b.String()
+	case *namespace:
+		return "<Namespace " + repr(v.dict) + ">"
+	case *loop:
+		return "<LoopContext " + strconv.Itoa(v.index+1) + "/" + strconv.Itoa(len(v.items)) + ">"
+	case function:
+		return "<function>"
+	}
+
+	return fmt.Sprint(v)
+}
+
+// join is strings.Join for templates, which fails rather than building a
+// string larger than checkSize allows
+func join(parts []string, sep string) (string, error) {
+	n := len(sep) * max(len(parts)-1, 0)
+	for _, p := range parts {
+		if n += len(p); n > jinjaMaxOutput {
+			return "", errJinjaOutput
+		}
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIn") {
+		s += ".0"
+	}
+
+	return s
+}
+
+// toJSON encodes v like Python's json.dumps with ensure_ascii disabled
+func toJSON(b *strings.Builder, v any, indent string, level int) error {
+	if b.Len() > jinjaMaxOutput {
+		return errJinjaOutput
+	}
+
+	newline := func(level int) error {
+		if indent != "" {
+			if len(indent) > (jinjaMaxOutput-b.Len())/max(level, 1) {
+				return errJinjaOutput
+			}
+
+			b.WriteByte('\n')
+			b.WriteString(strings.Repeat(indent, level))
+		}
+		return nil
+	}
+
+	separator := ", "
+	if indent != "" {
+		separator = ","
+	}
+
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			b.WriteString("Infinity")
+		case math.IsInf(v, -1):
+			b.WriteString("-Infinity")
+		case math.IsNaN(v):
+			b.WriteString("NaN")
+		default:
+			b.WriteString(formatFloat(v))
+		}
+	case string:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+
+		b.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	case []any:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteString(separator)
+			}
+
+			if err := newline(level + 1); err != nil {
+				return err
+			}
+
+			if err := toJSON(b, item, indent, level+1); err != nil {
+				return err
+			}
+		}
+
+		if err := newline(level); err != nil {
+			return err
+		}
+		b.WriteByte(']')
+	case *dict:
+		if len(v.keys) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+
+		b.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				b.WriteString(separator)
+			}
+
+			if err := newline(level + 1); err != nil {
+				return err
+			}
+
+			if err := toJSON(b, k, indent, level+1); err != nil {
+				return err
+			}
+
+			b.WriteString(": ")
+			if err := toJSON(b, v.values[k], indent, level+1); err != nil {
+				return err
+			}
+		}
+
+		if err := newline(level); err != nil {
+			return err
+		}
+		b.WriteByte('}')
+	case *namespace:
+		return toJSON(b, v.dict, indent, level)
+	case undefined:
+		return fmt.Errorf("jinja: '%s' is undefined", v.name)
+	default:
+		return fmt.Errorf("jinja: object of type %s is not JSON serializable", typeName(v))
+	}
+
+	return nil
+}
+
+func argument(args []any, kwargs map[string]any, i int, name string) (any, bool) {
+	if i < len(args) {
+		return args[i], true
+	}
+
+	v, ok := kwargs[name]
+	return v, ok
+}
+
+func stringArgument(args []any, kwargs map[string]any, i int, name, def string) (string, error) {
+	v, ok := argument(args, kwargs, i, name)
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("jinja: %s must be a string, not %s", name, typeName(v))
+	}
+
+	return s, nil
+}
+
+var jinjaGlobals map[string]function
+
+func init() {
+	jinjaGlobals = map[string]function{
+		"raise_exception": func(_ *renderer, args []any, _ map[string]any) (any, error) {
+			var msg string
+			if len(args) > 0 {
+				msg = toString(args[0])
+			}
+
+			return nil, fmt.Errorf("jinja: %s", msg)
+		},
+		"namespace": func(_ *renderer, args []any, kwargs map[string]any) (any, error) {
+			ns := &namespace{newDict()}
+			for _, arg := range args {
+				if d, ok := arg.(*dict); ok {
+					for _, k := range d.keys {
+						ns.set(k, d.values[k])
+					}
+				}
+			}
+
+			keys := maps.Keys(kwargs)
+			sort.Strings(keys)
+			for _, k := range keys {
+				ns.set(k, kwargs[k])
+			}
+
+			return ns, nil
+		},
+		"range": func(_ *renderer, args []any, _ map[string]any) (any, error) {
+			var bounds []int64
+			for _, arg := range args {
+				i, ok := toInt(arg)
+				if !ok {
+					return nil, fmt.Errorf("jinja: range arguments must be integers, not %s", typeName(arg))
+				}
+
+				bounds = append(bounds, i)
+			}
+
+			start, stop, step := int64(0), int64(0), int64(1)
+			switch len(bounds) {
+			case 1:
+				stop = bounds[0]
+			case 2:
+				start, stop = bounds[0], bounds[1]
+			case 3:
+				start, stop, step = bounds[0], bounds[1], bounds[2]
+			default:
+				return nil, errors.New("jinja: range expects 1 to 3 arguments")
+			}
+
+			if step == 0 {
+				return nil, errors.New("jinja: range step must not be zero")
+			}
+
+			var l []any
+			for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+				if len(l) >= jinjaMaxIterations {
+					return nil, errJinjaIterations
+				}
+
+				l = append(l, i)
+			}
+
+			return l, nil
+		},
+		"dict": func(_ *renderer, args []any, kwargs map[string]any) (any, error) {
+			d := newDict()
+			keys := maps.Keys(kwargs)
+			sort.Strings(keys)
+			for _, k := range keys {
+				d.set(k, kwargs[k])
+			}
+
+			return d, nil
+		},
+		"strftime_now": func(_ *renderer, args []any, kwargs map[string]any) (any, error) {
+			format, err := stringArgument(args, kwargs, 0, "format", "")
+			if err != nil {
+				return nil, err
+			}
+
+			return strftime(time.Now(), format), nil
+		},
+	}
+}
+
+// strftime formats t with the common C strftime directives
+func strftime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case '-':
+			if i+1 < len(format) && format[i+1] == 'd' {
+				i++
+				b.WriteString(strconv.Itoa(t.Day()))
+			} else {
+				b.WriteString("%-")
+			}
+		case 'e':
+			b.WriteString(t.Format("_2"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+
+	return b.String()
+}
+
+func method(fn func(args []any, kwargs map[string]any) (any, error)) function {
+	return func(_ *renderer, args []any, kwargs map[string]any) (any, error) {
+		return fn(args, kwargs)
+	}
+}
+
+func stringMethod(s, name string) (function, bool) {
+	strip := func(trim func(string, string) string, trimSpace func(string) string) function {
+		return method(func(args []any, kwargs map[string]any) (any, error) {
+			chars, ok := argument(args, kwargs, 0, "chars")
+			if !ok || chars == nil {
+				return trimSpace(s), nil
+			}
+
+			return trim(s, toString(chars)), nil
+		})
+	}
+
+	switch name {
+	case "strip":
+		return strip(strings.Trim, strings.TrimSpace), true
+	case "lstrip":
+		return strip(strings.TrimLeft, func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }), true
+	case "rstrip":
+		return strip(strings.TrimRight, func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }), true
+	case "upper":
+		return method(func([]any, map[string]any) (any, error) { return strings.ToUpper(s), nil }), true
+	case "lower":
+		return method(func([]any, map[string]any) (any, error) { return strings.ToLower(s), nil }), true
+	case "title":
+		return method(func([]any, map[string]any) (any, error) { return title(s), nil }), true
+	case "capitalize":
+		return method(func([]any, map[string]any) (any, error) { return capitalize(s), nil }), true
+	case "startswith", "endswith":
+		has := strings.HasPrefix
+		if name == "endswith" {
+			has = strings.HasSuffix
+		}
+
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("jinja: %s expects 1 argument", name)
+			}
+
+			prefixes := []any{args[0]}
+			if l, ok := args[0].([]any); ok {
+				prefixes = l
+			}
+
+			for _, p := range prefixes {
+				if p, ok := p.(string); ok && has(s, p) {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		}), true
+	case "split":
+		return method(func(args []any, kwargs map[string]any) (any, error) {
+			sep, err := stringArgument(args, kwargs, 0, "sep", "")
+			if err != nil {
+				return nil, err
+			}
+
+			n := -1
+			if v, ok := argument(args, kwargs, 1, "maxsplit"); ok {
+				if i, ok := toInt(v); ok && i >= 0 {
+					n = int(i) + 1
+				}
+			}
+
+			var parts []string
+			if sep == "" {
+				parts = strings.Fields(s)
+				if n > 0 && len(parts) > n {
+					// rejoin the remainder after maxsplit fields
+					rest := strings.TrimLeftFunc(s, unicode.IsSpace)
+					for range n - 1 {
+						rest = strings.TrimLeftFunc(rest[strings.IndexFunc(rest, unicode.IsSpace):], unicode.IsSpace)
+					}
+					parts = append(parts[:n-1], rest)
+				}
+			} else {
+				parts = strings.SplitN(s, sep, n)
+			}
+
+			l := make([]any, len(parts))
+			for i, p := range parts {
+				l[i] = p
+			}
+
+			return l, nil
+		}), true
+	case "replace":
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) < 2 {
+				return nil, errors.New("jinja: replace expects 2 arguments")
+			}
+
+			n := -1
+			if len(args) > 2 {
+				if i, ok := toInt(args[2]); ok {
+					n = int(i)
+				}
+			}
+
+			old, new := toString(args[0]), toString(args[1])
+			if len(new) > len(old) {
+				count := strings.Count(s, old)
+				if n >= 0 {
+					count = min(count, n)
+				}
+
+				if count > 0 && len(new)-len(old) > (jinjaMaxOutput-len(s))/count {
+					return nil, errJinjaOutput
+				}
+			}
+
+			return strings.Replace(s, old, new, n), nil
+		}), true
+	case "find":
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("jinja: find expects 1 argument")
+			}
+
+			i := strings.Index(s, toString(args[0]))
+			if i > 0 {
+				i = len([]rune(s[:i]))
+			}
+
+			return int64(i), nil
+		}), true
+	case "count":
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("jinja: count expects 1 argument")
+			}
+
+			return int64(strings.Count(s, toString(args[0]))), nil
+		}), true
+	case "join":
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("jinja: join expects 1 argument")
+			}
+
+			items, err := iterate(args[0])
+			if err != nil {
+				return nil, err
+			}
+
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = toString(item)
+			}
+
+			return join(parts, s)
+		}), true
+	}
+
+	return nil, false
+}
+
+func dictMethod(d *dict, name string) (function, bool) {
+	switch name {
+	case "items":
+		return method(func([]any, map[string]any) (any, error) {
+			l := make([]any, len(d.keys))
+			for i, k := range d.keys {
+				l[i] = []any{k, d.values[k]}
+			}
+
+			return l, nil
+		}), true
+	case "keys":
+		return method(func([]any, map[string]any) (any, error) {
+			return iterate(d)
+		}), true
+	case "values":
+		return method(func([]any, map[string]any) (any, error) {
+			l := make([]any, len(d.keys))
+			for i, k := range d.keys {
+				l[i] = d.values[k]
+			}
+
+			return l, nil
+		}), true
+	case "get":
+		return method(func(args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("jinja: get expects at least 1 argument")
+			}
+
+			if v, ok := d.values[toString(args[0])]; ok {
+				return v, nil
+			}
+
+			if len(args) > 1 {
+				return args[1], nil
+			}
+
+			return nil, nil
+		}), true
+	}
+
+	return nil, false
+}
+
+func title(s string) string {
+	var b strings.Builder
+	prev := ' '
+	for _, r := range s {
+		if unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '\'' {
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+		prev = r
+	}
+
+	return b.String()
+}
+
+func capitalize(s string) string {
+	for i, r := range s {
+		return string(unicode.ToUpper(r)) + strings.ToLower(s[i+len(string(r)):])
+	}
+
+	return s
+}
+
+type filter func(r *renderer, v any, args []any, kwargs map[string]any) (any, error)
+
+var jinjaFilters map[string]filter
+
+func init() {
+	stringFilter := func(fn func(string) string) filter {
+		return func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			return fn(toString(v)), nil
+		}
+	}
+
+	length := func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+		switch v := v.(type) {
+		case string:
+			return int64(len([]rune(v))), nil
+		case []any:
+			return int64(len(v)), nil
+		case *dict:
+			return int64(len(v.keys)), nil
+		case undefined:
+			return int64(0), nil
+		}
+
+		return nil, fmt.Errorf("jinja: object of type %s has no len()", typeName(v))
+	}
+
+	def := func(_ *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+		d, _ := argument(args, kwargs, 0, "default_value")
+		if d == nil {
+			d = ""
+		}
+
+		boolean, _ := argument(args, kwargs, 1, "boolean")
+		if _, ok := v.(undefined); ok || (truthy(boolean) && !truthy(v)) {
+			return d, nil
+		}
+
+		return v, nil
+	}
+
+	jinjaFilters = map[string]filter{
+		"trim": func(_ *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+			chars, err := stringArgument(args, kwargs, 0, "chars", "")
+			if err != nil {
+				return nil, err
+			}
+
+			if chars == "" {
+				return strings.TrimSpace(toString(v)), nil
+			}
+
+			return strings.Trim(toString(v), chars), nil
+		},
+		"upper":      stringFilter(strings.ToUpper),
+		"lower":      stringFilter(strings.ToLower),
+		"title":      stringFilter(title),
+		"capitalize": stringFilter(capitalize),
+		"string":     stringFilter(func(s string) string { return s }),
+		"safe":       stringFilter(func(s string) string { return s }),
+		"length":     length,
+		"count":      length,
+		"default":    def,
+		"d":          def,
+		"tojson": func(_ *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+			var indent string
+			if i, ok := argument(args, kwargs, 0, "indent"); ok && i != nil {
+				n, ok := toInt(i)
+				if !ok {
+					return nil, errors.New("jinja: tojson indent must be an integer")
+				}
+
+				if n > jinjaMaxOutput {
+					return nil, errJinjaOutput
+				}
+
+				indent = strings.Repeat(" ", int(max(n, 0)))
+			}
+
+			var b strings.Builder
+			if err := toJSON(&b, v, indent, 0); err != nil {
+				return nil, err
+			}
+
+			return b.String(), nil
+		},
+		"join": func(_ *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+			sep, err := stringArgument(args, kwargs, 0, "d", "")
+			if err != nil {
+				return nil, err
+			}
+
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+
+			attr, _ := argument(nil, kwargs, 0, "attribute")
+			parts := make([]string, len(items))
+			for i, item := range items {
+				if attr != nil {
+					if item, err = getItem(item, attr); err != nil {
+						return nil, err
+					}
+				}
+
+				parts[i] = toString(item)
+			}
+
+			return join(parts, sep)
+		},
+		"first": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil || len(items) == 0 {
+				return undefined{"first"}, err
+			}
+
+			return items[0], nil
+		},
+		"last": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil || len(items) == 0 {
+				return undefined{"last"}, err
+			}
+
+			return items[len(items)-1], nil
+		},
+		"list": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterate(v)
+			return slices.Clone(items), err
+		},
+		"reverse": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			if s, ok := v.(string); ok {
+				runes := []rune(s)
+				slices.Reverse(runes)
+				return string(runes), nil
+			}
+
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+
+			items = slices.Clone(items)
+			slices.Reverse(items)
+			return items, nil
+		},
+		"unique": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+
+			var unique []any
+			for _, item := range items {
+				if !slices.ContainsFunc(unique, func(u any) bool { return equal(u, item) }) {
+					unique = append(unique, item)
+				}
+			}
+
+			return unique, nil
+		},
+		"items": func(r *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			d, ok := v.(*dict)
+			if !ok {
+				return nil, fmt.Errorf("jinja: items expects a mapping, not %s", typeName(v))
+			}
+
+			m, _ := dictMethod(d, "items")
+			return m(r, nil, nil)
+		},
+		"int": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			switch v := v.(type) {
+			case float64:
+				return int64(v), nil
+			case string:
+				i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+				if err != nil {
+					return int64(0), nil
+				}
+
+				return i, nil
+			}
+
+			i, _ := toInt(v)
+			return i, nil
+		},
+		"float": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			if s, ok := v.(string); ok {
+				f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					return 0.0, nil
+				}
+
+				return f, nil
+			}
+
+			f, _ := toFloat(v)
+			return f, nil
+		},
+		"abs": func(_ *renderer, v any, _ []any, _ map[string]any) (any, error) {
+			switch v := v.(type) {
+			case int64:
+				if v < 0 {
+					return -v, nil
+				}
+
+				return v, nil
+			case float64:
+				return math.Abs(v), nil
+			}
+
+			return nil, fmt.Errorf("jinja: bad operand type for abs: %s", typeName(v))
+		},
+		"replace": func(_ *renderer, v any, args []any, _ map[string]any) (any, error) {
+			m, _ := stringMethod(toString(v), "replace")
+			return m(nil, args, nil)
+		},
+		"indent": func(_ *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+			width := "    "
+			if w, ok := argument(args, kwargs, 0, "width"); ok {
+				if n, ok := toInt(w); ok {
+					if n > jinjaMaxOutput {
+						return nil, errJinjaOutput
+					}
+
+					width = strings.Repeat(" ", int(max(n, 0)))
+				} else {
+					width = toString(w)
+				}
+			}
+
+			first, _ := argument(args, kwargs, 1, "first")
+			blank, _ := argument(args, kwargs, 2, "blank")
+
+			lines := strings.Split(toString(v), "\n")
+			if len(width) > 0 && len(lines) > (jinjaMaxOutput-len(toString(v)))/len(width) {
+				return nil, errJinjaOutput
+			}
+
+			for i, line := range lines {
+				if (i > 0 || truthy(first)) && (line != "" || truthy(blank)) {
+					lines[i] = width + line
+				}
+			}
+
+			return join(lines, "\n")
+		},
+		"map": func(r *renderer, v any, args []any, kwargs map[string]any) (any, error) {
+			items, err := iterate(v)
+			if err != nil {
+				return nil, err
+			}
+
+			out := make([]any, len(items))
+			if attr, ok := kwargs["attribute"]; ok {
+				for i, item := range items {
+					if out[i], err = getItem(item, attr); err != nil {
+						return nil, err
+					}
+
+					if _, ok := out[i].(undefined); ok {
+						if d, ok := kwargs["default"]; ok {
+							out[i] = d
+						}
+					}
+				}
+
+				return out, nil
+			}
+
+			if len(args) == 0 {
+				return nil, errors.New("jinja: map expects a filter name or attribute")
+			}
+
+			f, ok := jinjaFilters[toString(args[0])]
+			if !ok {
+				return nil, fmt.Errorf("jinja: unknown filter '%s'", toString(args[0]))
+			}
+
+			for i, item := range items {
+				if out[i], err = f(r, item, args[1:], nil); err != nil {
+					return nil, err
+				}
+			}
+
+			return out, nil
+		},
+		"select":     selectFilter(false, false),
+		"reject":     selectFilter(false, true),
+		"selectattr": selectFilter(true, false),
+		"rejectattr": selectFilter(true, true),
+	}
+}
+
+// selectFilter filters items with a test, applied to an attribute of each
+// item for selectattr and rejectattr
+func selectFilter(attr, reject bool) filter {
+	return func(_ *renderer, v any, args []any, _ map[string]any) (any, error) {
+		items, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var key any
+		if attr {
+			if len(args) == 0 {
+				return nil, errors.New("jinja: missing attribute")
+			}
+
+			key, args = args[0], args[1:]
+		}
+
+		test := jinjaTests["truthy"]
+		if len(args) > 0 {
+			name := toString(args[0])
+			var ok bool
+			if test, ok = jinjaTests[name]; !ok {
+				return nil, fmt.Errorf("jinja: unknown test '%s'", name)
+			}
+
+			args = args[1:]
+		}
+
+		var out []any
+		for _, item := range items {
+			value := item
+			if attr {
+				if value, err = getItem(item, key); err != nil {
+					return nil, err
+				}
+			}
+
+			ok, err := test(value, args)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok != reject {
+				out = append(out, item)
+			}
+		}
+
+		return out, nil
+	}
+}
+
+type test func(v any, args []any) (bool, error)
+
+var jinjaTests map[string]test
+
+func init() {
+	is := func(fn func(v any) bool) test {
+		return func(v any, _ []any) (bool, error) {
+			return fn(v), nil
+		}
+	}
+
+	compareTest := func(fn func(c int) bool) test {
+		return func(v any, args []any) (bool, error) {
+			if len(args) != 1 {
+				return false, errors.New("jinja: comparison test expects 1 argument")
+			}
+
+			c, err := compare(v, args[0])
+			return fn(c), err
+		}
+	}
+
+	eq := func(v any, args []any) (bool, error) {
+		if len(args) != 1 {
+			return false, errors.New("jinja: equalto expects 1 argument")
+		}
+
+		return equal(v, args[0]), nil
+	}
+
+	jinjaTests = map[string]test{
+		"defined":   is(func(v any) bool { _, ok := v.(undefined); return !ok }),
+		"undefined": is(func(v any) bool { _, ok := v.(undefined); return ok }),
+		"none":      is(func(v any) bool { return v == nil }),
+		"boolean":   is(func(v any) bool { _, ok := v.(bool); return ok }),
+		"true":      is(func(v any) bool { b, ok := v.(bool); return ok && b }),
+		"false":     is(func(v any) bool { b, ok := v.(bool); return ok && !b }),
+		"string":    is(func(v any) bool { _, ok := v.(string); return ok }),
+		"integer":   is(func(v any) bool { _, ok := v.(int64); return ok }),
+		"float":     is(func(v any) bool { _, ok := v.(float64); return ok }),
+		"number": is(func(v any) bool {
+			switch v.(type) {
+			case int64, float64:
+				return true
+			}
+			return false
+		}),
+		"mapping": is(func(v any) bool {
+			switch v.(type) {
+			case *dict, *namespace:
+				return true
+			}
+			return false
+		}),
+		"sequence": is(func(v any) bool {
+			switch v.(type) {
+			case []any, string, *dict:
+				return true
+			}
+			return false
+		}),
+		"iterable": is(func(v any) bool {
+			switch v.(type) {
+			case []any, string, *dict:
+				return true
+			}
+			return false
+		}),
+		"callable": is(func(v any) bool { _, ok := v.(function); return ok }),
+		"truthy":   is(truthy),
+		"odd": is(func(v any) bool {
+			i, ok := toInt(v)
+			return ok && i%2 != 0
+		}),
+		"even": is(func(v any) bool {
+			i, ok := toInt(v)
+			return ok && i%2 == 0
+		}),
+		"lower": is(func(v any) bool {
+			s, ok := v.(string)
+			return ok && s == strings.ToLower(s)
+		}),
+		"upper": is(func(v any) bool {
+			s, ok := v.(string)
+			return ok && s == strings.ToUpper(s)
+		}),
+		"equalto": eq,
+		"eq":      eq,
+		"==":      eq,
+		"ne": func(v any, args []any) (bool, error) {
+			ok, err := eq(v, args)
+			return !ok, err
+		},
+		"!=": func(v any, args []any) (bool, error) {
+			ok, err := eq(v, args)
+			return !ok, err
+		},
+		"lt":          compareTest(func(c int) bool { return c < 0 }),
+		"lessthan":    compareTest(func(c int) bool { return c < 0 }),
+		"le":          compareTest(func(c int) bool { return c <= 0 }),
+		"gt":          compareTest(func(c int) bool { return c > 0 }),
+		"greaterthan": compareTest(func(c int) bool { return c > 0 }),
+		"ge":          compareTest(func(c int) bool { return c >= 0 }),
+		"in": func(v any, args []any) (bool, error) {
+			if len(args) != 1 {
+				return false, errors.New("jinja: in expects 1 argument")
+			}
+
+			return contains(args[0], v)
+		},
+	}
+}
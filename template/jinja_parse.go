@@ -0,0 +1,1241 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// jinja templates are lexed with the same settings transformers uses for
+// chat templates: trim_blocks and lstrip_blocks are enabled so a newline
+// after a block tag is removed along with any indentation before it
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenVarBegin
+	tokenVarEnd
+	tokenBlockBegin
+	tokenBlockEnd
+	tokenName
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenOperator
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of template"
+	case tokenText:
+		return "text"
+	case tokenVarEnd, tokenBlockEnd:
+		return strconv.Quote(strings.TrimLeft(t.value, "-+"))
+	}
+
+	return strconv.Quote(t.value)
+}
+
+// operators are sorted so longer operators match first
+var operators = []string{"**", "//", "==", "!=", "<=", ">=", "+", "-", "*", "/", "%", "~", "<", ">", "(", ")", "[", "]", "{", "}", ",", ".", ":", "|", "="}
+
+type lexer struct {
+	src    string
+	pos    int
+	tokens []token
+
+	// text is the index of the last text token, which whitespace control
+	// of the following tag may trim
+	text int
+
+	// trim is set by a tag ending in a minus and trims all whitespace from
+	// the following text. newline is set by block tags for trim_blocks
+	trim, newline bool
+}
+
+func lex(src string) ([]token, error) {
+	l := lexer{src: src, text: -1}
+	for l.pos < len(l.src) {
+		i := indexTag(l.src[l.pos:])
+		if i < 0 {
+			l.emitText(l.src[l.pos:])
+			break
+		}
+
+		l.emitText(l.src[l.pos : l.pos+i])
+		l.pos += i
+
+		if err := l.tag(); err != nil {
+			return nil, err
+		}
+	}
+
+	l.tokens = append(l.tokens, token{kind: tokenEOF, pos: len(l.src)})
+	return l.tokens, nil
+}
+
+// indexTag returns the index of the next {{, {% or {# in s
+func indexTag(s string) int {
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '{' && (s[i+1] == '{' || s[i+1] == '%' || s[i+1] == '#') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *lexer) emitText(s string) {
+	if l.trim {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	} else if l.newline {
+		if strings.HasPrefix(s, "\r\n") {
+			s = s[2:]
+		} else if strings.HasPrefix(s, "\n") {
+			s = s[1:]
+		}
+	}
+
+	l.trim, l.newline = false, false
+	l.text = -1
+	if s != "" {
+		l.text = len(l.tokens)
+		l.tokens = append(l.tokens, token{kind: tokenText, value: s, pos: l.pos})
+	}
+}
+
+// stripText applies whitespace control of a tag to the text preceding it
+func (l *lexer) stripText(modifier byte, block bool) {
+	if l.text < 0 {
+		return
+	}
+
+	t := &l.tokens[l.text]
+	switch {
+	case modifier == '-':
+		t.value = strings.TrimRightFunc(t.value, unicode.IsSpace)
+	case modifier != '+' && block:
+		// lstrip_blocks only strips when the tag is the first thing on its line
+		i := strings.LastIndexByte(t.value, '\n')
+		if strings.TrimLeft(t.value[i+1:], " \t") == "" && (i >= 0 || l.text == 0) {
+			t.value = t.value[:i+1]
+		}
+	}
+
+	if t.value == "" {
+		l.tokens = l.tokens[:l.text]
+	}
+
+	l.text = -1
+}
+
+func (l *lexer) tag() error {
+	start := l.pos
+	kind := l.src[l.pos+1]
+	l.pos += 2
+
+	var modifier byte
+	if l.pos < len(l.src) && (l.src[l.pos] == '-' || l.src[l.pos] == '+') {
+		modifier = l.src[l.pos]
+		l.pos++
+	}
+
+	l.stripText(modifier, kind != '{')
+
+	if kind == '#' {
+		end := strings.Index(l.src[l.pos:], "#}")
+		if end < 0 {
+			return fmt.Errorf("unclosed comment at offset %d", start)
+		}
+
+		l.pos += end + 2
+		l.trim = end > 0 && l.src[l.pos-3] == '-'
+		l.newline = !l.trim && !(end > 0 && l.src[l.pos-3] == '+')
+		return nil
+	}
+
+	begin, end, closer := tokenVarBegin, tokenVarEnd, "}}"
+	if kind == '%' {
+		begin, end, closer = tokenBlockBegin, tokenBlockEnd, "%}"
+	}
+
+	l.tokens = append(l.tokens, token{kind: begin, pos: start})
+	for {
+		for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+			l.pos++
+		}
+
+		if l.pos >= len(l.src) {
+			return fmt.Errorf("unclosed tag at offset %d", start)
+		}
+
+		rest := l.src[l.pos:]
+		for _, prefix := range []string{"-", "+", ""} {
+			if strings.HasPrefix(rest, prefix+closer) {
+				l.tokens = append(l.tokens, token{kind: end, value: prefix + closer, pos: l.pos})
+				l.pos += len(prefix + closer)
+				l.trim = prefix == "-"
+				l.newline = kind == '%' && prefix == ""
+				return nil
+			}
+		}
+
+		if err := l.next(); err != nil {
+			return err
+		}
+	}
+}
+
+// next lexes a single token inside a tag
+func (l *lexer) next() error {
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '\'' || c == '"':
+		s, n, err := unquote(l.src[l.pos:])
+		if err != nil {
+			return fmt.Errorf("%w at offset %d", err, start)
+		}
+
+		l.pos += n
+		l.tokens = append(l.tokens, token{kind: tokenString, value: s, pos: start})
+	case c >= '0' && c <= '9':
+		kind := tokenInt
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			l.pos++
+		}
+
+		if l.pos+1 < len(l.src) && l.src[l.pos] == '.' && isDigit(l.src[l.pos+1]) {
+			kind = tokenFloat
+			l.pos++
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		}
+
+		l.tokens = append(l.tokens, token{kind: kind, value: strings.ReplaceAll(l.src[start:l.pos], "_", ""), pos: start})
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isDigit(l.src[l.pos]) || unicode.IsLetter(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+
+		l.tokens = append(l.tokens, token{kind: tokenName, value: l.src[start:l.pos], pos: start})
+	default:
+		for _, op := range operators {
+			if strings.HasPrefix(l.src[l.pos:], op) {
+				l.pos += len(op)
+				l.tokens = append(l.tokens, token{kind: tokenOperator, value: op, pos: start})
+				return nil
+			}
+		}
+
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return fmt.Errorf("unexpected character %q at offset %d", r, start)
+	}
+
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// unquote reads a quoted string literal from the start of s, returning its
+// value and length
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case '0':
+				b.WriteByte(0)
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+				if i+n >= len(s) {
+					return "", 0, errors.New("invalid escape in string")
+				}
+
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, errors.New("invalid escape in string")
+				}
+
+				b.WriteRune(rune(r))
+				i += n
+			case '\\', '\'', '"':
+				b.WriteByte(s[i])
+			case '\n':
+				// line continuation
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, errors.New("unterminated string")
+}
+
+// Quote returns s as a Jinja string literal
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if unicode.IsPrint(r) {
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, `\U%08x`, r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseJinja(s string) ([]node, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	nodes, end, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+
+	if end != "" {
+		return nil, p.errorf("unexpected '%s'", end)
+	}
+
+	return nodes, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("jinja: %s at offset %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+// is reports whether the next token is the operator or name s
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == tokenOperator || t.kind == tokenName) && t.value == s
+}
+
+func (p *parser) accept(s string) bool {
+	if p.is(s) {
+		p.advance()
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected '%s', found %s", s, p.peek())
+	}
+
+	return nil
+}
+
+func (p *parser) expectKind(kind tokenKind) (token, error) {
+	t := p.advance()
+	if t.kind != kind {
+		p.pos--
+		switch kind {
+		case tokenName:
+			return t, p.errorf("expected name, found %s", t)
+		case tokenBlockEnd:
+			return t, p.errorf("expected end of block, found %s", t)
+		case tokenVarEnd:
+			return t, p.errorf("expected end of expression, found %s", t)
+		}
+		return t, p.errorf("unexpected %s", t)
+	}
+
+	return t, nil
+}
+
+// parseBody parses nodes until an end tag such as endif, else or elif and
+// returns the name of the tag that ended it. The tag's name is consumed but
+// the rest of it is left for the caller.
+func (p *parser) parseBody(ends ...string) ([]node, string, error) {
+	var nodes []node
+	for {
+		t := p.advance()
+		switch t.kind {
+		case tokenEOF:
+			if len(ends) > 0 {
+				return nil, "", p.errorf("missing '%s'", ends[0])
+			}
+
+			return nodes, "", nil
+		case tokenText:
+			nodes = append(nodes, &textNode{t.value})
+		case tokenVarBegin:
+			e, err := p.parseExpression()
+			if err != nil {
+				return nil, "", err
+			}
+
+			if _, err := p.expectKind(tokenVarEnd); err != nil {
+				return nil, "", err
+			}
+
+			nodes = append(nodes, &outputNode{e})
+		case tokenBlockBegin:
+			name, err := p.expectKind(tokenName)
+			if err != nil {
+				return nil, "", err
+			}
+
+			for _, end := range ends {
+				if name.value == end {
+					return nodes, end, nil
+				}
+			}
+
+			n, err := p.parseStatement(name.value)
+			if err != nil {
+				return nil, "", err
+			}
+
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+		default:
+			return nil, "", p.errorf("unexpected %s", t)
+		}
+	}
+}
+
+func (p *parser) endBlock() error {
+	_, err := p.expectKind(tokenBlockEnd)
+	return err
+}
+
+func (p *parser) parseStatement(name string) (node, error) {
+	switch name {
+	case "if":
+		return p.parseIf()
+	case "for":
+		return p.parseFor()
+	case "set":
+		return p.parseSet()
+	case "macro":
+		return p.parseMacro()
+	case "break", "continue":
+		if err := p.endBlock(); err != nil {
+			return nil, err
+		}
+
+		return &loopControlNode{name}, nil
+	case "generation":
+		// transformers marks assistant output with generation blocks
+		// which have no effect on rendering
+		if err := p.endBlock(); err != nil {
+			return nil, err
+		}
+
+		body, _, err := p.parseBody("endgeneration")
+		if err != nil {
+			return nil, err
+		}
+
+		return &listNode{body}, p.endBlock()
+	case "raw":
+		if err := p.endBlock(); err != nil {
+			return nil, err
+		}
+
+		return p.parseRaw()
+	}
+
+	return nil, p.errorf("unknown tag '%s'", name)
+}
+
+func (p *parser) parseIf() (node, error) {
+	var n ifNode
+	for {
+		cond, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.endBlock(); err != nil {
+			return nil, err
+		}
+
+		body, end, err := p.parseBody("elif", "else", "endif")
+		if err != nil {
+			return nil, err
+		}
+
+		n.conds = append(n.conds, cond)
+		n.bodies = append(n.bodies, body)
+
+		switch end {
+		case "elif":
+			continue
+		case "else":
+			if err := p.endBlock(); err != nil {
+				return nil, err
+			}
+
+			n.els, _, err = p.parseBody("endif")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &n, p.endBlock()
+	}
+}
+
+func (p *parser) parseFor() (node, error) {
+	var n forNode
+	for {
+		t, err := p.expectKind(tokenName)
+		if err != nil {
+			return nil, err
+		}
+
+		n.targets = append(n.targets, t.value)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	// the filter condition can't be parsed as a conditional expression
+	n.iter, err = p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("if") {
+		if n.cond, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("recursive") {
+		return nil, p.errorf("recursive loops are not supported")
+	}
+
+	if err := p.endBlock(); err != nil {
+		return nil, err
+	}
+
+	body, end, err := p.parseBody("else", "endfor")
+	if err != nil {
+		return nil, err
+	}
+
+	n.body = body
+	if end == "else" {
+		if err := p.endBlock(); err != nil {
+			return nil, err
+		}
+
+		if n.els, _, err = p.parseBody("endfor"); err != nil {
+			return nil, err
+		}
+	}
+
+	return &n, p.endBlock()
+}
+
+func (p *parser) parseSet() (node, error) {
+	t, err := p.expectKind(tokenName)
+	if err != nil {
+		return nil, err
+	}
+
+	n := setNode{targets: []string{t.value}}
+	if p.accept(".") {
+		attr, err := p.expectKind(tokenName)
+		if err != nil {
+			return nil, err
+		}
+
+		n.attr = attr.value
+	} else {
+		for p.accept(",") {
+			t, err := p.expectKind(tokenName)
+			if err != nil {
+				return nil, err
+			}
+
+			n.targets = append(n.targets, t.value)
+		}
+	}
+
+	if p.accept("=") {
+		if n.value, err = p.parseTuple(); err != nil {
+			return nil, err
+		}
+
+		return &n, p.endBlock()
+	}
+
+	// block assignment captures the rendered body
+	if err := p.endBlock(); err != nil {
+		return nil, err
+	}
+
+	if n.body, _, err = p.parseBody("endset"); err != nil {
+		return nil, err
+	}
+
+	if n.body == nil {
+		n.body = []node{}
+	}
+
+	return &n, p.endBlock()
+}
+
+func (p *parser) parseMacro() (node, error) {
+	name, err := p.expectKind(tokenName)
+	if err != nil {
+		return nil, err
+	}
+
+	n := macroNode{name: name.value}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for !p.accept(")") {
+		if len(n.params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		param, err := p.expectKind(tokenName)
+		if err != nil {
+			return nil, err
+		}
+
+		var def expr
+		if p.accept("=") {
+			if def, err = p.parseExpression(); err != nil {
+				return nil, err
+			}
+		} else if len(n.defaults) > 0 && n.defaults[len(n.defaults)-1] != nil {
+			return nil, p.errorf("non-default argument follows default argument")
+		}
+
+		n.params = append(n.params, param.value)
+		n.defaults = append(n.defaults, def)
+	}
+
+	if err := p.endBlock(); err != nil {
+		return nil, err
+	}
+
+	if n.body, _, err = p.parseBody("endmacro"); err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokenName && p.peek().value == n.name {
+		p.advance()
+	}
+
+	return &n, p.endBlock()
+}
+
+// parseRaw joins everything up to endraw back into text
+func (p *parser) parseRaw() (node, error) {
+	var b strings.Builder
+	for {
+		t := p.advance()
+		switch t.kind {
+		case tokenEOF:
+			return nil, p.errorf("missing 'endraw'")
+		case tokenText, tokenVarEnd, tokenBlockEnd:
+			b.WriteString(t.value)
+		case tokenVarBegin:
+			b.WriteString("{{ ")
+		case tokenBlockBegin:
+			if p.peek().kind == tokenName && p.peek().value == "endraw" {
+				p.advance()
+				return &textNode{b.String()}, p.endBlock()
+			}
+
+			b.WriteString("{% ")
+		case tokenString:
+			b.WriteString(Quote(t.value) + " ")
+		default:
+			b.WriteString(t.value + " ")
+		}
+	}
+}
+
+// parseTuple parses an expression, or a tuple if it's followed by a comma
+func (p *parser) parseTuple() (expr, error) {
+	e, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.is(",") {
+		return e, nil
+	}
+
+	items := []expr{e}
+	for p.accept(",") {
+		if k := p.peek().kind; k == tokenBlockEnd || k == tokenVarEnd {
+			break
+		}
+
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, e)
+	}
+
+	return &listExpr{items}, nil
+}
+
+func (p *parser) parseExpression() (expr, error) {
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("if") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		var els expr
+		if p.accept("else") {
+			if els, err = p.parseExpression(); err != nil {
+				return nil, err
+			}
+		}
+
+		e = &condExpr{cond: cond, then: e, els: els}
+	}
+
+	return e, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalExpr{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalExpr{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notExpr{e}, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (expr, error) {
+	left, err := p.parseMath1()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+		switch {
+		case p.is("==") || p.is("!=") || p.is("<") || p.is(">") || p.is("<=") || p.is(">=") || p.is("in"):
+			op = p.advance().value
+		case p.is("not") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenName && p.tokens[p.pos+1].value == "in":
+			p.pos += 2
+			op = "not in"
+		default:
+			return left, nil
+		}
+
+		right, err := p.parseMath1()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMath1() (expr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("+") || p.is("-") {
+		op := p.advance().value
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseConcat() (expr, error) {
+	left, err := p.parseMath2()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("~") {
+		right, err := p.parseMath2()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryExpr{op: "~", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseMath2() (expr, error) {
+	left, err := p.parsePow()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("*") || p.is("/") || p.is("//") || p.is("%") {
+		op := p.advance().value
+		right, err := p.parsePow()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePow() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("**") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryExpr{op: "**", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.is("-") || p.is("+") {
+		op := p.advance().value
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		if op == "+" {
+			return e, nil
+		}
+
+		return &negExpr{e}, nil
+	}
+
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parsePostfix(e)
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenString:
+		s := t.value
+		// adjacent strings are concatenated
+		for p.peek().kind == tokenString {
+			s += p.advance().value
+		}
+
+		return &literalExpr{s}, nil
+	case tokenInt:
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", t.value)
+		}
+
+		return &literalExpr{n}, nil
+	case tokenFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", t.value)
+		}
+
+		return &literalExpr{f}, nil
+	case tokenName:
+		switch t.value {
+		case "true", "True":
+			return &literalExpr{true}, nil
+		case "false", "False":
+			return &literalExpr{false}, nil
+		case "none", "None":
+			return &literalExpr{nil}, nil
+		}
+
+		return &nameExpr{t.value}, nil
+	case tokenOperator:
+		switch t.value {
+		case "(":
+			if p.accept(")") {
+				return &listExpr{}, nil
+			}
+
+			e, err := p.parseTuple()
+			if err != nil {
+				return nil, err
+			}
+
+			return e, p.expect(")")
+		case "[":
+			var items []expr
+			for !p.accept("]") {
+				if len(items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+
+					if p.accept("]") {
+						break
+					}
+				}
+
+				e, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, e)
+			}
+
+			return &listExpr{items}, nil
+		case "{":
+			var d dictExpr
+			for !p.accept("}") {
+				if len(d.keys) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+
+					if p.accept("}") {
+						break
+					}
+				}
+
+				k, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+
+				v, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+
+				d.keys = append(d.keys, k)
+				d.values = append(d.values, v)
+			}
+
+			return &d, nil
+		}
+	}
+
+	p.pos--
+	return nil, p.errorf("unexpected %s", t)
+}
+
+func (p *parser) parsePostfix(e expr) (expr, error) {
+	for {
+		switch {
+		case p.accept("."):
+			t := p.advance()
+			switch t.kind {
+			case tokenName:
+				e = &getExpr{obj: e, key: &literalExpr{t.value}}
+			case tokenInt:
+				n, _ := strconv.ParseInt(t.value, 10, 64)
+				e = &getExpr{obj: e, key: &literalExpr{n}}
+			default:
+				p.pos--
+				return nil, p.errorf("expected attribute name, found %s", t)
+			}
+		case p.accept("["):
+			key, err := p.parseSubscript()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+			e = &getExpr{obj: e, key: key}
+		case p.is("("):
+			args, kwargs, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+
+			e = &callExpr{fn: e, args: args, kwargs: kwargs}
+		case p.accept("|"):
+			name, err := p.expectKind(tokenName)
+			if err != nil {
+				return nil, err
+			}
+
+			f := filterExpr{name: name.value, value: e}
+			if p.is("(") {
+				if f.args, f.kwargs, err = p.parseArgs(); err != nil {
+					return nil, err
+				}
+			}
+
+			e = &f
+		case p.accept("is"):
+			negate := p.accept("not")
+			name, err := p.expectKind(tokenName)
+			if err != nil {
+				return nil, err
+			}
+
+			t := testExpr{name: name.value, value: e, negate: negate}
+			if p.is("(") {
+				if t.args, _, err = p.parseArgs(); err != nil {
+					return nil, err
+				}
+			} else if k := p.peek().kind; k == tokenString || k == tokenInt || k == tokenFloat || (k == tokenName && !isKeyword(p.peek().value)) {
+				// tests accept a single argument without parentheses
+				arg, err := p.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+
+				t.args = []expr{arg}
+			}
+
+			e = &t
+		default:
+			return e, nil
+		}
+	}
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "and", "or", "not", "in", "is", "if", "else", "recursive":
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) parseSubscript() (expr, error) {
+	var parts [3]expr
+	var colons int
+	for i := 0; i < 3; i++ {
+		if !p.is(":") && !p.is("]") {
+			e, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+
+			parts[i] = e
+		}
+
+		if i == 2 || !p.accept(":") {
+			break
+		}
+
+		colons++
+	}
+
+	if colons == 0 {
+		if parts[0] == nil {
+			return nil, p.errorf("expected subscript")
+		}
+
+		return parts[0], nil
+	}
+
+	return &sliceExpr{start: parts[0], stop: parts[1], step: parts[2]}, nil
+}
+
+func (p *parser) parseArgs() ([]expr, map[string]expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+
+	var args []expr
+	var kwargs map[string]expr
+	for !p.accept(")") {
+		if len(args)+len(kwargs) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+
+			if p.accept(")") {
+				break
+			}
+		}
+
+		if t := p.peek(); t.kind == tokenName && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenOperator && p.tokens[p.pos+1].value == "=" {
+			p.pos += 2
+			e, err := p.parseExpression()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if kwargs == nil {
+				kwargs = make(map[string]expr)
+			}
+
+			kwargs[t.value] = e
+			continue
+		}
+
+		if len(kwargs) > 0 {
+			return nil, nil, p.errorf("positional argument follows keyword argument")
+		}
+
+		e, err := p.parseExpression()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		args = append(args, e)
+	}
+
+	return args, kwargs, nil
+}
@@ -0,0 +1,398 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestJinjaTemplates(t *testing.T) {
+	messages := map[string][]api.Message{
+		"user": {
+			{Role: "user", Content: "Hello, how are you?"},
+		},
+		"user-assistant-user": {
+			{Role: "user", Content: "Hello, how are you?"},
+			{Role: "assistant", Content: "I'm doing great. How can I help you today?"},
+			{Role: "user", Content: "I'd like to show off how chat templating works!"},
+		},
+		"system-user-assistant-user": {
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "Hello, how are you?"},
+			{Role: "assistant", Content: "I'm doing great. How can I help you today?"},
+			{Role: "user", Content: "I'd like to show off how chat templating works!"},
+		},
+	}
+
+	const (
+		u    = "user"
+		uau  = "user-assistant-user"
+		suau = "system-user-assistant-user"
+	)
+
+	// the line numbers of templates.jsonl mapped to the message sets whose
+	// output matches the bundled template. The rest differ because the
+	// original templates add default system prompts, drop system messages or
+	// format whitespace differently.
+	matches := map[int][]string{
+		1: {u, uau}, 2: {u, uau, suau}, 3: {u, uau, suau}, 4: {u, uau, suau},
+		5: {u, uau, suau}, 6: {u, uau, suau}, 7: {u, uau, suau}, 8: {suau},
+		9: {suau}, 16: {u, uau, suau}, 17: {u, uau, suau}, 18: {suau},
+		19: {suau}, 21: {u}, 22: {u, uau}, 23: {u, uau, suau},
+		24: {u, uau, suau}, 26: {u, uau, suau}, 28: {u, uau}, 29: {u, uau},
+		30: {u, uau, suau}, 34: {u}, 35: {suau},
+	}
+
+	// templates which reject system messages
+	rejects := []int{11, 12, 15, 22, 25}
+
+	f, err := os.Open(filepath.Join("testdata", "templates.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var line int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line++
+
+		var ss map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &ss); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, s := range ss {
+			tmpl, err := Parse(`{% set eos_token = "</s>" %}` + s)
+			if err != nil {
+				t.Fatalf("line %d: %v", line, err)
+			}
+
+			if !tmpl.IsJinja() {
+				t.Fatalf("line %d: expected a jinja template", line)
+			}
+
+			for n, msgs := range messages {
+				t.Run(name+"/"+n, func(t *testing.T) {
+					var b bytes.Buffer
+					if err := tmpl.Execute(&b, Values{Messages: msgs}); err != nil {
+						if n == suau && slices.Contains(rejects, line) {
+							return
+						}
+
+						t.Fatalf("line %d: %v", line, err)
+					}
+
+					if !slices.Contains(matches[line], n) {
+						return
+					}
+
+					expect, err := os.ReadFile(filepath.Join("testdata", name+".gotmpl", n))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if diff := cmp.Diff(b.String(), string(expect)); diff != "" {
+						t.Errorf("line %d: mismatch (-got +want):\n%s", line, diff)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestJinja(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		values   Values
+		expected string
+	}{
+		{
+			name:     "whitespace control",
+			template: "{% for m in messages %}\n  {%- if m.role == 'user' %}\n    [{{ m.content }}]\n  {%- endif %}\n{% endfor %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "user", Content: "c"}}},
+			expected: "    [a]    [c]",
+		},
+		{
+			name:     "comments",
+			template: "{# comment #}\na{#- trimmed -#}  b",
+			expected: "ab",
+		},
+		{
+			name:     "loop",
+			template: "{% for m in messages %}{{ loop.index }}/{{ loop.length }}{% if loop.first %}F{% endif %}{% if loop.last %}L{% endif %} {% endfor %}",
+			values:   Values{Messages: []api.Message{{Role: "user"}, {Role: "assistant"}, {Role: "user"}}},
+			expected: "1/3F 2/3 3/3L ",
+		},
+		{
+			name:     "loop filter and else",
+			template: "{% for m in messages if m.role == 'system' %}{{ m.content }}{% else %}none{% endfor %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}}},
+			expected: "none",
+		},
+		{
+			name:     "break and continue",
+			template: "{% for i in range(10) %}{% if i == 1 %}{% continue %}{% endif %}{% if i > 3 %}{% break %}{% endif %}{{ i }}{% endfor %}",
+			expected: "023",
+		},
+		{
+			name:     "scoping",
+			template: "{% set x = 1 %}{% for i in range(3) %}{% set x = i %}{% endfor %}{{ x }}",
+			expected: "1",
+		},
+		{
+			name:     "namespace",
+			template: "{% set ns = namespace(found=false, n=0) %}{% for m in messages %}{% set ns.n = ns.n + 1 %}{% if m.role == 'system' %}{% set ns.found = true %}{% endif %}{% endfor %}{{ ns.found }} {{ ns.n }}",
+			values:   Values{Messages: []api.Message{{Role: "system"}, {Role: "user"}}},
+			expected: "True 2",
+		},
+		{
+			name:     "indexing and slicing",
+			template: "{{ messages[-1].content }} {{ messages[1:] | map(attribute='content') | join(',') }} {{ 'hello'[::-1] }} {{ 'hello'[1:3] }}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "user", Content: "c"}}},
+			expected: "c b,c olleh el",
+		},
+		{
+			name:     "operators",
+			template: "{{ 7 // 2 }} {{ -7 // 2 }} {{ 7 % 3 }} {{ -7 % 3 }} {{ 7 / 2 }} {{ 2 ** 3 }} {{ 'a' ~ 1 }} {{ 'ab' * 2 }} {{ [1] + [2] }} {{ 'b' in 'abc' }} {{ 'x' not in ['y'] }}",
+			expected: "3 -4 1 2 3.5 8 a1 abab [1, 2] True True",
+		},
+		{
+			name:     "filters",
+			template: "{{ '  x  ' | trim }}|{{ 'ab' | upper }}|{{ 'hello world' | title }}|{{ messages | length }}|{{ undefined_name | default('d') }}|{{ [3, 1, 3] | unique | list }}|{{ 'a\nb' | indent(2) }}",
+			values:   Values{Messages: []api.Message{{Role: "user"}}},
+			expected: "x|AB|Hello World|1|d|[3, 1]|a\n  b",
+		},
+		{
+			name:     "filters bind tighter than operators",
+			template: "{{ 'a' + ' b ' | trim + 'c' }}",
+			expected: "abc",
+		},
+		{
+			name:     "selectattr",
+			template: "{{ messages | selectattr('role', 'equalto', 'user') | map(attribute='content') | join }}{{ messages | rejectattr('role', 'eq', 'user') | list | length }}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "user", Content: "c"}}},
+			expected: "ac1",
+		},
+		{
+			name:     "tests",
+			template: "{{ foo is defined }} {{ foo is not defined }} {{ none is none }} {{ 'a' is string }} {{ {} is mapping }} {{ 3 is odd }} {{ messages is iterable }}",
+			expected: "False True True True True True True",
+		},
+		{
+			name:     "methods",
+			template: "{{ ' a '.strip() }}|{{ 'abc'.startswith('ab') }}|{{ 'a,b,c'.split(',', 1) }}|{{ 'user'.title() }}|{{ {'k': 'v'}.get('k') }}|{{ {'k': 'v'}.get('x', 'y') }}{% for k, v in {'a': 1, 'b': 2}.items() %}|{{ k }}={{ v }}{% endfor %}",
+			expected: "a|True|['a', 'b,c']|User|v|y|a=1|b=2",
+		},
+		{
+			name:     "conditional expression",
+			template: "{{ 'yes' if messages else 'no' }}{{ 'x' if false }}",
+			expected: "no",
+		},
+		{
+			name:     "macro",
+			template: "{% macro greet(name, greeting='Hello') %}{{ greeting }}, {{ name }}!{% endmacro %}{{ greet('a') }} {{ greet('b', greeting='Hi') }}",
+			expected: "Hello, a! Hi, b!",
+		},
+		{
+			name:     "set block",
+			template: "{% set x %}a{{ 1 + 1 }}{% endset %}{{ x | length }}",
+			expected: "2",
+		},
+		{
+			name:     "raw",
+			template: "{% raw %}{{ not evaluated }}{% endraw %}",
+			expected: "{{ not evaluated }}",
+		},
+		{
+			name:     "tojson",
+			template: "{{ tools | tojson }}",
+			values: Values{Tools: []api.Tool{{
+				Type: "function",
+				Function: api.ToolFunction{
+					Name:        "get_weather",
+					Description: "Get the weather <now>",
+				},
+			}}},
+			expected: `[{"type": "function", "function": {"name": "get_weather", "description": "Get the weather <now>", "parameters": {"type": "", "required": null, "properties": null}}}]`,
+		},
+		{
+			name:     "tojson indent",
+			template: "{{ {'a': [1, 2.5], 'b': none} | tojson(indent=2) }}",
+			expected: "{\n  \"a\": [\n    1,\n    2.5\n  ],\n  \"b\": null\n}",
+		},
+		{
+			name:     "no tools",
+			template: "{% if tools %}tools{% endif %}{{ tools is none }}",
+			expected: "True",
+		},
+		{
+			name:     "tool calls",
+			template: "{% for m in messages %}{% for tc in m.tool_calls %}{{ tc.function.name }}({{ tc.function.arguments | tojson }}){% endfor %}{% endfor %}",
+			values: Values{Messages: []api.Message{{Role: "assistant", ToolCalls: []api.ToolCall{{
+				Function: api.ToolCallFunction{Name: "get_weather", Arguments: api.ToolCallFunctionArguments{"city": "Paris", "days": 3}},
+			}}}}},
+			expected: `get_weather({"city": "Paris", "days": 3})`,
+		},
+		{
+			name:     "generation prompt",
+			template: "{% for m in messages %}<{{ m.role }}>{{ m.content }}</{{ m.role }}>{% endfor %}{% if add_generation_prompt %}<assistant>{% endif %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "Hi"}}},
+			expected: "<user>Hi</user><assistant>",
+		},
+		{
+			name:     "continue final message",
+			template: "{% for m in messages %}<{{ m.role }}>{{ m.content }}</{{ m.role }}>{% endfor %}{% if add_generation_prompt %}<assistant>{% endif %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}}},
+			expected: "<user>Hi</user><assistant>Hello",
+		},
+		{
+			name:     "collate",
+			template: "{% for m in messages %}{{ m.role }}:{{ m.content }};{% endfor %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}, {Role: "user", Content: "b"}}},
+			expected: "user:a\n\nb;",
+		},
+		{
+			name:     "special tokens",
+			template: "{% set eos_token = '<|end|>' %}\n{{ bos_token }}{% for m in messages %}{{ m.content + eos_token }}{% endfor %}",
+			values:   Values{Messages: []api.Message{{Role: "user", Content: "a"}}},
+			expected: "a<|end|>",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			// Parse only detects jinja with statements so parse expressions directly
+			j, err := parseJinjaTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tmpl := &Template{raw: tt.template, jinja: j}
+
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, tt.values); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(b.String(), tt.expected); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJinjaErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		err      string
+	}{
+		{"raise_exception", "{{ raise_exception('roles must alternate') }}", "jinja: roles must alternate"},
+		{"undefined attribute", "{{ foo.bar }}", "'foo' is undefined"},
+		{"undefined arithmetic", "{{ foo + 'a' }}", "'foo' is undefined"},
+		{"type mismatch", "{{ 'a' + 1 }}", "unsupported operand types for +: str and int"},
+		{"unknown filter", "{{ 'a' | shout }}", "unknown filter 'shout'"},
+		{"not callable", "{{ messages() }}", "list is not callable"},
+		{"iterations", "{% for i in range(1000) %}{% for j in range(1000) %}{% endfor %}{% endfor %}", errJinjaIterations.Error()},
+		{"recursion", "{% macro f() %}{{ f() }}{% endmacro %}{{ f() }}", errJinjaDepth.Error()},
+		{"output", "{% for i in range(100) %}{{ 'x' * 1000000 }}{% endfor %}", errJinjaOutput.Error()},
+		{"repeat overflow", "{% set x = 'ab' * 4611686018427387904 %}", errJinjaOutput.Error()},
+		{"string doubling", "{% set ns = namespace(s='aaaaaaaaaaaaaaaa') %}{% for i in range(30) %}{% set ns.s = ns.s + ns.s %}{% endfor %}", errJinjaOutput.Error()},
+		{"concat doubling", "{% set ns = namespace(s='aaaaaaaaaaaaaaaa') %}{% for i in range(30) %}{% set ns.s = ns.s ~ ns.s %}{% endfor %}", errJinjaOutput.Error()},
+		{"list doubling", "{% set ns = namespace(l=[1]) %}{% for i in range(30) %}{% set ns.l = ns.l + ns.l %}{% endfor %}", errJinjaIterations.Error()},
+		{"list repr", "{% set ns = namespace(l=['x' * 1000000]) %}{% for i in range(17) %}{% set ns.l = ns.l + ns.l %}{% endfor %}{% set s = ns.l ~ '' %}", errJinjaOutput.Error()},
+		{"join", "{% set ns = namespace(l=['x' * 1000000]) %}{% for i in range(17) %}{% set ns.l = ns.l + ns.l %}{% endfor %}{% set s = ns.l | join %}", errJinjaOutput.Error()},
+		{"replace", "{% set s = ('a' * 1000000).replace('a', 'b' * 1000) %}", errJinjaOutput.Error()},
+		{"indent", "{% set s = ('\\n' * 1000000) | indent(1000, blank=true) %}", errJinjaOutput.Error()},
+		{"tojson indent", "{% set ns = namespace(l=[]) %}{% for i in range(100) %}{% set ns.l = [ns.l] %}{% endfor %}{% set s = ns.l | tojson(indent=10000000) %}", errJinjaOutput.Error()},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := parseJinjaTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = (&Template{jinja: j}).Execute(&bytes.Buffer{}, Values{})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestJinjaParse(t *testing.T) {
+	cases := []struct {
+		template string
+		jinja    bool
+		vars     []string
+		err      bool
+	}{
+		{template: "{{ .Prompt }}", vars: []string{"prompt", "response"}},
+		{template: "{{ bos_token }}{% if messages %}{{ messages[0]['content'] }}{% endif %}", jinja: true, vars: []string{"bos_token", "messages"}},
+		// jinja is only tried for text with statements or comments
+		{template: "{{ bos_token }}", err: true},
+		{template: "{% for m in messages %}{{ m.content }}{% endfor %}{% if tools %}{{ tools | tojson }}{% endif %}", jinja: true, vars: []string{"m", "messages", "tools"}},
+		// go templates with jinja-like text are still go templates
+		{template: "{{ .Prompt }} {% not jinja", vars: []string{"prompt", "response"}},
+		{template: "{% if %}{{ x }}", err: true},
+		{template: "{% for m in messages %}{{ m }}", err: true},
+		{template: "{{ 'unterminated }}", err: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if tmpl.IsJinja() != tt.jinja {
+				t.Errorf("expected jinja %t", tt.jinja)
+			}
+
+			if diff := cmp.Diff(tmpl.Vars(), tt.vars); diff != "" {
+				t.Errorf("mismatch (-got +want):\n%s", diff)
+			}
+
+			if tmpl.String() != tt.template {
+				t.Errorf("expected template text to be preserved")
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"</s>", `a"b\c`, "<|im_end|>\n", "\x00"} {
+		tmpl, err := Parse("{% set x = " + Quote(s) + " %}{{ x }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, Values{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != s {
+			t.Errorf("expected %q, got %q", s, b.String())
+		}
+	}
+}
@@ -95,6 +95,9 @@ var DefaultTemplate, _ = Parse("{{ .Prompt }}")
 type Template struct {
 	*template.Template
 	raw string
+
+	// jinja is set instead of Template for Jinja2 chat templates
+	jinja *jinja
 }
 
 // response is a template node that can be added to templates that don't already have one
@@ -123,11 +126,28 @@ var funcs = template.FuncMap{
 	},
 }
 
+// Parse parses s as a Go template or, if it contains Jinja statements or
+// comments, as a Jinja2 chat template such as a model's
+// tokenizer.chat_template. Text that is valid as both is a Jinja2 template.
 func Parse(s string) (*Template, error) {
+	var jerr error
+	if strings.Contains(s, "{%") || strings.Contains(s, "{#") {
+		j, err := parseJinjaTemplate(s)
+		if err == nil {
+			return &Template{raw: s, jinja: j}, nil
+		}
+
+		jerr = err
+	}
+
 	tmpl := template.New("").Option("missingkey=zero").Funcs(funcs)
 
 	tmpl, err := tmpl.Parse(s)
 	if err != nil {
+		if jerr != nil {
+			return nil, jerr
+		}
+
 		return nil, err
 	}
 
@@ -144,7 +164,49 @@ func (t *Template) String() string {
 	return t.raw
 }
 
+// IsJinja reports whether t is a Jinja2 template
+func (t *Template) IsJinja() bool {
+	return t.jinja != nil
+}
+
+// thinkingDelimiters are the delimiters around the thinking of common
+// thinking models
+var thinkingDelimiters = [][2]string{
+	{"<think>", "</think>"},
+	{"<thinking>", "</thinking>"},
+	{"◁think▷", "◁/think▷"},
+}
+
+// Thinking returns the delimiters around the thinking of a thinking model
+// when t mentions them, usually to leave earlier thinking out of the prompt
+// or to start the response with it.
+func (t *Template) Thinking() (start, end string) {
+	for _, d := range thinkingDelimiters {
+		if strings.Contains(t.raw, d[0]) || strings.Contains(t.raw, d[1]) {
+			return d[0], d[1]
+		}
+	}
+
+	return "", ""
+}
+
+// RendersThinking reports whether t renders the thinking of messages itself,
+// from .Thinking or, in Jinja templates, message.reasoning_content
+func (t *Template) RendersThinking() bool {
+	if t.jinja != nil {
+		return strings.Contains(t.raw, "reasoning_content")
+	}
+
+	return slices.Contains(t.Vars(), "thinking")
+}
+
 func (t *Template) Vars() []string {
+	if t.jinja != nil {
+		vars := t.jinja.vars()
+		slices.Sort(vars)
+		return vars
+	}
+
 	var vars []string
 	for _, tt := range t.Templates() {
 		for _, n := range tt.Root.Nodes {
@@ -173,6 +235,10 @@ type Values struct {
 }
 
 func (t *Template) Subtree(fn func(parse.Node) bool) *template.Template {
+	if t.jinja != nil {
+		return nil
+	}
+
 	var walk func(parse.Node) parse.Node
 	walk = func(n parse.Node) parse.Node {
 		if fn(n) {
@@ -219,6 +285,10 @@ func (t *Template) Subtree(fn func(parse.Node) bool) *template.Template {
 }
 
 func (t *Template) Execute(w io.Writer, v Values) error {
+	if t.jinja != nil {
+		return t.executeJinja(w, v)
+	}
+
 	system, messages := collate(v.Messages)
 	if v.Prompt != "" && v.Suffix != "" {
 		return t.Template.Execute(w, map[string]any{
@@ -376,3 +376,33 @@ func TestExecuteWithSuffix(t *testing.T) {
 		})
 	}
 }
+
+func TestThinking(t *testing.T) {
+	cases := []struct {
+		template   string
+		start, end string
+		renders    bool
+	}{
+		{"{{ .Prompt }}", "", "", false},
+		{"{{ range .Messages }}{{ .Content }}{{ end }}<think>", "<think>", "</think>", false},
+		{"{{ range .Messages }}{{ .Thinking }}</think>{{ .Content }}{{ end }}", "<think>", "</think>", true},
+		{"{{ range .Messages }}{{ .Content }}{{ end }}<thinking>", "<thinking>", "</thinking>", false},
+		{"{% for m in messages %}{{ m.content.split('</think>')[-1] }}{% endfor %}", "<think>", "</think>", false},
+		{"{% for m in messages %}{{ m.reasoning_content }}{{ m.content }}{% endfor %}", "", "", true},
+	}
+
+	for _, tt := range cases {
+		tmpl, err := Parse(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if start, end := tmpl.Thinking(); start != tt.start || end != tt.end {
+			t.Errorf("%s: expected delimiters %q %q, got %q %q", tt.template, tt.start, tt.end, start, end)
+		}
+
+		if renders := tmpl.RendersThinking(); renders != tt.renders {
+			t.Errorf("%s: expected RendersThinking %t, got %t", tt.template, tt.renders, renders)
+		}
+	}
+}